@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cutlery47/gostream/pkg/client"
+)
+
+const keysUsage = `usage: gostreamctl keys <command> [flags] [args]
+
+commands:
+  list            list api keys of the user
+  create          create api key, the secret is only shown once
+  delete <key>    revoke api key`
+
+func keys(ctx context.Context, cli *cli, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, keysUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		return listKeys(ctx, cli, args[1:])
+	case "create":
+		return createKey(ctx, cli, args[1:])
+	case "delete":
+		return deleteKey(ctx, cli, args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, keysUsage)
+		os.Exit(2)
+		return nil
+	}
+}
+
+func listKeys(ctx context.Context, cli *cli, args []string) error {
+	flags := flag.NewFlagSet("keys list", flag.ExitOnError)
+	user := flags.String("user", client.Me, "id of the user")
+
+	if err := parseArgs(flags, args, 0, 0, ""); err != nil {
+		return err
+	}
+
+	keys, err := cli.c.Keys(ctx, *user)
+	if err != nil {
+		return err
+	}
+
+	if cli.json {
+		return printJSON(keys)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED AT")
+	for _, key := range keys {
+		scopes := "all"
+		if len(key.Scopes) > 0 {
+			scopes = strings.Join(key.Scopes, ",")
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", key.ID, key.Name, scopes, key.CreatedAt.Local().Format(time.DateTime))
+	}
+
+	return w.Flush()
+}
+
+func createKey(ctx context.Context, cli *cli, args []string) error {
+	flags := flag.NewFlagSet("keys create", flag.ExitOnError)
+	user := flags.String("user", client.Me, "id of the user")
+	name := flags.String("name", "", "label of the key")
+	scopes := flags.String("scopes", "", "comma separated scopes (all of the user scopes, if empty)")
+
+	if err := parseArgs(flags, args, 0, 0, ""); err != nil {
+		return err
+	}
+
+	var list []string
+	if *scopes != "" {
+		list = strings.Split(*scopes, ",")
+	}
+
+	key, err := cli.c.CreateKey(ctx, *user, *name, list)
+	if err != nil {
+		return err
+	}
+
+	if cli.json {
+		return printJSON(key)
+	}
+
+	fmt.Println("id: ", key.ID)
+	fmt.Println("key:", key.Key)
+	fmt.Fprintln(os.Stderr, "the key isn't shown again, store it now")
+
+	return nil
+}
+
+func deleteKey(ctx context.Context, cli *cli, args []string) error {
+	flags := flag.NewFlagSet("keys delete", flag.ExitOnError)
+	user := flags.String("user", client.Me, "id of the user")
+
+	if err := parseArgs(flags, args, 1, 1, "<key>"); err != nil {
+		return err
+	}
+
+	if err := cli.c.DeleteKey(ctx, *user, flags.Arg(0)); err != nil {
+		return err
+	}
+
+	fmt.Println("revoked", flags.Arg(0))
+	return nil
+}
+
+func whoami(ctx context.Context, cli *cli, args []string) error {
+	flags := flag.NewFlagSet("whoami", flag.ExitOnError)
+
+	if err := parseArgs(flags, args, 0, 0, ""); err != nil {
+		return err
+	}
+
+	principal, err := cli.c.Me(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cli.json {
+		return printJSON(principal)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "user:\t%v\n", principal.UserID)
+	fmt.Fprintf(w, "name:\t%v\n", principal.Name)
+	fmt.Fprintf(w, "role:\t%v\n", principal.Role)
+	fmt.Fprintf(w, "scopes:\t%v\n", strings.Join(principal.Scopes, ","))
+	if principal.KeyID != "" {
+		fmt.Fprintf(w, "key:\t%v\n", principal.KeyID)
+	}
+	if principal.Tenant != "" {
+		fmt.Fprintf(w, "tenant:\t%v\n", principal.Tenant)
+	}
+
+	return w.Flush()
+}
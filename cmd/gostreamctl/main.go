@@ -0,0 +1,127 @@
+// gostreamctl is a command-line client of the gostream api.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cutlery47/gostream/pkg/client"
+)
+
+const usage = `usage: gostreamctl [flags] <command> [args]
+
+commands:
+  upload <file.mp4>       upload video
+  list                    list and search videos
+  show <id>               show metadata and processing status of the video
+  delete <id>             delete video
+  download <id> [file]    download original video
+  playlist <id> [name]    print master or rendition playlist
+  keys <list|create|delete>  manage api keys
+  whoami                  show the authenticated user
+
+flags:`
+
+// settings, shared by the commands
+type cli struct {
+	c    *client.Client
+	json bool
+}
+
+type command func(ctx context.Context, cli *cli, args []string) error
+
+var commands = map[string]command{
+	"upload":   upload,
+	"list":     list,
+	"show":     show,
+	"delete":   remove,
+	"download": download,
+	"playlist": playlist,
+	"keys":     keys,
+	"whoami":   whoami,
+}
+
+func main() {
+	flags := flag.NewFlagSet("gostreamctl", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	server := flags.String("server", env("GOSTREAM_SERVER", "http://localhost:8080"), "url of the server (GOSTREAM_SERVER)")
+	token := flags.String("token", os.Getenv("GOSTREAM_TOKEN"), "api key or bearer token (GOSTREAM_TOKEN)")
+	tenant := flags.String("tenant", os.Getenv("GOSTREAM_TENANT"), "tenant of the requests (GOSTREAM_TENANT)")
+	asJSON := flags.Bool("json", false, "print responses as json")
+
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cli := &cli{
+		c:    client.New(*server, client.Token(*token), client.Tenant(*tenant)),
+		json: *asJSON,
+	}
+
+	if err := cmd(ctx, cli, flags.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+
+		var e *client.Error
+		if errors.As(err, &e) && e.Code != "" {
+			fmt.Fprintln(os.Stderr, "code:", e.Code)
+		}
+
+		os.Exit(1)
+	}
+}
+
+// prints v as indented json
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// parses flags of the command, which takes from min to max positional args
+func parseArgs(flags *flag.FlagSet, args []string, min, max int, names string) error {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: gostreamctl %v [flags] %v\n", flags.Name(), names)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() < min || flags.NArg() > max {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	return nil
+}
+
+func env(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
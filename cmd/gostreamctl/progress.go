@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const barWidth = 30
+
+// renders progress of a transfer on stderr, as the reader is read
+type progress struct {
+	r     io.Reader
+	label string
+	total int64
+
+	mu      sync.Mutex
+	done    int64
+	start   time.Time
+	printed time.Time
+}
+
+// total is -1, if unknown
+func newProgress(r io.Reader, label string, done, total int64) *progress {
+	return &progress{
+		r:     r,
+		label: label,
+		total: total,
+		done:  done,
+		start: time.Now(),
+	}
+}
+
+func (p *progress) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.add(n)
+	return n, err
+}
+
+// reads at the offset, if the reader supports it, e.g. when the file is sent in chunks
+func (p *progress) ReadAt(b []byte, off int64) (int, error) {
+	n, err := p.r.(io.ReaderAt).ReadAt(b, off)
+	p.add(n)
+	return n, err
+}
+
+func (p *progress) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done += int64(n)
+	// redrawing at most 10 times a second
+	if time.Since(p.printed) > 100*time.Millisecond {
+		p.print()
+	}
+}
+
+// prints the final state and moves to the next line
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.print()
+	fmt.Fprintln(os.Stderr)
+}
+
+func (p *progress) print() {
+	p.printed = time.Now()
+
+	rate := float64(p.done) / max(time.Since(p.start).Seconds(), 0.001)
+
+	if p.total <= 0 {
+		fmt.Fprintf(os.Stderr, "\r%v %v (%v/s)   ", p.label, formatBytes(p.done), formatBytes(int64(rate)))
+		return
+	}
+
+	ratio := min(float64(p.done)/float64(p.total), 1)
+	filled := int(ratio * barWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled)
+
+	fmt.Fprintf(os.Stderr, "\r%v [%v] %3.0f%% %v/%v (%v/s)   ", p.label, bar, ratio*100, formatBytes(p.done), formatBytes(p.total), formatBytes(int64(rate)))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
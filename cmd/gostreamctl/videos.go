@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cutlery47/gostream/pkg/client"
+)
+
+// interval of polling the processing status
+const pollInterval = 2 * time.Second
+
+func upload(ctx context.Context, cli *cli, args []string) error {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	title := flags.String("title", "", "title of the video (file name, if empty)")
+	description := flags.String("description", "", "description of the video")
+	tags := flags.String("tags", "", "comma separated tags")
+	visibility := flags.String("visibility", "", "public (default), unlisted or private")
+	attributes := flags.String("attributes", "", "json object of custom string attributes")
+	wait := flags.Bool("wait", false, "wait, until the video is processed")
+	quiet := flags.Bool("quiet", false, "don't show the progress bar")
+	restart := flags.Bool("restart", false, "discard interrupted upload of the file instead of resuming")
+
+	if err := parseArgs(flags, args, 1, 1, "<file.mp4>"); err != nil {
+		return err
+	}
+
+	meta := client.UploadMeta{
+		Title:       *title,
+		Description: *description,
+		Visibility:  *visibility,
+	}
+	if *tags != "" {
+		meta.Tags = strings.Split(*tags, ",")
+	}
+	if *attributes != "" {
+		if err := json.Unmarshal([]byte(*attributes), &meta.Attributes); err != nil {
+			return fmt.Errorf("attributes should be a json object of strings: %v", err)
+		}
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	video, err := uploadFile(ctx, cli, file, info.Size(), meta, *restart, *quiet)
+	if err != nil {
+		return err
+	}
+
+	if *wait && video.Status == client.StatusProcessing {
+		if video, err = cli.c.WaitVideo(ctx, video.ID, pollInterval); err != nil {
+			return err
+		}
+	}
+
+	return cli.printVideo(video)
+}
+
+// uploads the file in chunks, resuming the upload, interrupted by the previous run
+// id of the upload is kept next to the file, until it's complete
+func uploadFile(ctx context.Context, cli *cli, file *os.File, size int64, meta client.UploadMeta, restart, quiet bool) (client.Video, error) {
+	statePath := file.Name() + ".upload"
+
+	session, err := resumableUpload(ctx, cli, statePath, file.Name(), size, meta, restart)
+	if isNotFound(err) {
+		// the server doesn't support resumable uploads, so the file is sent at once
+		return uploadWhole(ctx, cli, file, size, meta, quiet)
+	}
+	if err != nil {
+		return client.Video{}, err
+	}
+
+	var body io.ReaderAt = file
+	var bar *progress
+	if !quiet {
+		bar = newProgress(file, "uploading", session.Offset, size)
+		body = bar
+	}
+
+	video, err := cli.c.ResumeUpload(ctx, session.ID, body)
+	if bar != nil {
+		bar.finish()
+	}
+	if err != nil {
+		// the state is kept, so that the upload could be resumed
+		return video, fmt.Errorf("upload is interrupted, run the command again to resume: %w", err)
+	}
+
+	os.Remove(statePath)
+	return video, nil
+}
+
+// returns the upload of the previous run, if it can be resumed, or starts a new one
+func resumableUpload(ctx context.Context, cli *cli, statePath, filename string, size int64, meta client.UploadMeta, restart bool) (client.UploadSession, error) {
+	if id, err := os.ReadFile(statePath); err == nil {
+		session, err := cli.c.UploadStatus(ctx, string(id))
+
+		switch {
+		// the file has changed since
+		case err == nil && (restart || session.Size != size):
+			if err := cli.c.CancelUpload(ctx, session.ID); err != nil {
+				return session, err
+			}
+		case err == nil:
+			fmt.Fprintln(os.Stderr, "resuming upload", session.ID)
+			return session, nil
+		// expired or cancelled upload
+		case !isNotFound(err):
+			return session, err
+		}
+	}
+
+	session, err := cli.c.CreateUpload(ctx, filename, size, meta)
+	if err != nil {
+		return session, err
+	}
+
+	return session, os.WriteFile(statePath, []byte(session.ID), 0644)
+}
+
+func uploadWhole(ctx context.Context, cli *cli, file *os.File, size int64, meta client.UploadMeta, quiet bool) (client.Video, error) {
+	var body io.Reader = file
+	var bar *progress
+	if !quiet {
+		bar = newProgress(file, "uploading", 0, size)
+		body = bar
+	}
+
+	video, err := cli.c.Upload(ctx, filepath.Base(file.Name()), body, meta)
+	if bar != nil {
+		bar.finish()
+	}
+	return video, err
+}
+
+func isNotFound(err error) bool {
+	var e *client.Error
+	return errors.As(err, &e) && e.Status == http.StatusNotFound
+}
+
+func list(ctx context.Context, cli *cli, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+
+	var query client.VideoQuery
+	flags.StringVar(&query.Status, "status", "", "processing, ready or failed")
+	flags.StringVar(&query.Visibility, "visibility", "", "public (default), unlisted or private")
+	flags.StringVar(&query.Tag, "tag", "", "tag of the video")
+	flags.StringVar(&query.Owner, "owner", "", "owner of the video")
+	flags.Float64Var(&query.MinDuration, "min-duration", 0, "least duration (seconds)")
+	flags.Float64Var(&query.MaxDuration, "max-duration", 0, "largest duration (seconds)")
+	flags.StringVar(&query.Search, "q", "", "words to search in the title")
+	flags.StringVar(&query.Sort, "sort", "", "uploaded_at (default), title or duration")
+	flags.StringVar(&query.Order, "order", "", "asc or desc (default)")
+	flags.IntVar(&query.Limit, "limit", 0, "page size (20 by default, 100 at most)")
+	flags.StringVar(&query.Cursor, "cursor", "", "cursor of the page")
+	all := flags.Bool("all", false, "fetch every page")
+
+	if err := parseArgs(flags, args, 0, 0, ""); err != nil {
+		return err
+	}
+
+	var videos []client.Video
+	for {
+		page, err := cli.c.Videos(ctx, query)
+		if err != nil {
+			return err
+		}
+		videos = append(videos, page.Videos...)
+
+		query.Cursor = page.NextCursor
+		if !*all || query.Cursor == "" {
+			break
+		}
+	}
+
+	if cli.json {
+		return printJSON(client.VideoPage{Videos: videos, NextCursor: query.Cursor})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTITLE\tSTATUS\tVISIBILITY\tDURATION\tSIZE\tUPLOADED AT")
+	for _, video := range videos {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			video.ID,
+			video.Title,
+			video.Status,
+			video.Visibility,
+			formatDuration(video.Duration),
+			formatBytes(video.Size),
+			video.UploadedAt.Local().Format(time.DateTime),
+		)
+	}
+	w.Flush()
+
+	if query.Cursor != "" {
+		fmt.Fprintf(os.Stderr, "more videos: -cursor %v\n", query.Cursor)
+	}
+
+	return nil
+}
+
+func show(ctx context.Context, cli *cli, args []string) error {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	wait := flags.Bool("wait", false, "wait, until the video is processed")
+
+	if err := parseArgs(flags, args, 1, 1, "<id>"); err != nil {
+		return err
+	}
+
+	video, err := cli.c.Video(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *wait && video.Status == client.StatusProcessing {
+		if video, err = cli.c.WaitVideo(ctx, video.ID, pollInterval); err != nil {
+			return err
+		}
+	}
+
+	return cli.printVideo(video)
+}
+
+func remove(ctx context.Context, cli *cli, args []string) error {
+	flags := flag.NewFlagSet("delete", flag.ExitOnError)
+
+	if err := parseArgs(flags, args, 1, 1, "<id>"); err != nil {
+		return err
+	}
+
+	if err := cli.c.DeleteVideo(ctx, flags.Arg(0)); err != nil {
+		return err
+	}
+
+	fmt.Println("deleted", flags.Arg(0))
+	return nil
+}
+
+func download(ctx context.Context, cli *cli, args []string) error {
+	flags := flag.NewFlagSet("download", flag.ExitOnError)
+	restart := flags.Bool("restart", false, "discard partially downloaded file instead of resuming")
+	quiet := flags.Bool("quiet", false, "don't show the progress bar")
+
+	if err := parseArgs(flags, args, 1, 2, "<id> [file]"); err != nil {
+		return err
+	}
+
+	id, name := flags.Arg(0), flags.Arg(1)
+	if name == "" {
+		name = id + ".mp4"
+	}
+
+	video, err := cli.c.Video(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var offset int64
+	if !*restart {
+		if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+
+	if offset > 0 && offset == video.Size {
+		fmt.Fprintln(os.Stderr, name, "is already downloaded")
+		return nil
+	}
+
+	// the file doesn't belong to the video
+	if offset > video.Size {
+		offset = 0
+	}
+
+	dl, err := cli.c.Download(ctx, id, offset)
+	if err != nil {
+		return err
+	}
+	defer dl.Body.Close()
+
+	// the server sent the whole file, so it's written from scratch
+	if dl.Offset == 0 {
+		if offset > 0 {
+			fmt.Fprintln(os.Stderr, "server doesn't support resuming, downloading from the start")
+		}
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+	}
+
+	if _, err := file.Seek(dl.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	size := dl.Size
+	if size < 0 {
+		size = video.Size
+	}
+
+	var body io.Reader = dl.Body
+	var bar *progress
+	if !*quiet {
+		bar = newProgress(dl.Body, "downloading", dl.Offset, size)
+		body = bar
+	}
+
+	_, err = io.Copy(file, body)
+	if bar != nil {
+		bar.finish()
+	}
+	if err != nil {
+		// the partial file is kept, so that the download could be resumed
+		return fmt.Errorf("download is interrupted, run the command again to resume: %w", err)
+	}
+
+	fmt.Fprintln(os.Stderr, "saved to", name)
+	return nil
+}
+
+func playlist(ctx context.Context, cli *cli, args []string) error {
+	flags := flag.NewFlagSet("playlist", flag.ExitOnError)
+
+	if err := parseArgs(flags, args, 1, 2, "<id> [master|<rendition>]"); err != nil {
+		return err
+	}
+
+	name := flags.Arg(1)
+	if name == "" {
+		name = "master"
+	}
+	if !strings.HasSuffix(name, ".m3u8") {
+		name += ".m3u8"
+	}
+
+	raw, err := cli.c.Playlist(ctx, flags.Arg(0), name)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(raw)
+	return err
+}
+
+func (cli *cli) printVideo(video client.Video) error {
+	if cli.json {
+		return printJSON(video)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "id:\t%v\n", video.ID)
+	fmt.Fprintf(w, "title:\t%v\n", video.Title)
+	if video.Description != "" {
+		fmt.Fprintf(w, "description:\t%v\n", video.Description)
+	}
+	fmt.Fprintf(w, "status:\t%v\n", video.Status)
+	fmt.Fprintf(w, "visibility:\t%v\n", video.Visibility)
+	if video.Owner != "" {
+		fmt.Fprintf(w, "owner:\t%v\n", video.Owner)
+	}
+	if len(video.Tags) > 0 {
+		fmt.Fprintf(w, "tags:\t%v\n", strings.Join(video.Tags, ", "))
+	}
+	for key, value := range video.Attributes {
+		fmt.Fprintf(w, "attributes.%v:\t%v\n", key, value)
+	}
+	if len(video.Captions) > 0 {
+		fmt.Fprintf(w, "captions:\t%v\n", strings.Join(video.Captions, ", "))
+	}
+	fmt.Fprintf(w, "duration:\t%v\n", formatDuration(video.Duration))
+	fmt.Fprintf(w, "size:\t%v\n", formatBytes(video.Size))
+	fmt.Fprintf(w, "uploaded at:\t%v\n", video.UploadedAt.Local().Format(time.DateTime))
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if video.Status == client.StatusFailed {
+		return errors.New("video processing failed")
+	}
+
+	return nil
+}
+
+func formatDuration(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Second).String()
+}
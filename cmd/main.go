@@ -1,9 +1,17 @@
 package main
 
 import (
+	"os"
+
 	"github.com/cutlery47/gostream/internal/app"
 )
 
 func main() {
+	// "gostream migrate ..." manages the db schema instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		app.Migrate(os.Args[2:])
+		return
+	}
+
 	app.Run()
 }
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/joho/godotenv"
 )
@@ -9,10 +12,30 @@ type Config struct {
 	Log     LoggerConfig
 	Storage StorageConfig
 	Flag    FlagConfig
+	DRM     DRMConfig
+	Sign    SignConfig
+	Serve   ServeConfig
+	Live    LiveConfig
+	Auth    AuthConfig
+	Tenant  TenantConfig
+	Quota   QuotaConfig
+	Limit   LimitConfig
+	Trace   TraceConfig
+	Health  HealthConfig
 }
 
 type LoggerConfig struct {
 	AppLogsPath string `env:"APP_LOGS_PATH"`
+	// minimal level of the logged lines (debug, info, warn, error), error log never goes below error
+	Level string `env:"LOG_LEVEL" env-default:"info"`
+	// format of the stdout output (console / json), files are always written as json
+	Format string `env:"LOG_FORMAT" env-default:"console"`
+	// log files are rotated, once they grow over the max size (megabytes)
+	// rotated files are kept up to the max age (days, 0 keeps them all)
+	MaxSize    int  `env:"LOG_MAX_SIZE" env-default:"100"`
+	MaxBackups int  `env:"LOG_MAX_BACKUPS" env-default:"5"`
+	MaxAge     int  `env:"LOG_MAX_AGE" env-default:"30"`
+	Compress   bool `env:"LOG_COMPRESS"`
 }
 
 type StorageConfig struct {
@@ -24,6 +47,8 @@ type LocalConfig struct {
 	ManifestPath string `env:"MANIFEST_PATH"`
 	ChunkPath    string `env:"CHUNK_PATH"`
 	VideoPath    string `env:"VIDEO_PATH"`
+	// directory of json indexes, replacing the db in local mode
+	IndexPath string `env:"INDEX_PATH"`
 }
 
 type DistrConfig struct {
@@ -38,6 +63,8 @@ type DBConfig struct {
 	Port     string `env:"POSTGRES_PORT"`
 	DBName   string `env:"POSTGRES_NAME"`
 	SSLMode  string `env:"POSTGRES_SSL"`
+	// apply pending migrations on start, the service refuses to start with an outdated schema otherwise
+	Migrate bool `env:"POSTGRES_MIGRATE" env-default:"true"`
 }
 
 type S3Config struct {
@@ -47,6 +74,8 @@ type S3Config struct {
 	VidBucket   string `env:"MINIO_VID_BUCKET"`
 	ManBucket   string `env:"MINIO_CHUNK_BUCKET"`
 	ChunkBucket string `env:"MINIO_MAN_BUCKET"`
+	// objects of the tenants are kept under their key prefix (prefix) or in their own buckets (bucket)
+	Tenancy string `env:"MINIO_TENANCY" env-default:"prefix"`
 }
 
 type FlagConfig struct {
@@ -54,6 +83,136 @@ type FlagConfig struct {
 	Type string `env:"STORAGE_TYPE"`
 }
 
+type LiveConfig struct {
+	// address of the rtmp ingest server, disabled if empty
+	RTMPAddr string `env:"RTMP_ADDR"`
+	// address of the srt ingest server (udp), disabled if empty
+	SRTAddr string `env:"SRT_ADDR"`
+	// callers have to encrypt streams with it, if set (10 to 79 characters)
+	SRTPassphrase string `env:"SRT_PASSPHRASE"`
+	// how long lost srt packets are awaited
+	SRTLatency time.Duration `env:"SRT_LATENCY" env-default:"120ms"`
+	// working directory of the live packager
+	Path string `env:"LIVE_PATH"`
+	// length of the live segments (seconds)
+	SegmentTime int `env:"LIVE_SEGMENT_TIME" env-default:"2"`
+	// duration of the partial segments, enables low-latency hls (0 disables)
+	// encoder keyframe interval should not exceed it, as parts are cut on keyframes
+	PartTarget time.Duration `env:"LIVE_PART_TARGET"`
+	// amount of segments in the live playlist
+	Window int `env:"LIVE_WINDOW" env-default:"6"`
+	// playlist is extended to cover this much of the stream (0 disables dvr)
+	DVR time.Duration `env:"LIVE_DVR_WINDOW"`
+	// keep all the segments and turn finished streams into vod
+	Record bool `env:"LIVE_RECORD"`
+	// also remux recorded streams into mp4
+	RecordMP4 bool `env:"LIVE_RECORD_MP4"`
+}
+
+type DRMConfig struct {
+	// encryption scheme of the packaged output (none, cenc)
+	Scheme string `env:"DRM_SCHEME"`
+}
+
+type SignConfig struct {
+	// hmac secret, playback urls are not signed if empty
+	Secret string `env:"SIGN_SECRET"`
+	// lifetime of signed urls
+	TTL time.Duration `env:"SIGN_TTL" env-default:"1h"`
+	// bind signed urls to the ip of the client
+	BindIP bool `env:"SIGN_BIND_IP"`
+}
+
+type AuthConfig struct {
+	// modifying requests require credentials, everything is allowed to anyone otherwise
+	Enabled bool `env:"AUTH_ENABLED"`
+	// iss claim of the issued tokens, tokens signed with the secret should carry it as well
+	Issuer string `env:"AUTH_JWT_ISSUER" env-default:"gostream"`
+	// hmac secret (HS256) of the issued tokens, tokens are not issued if empty
+	Secret string `env:"AUTH_JWT_SECRET"`
+	// path to the pem encoded public key of an external token issuer (RS256, ES256 or EdDSA)
+	PublicKey string `env:"AUTH_JWT_PUBLIC_KEY"`
+	// iss claim of the tokens, signed with the public key (AUTH_JWT_ISSUER, if empty)
+	ExternalIssuer string `env:"AUTH_JWT_EXTERNAL_ISSUER"`
+	// lifetime of the issued tokens
+	TokenTTL time.Duration `env:"AUTH_TOKEN_TTL" env-default:"1h"`
+	// api key of the built-in admin, used to create the first users
+	AdminKey string `env:"AUTH_ADMIN_KEY"`
+}
+
+type TenantConfig struct {
+	// header, naming the tenant of the request
+	Header string `env:"TENANT_HEADER" env-default:"X-Tenant"`
+	// requests to "<tenant>.<domain>" hosts are resolved to the tenant (disabled if empty)
+	Domain string `env:"TENANT_DOMAIN"`
+	// tenants, served by the deployment, along with the default one (any, if empty)
+	Allowed []string `env:"TENANTS" env-separator:","`
+}
+
+// limits of the stored bytes (including segments, thumbnails and captions) and videos
+// zero values don't limit anything
+type QuotaConfig struct {
+	UserBytes    int64 `env:"QUOTA_USER_BYTES"`
+	UserVideos   int   `env:"QUOTA_USER_VIDEOS"`
+	TenantBytes  int64 `env:"QUOTA_TENANT_BYTES"`
+	TenantVideos int   `env:"QUOTA_TENANT_VIDEOS"`
+}
+
+// token bucket limits of each api key (or ip of the anonymous callers), in requests per minute
+// zero rate doesn't limit anything
+type LimitConfig struct {
+	// buckets are kept in memory of each instance (memory) or shared by the instances (postgres)
+	Backend       string `env:"LIMIT_BACKEND" env-default:"memory"`
+	Upload        int    `env:"LIMIT_UPLOAD" env-default:"10"`
+	UploadBurst   int    `env:"LIMIT_UPLOAD_BURST" env-default:"3"`
+	Delete        int    `env:"LIMIT_DELETE" env-default:"60"`
+	DeleteBurst   int    `env:"LIMIT_DELETE_BURST" env-default:"10"`
+	Playback      int    `env:"LIMIT_PLAYBACK" env-default:"1200"`
+	PlaybackBurst int    `env:"LIMIT_PLAYBACK_BURST" env-default:"200"`
+	// ffmpeg transcodes, run by the instance at once (unlimited, if zero)
+	Transcodes int `env:"LIMIT_TRANSCODES" env-default:"4"`
+}
+
+type TraceConfig struct {
+	// where the spans are exported (otlp / stdout / none)
+	Exporter string `env:"TRACE_EXPORTER" env-default:"none"`
+	// host:port of the otlp/http collector, OTEL_EXPORTER_OTLP_* variables are used if empty
+	Endpoint string `env:"TRACE_OTLP_ENDPOINT"`
+	// export spans over plain http
+	Insecure bool `env:"TRACE_OTLP_INSECURE"`
+	// share of the traces, started by the service, which are sampled
+	// traces of the callers are sampled as they decided
+	SampleRatio float64 `env:"TRACE_SAMPLE_RATIO" env-default:"1"`
+	ServiceName string  `env:"TRACE_SERVICE_NAME" env-default:"gostream"`
+}
+
+type HealthConfig struct {
+	// time, each readiness check is given
+	Timeout time.Duration `env:"HEALTH_TIMEOUT" env-default:"3s"`
+	// readiness report is reused for this long (0 runs the checks on every probe)
+	CacheTTL time.Duration `env:"HEALTH_CACHE_TTL" env-default:"5s"`
+	// free disk, required in each of the working directories (bytes)
+	MinFreeDisk int64 `env:"HEALTH_MIN_FREE_DISK" env-default:"1073741824"`
+	// uploads in progress, after which the instance isn't ready (unlimited, if zero)
+	MaxBacklog int `env:"HEALTH_MAX_BACKLOG"`
+}
+
+type ServeConfig struct {
+	// serving mode of source videos (proxy / redirect)
+	Video string `env:"SERVE_VIDEO" env-default:"proxy"`
+	// serving mode of chunks (proxy / redirect)
+	Chunk string `env:"SERVE_CHUNK" env-default:"proxy"`
+	// lifetime of presigned object storage urls
+	PresignTTL time.Duration `env:"PRESIGN_TTL" env-default:"5m"`
+	// base for the uris in served playlists (cdn host, path prefix, api version)
+	BaseURL string `env:"PLAYLIST_BASE_URL"`
+	// origins of the web players, allowed to call the api from the browser ("*" for any, none if empty)
+	AllowOrigins []string `env:"SERVE_ALLOW_ORIGINS" env-separator:","`
+	// addresses or cidr ranges of the reverse proxies, whose X-Forwarded-For is trusted
+	// client ip is the address of the connection, if empty
+	TrustedProxies []string `env:"SERVE_TRUSTED_PROXIES" env-separator:","`
+}
+
 func New() (cfg *Config, err error) {
 	godotenv.Load("yours.env")
 
@@ -62,8 +221,18 @@ func New() (cfg *Config, err error) {
 	var locConf LocalConfig
 	var logConf LoggerConfig
 	var flgConf FlagConfig
+	var drmConf DRMConfig
+	var sgnConf SignConfig
+	var srvConf ServeConfig
+	var livConf LiveConfig
+	var athConf AuthConfig
+	var tntConf TenantConfig
+	var qtaConf QuotaConfig
+	var lmtConf LimitConfig
+	var trcConf TraceConfig
+	var hlhConf HealthConfig
 
-	confs := []interface{}{&s3Conf, &dbConf, &locConf, &logConf, &flgConf}
+	confs := []interface{}{&s3Conf, &dbConf, &locConf, &logConf, &flgConf, &drmConf, &sgnConf, &srvConf, &livConf, &athConf, &tntConf, &qtaConf, &lmtConf, &trcConf, &hlhConf}
 	for _, conf := range confs {
 		if err = cleanenv.ReadEnv(conf); err != nil {
 			return nil, err
@@ -79,8 +248,40 @@ func New() (cfg *Config, err error) {
 				S3Config: s3Conf,
 			},
 		},
-		Flag: flgConf,
+		Flag:   flgConf,
+		DRM:    drmConf,
+		Sign:   sgnConf,
+		Serve:  srvConf,
+		Live:   livConf,
+		Auth:   athConf,
+		Tenant: tntConf,
+		Quota:  qtaConf,
+		Limit:  lmtConf,
+		Trace:  trcConf,
+		Health: hlhConf,
 	}
 
 	return cfg, nil
 }
+
+// secrets are not printed
+func (c AuthConfig) String() string {
+	return fmt.Sprintf("{Enabled:%v Issuer:%v Secret:%v PublicKey:%v ExternalIssuer:%v TokenTTL:%v AdminKey:%v}",
+		c.Enabled, c.Issuer, redacted(c.Secret), c.PublicKey, c.ExternalIssuer, c.TokenTTL, redacted(c.AdminKey))
+}
+
+func (c SignConfig) String() string {
+	return fmt.Sprintf("{Secret:%v TTL:%v BindIP:%v}", redacted(c.Secret), c.TTL, c.BindIP)
+}
+
+func (c LiveConfig) String() string {
+	return fmt.Sprintf("{RTMPAddr:%v SRTAddr:%v SRTPassphrase:%v SRTLatency:%v Path:%v SegmentTime:%v PartTarget:%v Window:%v DVR:%v Record:%v RecordMP4:%v}",
+		c.RTMPAddr, c.SRTAddr, redacted(c.SRTPassphrase), c.SRTLatency, c.Path, c.SegmentTime, c.PartTarget, c.Window, c.DVR, c.Record, c.RecordMP4)
+}
+
+func redacted(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "<redacted>"
+}
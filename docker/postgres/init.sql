@@ -0,0 +1,2 @@
+-- schema is created by the service, which applies its migrations on start
+CREATE DATABASE gostream;
@@ -1,15 +1,33 @@
 package app
 
 import (
+	"context"
 	"log"
+	"path"
+	"time"
 
 	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/controller/http/throttle"
 	v1 "github.com/cutlery47/gostream/internal/controller/http/v1"
+	v2 "github.com/cutlery47/gostream/internal/controller/http/v2"
+	"github.com/cutlery47/gostream/internal/controller/rtmp"
+	"github.com/cutlery47/gostream/internal/controller/srt"
+	"github.com/cutlery47/gostream/internal/drm"
+	"github.com/cutlery47/gostream/internal/live"
+	"github.com/cutlery47/gostream/internal/migrate"
+	"github.com/cutlery47/gostream/internal/playlist"
+	"github.com/cutlery47/gostream/internal/ratelimit"
 	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/sign"
 	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/cutlery47/gostream/internal/tracing"
+	"github.com/cutlery47/gostream/migrations"
 	"github.com/cutlery47/gostream/pkg/httpserver"
 	"github.com/cutlery47/gostream/pkg/logger"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap/zapcore"
 )
 
 //	@title			Gostream
@@ -22,6 +40,11 @@ import (
 
 //	@host	localhost:8080
 
+//	@securityDefinitions.apikey	Bearer
+//	@in							header
+//	@name						Authorization
+//	@description				"Bearer <api key or token>"
+
 func Run() {
 	cfg, err := config.New()
 	if err != nil {
@@ -30,9 +53,24 @@ func Run() {
 
 	log.Println(cfg)
 
-	reqLog := logger.New(cfg.Log.AppLogsPath+"/request.log", false)
-	errLog := logger.New(cfg.Log.AppLogsPath+"/error.log", true)
-	infLog := logger.New(cfg.Log.AppLogsPath+"/info.log", false)
+	level, err := zapcore.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		log.Fatal("unknown log level: ", cfg.Log.Level)
+	}
+
+	if format := cfg.Log.Format; format != logger.FormatConsole && format != logger.FormatJSON {
+		log.Fatal("unknown log format: ", format)
+	}
+
+	logOpts := []logger.Option{
+		logger.Level(level),
+		logger.Format(cfg.Log.Format),
+		logger.Rotate(cfg.Log.MaxSize, cfg.Log.MaxBackups, cfg.Log.MaxAge, cfg.Log.Compress),
+	}
+
+	reqLog := logger.New(cfg.Log.AppLogsPath+"/request.log", false, logOpts...)
+	errLog := logger.New(cfg.Log.AppLogsPath+"/error.log", true, logOpts...)
+	infLog := logger.New(cfg.Log.AppLogsPath+"/info.log", false, logOpts...)
 
 	// flushing any remaining data
 	defer reqLog.Sync()
@@ -43,32 +81,190 @@ func Run() {
 		log.Fatal("all loggers should be properly configured")
 	}
 
+	scheme, err := drm.ParseScheme(cfg.DRM.Scheme)
+	if err != nil {
+		log.Fatal("error when loading drm config: ", err)
+	}
+
+	for _, mode := range []string{cfg.Serve.Video, cfg.Serve.Chunk} {
+		if mode != v1.ServeProxy && mode != v1.ServeRedirect {
+			log.Fatal("unknown serving mode: ", mode)
+		}
+	}
+
+	if pass := cfg.Live.SRTPassphrase; pass != "" && (len(pass) < 10 || len(pass) > 79) {
+		log.Fatal("srt passphrase should be 10 to 79 characters long")
+	}
+
+	if backend := cfg.Limit.Backend; backend != ratelimit.BackendMemory && backend != ratelimit.BackendPostgres {
+		log.Fatal("unknown rate limit backend: ", backend)
+	}
+
+	if mode := cfg.Storage.Distr.S3Config.Tenancy; mode != storage.TenancyPrefix && mode != storage.TenancyBucket {
+		log.Fatal("unknown tenancy mode: ", mode)
+	}
+
+	for _, id := range cfg.Tenant.Allowed {
+		if !tenant.Valid(id) {
+			log.Fatal("invalid tenant: ", id)
+		}
+	}
+
+	if ratio := cfg.Trace.SampleRatio; ratio < 0 || ratio > 1 {
+		log.Fatal("trace sample ratio should be between 0 and 1")
+	}
+
+	shutdownTracing, err := tracing.Init(cfg.Trace)
+	if err != nil {
+		log.Fatal("error when initializing tracing: ", err)
+	}
+	defer func() {
+		// spans, which weren't exported yet, are flushed on shutdown
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			errLog.Error("error when flushing spans: " + err.Error())
+		}
+	}()
+
+	renderer, err := playlist.NewRenderer(cfg.Serve.BaseURL)
+	if err != nil {
+		log.Fatal("error when parsing playlist base url: ", err)
+	}
+
 	var st storage.Storage
+	var streams storage.StreamRepository
+	var videos storage.VideoRepository
+	var users storage.UserRepository
+
+	// dependencies of the distributed mode, checked by the readiness probe
+	var repo *storage.FileRepository
+	var migrator *migrate.Migrator
+	var s3 *storage.MinioS3
+
+	var limiter ratelimit.Limiter = ratelimit.NewMemory()
 
 	if cfg.Flag.Type == "local" {
-		st = storage.NewLocalStorage(errLog, cfg.Storage.Local)
+		if cfg.Limit.Backend == ratelimit.BackendPostgres {
+			log.Fatal("rate limits can't be kept in postgres in local mode")
+		}
+
+		// local files can't be presigned
+		cfg.Serve.Video = v1.ServeProxy
+		cfg.Serve.Chunk = v1.ServeProxy
+
+		keys := storage.NewLocalKeyRepository(path.Join(cfg.Storage.Local.IndexPath, "keys.json"))
+		videos = storage.NewLocalVideoRepository(path.Join(cfg.Storage.Local.IndexPath, "videos.json"))
+		st = storage.NewLocalStorage(errLog, cfg.Storage.Local, cfg.Quota, keys, videos)
+		streams = storage.NewLocalStreamRepository(path.Join(cfg.Storage.Local.IndexPath, "streams.json"))
+		users = storage.NewLocalUserRepository(path.Join(cfg.Storage.Local.IndexPath, "users.json"), path.Join(cfg.Storage.Local.IndexPath, "api_keys.json"))
 	} else {
-		repo, err := storage.NewFileRepository(cfg.Storage.Distr.DBConfig)
+		db, err := storage.OpenDB(cfg.Storage.Distr.DBConfig)
 		if err != nil {
 			log.Fatal("Error when initializing db: ", err)
 		}
 
-		s3, err := storage.NewS3(cfg.Storage.Distr.S3Config)
+		if migrator, err = migrate.New(db, migrations.FS); err != nil {
+			log.Fatal("error when loading migrations: ", err)
+		}
+
+		if err := prepareSchema(infLog, migrator, cfg.Storage.Distr.DBConfig.Migrate); err != nil {
+			log.Fatal("error when migrating db: ", err)
+		}
+
+		repo = storage.NewFileRepository(db, cfg.Quota)
+
+		s3, err = storage.NewS3(cfg.Storage.Distr.S3Config)
 		if err != nil {
 			log.Fatal("Error when initializing s3: ", err)
 		}
 
 		st = storage.NewDistibutedStorage(infLog, errLog, cfg.Storage, repo, s3)
+		streams = repo
+		videos = repo
+		users = repo
+
+		if cfg.Limit.Backend == ratelimit.BackendPostgres {
+			limiter = ratelimit.NewShared(errLog, repo)
+		}
 	}
 
+	manager := live.NewManager(cfg.Live)
+
 	svc := service.NewStreamService(
 		infLog,
 		cfg.Storage.Local,
+		cfg.Quota,
 		st,
+		videos,
+		streams,
+		scheme,
+		cfg.Serve.PresignTTL,
+		renderer,
+		manager,
+		ratelimit.NewSemaphore(cfg.Limit.Transcodes),
 	)
 
+	liveSvc := service.NewLiveStreamService(infLog, errLog, cfg.Live, streams, videos, st, manager)
+
+	// license server for ClearKey protected content
+	lic := drm.NewClearKeyServer(st, svc)
+
+	// playback urls are signed only if secret is provided
+	var signer *sign.Signer
+	if cfg.Sign.Secret != "" {
+		signer = sign.New(cfg.Sign.Secret, cfg.Sign.TTL)
+	}
+
+	authenticator, err := auth.New(cfg.Auth, users)
+	if err != nil {
+		log.Fatal("error when loading auth config: ", err)
+	}
+
+	accounts := service.NewAccountService(users)
+
+	tenants := tenant.NewResolver(cfg.Tenant)
+
+	throttler := throttle.New(limiter, cfg.Limit)
+
+	checker := newChecker(cfg, repo, migrator, s3, svc)
+
 	e := echo.New()
-	v1.NewController(e, svc, reqLog, errLog, infLog)
+	if e.IPExtractor, err = throttle.IPExtractor(cfg.Serve.TrustedProxies); err != nil {
+		log.Fatal("error when loading trusted proxies: ", err)
+	}
+
+	v1.NewController(e, svc, liveSvc, accounts, lic, authenticator, tenants, throttler, checker, signer, cfg.Sign.BindIP, cfg.Serve, reqLog, errLog, infLog)
+	v2.NewController(e, svc, throttler, signer, cfg.Sign.BindIP, cfg.Serve, renderer, reqLog)
+
+	if cfg.Live.RTMPAddr != "" {
+		rtmpServ := rtmp.NewServer(cfg.Live.RTMPAddr, liveSvc)
+		defer rtmpServ.Close()
+
+		go func() {
+			if err := rtmpServ.ListenAndServe(); err != nil {
+				errLog.Error("rtmp server error: " + err.Error())
+			}
+		}()
+	}
+
+	if cfg.Live.SRTAddr != "" {
+		srtServ := srt.NewServer(cfg.Live.SRTAddr, cfg.Live.SRTPassphrase, cfg.Live.SRTLatency, liveSvc)
+		defer srtServ.Close()
+
+		go func() {
+			if err := srtServ.ListenAndServe(); err != nil {
+				errLog.Error("srt server error: " + err.Error())
+			}
+		}()
+	}
+
+	var opts []httpserver.Option
+	if cfg.Live.PartTarget > 0 {
+		// blocked playlist requests (served in low-latency mode only) are held for up to three target durations
+		opts = append(opts, httpserver.WriteTimeout(time.Duration(3*cfg.Live.SegmentTime+3)*time.Second))
+	}
 
-	httpserver.New(e).Run()
+	httpserver.New(e, opts...).Run()
 }
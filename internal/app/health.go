@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/health"
+	"github.com/cutlery47/gostream/internal/migrate"
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/storage"
+)
+
+// dependency checks of the readiness probe
+// repo, migrator and s3 are nil in local mode
+func newChecker(cfg *config.Config, repo *storage.FileRepository, migrator *migrate.Migrator, s3 *storage.MinioS3, svc *service.StreamService) *health.Checker {
+	checker := health.NewChecker(cfg.Health.Timeout, cfg.Health.CacheTTL)
+
+	if repo != nil {
+		checker.Add("db", func(ctx context.Context) (any, error) {
+			if err := repo.Ping(ctx); err != nil {
+				return nil, err
+			}
+
+			version, err := migrator.Version(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			details := map[string]int{"schema_version": version, "expected_version": migrator.Latest()}
+
+			return details, migrator.Check(ctx)
+		})
+	}
+
+	if s3 != nil {
+		checker.Add("object_storage", func(ctx context.Context) (any, error) {
+			return nil, s3.Ping(ctx)
+		})
+	}
+
+	checker.Add("ffmpeg", health.Binary("ffmpeg"))
+	checker.Add("ffprobe", health.Binary("ffprobe"))
+
+	local := cfg.Storage.Local
+	dirs := []string{local.VideoPath, local.ManifestPath, local.ChunkPath, cfg.Live.Path}
+	if repo == nil {
+		dirs = append(dirs, local.IndexPath)
+	}
+	checker.Add("disk", health.Disk(cfg.Health.MinFreeDisk, dirs...))
+
+	checker.Add("queue", func(ctx context.Context) (any, error) {
+		backlog := svc.Backlog()
+
+		details := map[string]int{
+			"uploads":        backlog.Uploads,
+			"transcodes":     backlog.Transcodes,
+			"max_transcodes": backlog.MaxTranscodes,
+		}
+
+		if limit := cfg.Health.MaxBacklog; limit > 0 && backlog.Uploads > limit {
+			return details, fmt.Errorf("%v uploads are in progress, at most %v are expected", backlog.Uploads, limit)
+		}
+
+		return details, nil
+	})
+
+	return checker
+}
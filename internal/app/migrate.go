@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/migrate"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/migrations"
+	"go.uber.org/zap"
+)
+
+// time, migrations of a single run are given
+const migrateTimeout = 10 * time.Minute
+
+// applies pending migrations, if allowed, and makes sure, the schema matches the binary
+func prepareSchema(infLog *zap.Logger, migrator *migrate.Migrator, apply bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	if apply {
+		done, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range done {
+			infLog.Info(fmt.Sprintf("applied migration %v_%v", migration.Version, migration.Name))
+		}
+	}
+
+	err := migrator.Check(ctx)
+	if errors.Is(err, migrate.ErrSchemaOutdated) {
+		return fmt.Errorf("%w, run \"migrate up\" first", err)
+	}
+
+	return err
+}
+
+const migrateUsage = `usage: gostream migrate <command>
+
+commands:
+  up            apply pending migrations
+  down [n|all]  revert n latest migrations (1 by default)
+  status        list migrations along with their state`
+
+// runs "migrate" subcommand
+func Migrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		log.Fatal("error when loading config: ", err)
+	}
+
+	if cfg.Flag.Type == "local" {
+		log.Fatal("there is no db to migrate in local mode")
+	}
+
+	db, err := storage.OpenDB(cfg.Storage.Distr.DBConfig)
+	if err != nil {
+		log.Fatal("Error when initializing db: ", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		log.Fatal("error when loading migrations: ", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		printMigrations("applied", done, err)
+		if err != nil {
+			log.Fatal("error when applying migrations: ", err)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if args[1] == "all" {
+				steps = migrator.Latest() + 1
+			} else if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatal(migrateUsage)
+			}
+		}
+
+		done, err := migrator.Down(ctx, steps)
+		printMigrations("reverted", done, err)
+		if err != nil {
+			log.Fatal("error when reverting migrations: ", err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal("error when reading migrations: ", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, at := "pending", ""
+			if status.Applied {
+				state = "applied"
+			}
+			// applied by the init scripts, but not recorded yet
+			if !status.AppliedAt.IsZero() {
+				at = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%v\t%v\t%v\n", status.Version, status.Name, state, at)
+		}
+		w.Flush()
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
+
+func printMigrations(action string, done []migrate.Migration, err error) {
+	if len(done) == 0 && err == nil {
+		fmt.Println("nothing to do")
+	}
+
+	for _, migration := range done {
+		fmt.Printf("%v %04d_%v\n", action, migration.Version, migration.Name)
+	}
+}
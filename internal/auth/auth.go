@@ -0,0 +1,192 @@
+// Package auth authenticates api clients and checks what they are allowed to do.
+//
+// Clients authenticate either with api keys, stored hashed in the user
+// repository, or with jwt bearer tokens, issued by the app itself (HS256)
+// or by an external issuer (verified with its public key).
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+)
+
+// authenticated client
+type Principal struct {
+	UserID string
+	Name   string
+	Role   storage.Role
+	// granted scopes, narrowed down by the api key or token
+	Scopes []Scope
+	// api key, the client was authenticated with (empty for tokens)
+	KeyID string
+	// tenant, the client belongs to (empty for the ones, allowed to act in any of them)
+	Tenant string
+}
+
+// principal of the built-in admin, authenticated with the configured admin key
+// admin acts in the tenant, named by the request
+var Admin = Principal{UserID: "admin", Name: "admin", Role: storage.RoleAdmin, Scopes: []Scope{ScopeAdmin}}
+
+// principal of every request, while authentication is disabled
+var Anonymous = Principal{Name: "anonymous", Role: storage.RoleAdmin, Scopes: []Scope{ScopeAdmin}}
+
+// checks if the principal was granted the scope
+func (p Principal) Can(scope Scope) bool {
+	return grants(p.Scopes, scope)
+}
+
+func (p Principal) Admin() bool {
+	return p.Can(ScopeAdmin)
+}
+
+// checks if the principal may use the scope on a resource of the owner
+func (p Principal) Authorized(scope Scope, owner string) bool {
+	if !p.Can(scope) {
+		return false
+	}
+
+	if p.Admin() || (owner != "" && owner == p.UserID) {
+		return true
+	}
+
+	// editors curate metadata of every video
+	return scope == ScopeVideosWrite && p.Role == storage.RoleEditor
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// returns principal of the request, ErrUnauthenticated if there is none
+func Require(ctx context.Context) (Principal, error) {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return p, ErrUnauthenticated
+	}
+	return p, nil
+}
+
+// returns principal of the request, if it was granted the scope
+func RequireScope(ctx context.Context, scope Scope) (Principal, error) {
+	p, err := Require(ctx)
+	if err != nil {
+		return p, err
+	}
+
+	if !p.Can(scope) {
+		return p, ErrInsufficientScope
+	}
+
+	return p, nil
+}
+
+// checks if the principal of the request may use the scope on a resource of the owner
+func Authorize(ctx context.Context, scope Scope, owner string) error {
+	p, err := RequireScope(ctx, scope)
+	if err != nil {
+		return err
+	}
+
+	if !p.Authorized(scope, owner) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+type Authenticator struct {
+	conf  config.AuthConfig
+	users storage.UserRepository
+
+	tokens *tokenVerifier
+}
+
+func New(conf config.AuthConfig, users storage.UserRepository) (*Authenticator, error) {
+	tokens, err := newTokenVerifier(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{
+		conf:   conf,
+		users:  users,
+		tokens: tokens,
+	}, nil
+}
+
+func (a *Authenticator) Enabled() bool {
+	return a.conf.Enabled
+}
+
+// authenticates value of the Authorization header ("Bearer <api key or token>")
+func (a *Authenticator) Authenticate(ctx context.Context, header string) (Principal, error) {
+	scheme, credentials, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	credentials = strings.TrimSpace(credentials)
+	if strings.HasPrefix(credentials, keyPrefix) || a.adminKey(credentials) {
+		return a.APIKey(ctx, credentials)
+	}
+
+	return a.Token(credentials)
+}
+
+func (a *Authenticator) APIKey(ctx context.Context, key string) (Principal, error) {
+	if a.adminKey(key) {
+		return Admin, nil
+	}
+
+	id, secret, ok := parseKey(key)
+	if !ok {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	stored, err := a.users.ReadAPIKey(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrDBNotFound) {
+			err = ErrInvalidCredentials
+		}
+		return Principal{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(stored.Hash)) != 1 {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	// user is looked up within the tenant of the key
+	user, err := a.users.ReadUser(tenant.NewContext(ctx, stored.Tenant), stored.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDBNotFound) {
+			err = ErrInvalidCredentials
+		}
+		return Principal{}, err
+	}
+
+	return Principal{
+		UserID: user.ID,
+		Name:   user.Name,
+		Role:   user.Role,
+		Scopes: restrict(RoleScopes(user.Role), ParseScopes(stored.Scopes)),
+		KeyID:  stored.ID,
+		Tenant: stored.Tenant,
+	}, nil
+}
+
+func (a *Authenticator) adminKey(key string) bool {
+	return a.conf.AdminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(a.conf.AdminKey)) == 1
+}
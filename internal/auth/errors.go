@@ -0,0 +1,11 @@
+package auth
+
+import "github.com/cutlery47/gostream/internal/errs"
+
+var (
+	ErrUnauthenticated    = errs.New(errs.Unauthenticated, "unauthenticated", "request requires an api key or a bearer token")
+	ErrInvalidCredentials = errs.New(errs.Unauthenticated, "invalid_credentials", "api key or bearer token is invalid or expired")
+	ErrForbidden          = errs.New(errs.Forbidden, "forbidden", "not allowed to access the resource")
+	ErrInsufficientScope  = errs.New(errs.Forbidden, "insufficient_scope", "credentials lack the scope, required by the request")
+	ErrTokensDisabled     = errs.New(errs.NotImplemented, "tokens_disabled", "token issuing is not configured")
+)
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/storage"
+)
+
+// key format: gsk_<hex id>_<base64url secret>
+const keyPrefix = "gsk_"
+
+// returns new api key of the user and its record, holding only the hash of the secret
+// key is restricted to the scopes, unless they are nil
+func NewAPIKey(userID, name string, scopes []Scope) (string, storage.APIKey, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(id); err != nil {
+		return "", storage.APIKey{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", storage.APIKey{}, err
+	}
+
+	encodedID := hex.EncodeToString(id)
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+
+	record := storage.APIKey{
+		ID:        encodedID,
+		UserID:    userID,
+		Name:      name,
+		Hash:      HashSecret(encodedSecret),
+		Scopes:    FormatScopes(scopes),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	return keyPrefix + encodedID + "_" + encodedSecret, record, nil
+}
+
+// secrets are random, so a plain (unsalted) hash is enough
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func parseKey(key string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(key, keyPrefix)
+	if !ok {
+		return "", "", false
+	}
+
+	// id is hex, so the first underscore separates it
+	id, secret, ok = strings.Cut(rest, "_")
+	return id, secret, ok && id != "" && secret != ""
+}
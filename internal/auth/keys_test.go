@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, record, err := NewAPIKey("alice", "ci", []Scope{ScopeVideosRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, secret, ok := parseKey(key)
+	if !ok {
+		t.Fatalf("couldn't parse %q", key)
+	}
+
+	if id != record.ID {
+		t.Errorf("id: got %q, want %q", id, record.ID)
+	}
+	// only the hash of the secret is kept
+	if record.Hash != HashSecret(secret) || strings.Contains(record.Hash, secret) {
+		t.Errorf("hash: got %q", record.Hash)
+	}
+	if len(record.Scopes) != 1 || record.Scopes[0] != string(ScopeVideosRead) {
+		t.Errorf("scopes: got %v", record.Scopes)
+	}
+
+	other, _, err := NewAPIKey("alice", "ci", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key {
+		t.Error("keys are not random")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	cases := map[string]struct {
+		key    string
+		id     string
+		secret string
+		ok     bool
+	}{
+		"valid":          {"gsk_0a1b_c_d-e", "0a1b", "c_d-e", true},
+		"no prefix":      {"0a1b_secret", "", "", false},
+		"no secret":      {"gsk_0a1b", "", "", false},
+		"empty id":       {"gsk__secret", "", "", false},
+		"empty secret":   {"gsk_0a1b_", "", "", false},
+		"other prefix":   {"ghp_0a1b_secret", "", "", false},
+		"prefix only":    {"gsk_", "", "", false},
+		"case sensitive": {"GSK_0a1b_secret", "", "", false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			id, secret, ok := parseKey(tc.key)
+			if ok != tc.ok || (ok && (id != tc.id || secret != tc.secret)) {
+				t.Errorf("got %q, %q, %v, want %q, %q, %v", id, secret, ok, tc.id, tc.secret, tc.ok)
+			}
+		})
+	}
+}
+
+func TestHashSecret(t *testing.T) {
+	if HashSecret("secret") != HashSecret("secret") {
+		t.Error("hash is not deterministic")
+	}
+	if HashSecret("secret") == HashSecret("secret2") {
+		t.Error("different secrets have the same hash")
+	}
+	// hex encoded sha256
+	if got := HashSecret(""); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	a := newTestAuthenticator(t, config.AuthConfig{AdminKey: "admin-key"})
+	ctx := tenant.NewContext(context.Background(), "team")
+
+	if err := a.users.CreateUser(ctx, storage.User{ID: "alice", Name: "alice", Role: storage.RoleUploader}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := func(scopes []Scope) string {
+		key, record, err := NewAPIKey("alice", "test", scopes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.users.CreateAPIKey(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	full := store(nil)
+	restricted := store([]Scope{ScopeVideosRead, ScopeAdmin})
+
+	// keys are found out across the tenants, principal belongs to the tenant of the key
+	p, err := a.APIKey(context.Background(), full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.UserID != "alice" || p.Tenant != "team" || p.KeyID == "" || len(p.Scopes) != 3 {
+		t.Errorf("got %+v", p)
+	}
+
+	p, err = a.APIKey(context.Background(), restricted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Scopes) != 1 || p.Scopes[0] != ScopeVideosRead {
+		t.Errorf("scopes: got %v, want [videos:read]", p.Scopes)
+	}
+
+	p, err = a.Authenticate(context.Background(), "Bearer admin-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Admin() {
+		t.Errorf("got %+v, want the admin", p)
+	}
+
+	id, _, _ := parseKey(full)
+
+	invalid := map[string]string{
+		"wrong secret": keyPrefix + id + "_wrong",
+		"unknown id":   keyPrefix + "ffff_secret",
+		"malformed":    "gsk_",
+		"admin prefix": "admin-key2",
+	}
+
+	for name, key := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := a.APIKey(context.Background(), key); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("got %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := newTestAuthenticator(t, config.AuthConfig{Issuer: "gostream", Secret: testSecret})
+
+	cases := map[string]string{
+		"no scheme":   "token",
+		"basic":       "Basic dXNlcjpwYXNz",
+		"empty":       "Bearer ",
+		"invalid jwt": "Bearer a.b.c",
+		"unknown key": "Bearer gsk_00_secret",
+	}
+
+	for name, header := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := a.Authenticate(context.Background(), header); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("got %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
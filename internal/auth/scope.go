@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/cutlery47/gostream/internal/storage"
+)
+
+// permission to perform a kind of operations
+type Scope string
+
+const (
+	ScopeVideosRead   Scope = "videos:read"
+	ScopeVideosWrite  Scope = "videos:write"
+	ScopeVideosDelete Scope = "videos:delete"
+	// grants every other scope, user management included
+	ScopeAdmin Scope = "admin:*"
+)
+
+var Scopes = []Scope{ScopeVideosRead, ScopeVideosWrite, ScopeVideosDelete, ScopeAdmin}
+
+// scopes, granted by each of the roles
+// uploaders and editors differ in ownership rules (see Principal.Authorized)
+var roleScopes = map[storage.Role][]Scope{
+	storage.RoleViewer:   {ScopeVideosRead},
+	storage.RoleUploader: {ScopeVideosRead, ScopeVideosWrite, ScopeVideosDelete},
+	storage.RoleEditor:   {ScopeVideosRead, ScopeVideosWrite, ScopeVideosDelete},
+	storage.RoleAdmin:    {ScopeAdmin},
+}
+
+func ValidRole(role storage.Role) bool {
+	_, ok := roleScopes[role]
+	return ok
+}
+
+func ValidScope(scope Scope) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// returns scopes of the role
+func RoleScopes(role storage.Role) []Scope {
+	return slices.Clone(roleScopes[role])
+}
+
+// checks if the scopes include the scope
+func grants(scopes []Scope, scope Scope) bool {
+	return scope == "" || slices.Contains(scopes, scope) || slices.Contains(scopes, ScopeAdmin)
+}
+
+// returns requested scopes, which are granted, in the order they were requested
+// nil request grants everything
+func restrict(granted, requested []Scope) []Scope {
+	if requested == nil {
+		return granted
+	}
+
+	scopes := []Scope{}
+	for _, scope := range requested {
+		if grants(granted, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// scopes are stored as plain strings
+func ParseScopes(values []string) []Scope {
+	if values == nil {
+		return nil
+	}
+
+	scopes := make([]Scope, len(values))
+	for i, value := range values {
+		scopes[i] = Scope(value)
+	}
+	return scopes
+}
+
+func FormatScopes(scopes []Scope) []string {
+	if scopes == nil {
+		return nil
+	}
+
+	values := make([]string, len(scopes))
+	for i, scope := range scopes {
+		values[i] = string(scope)
+	}
+	return values
+}
+
+// space separated oauth-style scope claim
+func joinScopes(scopes []Scope) string {
+	return strings.Join(FormatScopes(scopes), " ")
+}
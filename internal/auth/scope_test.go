@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cutlery47/gostream/internal/storage"
+)
+
+func principal(id string, role storage.Role, scopes ...Scope) Principal {
+	if scopes == nil {
+		scopes = RoleScopes(role)
+	}
+	return Principal{UserID: id, Role: role, Scopes: scopes}
+}
+
+func TestAuthorized(t *testing.T) {
+	cases := map[string]struct {
+		principal Principal
+		scope     Scope
+		owner     string
+		want      bool
+	}{
+		"viewer reads own":       {principal("alice", storage.RoleViewer), ScopeVideosRead, "alice", true},
+		"viewer reads other":     {principal("alice", storage.RoleViewer), ScopeVideosRead, "bob", false},
+		"viewer writes own":      {principal("alice", storage.RoleViewer), ScopeVideosWrite, "alice", false},
+		"uploader writes own":    {principal("alice", storage.RoleUploader), ScopeVideosWrite, "alice", true},
+		"uploader writes other":  {principal("alice", storage.RoleUploader), ScopeVideosWrite, "bob", false},
+		"uploader deletes own":   {principal("alice", storage.RoleUploader), ScopeVideosDelete, "alice", true},
+		"uploader deletes other": {principal("alice", storage.RoleUploader), ScopeVideosDelete, "bob", false},
+		"uploader, unowned":      {principal("alice", storage.RoleUploader), ScopeVideosDelete, "", false},
+		"editor writes other":    {principal("alice", storage.RoleEditor), ScopeVideosWrite, "bob", true},
+		"editor deletes other":   {principal("alice", storage.RoleEditor), ScopeVideosDelete, "bob", false},
+		"editor deletes own":     {principal("alice", storage.RoleEditor), ScopeVideosDelete, "alice", true},
+		"admin deletes other":    {principal("root", storage.RoleAdmin), ScopeVideosDelete, "bob", true},
+		"admin, unowned":         {principal("root", storage.RoleAdmin), ScopeVideosDelete, "", true},
+		"built-in admin":         {Admin, ScopeAdmin, "", true},
+		"restricted key, own":    {principal("alice", storage.RoleUploader, ScopeVideosRead), ScopeVideosDelete, "alice", false},
+		"restricted editor key":  {principal("alice", storage.RoleEditor, ScopeVideosRead), ScopeVideosWrite, "bob", false},
+		"uploader, admin scope":  {principal("alice", storage.RoleUploader), ScopeAdmin, "alice", false},
+		"unowned, no user id":    {principal("", storage.RoleUploader), ScopeVideosWrite, "", false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.principal.Authorized(tc.scope, tc.owner); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	uploader := RoleScopes(storage.RoleUploader)
+
+	cases := map[string]struct {
+		granted   []Scope
+		requested []Scope
+		want      []Scope
+	}{
+		"nil request":   {uploader, nil, uploader},
+		"empty request": {uploader, []Scope{}, []Scope{}},
+		"subset":        {uploader, []Scope{ScopeVideosRead}, []Scope{ScopeVideosRead}},
+		"order kept":    {uploader, []Scope{ScopeVideosDelete, ScopeVideosRead}, []Scope{ScopeVideosDelete, ScopeVideosRead}},
+		"not granted":   {RoleScopes(storage.RoleViewer), []Scope{ScopeVideosRead, ScopeVideosWrite, ScopeAdmin}, []Scope{ScopeVideosRead}},
+		"duplicates":    {uploader, []Scope{ScopeVideosRead, ScopeVideosRead}, []Scope{ScopeVideosRead}},
+		"unknown":       {uploader, []Scope{"videos:*"}, []Scope{}},
+		"admin grants":  {RoleScopes(storage.RoleAdmin), []Scope{ScopeVideosWrite}, []Scope{ScopeVideosWrite}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := restrict(tc.granted, tc.requested); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	cases := map[string]struct {
+		ctx   context.Context
+		owner string
+		err   error
+	}{
+		"anonymous":   {context.Background(), "alice", ErrUnauthenticated},
+		"owner":       {NewContext(context.Background(), principal("alice", storage.RoleUploader)), "alice", nil},
+		"other owner": {NewContext(context.Background(), principal("bob", storage.RoleUploader)), "alice", ErrForbidden},
+		"no scope":    {NewContext(context.Background(), principal("alice", storage.RoleViewer)), "alice", ErrInsufficientScope},
+		"admin":       {NewContext(context.Background(), Admin), "alice", nil},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if err := Authorize(tc.ctx, ScopeVideosDelete, tc.owner); !errors.Is(err, tc.err) {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claims of the bearer tokens, subject is the user id
+type tokenClaims struct {
+	Name string       `json:"name,omitempty"`
+	Role storage.Role `json:"role,omitempty"`
+	// space separated, narrows down the scopes of the role
+	Scope *string `json:"scope,omitempty"`
+	// tenant of the user, the default one if omitted
+	Tenant string `json:"tenant,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type tokenVerifier struct {
+	issuer string
+	// accepted issuer of the tokens, signed with the public key
+	externalIssuer string
+	ttl            time.Duration
+
+	// nil, if the app doesn't issue tokens
+	secret []byte
+	// nil, if there is no external issuer
+	publicKey crypto.PublicKey
+
+	// nil, if tokens are neither issued nor accepted
+	parser *jwt.Parser
+}
+
+func newTokenVerifier(conf config.AuthConfig) (*tokenVerifier, error) {
+	tv := &tokenVerifier{
+		issuer:         conf.Issuer,
+		externalIssuer: conf.ExternalIssuer,
+		ttl:            conf.TokenTTL,
+	}
+	if tv.externalIssuer == "" {
+		tv.externalIssuer = conf.Issuer
+	}
+
+	var methods []string
+	if conf.Secret != "" {
+		tv.secret = []byte(conf.Secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	if conf.PublicKey != "" {
+		pem, err := os.ReadFile(conf.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("error when reading jwt public key: %v", err)
+		}
+
+		key, alg, err := parsePublicKey(pem)
+		if err != nil {
+			return nil, err
+		}
+
+		tv.publicKey = key
+		methods = append(methods, alg)
+	}
+
+	// empty list would allow any method
+	if len(methods) == 0 {
+		return tv, nil
+	}
+
+	// issuer depends on the signing method, so it's checked after parsing
+	tv.parser = jwt.NewParser(
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+
+	return tv, nil
+}
+
+// the algorithm is determined by the key type, so tokens can't pick a weaker one
+func parsePublicKey(pem []byte) (crypto.PublicKey, string, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return key, jwt.SigningMethodRS256.Alg(), nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(pem); err == nil {
+		return key, jwt.SigningMethodES256.Alg(), nil
+	}
+	if key, err := jwt.ParseEdPublicKeyFromPEM(pem); err == nil {
+		return key, jwt.SigningMethodEdDSA.Alg(), nil
+	}
+
+	return nil, "", fmt.Errorf("jwt public key should be a pem encoded rsa, ecdsa or ed25519 key")
+}
+
+func (tv *tokenVerifier) key(token *jwt.Token) (any, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return tv.secret, nil
+	case *jwt.SigningMethodRSA:
+		if key, ok := tv.publicKey.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if key, ok := tv.publicKey.(*ecdsa.PublicKey); ok {
+			return key, nil
+		}
+	case *jwt.SigningMethodEd25519:
+		if key, ok := tv.publicKey.(ed25519.PublicKey); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected signing method: %v", token.Method.Alg())
+}
+
+// tokens, signed with the secret, are issued by the app itself, the other ones by the external issuer
+func (tv *tokenVerifier) expectedIssuer(token *jwt.Token) string {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return tv.issuer
+	}
+	return tv.externalIssuer
+}
+
+// checks signature, issuer and expiry of the bearer token, returning its principal
+func (a *Authenticator) Token(token string) (Principal, error) {
+	var claims tokenClaims
+
+	if a.tokens.parser == nil {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	parsed, err := a.tokens.parser.ParseWithClaims(token, &claims, a.tokens.key)
+	if err != nil {
+		return Principal{}, ErrInvalidCredentials.Wrap(err)
+	}
+
+	if claims.Issuer != a.tokens.expectedIssuer(parsed) {
+		return Principal{}, ErrInvalidCredentials.Wrap(jwt.ErrTokenInvalidIssuer)
+	}
+
+	if claims.Subject == "" {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	if claims.Role == "" {
+		claims.Role = storage.RoleViewer
+	}
+	if !ValidRole(claims.Role) {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	if claims.Tenant == "" {
+		claims.Tenant = tenant.Default
+	}
+	if !tenant.Valid(claims.Tenant) {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	scopes := RoleScopes(claims.Role)
+	if claims.Scope != nil {
+		scopes = restrict(scopes, ParseScopes(strings.Fields(*claims.Scope)))
+	}
+
+	return Principal{
+		UserID: claims.Subject,
+		Name:   claims.Name,
+		Role:   claims.Role,
+		Scopes: scopes,
+		Tenant: claims.Tenant,
+	}, nil
+}
+
+// issues HS256 bearer token of the principal
+func (a *Authenticator) IssueToken(p Principal) (string, time.Time, error) {
+	if a.tokens.secret == nil {
+		return "", time.Time{}, ErrTokensDisabled
+	}
+
+	now := time.Now()
+	expires := now.Add(a.tokens.ttl)
+
+	// tokens are as restricted as the credentials they were issued for
+	scope := joinScopes(p.Scopes)
+
+	claims := tokenClaims{
+		Name:   p.Name,
+		Role:   p.Role,
+		Scope:  &scope,
+		Tenant: p.Tenant,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    a.tokens.issuer,
+			Subject:   p.UserID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.tokens.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expires, nil
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "secret"
+
+// writes the pem encoded public key of a new ed25519 key pair, returning its private key
+func testPublicKey(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := path.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return keyPath, private
+}
+
+func newTestAuthenticator(t *testing.T, conf config.AuthConfig) *Authenticator {
+	t.Helper()
+
+	dir := t.TempDir()
+	users := storage.NewLocalUserRepository(path.Join(dir, "users.json"), path.Join(dir, "keys.json"))
+
+	a, err := New(conf, users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func testClaims(issuer string, expires time.Time) tokenClaims {
+	return tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "alice",
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key any, claims tokenClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestToken(t *testing.T) {
+	keyPath, private := testPublicKey(t)
+	hour := time.Now().Add(time.Hour)
+
+	both := newTestAuthenticator(t, config.AuthConfig{Issuer: "gostream", Secret: testSecret, PublicKey: keyPath, ExternalIssuer: "https://idp.example.com"})
+	secretOnly := newTestAuthenticator(t, config.AuthConfig{Issuer: "gostream", Secret: testSecret})
+	keyOnly := newTestAuthenticator(t, config.AuthConfig{Issuer: "gostream", PublicKey: keyPath})
+
+	pemBytes, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		a     *Authenticator
+		token string
+		valid bool
+	}{
+		"issued":           {both, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), testClaims("gostream", hour)), true},
+		"external":         {both, signToken(t, jwt.SigningMethodEdDSA, private, testClaims("https://idp.example.com", hour)), true},
+		"external, local":  {both, signToken(t, jwt.SigningMethodEdDSA, private, testClaims("gostream", hour)), false},
+		"issued, external": {both, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), testClaims("https://idp.example.com", hour)), false},
+		"default issuer":   {keyOnly, signToken(t, jwt.SigningMethodEdDSA, private, testClaims("gostream", hour)), true},
+		"wrong secret":     {secretOnly, signToken(t, jwt.SigningMethodHS256, []byte("other"), testClaims("gostream", hour)), false},
+		"none":             {both, signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, testClaims("gostream", hour)), false},
+		"hs384":            {secretOnly, signToken(t, jwt.SigningMethodHS384, []byte(testSecret), testClaims("gostream", hour)), false},
+		// public key, used as the hmac secret
+		"hs256, key only": {keyOnly, signToken(t, jwt.SigningMethodHS256, pemBytes, testClaims("gostream", hour)), false},
+		"eddsa, no key":   {secretOnly, signToken(t, jwt.SigningMethodEdDSA, private, testClaims("gostream", hour)), false},
+		"expired":         {both, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), testClaims("gostream", time.Now().Add(-time.Hour))), false},
+		"within leeway":   {both, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), testClaims("gostream", time.Now().Add(-10*time.Second))), true},
+		"no expiry":       {both, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), tokenClaims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "gostream", Subject: "alice"}}), false},
+		"no issuer":       {both, signToken(t, jwt.SigningMethodHS256, []byte(testSecret), testClaims("", hour)), false},
+		"malformed":       {both, "not.a.token", false},
+		"disabled":        {newTestAuthenticator(t, config.AuthConfig{}), signToken(t, jwt.SigningMethodHS256, []byte(testSecret), testClaims("gostream", hour)), false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p, err := tc.a.Token(tc.token)
+			if !tc.valid {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("got %v, want ErrInvalidCredentials", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.UserID != "alice" {
+				t.Errorf("user: got %q, want alice", p.UserID)
+			}
+		})
+	}
+}
+
+func TestTokenClaims(t *testing.T) {
+	a := newTestAuthenticator(t, config.AuthConfig{Issuer: "gostream", Secret: testSecret})
+	hour := time.Now().Add(time.Hour)
+
+	withClaims := func(edit func(*tokenClaims)) string {
+		claims := testClaims("gostream", hour)
+		edit(&claims)
+		return signToken(t, jwt.SigningMethodHS256, []byte(testSecret), claims)
+	}
+
+	scope := "videos:read admin:*"
+
+	p, err := a.Token(withClaims(func(c *tokenClaims) {
+		c.Role = storage.RoleUploader
+		c.Scope = &scope
+		c.Tenant = "team"
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// scopes, the role doesn't grant, are dropped
+	if len(p.Scopes) != 1 || p.Scopes[0] != ScopeVideosRead {
+		t.Errorf("scopes: got %v, want [videos:read]", p.Scopes)
+	}
+	if p.Tenant != "team" {
+		t.Errorf("tenant: got %q, want team", p.Tenant)
+	}
+
+	p, err = a.Token(withClaims(func(c *tokenClaims) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Role != storage.RoleViewer || p.Tenant != "default" {
+		t.Errorf("defaults: got role %q and tenant %q", p.Role, p.Tenant)
+	}
+
+	invalid := map[string]func(*tokenClaims){
+		"no subject":     func(c *tokenClaims) { c.Subject = "" },
+		"unknown role":   func(c *tokenClaims) { c.Role = "owner" },
+		"invalid tenant": func(c *tokenClaims) { c.Tenant = "Team/1" },
+	}
+
+	for name, edit := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := a.Token(withClaims(edit)); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("got %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestIssueToken(t *testing.T) {
+	a := newTestAuthenticator(t, config.AuthConfig{Issuer: "gostream", Secret: testSecret, TokenTTL: time.Hour})
+
+	issued := Principal{UserID: "alice", Name: "Alice", Role: storage.RoleUploader, Scopes: []Scope{ScopeVideosRead}, Tenant: "team"}
+
+	token, expires, err := a.IssueToken(issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(expires) <= 59*time.Minute {
+		t.Errorf("expires at %v", expires)
+	}
+
+	p, err := a.Token(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tokens are as restricted as the credentials they were issued for
+	if p.UserID != issued.UserID || p.Role != issued.Role || p.Tenant != issued.Tenant || len(p.Scopes) != 1 || p.Scopes[0] != ScopeVideosRead {
+		t.Errorf("got %+v, want %+v", p, issued)
+	}
+
+	keyPath, _ := testPublicKey(t)
+	if _, _, err := newTestAuthenticator(t, config.AuthConfig{PublicKey: keyPath}).IssueToken(issued); !errors.Is(err, ErrTokensDisabled) {
+		t.Errorf("got %v, want ErrTokensDisabled", err)
+	}
+}
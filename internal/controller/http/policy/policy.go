@@ -0,0 +1,87 @@
+// Package policy decides, what callers of each http route should be allowed to.
+//
+// Every route of a group, guarded by a policy, has to be listed in it:
+// routes without a rule are denied, so a forgotten entry can't open anything up.
+// Methods, which aren't listed for a known path, are denied as well.
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/labstack/echo/v4"
+)
+
+// requirement of a single route
+type Rule struct {
+	// anyone may call the route, even without credentials
+	Public bool
+	// scope, the caller should be granted (any authenticated caller, if empty)
+	Scope auth.Scope
+}
+
+var (
+	// files, fetched by the players, which can't send credentials
+	Public = Rule{Public: true}
+	// route checks permissions of the caller itself
+	Authenticated = Rule{}
+)
+
+func Require(scope auth.Scope) Rule {
+	return Rule{Scope: scope}
+}
+
+// rules, keyed by "<method> <route path>"
+type Policy map[string]Rule
+
+// returns middleware, enforcing the policy
+func (p Policy) Middleware() echo.MiddlewareFunc {
+	// methods of each of the paths, which are known to the policy
+	paths := make(map[string][]string)
+	for route := range p {
+		method, path, _ := strings.Cut(route, " ")
+		paths[path] = append(paths[path], method)
+	}
+	for _, methods := range paths {
+		slices.Sort(methods)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			rule, ok := p[c.Request().Method+" "+c.Path()]
+			if !ok {
+				// unknown paths are rejected by echo itself (404)
+				if strings.HasSuffix(c.Path(), "/*") {
+					return next(c)
+				}
+
+				// route might exist, but its method was left out of the policy
+				if methods, known := paths[c.Path()]; known {
+					c.Response().Header().Set(echo.HeaderAllow, strings.Join(methods, ", "))
+					return echo.ErrMethodNotAllowed
+				}
+
+				return auth.ErrForbidden.Wrap(fmt.Errorf("route %v %v has no policy", c.Request().Method, c.Path()))
+			}
+
+			if rule.Public {
+				return next(c)
+			}
+
+			principal, err := auth.Require(c.Request().Context())
+			if err != nil {
+				return err
+			}
+
+			if !principal.Can(rule.Scope) {
+				// rfc 6750
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="insufficient_scope", scope="%v"`, rule.Scope))
+				return auth.ErrInsufficientScope
+			}
+
+			return next(c)
+		}
+	}
+}
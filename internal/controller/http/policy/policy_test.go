@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/controller/http/problem"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var testPolicy = Policy{
+	"GET /api/videos":             Require(auth.ScopeVideosRead),
+	"DELETE /api/videos/:id":      Require(auth.ScopeVideosDelete),
+	"GET /api/videos/:id":         Require(auth.ScopeVideosRead),
+	"GET /api/videos/:id/segment": Public,
+	"GET /api/me":                 Authenticated,
+}
+
+var testPrincipals = map[string]auth.Principal{
+	"viewer": {UserID: "viewer", Role: storage.RoleViewer, Scopes: auth.RoleScopes(storage.RoleViewer)},
+	"admin":  auth.Admin,
+	// api key, restricted to reading
+	"reader": {UserID: "uploader", Role: storage.RoleUploader, Scopes: []auth.Scope{auth.ScopeVideosRead}},
+}
+
+func newTestServer() *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = problem.Handler(zap.NewNop())
+
+	// principal is named by the header, instead of being authenticated
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if p, ok := testPrincipals[c.Request().Header.Get("X-Principal")]; ok {
+				c.SetRequest(c.Request().WithContext(auth.NewContext(c.Request().Context(), p)))
+			}
+			return next(c)
+		}
+	}
+
+	ok := func(c echo.Context) error { return c.NoContent(200) }
+
+	g := e.Group("/api", authenticate, testPolicy.Middleware())
+	g.GET("/videos", ok)
+	g.GET("/videos/:id", ok)
+	g.DELETE("/videos/:id", ok)
+	g.GET("/videos/:id/segment", ok)
+	g.GET("/me", ok)
+	// registered, but left out of the policy
+	g.PUT("/videos/:id", ok)
+	g.POST("/unlisted", ok)
+
+	return e
+}
+
+func TestMiddleware(t *testing.T) {
+	e := newTestServer()
+
+	cases := map[string]struct {
+		method    string
+		path      string
+		principal string
+		status    int
+	}{
+		"public":                {"GET", "/api/videos/1/segment", "", 200},
+		"no credentials":        {"GET", "/api/videos", "", 401},
+		"scope granted":         {"GET", "/api/videos/1", "viewer", 200},
+		"scope missing":         {"DELETE", "/api/videos/1", "viewer", 403},
+		"scope restricted":      {"DELETE", "/api/videos/1", "reader", 403},
+		"admin":                 {"DELETE", "/api/videos/1", "admin", 200},
+		"authenticated":         {"GET", "/api/me", "viewer", 200},
+		"authenticated, no one": {"GET", "/api/me", "", 401},
+		"method left out":       {"PUT", "/api/videos/1", "admin", 405},
+		// echo routes it to the catch-all route of the group
+		"method not registered":  {"POST", "/api/videos/1", "admin", 404},
+		"route left out":         {"POST", "/api/unlisted", "admin", 403},
+		"unknown route":          {"GET", "/api/unknown", "admin", 404},
+		"unknown route, no user": {"GET", "/api/unknown", "", 404},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.principal != "" {
+				req.Header.Set("X-Principal", tc.principal)
+			}
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("got %v, want %v (%v)", rec.Code, tc.status, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestInsufficientScopeHeader(t *testing.T) {
+	e := newTestServer()
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/videos/1", nil)
+	req.Header.Set("X-Principal", "viewer")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	want := `Bearer error="insufficient_scope", scope="videos:delete"`
+	if got := rec.Header().Get(echo.HeaderWWWAuthenticate); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
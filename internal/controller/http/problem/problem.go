@@ -0,0 +1,145 @@
+// Package problem reports http errors as RFC 7807 problem details.
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/errs"
+	"github.com/cutlery47/gostream/internal/logging"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const ContentType = "application/problem+json"
+
+// returned when request parameter or body is malformed
+var ErrInvalidParam = errs.New(errs.Invalid, "invalid_parameter", "invalid request parameter")
+
+// body of every error response
+type Problem struct {
+	// uri, identifying the problem type
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// path of the failed request
+	Instance string `json:"instance"`
+	// stable machine-readable code (e.g. video_not_found)
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// field-level validation details
+	Errors []errs.FieldError `json:"errors,omitempty"`
+}
+
+var statuses = map[errs.Kind]int{
+	errs.Internal:        http.StatusInternalServerError,
+	errs.Invalid:         http.StatusBadRequest,
+	errs.NotFound:        http.StatusNotFound,
+	errs.Conflict:        http.StatusConflict,
+	errs.Forbidden:       http.StatusForbidden,
+	errs.Precondition:    http.StatusPreconditionFailed,
+	errs.Unavailable:     http.StatusServiceUnavailable,
+	errs.NotImplemented:  http.StatusNotImplemented,
+	errs.Unsupported:     http.StatusUnsupportedMediaType,
+	errs.Unauthenticated: http.StatusUnauthorized,
+	errs.Limited:         http.StatusTooManyRequests,
+}
+
+// reports malformed request parameter
+func Param(param, message string) error {
+	return ErrInvalidParam.WithFields(errs.FieldError{Field: param, Message: message})
+}
+
+// http status, corresponding to the error kind
+func Status(kind errs.Kind) int {
+	if status, ok := statuses[kind]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// converts err into the problem, describing it to the client
+func New(c echo.Context, err error) Problem {
+	p := Problem{
+		Instance:  c.Request().URL.Path,
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+
+	var he *echo.HTTPError
+	if e := errs.From(err); e != nil {
+		p.Status = Status(e.Kind)
+		p.Code = e.Code
+		p.Errors = e.Fields
+		if e.Kind != errs.Internal {
+			p.Detail = e.Message
+		}
+	} else if errors.As(err, &he) {
+		// errors of echo itself (e.g. unknown route) and its middleware
+		p.Status = he.Code
+		p.Code = code(he.Code)
+		if msg, ok := he.Message.(string); ok && he.Code < 500 {
+			p.Detail = msg
+		}
+	} else {
+		p.Status = http.StatusInternalServerError
+		p.Code = code(p.Status)
+	}
+
+	p.Title = http.StatusText(p.Status)
+	p.Type = "about:blank"
+	if p.Code != code(p.Status) {
+		p.Type = "/problems/" + strings.ReplaceAll(p.Code, "_", "-")
+	}
+
+	return p
+}
+
+// snake cased status text (e.g. not_found)
+func code(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+// replaces the default echo error handler
+func Handler(errLog *zap.Logger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		p := New(c, err)
+
+		// unexpected errors are logged, but not disclosed
+		if p.Status >= 500 {
+			logging.For(c.Request().Context(), errLog).Error(fmt.Sprintf("Error: %v", err), zap.String("path", p.Instance))
+		}
+
+		if p.Status == http.StatusUnauthorized {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="gostream"`)
+		}
+
+		// whole seconds, rounded up
+		if e := errs.From(err); e != nil && e.RetryAfter > 0 {
+			c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int((e.RetryAfter+time.Second-1)/time.Second)))
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(p.Status)
+		} else {
+			c.Response().Header().Set(echo.HeaderContentType, ContentType)
+			c.Response().WriteHeader(p.Status)
+			err = c.Echo().JSONSerializer.Serialize(c, p, "")
+		}
+		if err != nil {
+			errLog.Error(fmt.Sprintf("Error when writing problem: %v", err))
+		}
+	}
+}
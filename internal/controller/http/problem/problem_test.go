@@ -0,0 +1,170 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/errs"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var errVideoNotFound = errs.New(errs.NotFound, "video_not_found", "couldn't find requested video file")
+
+func TestStatus(t *testing.T) {
+	// every kind is mapped onto its own status
+	seen := map[int]errs.Kind{}
+	for kind := errs.Internal; kind <= errs.Limited; kind++ {
+		status := Status(kind)
+		if other, ok := seen[status]; ok {
+			t.Errorf("kinds %v and %v are both reported as %v", other, kind, status)
+		}
+		seen[status] = kind
+	}
+
+	if got := Status(errs.Kind(100)); got != http.StatusInternalServerError {
+		t.Errorf("unknown kind: got %v", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		want Problem
+	}{
+		"service error": {
+			errVideoNotFound,
+			Problem{Type: "/problems/video-not-found", Title: "Not Found", Status: 404, Detail: "couldn't find requested video file", Code: "video_not_found"},
+		},
+		// the kind and code survive wrapping
+		"wrapped": {
+			fmt.Errorf("reading: %w", errVideoNotFound.Wrap(errors.New("no rows"))),
+			Problem{Type: "/problems/video-not-found", Title: "Not Found", Status: 404, Detail: "couldn't find requested video file", Code: "video_not_found"},
+		},
+		"fields": {
+			Param("limit", "should be a number"),
+			Problem{Type: "/problems/invalid-parameter", Title: "Bad Request", Status: 400, Detail: "invalid request parameter", Code: "invalid_parameter",
+				Errors: []errs.FieldError{{Field: "limit", Message: "should be a number"}}},
+		},
+		// details of internal errors aren't disclosed
+		"internal": {
+			errs.New(errs.Internal, "db_failure", "connection string is postgres://secret"),
+			Problem{Type: "/problems/db-failure", Title: "Internal Server Error", Status: 500, Code: "db_failure"},
+		},
+		"plain error": {
+			errors.New("connection refused"),
+			Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Code: "internal_server_error"},
+		},
+		"echo error": {
+			echo.ErrNotFound,
+			Problem{Type: "about:blank", Title: "Not Found", Status: 404, Detail: "Not Found", Code: "not_found"},
+		},
+		"echo internal error": {
+			echo.NewHTTPError(http.StatusBadGateway, "upstream is down"),
+			Problem{Type: "about:blank", Title: "Bad Gateway", Status: 502, Code: "bad_gateway"},
+		},
+		// statuses without a text get the generic code
+		"unknown status": {
+			echo.NewHTTPError(499, "closed"),
+			Problem{Type: "about:blank", Status: 499, Detail: "closed", Code: "error"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v2/videos/id?x=1", nil)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+
+			tc.want.Instance, tc.want.RequestID = "/api/v2/videos/id", "req-1"
+
+			if got := New(c, tc.err); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	cases := map[string]struct {
+		method  string
+		err     error
+		status  int
+		headers map[string]string
+		body    bool
+	}{
+		"problem": {
+			method: http.MethodGet, err: errVideoNotFound, status: 404, body: true,
+		},
+		"unauthenticated": {
+			method: http.MethodGet, err: errs.New(errs.Unauthenticated, "unauthenticated", "missing credentials"), status: 401, body: true,
+			headers: map[string]string{echo.HeaderWWWAuthenticate: `Bearer realm="gostream"`},
+		},
+		// retry delay is rounded up to whole seconds
+		"retry after": {
+			method: http.MethodGet, err: errs.New(errs.Limited, "rate_limited", "too many requests").After(1500 * time.Millisecond), status: 429, body: true,
+			headers: map[string]string{echo.HeaderRetryAfter: "2"},
+		},
+		"head": {
+			method: http.MethodHead, err: errVideoNotFound, status: 404,
+		},
+	}
+
+	handler := Handler(zap.NewNop())
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(tc.method, "/api/v2/videos/id", nil), rec)
+
+			handler(tc.err, c)
+
+			if rec.Code != tc.status {
+				t.Errorf("got status %v, want %v", rec.Code, tc.status)
+			}
+			for header, want := range tc.headers {
+				if got := rec.Header().Get(header); got != want {
+					t.Errorf("%v: got %q, want %q", header, got, want)
+				}
+			}
+
+			if !tc.body {
+				if rec.Body.Len() != 0 {
+					t.Errorf("got body %q", rec.Body)
+				}
+				return
+			}
+
+			if got := rec.Header().Get(echo.HeaderContentType); got != ContentType {
+				t.Errorf("content type: got %q", got)
+			}
+
+			var p Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Status != tc.status || p.Code != errs.From(tc.err).Code {
+				t.Errorf("got %+v", p)
+			}
+		})
+	}
+}
+
+func TestHandlerCommitted(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	// the response is already on its way, so the error can't be reported
+	c.String(200, "partial")
+	Handler(zap.NewNop())(errVideoNotFound, c)
+
+	if rec.Code != 200 || rec.Body.String() != "partial" {
+		t.Errorf("got %v %q", rec.Code, rec.Body)
+	}
+}
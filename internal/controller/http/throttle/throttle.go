@@ -0,0 +1,121 @@
+// Package throttle applies rate limits to the http routes.
+//
+// Routes are grouped into classes (uploads, deletes, playback), each limited
+// separately for every client. Clients are told when to retry with the
+// Retry-After header of the 429 responses.
+package throttle
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/ratelimit"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/labstack/echo/v4"
+)
+
+// group of the routes, sharing a limit
+type Class string
+
+const (
+	Upload   Class = "upload"
+	Delete   Class = "delete"
+	Playback Class = "playback"
+)
+
+// limits of the classes, enforced by the limiter
+type Throttle struct {
+	limiter ratelimit.Limiter
+	limits  map[Class]ratelimit.Limit
+}
+
+func New(limiter ratelimit.Limiter, conf config.LimitConfig) *Throttle {
+	return &Throttle{
+		limiter: limiter,
+		limits: map[Class]ratelimit.Limit{
+			Upload:   ratelimit.PerMinute(conf.Upload, conf.UploadBurst),
+			Delete:   ratelimit.PerMinute(conf.Delete, conf.DeleteBurst),
+			Playback: ratelimit.PerMinute(conf.Playback, conf.PlaybackBurst),
+		},
+	}
+}
+
+// classes, keyed by "<method> <route path>"
+// routes, which aren't listed, aren't limited
+type Routes map[string]Class
+
+// returns middleware, limiting the routes
+// should run after the caller is authenticated
+func (r Routes) Middleware(t *Throttle) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			class, ok := r[c.Request().Method+" "+c.Path()]
+			if !ok {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+			key := fmt.Sprintf("%v:%v:%v", class, tenant.FromContext(ctx), client(c))
+
+			wait, err := t.limiter.Take(ctx, key, t.limits[class])
+			if err != nil {
+				return err
+			}
+
+			if wait > 0 {
+				return ratelimit.ErrRateLimited.After(wait)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// api key of the caller, or its user (when authenticated with a token), or its ip
+func client(c echo.Context) string {
+	p, _ := auth.FromContext(c.Request().Context())
+
+	switch {
+	case p.KeyID != "":
+		return "key:" + p.KeyID
+	case p.UserID != "":
+		return "user:" + p.UserID
+	default:
+		return "ip:" + c.RealIP()
+	}
+}
+
+// returns extractor of the client ips, the anonymous callers are limited by
+// X-Forwarded-For is only trusted, when the connection comes from one of the proxies,
+// so that the clients can't pick a fresh bucket (or an ip of a signed url) by spoofing it
+func IPExtractor(proxies []string) (echo.IPExtractor, error) {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	opts := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+
+	for _, proxy := range proxies {
+		// single addresses are ranges of their own
+		if ip := net.ParseIP(proxy); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			bits := len(ip) * 8
+
+			opts = append(opts, echo.TrustIPRange(&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}))
+			continue
+		}
+
+		_, ipRange, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy address: %v", proxy)
+		}
+
+		opts = append(opts, echo.TrustIPRange(ipRange))
+	}
+
+	return echo.ExtractIPFromXFFHeader(opts...), nil
+}
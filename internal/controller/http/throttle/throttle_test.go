@@ -0,0 +1,88 @@
+package throttle
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/ratelimit"
+	"github.com/labstack/echo/v4"
+)
+
+func TestIPExtractor(t *testing.T) {
+	tests := map[string]struct {
+		proxies []string
+		remote  string
+		xff     string
+		want    string
+	}{
+		"direct":          {remote: "203.0.113.7", want: "203.0.113.7"},
+		"spoofed":         {remote: "203.0.113.7", xff: "198.51.100.1", want: "203.0.113.7"},
+		"private spoofed": {remote: "10.0.0.2", xff: "198.51.100.1", want: "10.0.0.2"},
+		"proxied":         {proxies: []string{"10.0.0.1"}, remote: "10.0.0.1", xff: "203.0.113.7", want: "203.0.113.7"},
+		"untrusted proxy": {proxies: []string{"10.0.0.1"}, remote: "10.0.0.2", xff: "203.0.113.7", want: "10.0.0.2"},
+		"proxy range":     {proxies: []string{"10.0.0.0/8"}, remote: "10.1.2.3", xff: "203.0.113.7", want: "203.0.113.7"},
+		// only the addresses, appended by the trusted proxies, are skipped
+		"proxy chain":  {proxies: []string{"10.0.0.1"}, remote: "10.0.0.1", xff: "198.51.100.1, 203.0.113.7", want: "203.0.113.7"},
+		"ipv6 proxied": {proxies: []string{"2001:db8::1"}, remote: "[2001:db8::1]", xff: "203.0.113.7", want: "203.0.113.7"},
+	}
+
+	for name, tc := range tests {
+		extract, err := IPExtractor(tc.proxies)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote + ":1234"
+		if tc.xff != "" {
+			req.Header.Set(echo.HeaderXForwardedFor, tc.xff)
+		}
+
+		if got := extract(req); got != tc.want {
+			t.Errorf("%v: got %v, want %v", name, got, tc.want)
+		}
+	}
+
+	for _, proxies := range [][]string{{"proxy"}, {"10.0.0.0/33"}} {
+		if _, err := IPExtractor(proxies); err == nil {
+			t.Errorf("%v: invalid proxies were accepted", proxies)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+
+	th := New(ratelimit.NewMemory(), config.LimitConfig{Upload: 1, UploadBurst: 1})
+	routes := Routes{"POST /files": Upload}
+
+	ok := func(c echo.Context) error { return nil }
+
+	take := func(remote, xff string) error {
+		req := httptest.NewRequest(http.MethodPost, "/files", nil)
+		req.RemoteAddr = remote + ":1234"
+		req.Header.Set(echo.HeaderXForwardedFor, xff)
+
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.SetPath("/files")
+
+		return routes.Middleware(th)(ok)(c)
+	}
+
+	if err := take("203.0.113.7", "198.51.100.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// spoofed header doesn't get a fresh bucket
+	if err := take("203.0.113.7", "198.51.100.2"); !errors.Is(err, ratelimit.ErrRateLimited) {
+		t.Errorf("got %v, want ErrRateLimited", err)
+	}
+
+	if err := take("203.0.113.8", ""); err != nil {
+		t.Errorf("other client: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/labstack/echo/v4"
+)
+
+type authRoutes struct {
+	a *auth.Authenticator
+}
+
+func newAuthRoutes(g *echo.Group, a *auth.Authenticator) {
+	r := &authRoutes{
+		a: a,
+	}
+
+	g.GET("/me", r.me)
+	g.POST("/token", r.token)
+}
+
+type principalResponse struct {
+	UserID string `json:"user_id,omitempty"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	// scopes, granted to the request
+	Scopes []string `json:"scopes"`
+	// api key, the request was authenticated with
+	KeyID string `json:"key_id,omitempty"`
+	// tenant, the request was resolved to
+	Tenant string `json:"tenant"`
+}
+
+//	@Summary		Retrieve caller
+//	@Description	Get the user, the request was authenticated as
+//	@Tags			auth
+//	@Security		Bearer
+//	@Success		200	{object}	v1.principalResponse
+//	@Failure		401	{object}	problem.Problem
+//	@Router			/api/v1/auth/me [get]
+func (r *authRoutes) me(c echo.Context) error {
+	p, err := auth.Require(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, principalResponse{
+		UserID: p.UserID,
+		Name:   p.Name,
+		Role:   string(p.Role),
+		Scopes: auth.FormatScopes(p.Scopes),
+		KeyID:  p.KeyID,
+		Tenant: tenant.FromContext(c.Request().Context()),
+	})
+}
+
+type tokenResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+//	@Summary		Issue bearer token
+//	@Description	Exchange api key (or a token) for a short-lived bearer token of the same user
+//	@Tags			auth
+//	@Security		Bearer
+//	@Success		200	{object}	v1.tokenResponse
+//	@Failure		401	{object}	problem.Problem
+//	@Failure		501	{object}	problem.Problem	"Token issuing is not configured"
+//	@Router			/api/v1/auth/token [post]
+func (r *authRoutes) token(c echo.Context) error {
+	p, err := auth.Require(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	// anonymous callers have nothing to put into the token
+	if p.UserID == "" {
+		return auth.ErrUnauthenticated
+	}
+
+	// tokens of the admin are only valid within the requested tenant
+	if p.Tenant == "" {
+		p.Tenant = tenant.FromContext(c.Request().Context())
+	}
+
+	token, expires, err := r.a.IssueToken(p)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, tokenResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: expires,
+	})
+}
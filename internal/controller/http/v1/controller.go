@@ -1,22 +1,51 @@
 package v1
 
 import (
+	"github.com/cutlery47/gostream/config"
 	_ "github.com/cutlery47/gostream/docs"
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/controller/http/problem"
+	"github.com/cutlery47/gostream/internal/controller/http/throttle"
+	"github.com/cutlery47/gostream/internal/drm"
+	"github.com/cutlery47/gostream/internal/health"
+	"github.com/cutlery47/gostream/internal/metrics"
 	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/sign"
+	"github.com/cutlery47/gostream/internal/tenant"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	echoSwagger "github.com/swaggo/echo-swagger"
 	"go.uber.org/zap"
 )
 
-func NewController(e *echo.Echo, s service.Service, reqLog, errLog, infoLog *zap.Logger) {
+func NewController(e *echo.Echo, s service.Service, ls service.LiveService, us service.UserService, l drm.LicenseServer, a *auth.Authenticator, tenants *tenant.Resolver, throttler *throttle.Throttle, checker *health.Checker, signer *sign.Signer, bindIP bool, serve config.ServeConfig, reqLog, errLog, infoLog *zap.Logger) {
+	// errors of every api version are reported as problem details
+	e.HTTPErrorHandler = problem.Handler(errLog)
+
+	// outermost, so that requests are measured along with the rest of the middleware
+	e.Use(metricsMiddleware())
+	e.Use(tracingMiddleware())
 	e.Use(middleware.Recover())
+	// preflight requests are answered before the authentication
+	if len(serve.AllowOrigins) > 0 {
+		e.Use(middleware.CORSWithConfig(middleware.CORSConfig{AllowOrigins: serve.AllowOrigins, ExposeHeaders: []string{"ETag", "X-Request-ID", "Upload-Offset"}}))
+	}
+	// sets X-Request-ID, unless the client did
+	e.Use(requestIDMiddleware())
+	e.Use(authMiddleware(a, tenants))
 
-	e.GET("/health", func(c echo.Context) error { return c.NoContent(200) })
+	newHealthRoutes(e.Group(""), checker)
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
-	v1 := e.Group("/api/v1", requestLoggerMiddleware(reqLog))
+	v1 := e.Group("/api/v1", requestLoggerMiddleware(reqLog), routePolicy.Middleware(), routeLimits.Middleware(throttler))
 	{
-		newFileRoutes(v1.Group("/files"), s, newErrHandler(errLog))
+		newFileRoutes(v1.Group("/files"), s, signer, bindIP, serve)
+		newVideoRoutes(v1.Group("/videos"), s)
+		newStreamRoutes(v1.Group("/streams"), ls)
+		newLicenseRoutes(v1.Group("/license"), l, signer)
+		newAuthRoutes(v1.Group("/auth"), a)
+		newUserRoutes(v1.Group("/users"), us)
+		newUsageRoutes(v1.Group("/users"), s)
 	}
 }
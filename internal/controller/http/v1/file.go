@@ -1,44 +1,95 @@
 package v1
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
+	"net/url"
+	"path"
+	"strconv"
 	"strings"
 
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/controller/http/problem"
+	"github.com/cutlery47/gostream/internal/live"
+	"github.com/cutlery47/gostream/internal/playlist"
 	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/sign"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/cutlery47/gostream/internal/tracing"
+	"github.com/cutlery47/gostream/internal/utils"
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// serving modes of the stored files
+const (
+	// file bytes are streamed through the app
+	ServeProxy = "proxy"
+	// client is redirected to the object storage
+	ServeRedirect = "redirect"
 )
 
 type fileRoutes struct {
 	s service.Service
-	h *errHandler
+
+	// nil, if playback urls are not signed
+	signer *sign.Signer
+	bindIP bool
+
+	serve config.ServeConfig
 }
 
-func newFileRoutes(g *echo.Group, s service.Service, h *errHandler) {
+func newFileRoutes(g *echo.Group, s service.Service, signer *sign.Signer, bindIP bool, serve config.ServeConfig) {
 	r := &fileRoutes{
-		s: s,
-		h: h,
+		s:      s,
+		signer: signer,
+		bindIP: bindIP,
+		serve:  serve,
 	}
 
 	g.POST("/", r.upload)
-	g.GET("/:filename", r.get)
 	g.DELETE("/:filename", r.delete)
+
+	if signer != nil {
+		g.GET("/:filename", r.get, signedURLMiddleware(signer))
+		g.GET("/:filename/signed", r.signed)
+	} else {
+		g.GET("/:filename", r.get)
+	}
 }
 
 //	@Summary		Upload file to storage
 //	@Description	Upload file with name
 //	@Tags			files
+//	@Security		Bearer
 //	@Param			file	formData	file	true	"file to be uploaded"
 //	@Param			name	formData	string	true	"name of the file"
+//	@Param			title	formData	string	false	"title of the video (name, if empty)"
+//	@Param			tags	formData	string	false	"comma separated tags"
+//	@Param			description	formData	string	false	"description of the video"
+//	@Param			visibility	formData	string	false	"public (default), unlisted or private"
+//	@Param			attributes	formData	string	false	"json object of custom string attributes"
 //	@Success		200		{object}	v1.fileRoutes.upload.response
-//	@Failure		400		{object}	echo.HTTPError
-//	@Failure		500		{object}	echo.HTTPError	"Internal error"
+//	@Failure		400		{object}	problem.Problem
+//	@Failure		401		{object}	problem.Problem
+//	@Failure		403		{object}	problem.Problem	"Quota of the user or the tenant is exceeded"
+//	@Failure		409		{object}	problem.Problem	"Video or live stream with the name already exists"
+//	@Failure		429		{object}	problem.Problem	"Rate limit is exceeded or too many videos are being processed"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
 //	@Router			/api/v1/files [post]
 func (r *fileRoutes) upload(c echo.Context) error {
+	// whole body is received, once the form is parsed
+	_, receive := tracing.Start(c.Request().Context(), "fileRoutes.upload receive")
 	name := c.FormValue("name")
 	multipart, err := c.FormFile("file")
 	if err != nil {
-		return r.h.handle(err)
+		tracing.End(receive, err)
+		return problem.Param("file", "mp4 file is required")
 	}
+	receive.SetAttributes(attribute.Int64("upload.size", multipart.Size))
+	tracing.End(receive, nil)
 
 	ctx := c.Request().Context()
 
@@ -49,12 +100,26 @@ func (r *fileRoutes) upload(c echo.Context) error {
 
 	video, err := multipart.Open()
 	if err != nil {
-		return r.h.handle(err)
+		return err
+	}
+
+	meta := service.UploadMeta{
+		Title:       c.FormValue("title"),
+		Description: c.FormValue("description"),
+		Visibility:  storage.Visibility(c.FormValue("visibility")),
+	}
+	if tags := c.FormValue("tags"); tags != "" {
+		meta.Tags = strings.Split(tags, ",")
+	}
+	if attributes := c.FormValue("attributes"); attributes != "" {
+		if err := json.Unmarshal([]byte(attributes), &meta.Attributes); err != nil {
+			return problem.Param("attributes", "should be a json object of strings")
+		}
 	}
 
 	// uploading all the created files
-	if err := r.s.Upload(ctx, video, name); err != nil {
-		return r.h.handle(err)
+	if err := r.s.Upload(ctx, video, name, meta); err != nil {
+		return err
 	}
 
 	return c.JSON(200, "Success")
@@ -64,43 +129,181 @@ func (r *fileRoutes) upload(c echo.Context) error {
 //	@Description	Get file by name
 //	@Tags			files
 //	@Param			filename	query		string	true	"name of the file"
+//	@Param			token		query		string	false	"signed playback token"
+//	@Param			codecs		query		string	false	"comma separated codecs, supported by the client (playlists only)"
+//	@Param			_HLS_msn	query		int		false	"blocks, until the live playlist contains the media segment (low-latency streams only)"
+//	@Param			_HLS_part	query		int		false	"blocks, until the live playlist contains the part of the media segment (low-latency streams only)"
 //	@Success		200			{object}	string	"Binary file"
-//	@Failure		400			{object}	echo.HTTPError
-//	@Failure		404			{object}	echo.HTTPError	"Data couldn't be found"
-//	@Failure		500			{object}	echo.HTTPError	"Internal error"
+//	@Success		302			{string}	string	"Redirect to presigned object storage url"
+//	@Failure		400			{object}	problem.Problem
+//	@Failure		403			{object}	problem.Problem	"Token is missing, invalid or expired"
+//	@Failure		404			{object}	problem.Problem	"Data couldn't be found"
+//	@Failure		429			{object}	problem.Problem	"Rate limit is exceeded"
+//	@Failure		500			{object}	problem.Problem	"Internal error"
+//	@Failure		503			{object}	problem.Problem	"Live playlist wasn't updated in time"
 //	@Router			/api/v1/files/ [get]
 func (r *fileRoutes) get(c echo.Context) error {
-	c.Response().Header().Set("Access-Control-Allow-Origin", "*")
 	filename := c.Param("filename")
 
 	var file io.ReadCloser
 
 	ctx := c.Request().Context()
 
+	// letting the client fetch the file straight from the object storage
+	if r.redirect(filename) {
+		url, err := r.s.ServeURL(ctx, filename)
+		if err == nil {
+			return c.Redirect(302, url)
+		}
+
+		// live parts are served from memory
+		if !errors.Is(err, service.ErrNoRedirect) {
+			return err
+		}
+	}
+
+	if strings.HasSuffix(filename, ".m3u8") {
+		return r.playlist(c, filename)
+	}
+
 	// searching for requested file
 	file, err := r.s.Serve(ctx, filename)
 	if err != nil {
-		return r.h.handle(err)
+		return err
 	}
 
 	// converting the file into a sequence of bytes
 	blob, err := io.ReadAll(file)
 	if err != nil {
-		return r.h.handle(err)
+		return err
 	}
 
 	// returning the file
 	return c.Blob(200, "application/mpeg", blob)
 }
 
+// renders playlist for the requesting client
+func (r *fileRoutes) playlist(c echo.Context, filename string) error {
+	opts := playlist.Options{}
+
+	// every uri in the playlist should carry a token as well
+	if claims, ok := c.Get("claims").(sign.Claims); ok {
+		token, err := r.signer.Sign(claims)
+		if err != nil {
+			return err
+		}
+
+		opts.Query = url.Values{"token": {token}}
+	}
+
+	if codecs := c.QueryParam("codecs"); codecs != "" {
+		opts.Codecs = strings.Split(codecs, ",")
+	}
+
+	block, err := blockingRequest(c)
+	if err != nil {
+		return err
+	}
+
+	blob, err := r.s.ServePlaylist(c.Request().Context(), filename, opts, block)
+	if err != nil {
+		return err
+	}
+
+	return c.Blob(200, "application/vnd.apple.mpegurl", blob)
+}
+
+// parses blocking playlist reload params (LL-HLS)
+func blockingRequest(c echo.Context) (*live.Block, error) {
+	msn, part := c.QueryParam("_HLS_msn"), c.QueryParam("_HLS_part")
+	if msn == "" {
+		// part is meaningless without the segment
+		if part != "" {
+			return nil, problem.Param("_HLS_part", "requires _HLS_msn")
+		}
+		return nil, nil
+	}
+
+	block := &live.Block{Part: -1}
+
+	var err error
+	if block.MSN, err = strconv.ParseUint(msn, 10, 64); err != nil {
+		return nil, problem.Param("_HLS_msn", "should be a non-negative integer")
+	}
+
+	if part != "" {
+		if block.Part, err = strconv.Atoi(part); err != nil || block.Part < 0 {
+			return nil, problem.Param("_HLS_part", "should be a non-negative integer")
+		}
+	}
+
+	return block, nil
+}
+
+// checks if the file should be served with a redirect
+func (r *fileRoutes) redirect(filename string) bool {
+	switch path.Ext(filename) {
+	case ".m3u8":
+		// playlists are always served by the app
+		return false
+	case ".ts", ".m4s":
+		return r.serve.Chunk == ServeRedirect
+	default:
+		return r.serve.Video == ServeRedirect
+	}
+}
+
+//	@Summary		Issue signed playback url
+//	@Description	Get expiring url for the file, signed for its video
+//	@Tags			files
+//	@Param			filename	path		string	true	"name of the file"
+//	@Success		200			{object}	v1.fileRoutes.signed.response
+//	@Failure		404			{object}	problem.Problem	"Video couldn't be found"
+//	@Failure		500			{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/files/{filename}/signed [get]
+func (r *fileRoutes) signed(c echo.Context) error {
+	type response struct {
+		URL     string `json:"url"`
+		Expires int64  `json:"expires"`
+	}
+
+	filename := c.Param("filename")
+
+	// tokens are only issued to the callers, who could play the video themselves
+	if err := r.s.CheckPlayback(c.Request().Context(), filename); err != nil {
+		return err
+	}
+
+	var ip string
+	if r.bindIP {
+		ip = c.RealIP()
+	}
+
+	// token of one tenant isn't valid for the same named video of another
+	claims := r.signer.Claims(tenant.Qualify(c.Request().Context(), utils.VideoName(filename)), ip, playbackSession(c))
+
+	token, err := r.signer.Sign(claims)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(c.Request().URL.Path, "/signed") + "?token=" + token
+
+	return c.JSON(200, response{URL: url, Expires: claims.Expires})
+}
+
 //	@Summary		Delete file from storage
 //	@Description	Delete file by name
 //	@Tags			files
+//	@Security		Bearer
 //	@Param			filename	query		string	true	"name of the file"
 //	@Success		200			{object}	string
-//	@Failure		400			{object}	echo.HTTPError
-//	@Failure		404			{object}	echo.HTTPError	"Data couldn't be found"
-//	@Failure		500			{object}	echo.HTTPError	"Internal error"
+//	@Failure		400			{object}	problem.Problem
+//	@Failure		401			{object}	problem.Problem
+//	@Failure		403			{object}	problem.Problem	"Caller doesn't own the video"
+//	@Failure		404			{object}	problem.Problem	"Data couldn't be found"
+//	@Failure		429			{object}	problem.Problem	"Rate limit is exceeded"
+//	@Failure		500			{object}	problem.Problem	"Internal error"
 //	@Router			/api/v1/files/ [delete]
 func (r *fileRoutes) delete(c echo.Context) error {
 	filename := c.Param("filename")
@@ -108,7 +311,7 @@ func (r *fileRoutes) delete(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	if err := r.s.Remove(ctx, filename); err != nil {
-		return r.h.handle(err)
+		return err
 	}
 
 	return c.JSON(200, "Success")
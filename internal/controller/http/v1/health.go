@@ -0,0 +1,58 @@
+package v1
+
+import (
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/health"
+	"github.com/labstack/echo/v4"
+)
+
+type healthRoutes struct {
+	checker *health.Checker
+}
+
+func newHealthRoutes(g *echo.Group, checker *health.Checker) {
+	r := &healthRoutes{
+		checker: checker,
+	}
+
+	g.GET("/livez", r.live)
+	g.GET("/readyz", r.ready)
+	// kept for the older deployments
+	g.GET("/health", r.live)
+}
+
+type liveResponse struct {
+	Status string `json:"status"`
+}
+
+//	@Summary		Liveness probe
+//	@Description	Reports, that the process is up and serving requests, regardless of its dependencies
+//	@Tags			health
+//	@Produce		json
+//	@Success		200	{object}	v1.liveResponse
+//	@Router			/livez [get]
+func (r *healthRoutes) live(c echo.Context) error {
+	return c.JSON(200, liveResponse{Status: health.StatusOK})
+}
+
+//	@Summary		Readiness probe
+//	@Description	Checks the db (connection and schema version), the buckets (existence and writability), ffmpeg and ffprobe, free disk of the working directories and the upload backlog, each under its own timeout. The report is cached for a few seconds, errors and details of the checks are only shown to admins
+//	@Tags			health
+//	@Produce		json
+//	@Success		200	{object}	health.Report
+//	@Failure		503	{object}	health.Report	"Some of the checks failed"
+//	@Router			/readyz [get]
+func (r *healthRoutes) ready(c echo.Context) error {
+	report := r.checker.Run(c.Request().Context())
+
+	// probes are anonymous, while the details reveal hosts, paths and versions
+	if p, ok := auth.FromContext(c.Request().Context()); !ok || !p.Admin() {
+		report = report.Summary()
+	}
+
+	if !report.OK() {
+		return c.JSON(503, report)
+	}
+
+	return c.JSON(200, report)
+}
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"io"
+
+	"github.com/cutlery47/gostream/internal/drm"
+	"github.com/cutlery47/gostream/internal/sign"
+	"github.com/labstack/echo/v4"
+)
+
+type licenseRoutes struct {
+	l      drm.LicenseServer
+	signer *sign.Signer
+}
+
+func newLicenseRoutes(g *echo.Group, l drm.LicenseServer, signer *sign.Signer) {
+	r := &licenseRoutes{
+		l:      l,
+		signer: signer,
+	}
+
+	g.POST("", r.license)
+}
+
+//	@Summary		Acquire content license
+//	@Description	Exchange CDM license request for a license (EME ClearKey JSON), containing keys of the videos the caller may play
+//	@Tags			license
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		string	true	"license request generated by the CDM"
+//	@Param			token	query		string	false	"signed playback token of the video"
+//	@Success		200		{object}	string	"License"
+//	@Failure		400		{object}	problem.Problem
+//	@Failure		403		{object}	problem.Problem	"Invalid token"
+//	@Failure		404		{object}	problem.Problem	"Keys couldn't be found"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/license [post]
+func (r *licenseRoutes) license(c echo.Context) error {
+	challenge, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	// players of private videos carry the token, their playlists were signed with
+	if r.signer != nil && c.QueryParam("token") != "" {
+		claims, err := verifyToken(r.signer, c)
+		if err != nil {
+			return err
+		}
+		ctx = sign.NewContext(ctx, claims)
+	}
+
+	license, err := r.l.License(ctx, challenge)
+	if err != nil {
+		return err
+	}
+
+	return c.Blob(200, r.l.ContentType(), license)
+}
@@ -0,0 +1,10 @@
+package v1
+
+import "github.com/cutlery47/gostream/internal/controller/http/throttle"
+
+// rate limits of the v1 routes, other routes aren't limited
+var routeLimits = throttle.Routes{
+	"POST /api/v1/files/":            throttle.Upload,
+	"DELETE /api/v1/files/:filename": throttle.Delete,
+	"GET /api/v1/files/:filename":    throttle.Playback,
+}
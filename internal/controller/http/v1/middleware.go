@@ -1,6 +1,18 @@
 package v1
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/logging"
+	"github.com/cutlery47/gostream/internal/metrics"
+	"github.com/cutlery47/gostream/internal/sign"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/cutlery47/gostream/internal/tracing"
+	"github.com/cutlery47/gostream/internal/utils"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"go.uber.org/zap"
@@ -15,7 +27,7 @@ func requestLoggerMiddleware(reqLog *zap.Logger) echo.MiddlewareFunc {
 			LogURI:      true,
 			LogError:    true,
 			LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-				reqLog.Info(
+				logging.For(c.Request().Context(), reqLog).Info(
 					"",
 					zap.String("method", v.Method),
 					zap.Int("status", v.Status),
@@ -28,3 +40,186 @@ func requestLoggerMiddleware(reqLog *zap.Logger) echo.MiddlewareFunc {
 		},
 	)
 }
+
+// longest X-Request-ID, accepted from the clients
+const maxRequestIDLength = 128
+
+// takes X-Request-ID of the client or generates one, if it's missing or malformed
+// the id is echoed in the response and stored in the context, so that every log line of the request carries it
+func requestIDMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = uuid.NewString()
+			}
+
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			c.SetRequest(c.Request().WithContext(logging.WithRequestID(c.Request().Context(), id)))
+
+			return next(c)
+		}
+	}
+}
+
+// ids of the clients end up in the logs, so only the printable ones are accepted
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// records latency of the requests by route and status
+func metricsMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			// status is known only once the error is handled
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			metrics.HTTPRequests.
+				WithLabelValues(c.Request().Method, routeOf(c), strconv.Itoa(c.Response().Status)).
+				Observe(time.Since(start).Seconds())
+
+			return nil
+		}
+	}
+}
+
+// traces the requests, continuing the traces of the callers
+func tracingMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx, span := tracing.StartRequest(c.Request(), routeOf(c), c.RealIP())
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			tracing.EndRequest(span, c.Response().Status)
+
+			return nil
+		}
+	}
+}
+
+// path of the matched route
+// paths of the unknown routes would make up unbounded amount of metric labels and span names
+func routeOf(c echo.Context) string {
+	if c.Path() == "" {
+		return "unknown"
+	}
+	return c.Path()
+}
+
+// name of the cookie, identifying playback session
+const sessionCookie = "gostream_session"
+
+// rejects requests to files, which don't carry a valid signed token
+func signedURLMiddleware(s *sign.Signer) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, err := verifyToken(s, c)
+			if err != nil {
+				return err
+			}
+
+			// token is valid only for the files of a single video
+			// names are qualified, so the token is valid only within the tenant
+			if claims.Video != tenant.Qualify(c.Request().Context(), utils.VideoName(c.Param("filename"))) {
+				return sign.ErrTokenScope
+			}
+
+			// used for signing uris in the served playlists
+			c.Set("claims", claims)
+			// lets the players fetch files of private videos
+			c.SetRequest(c.Request().WithContext(sign.NewContext(c.Request().Context(), claims)))
+
+			return next(c)
+		}
+	}
+}
+
+// verifies the signed token of the request, along with the ip and the session it's bound to
+func verifyToken(s *sign.Signer, c echo.Context) (sign.Claims, error) {
+	claims, err := s.Verify(c.QueryParam("token"))
+	if err != nil {
+		return sign.Claims{}, err
+	}
+
+	if claims.IP != "" && claims.IP != c.RealIP() {
+		return sign.Claims{}, sign.ErrTokenScope
+	}
+
+	if claims.Session != "" && claims.Session != playbackSession(c) {
+		return sign.Claims{}, sign.ErrTokenScope
+	}
+
+	return claims, nil
+}
+
+func playbackSession(c echo.Context) string {
+	cookie, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// adds principal and tenant of the request to its context
+// requests without credentials stay anonymous, every request is allowed everything while auth is disabled
+// tenant is named by the request, unless its credentials belong to one
+func authMiddleware(a *auth.Authenticator, tenants *tenant.Resolver) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			requested, err := tenants.Resolve(c.Request())
+			if err != nil {
+				return err
+			}
+
+			p, authenticated := auth.Anonymous, true
+			if a.Enabled() {
+				header := c.Request().Header.Get(echo.HeaderAuthorization)
+				if header == "" {
+					authenticated = false
+				} else if p, err = a.Authenticate(ctx, header); err != nil {
+					return err
+				}
+			}
+
+			// credentials of a tenant are only valid within it
+			if authenticated && p.Tenant != "" {
+				if requested != "" && requested != p.Tenant {
+					return tenant.ErrTenantMismatch
+				}
+				requested = p.Tenant
+			}
+
+			if requested == "" {
+				requested = tenant.Default
+			}
+
+			ctx = tenant.NewContext(ctx, requested)
+			if authenticated {
+				ctx = auth.NewContext(ctx, p)
+			}
+
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/sign"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSignedURLMiddleware(t *testing.T) {
+	signer := sign.New("secret", time.Minute)
+
+	token := func(claims sign.Claims) string {
+		token, err := signer.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	const ip, session = "203.0.113.7", "session"
+
+	tests := map[string]struct {
+		token    string
+		filename string
+		tenant   string
+		ip       string
+		session  string
+		err      error
+	}{
+		"valid":           {token: token(signer.Claims("video", "", "")), filename: "video_0001.ts"},
+		"playlist":        {token: token(signer.Claims("video", "", "")), filename: "video.m3u8"},
+		"missing":         {filename: "video_0001.ts", err: sign.ErrMissingToken},
+		"expired":         {token: token(sign.Claims{Video: "video", Expires: time.Now().Add(-time.Second).Unix()}), filename: "video.m3u8", err: sign.ErrExpiredToken},
+		"other video":     {token: token(signer.Claims("video", "", "")), filename: "other_0001.ts", err: sign.ErrTokenScope},
+		"prefixed video":  {token: token(signer.Claims("video", "", "")), filename: "video_2_0001.ts", err: sign.ErrTokenScope},
+		"other tenant":    {token: token(signer.Claims("video", "", "")), filename: "video.m3u8", tenant: "other", err: sign.ErrTokenScope},
+		"tenant video":    {token: token(signer.Claims("other/video", "", "")), filename: "video.m3u8", tenant: "other"},
+		"default tenant":  {token: token(signer.Claims("other/video", "", "")), filename: "video.m3u8", err: sign.ErrTokenScope},
+		"bound ip":        {token: token(signer.Claims("video", ip, "")), filename: "video.m3u8", ip: ip},
+		"other ip":        {token: token(signer.Claims("video", ip, "")), filename: "video.m3u8", ip: "198.51.100.1", err: sign.ErrTokenScope},
+		"bound session":   {token: token(signer.Claims("video", "", session)), filename: "video.m3u8", session: session},
+		"other session":   {token: token(signer.Claims("video", "", session)), filename: "video.m3u8", session: "other", err: sign.ErrTokenScope},
+		"missing session": {token: token(signer.Claims("video", "", session)), filename: "video.m3u8", err: sign.ErrTokenScope},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := echo.New()
+			e.IPExtractor = echo.ExtractIPDirect()
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/files/"+tc.filename+"?token="+url.QueryEscape(tc.token), nil)
+			if tc.ip != "" {
+				req.RemoteAddr = tc.ip + ":1234"
+			}
+			if tc.session != "" {
+				req.AddCookie(&http.Cookie{Name: sessionCookie, Value: tc.session})
+			}
+			if tc.tenant != "" {
+				req = req.WithContext(tenant.NewContext(req.Context(), tc.tenant))
+			}
+
+			c := e.NewContext(req, httptest.NewRecorder())
+			c.SetParamNames("filename")
+			c.SetParamValues(tc.filename)
+
+			var claims sign.Claims
+			var granted bool
+
+			err := signedURLMiddleware(signer)(func(c echo.Context) error {
+				claims, granted = sign.FromContext(c.Request().Context())
+				return nil
+			})(c)
+
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got %v, want %v", err, tc.err)
+			}
+
+			if tc.err == nil && (!granted || claims.Video != tenant.Qualify(req.Context(), "video")) {
+				t.Errorf("claims of the token weren't passed to the handler: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	a, err := auth.New(config.AuthConfig{Enabled: true, Issuer: "gostream", Secret: "secret", TokenTTL: time.Minute, AdminKey: "admin-key"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants := tenant.NewResolver(config.TenantConfig{Header: "X-Tenant"})
+
+	token := func(id string) string {
+		token, _, err := a.IssueToken(auth.Principal{UserID: "alice", Role: storage.RoleUploader, Tenant: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+
+	tests := map[string]struct {
+		header    string
+		requested string
+		tenant    string
+		user      string
+		err       error
+	}{
+		"anonymous":            {tenant: tenant.Default},
+		"anonymous, requested": {requested: "team", tenant: "team"},
+		"tenant of the token":  {header: token("team"), tenant: "team", user: "alice"},
+		"same tenant":          {header: token("team"), requested: "team", tenant: "team", user: "alice"},
+		"other tenant":         {header: token("team"), requested: "other", err: tenant.ErrTenantMismatch},
+		"default token":        {header: token(tenant.Default), requested: "team", err: tenant.ErrTenantMismatch},
+		"admin, any tenant":    {header: "Bearer admin-key", requested: "other", tenant: "other", user: "admin"},
+		"invalid token":        {header: "Bearer a.b.c", err: auth.ErrInvalidCredentials},
+		"invalid tenant":       {requested: "Team", err: tenant.ErrInvalidTenant},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/videos", nil)
+			if tc.header != "" {
+				req.Header.Set(echo.HeaderAuthorization, tc.header)
+			}
+			if tc.requested != "" {
+				req.Header.Set("X-Tenant", tc.requested)
+			}
+
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			var id, user string
+			err := authMiddleware(a, tenants)(func(c echo.Context) error {
+				id = tenant.FromContext(c.Request().Context())
+				if p, ok := auth.FromContext(c.Request().Context()); ok {
+					user = p.UserID
+				}
+				return nil
+			})(c)
+
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("got %v, want %v", err, tc.err)
+			}
+
+			if tc.err == nil && (id != tc.tenant || user != tc.user) {
+				t.Errorf("got tenant %q and user %q, want %q and %q", id, user, tc.tenant, tc.user)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package v1
+
+import (
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/controller/http/policy"
+)
+
+// permissions, required by each of the v1 routes
+// ownership of the videos and users is checked by the services
+var routePolicy = policy.Policy{
+	"POST /api/v1/files/":                policy.Require(auth.ScopeVideosWrite),
+	"DELETE /api/v1/files/:filename":     policy.Require(auth.ScopeVideosDelete),
+	"GET /api/v1/files/:filename":        policy.Public,
+	"GET /api/v1/files/:filename/signed": policy.Require(auth.ScopeVideosRead),
+	"GET /api/v1/videos":                 policy.Require(auth.ScopeVideosRead),
+	"GET /api/v1/videos/:id":             policy.Require(auth.ScopeVideosRead),
+	"PATCH /api/v1/videos/:id":           policy.Require(auth.ScopeVideosWrite),
+	"POST /api/v1/streams":               policy.Require(auth.ScopeVideosWrite),
+	"GET /api/v1/streams/:name":          policy.Require(auth.ScopeVideosRead),
+	"GET /api/v1/streams/:name/stats":    policy.Require(auth.ScopeVideosRead),
+	"DELETE /api/v1/streams/:name":       policy.Require(auth.ScopeVideosDelete),
+	"POST /api/v1/license":               policy.Public,
+	"GET /api/v1/auth/me":                policy.Authenticated,
+	"POST /api/v1/auth/token":            policy.Authenticated,
+	"POST /api/v1/users":                 policy.Require(auth.ScopeAdmin),
+	"GET /api/v1/users/:id":              policy.Authenticated,
+	"POST /api/v1/users/:id/keys":        policy.Authenticated,
+	"GET /api/v1/users/:id/keys":         policy.Authenticated,
+	"DELETE /api/v1/users/:id/keys/:key": policy.Authenticated,
+	"GET /api/v1/users/:id/usage":        policy.Authenticated,
+}
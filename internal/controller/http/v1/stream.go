@@ -0,0 +1,156 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/cutlery47/gostream/internal/controller/http/problem"
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type streamRoutes struct {
+	s service.LiveService
+}
+
+func newStreamRoutes(g *echo.Group, s service.LiveService) {
+	r := &streamRoutes{
+		s: s,
+	}
+
+	g.POST("", r.create)
+	g.GET("/:name", r.get)
+	g.GET("/:name/stats", r.stats)
+	g.DELETE("/:name", r.delete)
+}
+
+type streamResponse struct {
+	Name string `json:"name"`
+	// only returned when the stream is created
+	Key       string    `json:"key,omitempty"`
+	State     string    `json:"state"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newStreamResponse(stream storage.LiveStream) streamResponse {
+	return streamResponse{
+		Name:      stream.Name,
+		State:     string(stream.State),
+		UpdatedAt: stream.UpdatedAt,
+	}
+}
+
+//	@Summary		Create live stream
+//	@Description	Create live stream and its publishing key
+//	@Tags			streams
+//	@Security		Bearer
+//	@Param			name	formData	string	true	"name of the stream"
+//	@Success		200		{object}	v1.streamResponse
+//	@Failure		400		{object}	problem.Problem
+//	@Failure		401		{object}	problem.Problem
+//	@Failure		409		{object}	problem.Problem	"Stream or video with the name already exists"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/streams [post]
+func (r *streamRoutes) create(c echo.Context) error {
+	name := c.FormValue("name")
+	if name == "" {
+		return problem.Param("name", "is required")
+	}
+
+	stream, err := r.s.CreateStream(c.Request().Context(), name)
+	if err != nil {
+		return err
+	}
+
+	res := newStreamResponse(stream)
+	res.Key = stream.Key
+
+	return c.JSON(200, res)
+}
+
+//	@Summary		Retrieve live stream
+//	@Description	Get live stream state by name
+//	@Tags			streams
+//	@Param			name	path		string	true	"name of the stream"
+//	@Success		200		{object}	v1.streamResponse
+//	@Failure		404		{object}	problem.Problem	"Stream couldn't be found"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/streams/{name} [get]
+func (r *streamRoutes) get(c echo.Context) error {
+	stream, err := r.s.GetStream(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, newStreamResponse(stream))
+}
+
+type statsResponse struct {
+	Protocol      string    `json:"protocol"`
+	Since         time.Time `json:"since"`
+	BytesReceived uint64    `json:"bytes_received"`
+	BitrateKbps   float64   `json:"bitrate_kbps"`
+	// only reported by srt
+	Connection *connStatsResponse `json:"connection,omitempty"`
+}
+
+type connStatsResponse struct {
+	RTTMs                float64 `json:"rtt_ms"`
+	PacketsReceived      uint64  `json:"packets_received"`
+	PacketsLost          uint64  `json:"packets_lost"`
+	PacketsRetransmitted uint64  `json:"packets_retransmitted"`
+	PacketsDropped       uint64  `json:"packets_dropped"`
+}
+
+//	@Summary		Retrieve live stream stats
+//	@Description	Get ingest connection stats of the live stream
+//	@Tags			streams
+//	@Param			name	path		string	true	"name of the stream"
+//	@Success		200		{object}	v1.statsResponse
+//	@Failure		404		{object}	problem.Problem	"Stream couldn't be found or is not live"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/streams/{name}/stats [get]
+func (r *streamRoutes) stats(c echo.Context) error {
+	stats, err := r.s.Stats(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return err
+	}
+
+	res := statsResponse{
+		Protocol:      stats.Protocol,
+		Since:         stats.Since,
+		BytesReceived: stats.BytesReceived,
+		BitrateKbps:   stats.Bitrate / 1000,
+	}
+
+	if conn := stats.Conn; conn != nil {
+		res.Connection = &connStatsResponse{
+			RTTMs:                float64(conn.RTT.Microseconds()) / 1000,
+			PacketsReceived:      conn.PacketsReceived,
+			PacketsLost:          conn.PacketsLost,
+			PacketsRetransmitted: conn.PacketsRetransmitted,
+			PacketsDropped:       conn.PacketsDropped,
+		}
+	}
+
+	return c.JSON(200, res)
+}
+
+//	@Summary		Delete live stream
+//	@Description	Delete live stream, which is not live at the moment
+//	@Tags			streams
+//	@Security		Bearer
+//	@Param			name	path		string	true	"name of the stream"
+//	@Success		200		{object}	string
+//	@Failure		401		{object}	problem.Problem
+//	@Failure		404		{object}	problem.Problem	"Stream couldn't be found"
+//	@Failure		409		{object}	problem.Problem	"Stream is live"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/streams/{name} [delete]
+func (r *streamRoutes) delete(c echo.Context) error {
+	if err := r.s.DeleteStream(c.Request().Context(), c.Param("name")); err != nil {
+		return err
+	}
+
+	return c.JSON(200, "Success")
+}
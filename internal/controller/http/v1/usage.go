@@ -0,0 +1,63 @@
+package v1
+
+import (
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/labstack/echo/v4"
+)
+
+type usageRoutes struct {
+	s service.Service
+}
+
+func newUsageRoutes(g *echo.Group, s service.Service) {
+	r := &usageRoutes{
+		s: s,
+	}
+
+	g.GET("/:id/usage", r.get)
+}
+
+type quotaUsage struct {
+	// stored bytes, including every derived asset
+	Bytes  int64 `json:"bytes"`
+	Videos int   `json:"videos"`
+	// omitted, if unlimited
+	MaxBytes  int64 `json:"max_bytes,omitempty"`
+	MaxVideos int   `json:"max_videos,omitempty"`
+}
+
+func newQuotaUsage(usage service.Usage) quotaUsage {
+	return quotaUsage{
+		Bytes:     usage.Bytes,
+		Videos:    usage.Videos,
+		MaxBytes:  usage.MaxBytes,
+		MaxVideos: usage.MaxVideos,
+	}
+}
+
+type usageResponse struct {
+	User   quotaUsage `json:"user"`
+	Tenant quotaUsage `json:"tenant"`
+}
+
+//	@Summary		Retrieve storage usage
+//	@Description	Get storage usage and quotas of the user ("me" for the caller) and of the whole tenant
+//	@Tags			users
+//	@Security		Bearer
+//	@Param			id	path		string	true	"user id"
+//	@Success		200	{object}	v1.usageResponse
+//	@Failure		401	{object}	problem.Problem
+//	@Failure		403	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/users/{id}/usage [get]
+func (r *usageRoutes) get(c echo.Context) error {
+	user, tenant, err := r.s.Usage(c.Request().Context(), userID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, usageResponse{
+		User:   newQuotaUsage(user),
+		Tenant: newQuotaUsage(tenant),
+	})
+}
@@ -0,0 +1,216 @@
+package v1
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/controller/http/problem"
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type userRoutes struct {
+	s service.UserService
+}
+
+func newUserRoutes(g *echo.Group, s service.UserService) {
+	r := &userRoutes{
+		s: s,
+	}
+
+	g.POST("", r.create)
+	g.GET("/:id", r.get)
+	g.POST("/:id/keys", r.createKey)
+	g.GET("/:id/keys", r.keys)
+	g.DELETE("/:id/keys/:key", r.deleteKey)
+}
+
+type userRequest struct {
+	Name string `json:"name"`
+	// viewer, uploader (default), editor or admin
+	Role storage.Role `json:"role"`
+}
+
+type userResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	Tenant    string    `json:"tenant"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newUserResponse(user storage.User) userResponse {
+	return userResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Role:      string(user.Role),
+		Tenant:    user.Tenant,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+type keyRequest struct {
+	Name string `json:"name"`
+	// subset of the user scopes, all of them if omitted
+	Scopes []auth.Scope `json:"scopes"`
+}
+
+type keyResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// only returned when the key is created
+	Key string `json:"key,omitempty"`
+	// omitted, if the key has all the user scopes
+	Scopes    []string  `json:"scopes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newKeyResponse(key storage.APIKey) keyResponse {
+	return keyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+}
+
+// "me" stands for the user of the request
+func userID(c echo.Context) string {
+	id := c.Param("id")
+	if id == "me" {
+		p, _ := auth.FromContext(c.Request().Context())
+		return p.UserID
+	}
+	return id
+}
+
+//	@Summary		Create user
+//	@Description	Create user within the tenant of the request, only admins are allowed to
+//	@Tags			users
+//	@Security		Bearer
+//	@Accept			json
+//	@Param			user	body		v1.userRequest	true	"new user"
+//	@Success		201		{object}	v1.userResponse
+//	@Failure		400		{object}	problem.Problem
+//	@Failure		401		{object}	problem.Problem
+//	@Failure		403		{object}	problem.Problem
+//	@Failure		409		{object}	problem.Problem	"Name is taken"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/users [post]
+func (r *userRoutes) create(c echo.Context) error {
+	var req userRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return problem.Param("body", err.Error())
+	}
+
+	if req.Role == "" {
+		req.Role = storage.RoleUploader
+	}
+
+	user, err := r.s.CreateUser(c.Request().Context(), req.Name, req.Role)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(201, newUserResponse(user))
+}
+
+//	@Summary		Retrieve user
+//	@Description	Get user by id ("me" for the caller)
+//	@Tags			users
+//	@Security		Bearer
+//	@Param			id	path		string	true	"user id"
+//	@Success		200	{object}	v1.userResponse
+//	@Failure		401	{object}	problem.Problem
+//	@Failure		403	{object}	problem.Problem
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/users/{id} [get]
+func (r *userRoutes) get(c echo.Context) error {
+	user, err := r.s.User(c.Request().Context(), userID(c))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, newUserResponse(user))
+}
+
+//	@Summary		Create api key
+//	@Description	Create api key of the user, the key is only returned once
+//	@Description	Key can be restricted to some of the user scopes (e.g. upload-only keys)
+//	@Tags			users
+//	@Security		Bearer
+//	@Accept			json
+//	@Param			id	path		string			true	"user id"
+//	@Param			key	body		v1.keyRequest	false	"key label and scopes"
+//	@Success		201	{object}	v1.keyResponse
+//	@Failure		400	{object}	problem.Problem
+//	@Failure		401	{object}	problem.Problem
+//	@Failure		403	{object}	problem.Problem
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/users/{id}/keys [post]
+func (r *userRoutes) createKey(c echo.Context) error {
+	var req keyRequest
+	if c.Request().ContentLength != 0 {
+		if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+			return problem.Param("body", err.Error())
+		}
+	}
+
+	key, record, err := r.s.CreateAPIKey(c.Request().Context(), userID(c), req.Name, req.Scopes)
+	if err != nil {
+		return err
+	}
+
+	res := newKeyResponse(record)
+	res.Key = key
+
+	return c.JSON(201, res)
+}
+
+//	@Summary		List api keys
+//	@Description	Get api keys of the user, without their secrets
+//	@Tags			users
+//	@Security		Bearer
+//	@Param			id	path		string	true	"user id"
+//	@Success		200	{array}		v1.keyResponse
+//	@Failure		401	{object}	problem.Problem
+//	@Failure		403	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/users/{id}/keys [get]
+func (r *userRoutes) keys(c echo.Context) error {
+	keys, err := r.s.APIKeys(c.Request().Context(), userID(c))
+	if err != nil {
+		return err
+	}
+
+	res := []keyResponse{}
+	for _, key := range keys {
+		res = append(res, newKeyResponse(key))
+	}
+
+	return c.JSON(200, res)
+}
+
+//	@Summary		Revoke api key
+//	@Description	Delete api key of the user
+//	@Tags			users
+//	@Security		Bearer
+//	@Param			id	path	string	true	"user id"
+//	@Param			key	path	string	true	"key id"
+//	@Success		204
+//	@Failure		401	{object}	problem.Problem
+//	@Failure		403	{object}	problem.Problem
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/users/{id}/keys/{key} [delete]
+func (r *userRoutes) deleteKey(c echo.Context) error {
+	if err := r.s.RemoveAPIKey(c.Request().Context(), userID(c), c.Param("key")); err != nil {
+		return err
+	}
+
+	return c.NoContent(204)
+}
@@ -0,0 +1,263 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/controller/http/problem"
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// limits of the video pages, shared with v2
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+type videoRoutes struct {
+	s service.Service
+}
+
+func newVideoRoutes(g *echo.Group, s service.Service) {
+	r := &videoRoutes{
+		s: s,
+	}
+
+	g.GET("", r.list)
+	g.GET("/:id", r.get)
+	g.PATCH("/:id", r.update)
+}
+
+type videoResponse struct {
+	// stable id, by which the video is addressed in v2
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Status      string            `json:"status"`
+	Visibility  string            `json:"visibility"`
+	Owner       string            `json:"owner,omitempty"`
+	Tags        []string          `json:"tags"`
+	Attributes  map[string]string `json:"attributes"`
+	Duration    float64           `json:"duration"`
+	Size        int64             `json:"size"`
+	UploadedAt  time.Time         `json:"uploaded_at"`
+}
+
+func newVideoResponse(video storage.Video) videoResponse {
+	tags := video.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	attributes := video.Attributes
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+
+	return videoResponse{
+		ID:          video.ID,
+		Name:        video.Name,
+		Title:       video.Title,
+		Description: video.Description,
+		Status:      string(video.Status),
+		Visibility:  string(video.Visibility),
+		Owner:       video.Owner,
+		Tags:        tags,
+		Attributes:  attributes,
+		Duration:    video.Duration,
+		Size:        video.Size,
+		UploadedAt:  video.UploadedAt,
+	}
+}
+
+// metadata changes, omitted fields are left as is
+type videoPatchRequest struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+	// merged into the existing attributes, null values remove them
+	Attributes map[string]*string  `json:"attributes"`
+	Visibility *storage.Visibility `json:"visibility"`
+}
+
+type videoPageResponse struct {
+	Videos []videoResponse `json:"videos"`
+	// empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+//	@Summary		List videos
+//	@Description	Get a page of videos, matching the filters
+//	@Tags			videos
+//	@Param			status			query		string	false	"processing, ready or failed"
+//	@Param			visibility		query		string	false	"public (default), unlisted or private (own videos only, unless admin)"
+//	@Param			tag				query		string	false	"tag of the video"
+//	@Param			owner			query		string	false	"owner of the video"
+//	@Param			min_duration	query		number	false	"least duration (seconds)"
+//	@Param			max_duration	query		number	false	"largest duration (seconds)"
+//	@Param			q				query		string	false	"words to search in the title"
+//	@Param			sort			query		string	false	"uploaded_at (default), title or duration"
+//	@Param			order			query		string	false	"asc or desc (default)"
+//	@Param			limit			query		int		false	"page size (20 by default, 100 at most)"
+//	@Param			cursor			query		string	false	"cursor of the next page"
+//	@Success		200				{object}	v1.videoPageResponse
+//	@Failure		400				{object}	problem.Problem
+//	@Failure		500				{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/videos [get]
+func (r *videoRoutes) list(c echo.Context) error {
+	query := storage.VideoQuery{
+		Status:     storage.VideoStatus(c.QueryParam("status")),
+		Visibility: storage.Visibility(c.QueryParam("visibility")),
+		Tag:        c.QueryParam("tag"),
+		Owner:      c.QueryParam("owner"),
+		Search:     c.QueryParam("q"),
+		Sort:       c.QueryParam("sort"),
+		Desc:       true,
+		Limit:      DefaultPageSize,
+		Cursor:     c.QueryParam("cursor"),
+	}
+
+	// unlisted and private videos are only listed on demand
+	if query.Visibility == "" {
+		query.Visibility = storage.VisibilityPublic
+	}
+
+	if query.Sort == "" {
+		query.Sort = storage.SortUploaded
+	}
+
+	switch c.QueryParam("order") {
+	case "", "desc":
+	case "asc":
+		query.Desc = false
+	default:
+		return problem.Param("order", "should be asc or desc")
+	}
+
+	var err error
+	if limit := c.QueryParam("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > MaxPageSize {
+			return problem.Param("limit", fmt.Sprintf("should be 1 to %v", MaxPageSize))
+		}
+	}
+
+	if min := c.QueryParam("min_duration"); min != "" {
+		if query.MinDuration, err = strconv.ParseFloat(min, 64); err != nil {
+			return problem.Param("min_duration", "should be a number")
+		}
+	}
+
+	if max := c.QueryParam("max_duration"); max != "" {
+		if query.MaxDuration, err = strconv.ParseFloat(max, 64); err != nil {
+			return problem.Param("max_duration", "should be a number")
+		}
+	}
+
+	page, err := r.s.ListVideos(c.Request().Context(), query)
+	if err != nil {
+		return err
+	}
+
+	res := videoPageResponse{
+		Videos:     []videoResponse{},
+		NextCursor: page.NextCursor,
+	}
+	for _, video := range page.Videos {
+		res.Videos = append(res.Videos, newVideoResponse(video))
+	}
+
+	return c.JSON(200, res)
+}
+
+//	@Summary		Retrieve video
+//	@Description	Get video metadata, ETag header holds its version
+//	@Tags			videos
+//	@Param			id	path		string	true	"name of the video"
+//	@Success		200	{object}	v1.videoResponse
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/videos/{id} [get]
+func (r *videoRoutes) get(c echo.Context) error {
+	video, err := r.s.Video(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("ETag", ETag(video.Version))
+	return c.JSON(200, newVideoResponse(video))
+}
+
+//	@Summary		Edit video metadata
+//	@Description	Update title, description, tags, attributes or visibility of the video
+//	@Description	If-Match header makes the update fail, once the video was modified since it was fetched
+//	@Tags			videos
+//	@Security		Bearer
+//	@Accept			json
+//	@Param			id			path		string					true	"name of the video"
+//	@Param			If-Match	header		string					false	"ETag of the fetched video"
+//	@Param			metadata	body		v1.videoPatchRequest	true	"changed metadata"
+//	@Success		200			{object}	v1.videoResponse
+//	@Failure		400			{object}	problem.Problem
+//	@Failure		401			{object}	problem.Problem
+//	@Failure		403			{object}	problem.Problem	"Caller doesn't own the video"
+//	@Failure		404			{object}	problem.Problem
+//	@Failure		412			{object}	problem.Problem	"Video was modified"
+//	@Failure		500			{object}	problem.Problem	"Internal error"
+//	@Router			/api/v1/videos/{id} [patch]
+func (r *videoRoutes) update(c echo.Context) error {
+	version, err := IfMatch(c.Request().Header.Get("If-Match"))
+	if err != nil {
+		return err
+	}
+
+	var req videoPatchRequest
+
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return problem.Param("body", err.Error())
+	}
+
+	patch := service.VideoPatch{
+		Title:       req.Title,
+		Description: req.Description,
+		Tags:        req.Tags,
+		Attributes:  req.Attributes,
+		Visibility:  req.Visibility,
+	}
+
+	video, err := r.s.UpdateVideo(c.Request().Context(), c.Param("id"), patch, version)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("ETag", ETag(video.Version))
+	return c.JSON(200, newVideoResponse(video))
+}
+
+// entity tag of the video version
+func ETag(version int) string {
+	return fmt.Sprintf("%q", strconv.Itoa(version))
+}
+
+// returns the version, the client expects, 0 matches any
+func IfMatch(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || version < 1 {
+		// weak or foreign tags never match
+		return 0, service.ErrVideoModified
+	}
+
+	return version, nil
+}
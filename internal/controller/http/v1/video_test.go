@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cutlery47/gostream/internal/service"
+)
+
+func TestETag(t *testing.T) {
+	// the tag is strong, quoted the way clients send it back
+	if got := ETag(3); got != `"3"` {
+		t.Errorf("got %v", got)
+	}
+
+	version, err := IfMatch(ETag(3))
+	if err != nil || version != 3 {
+		t.Errorf("round trip: got %v, %v", version, err)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	cases := map[string]struct {
+		header  string
+		version int
+		err     error
+	}{
+		// no precondition, any version matches
+		"absent":   {"", 0, nil},
+		"wildcard": {"*", 0, nil},
+		"spaces":   {` "7" `, 7, nil},
+		"unquoted": {"7", 7, nil},
+		// weak tags are never produced, so they can't match
+		"weak":     {`W/"7"`, 0, service.ErrVideoModified},
+		"foreign":  {`"abc"`, 0, service.ErrVideoModified},
+		"zero":     {`"0"`, 0, service.ErrVideoModified},
+		"negative": {`"-1"`, 0, service.ErrVideoModified},
+		"list":     {`"6", "7"`, 0, service.ErrVideoModified},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			version, err := IfMatch(tc.header)
+			if version != tc.version || !errors.Is(err, tc.err) {
+				t.Errorf("got %v, %v, want %v, %v", version, err, tc.version, tc.err)
+			}
+		})
+	}
+}
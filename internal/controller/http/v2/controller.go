@@ -0,0 +1,49 @@
+// Package v2 exposes the api around stable video ids.
+//
+// Unlike v1, which addresses everything by user-supplied file names, videos
+// uploaded through v2 are stored under generated uuids. Videos uploaded
+// through v1 get ids as well, so that both versions serve the same videos.
+package v2
+
+import (
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/controller/http/throttle"
+	"github.com/cutlery47/gostream/internal/logging"
+	"github.com/cutlery47/gostream/internal/playlist"
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/sign"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.uber.org/zap"
+)
+
+func NewController(e *echo.Echo, s service.Service, throttler *throttle.Throttle, signer *sign.Signer, bindIP bool, serve config.ServeConfig, renderer *playlist.Renderer, reqLog *zap.Logger) {
+	v2 := e.Group("/api/v2", requestLoggerMiddleware(reqLog), routePolicy.Middleware(), routeLimits.Middleware(throttler))
+	{
+		newVideoRoutes(v2.Group("/videos"), s, signer, bindIP, serve, renderer)
+		newUploadRoutes(v2.Group("/uploads"), s)
+	}
+}
+
+func requestLoggerMiddleware(reqLog *zap.Logger) echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(
+		middleware.RequestLoggerConfig{
+			LogMethod:   true,
+			LogStatus:   true,
+			LogRemoteIP: true,
+			LogURI:      true,
+			LogError:    true,
+			LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+				logging.For(c.Request().Context(), reqLog).Info(
+					"",
+					zap.String("method", v.Method),
+					zap.Int("status", v.Status),
+					zap.String("IP", v.RemoteIP),
+					zap.String("URI", v.URI),
+					zap.Error(v.Error),
+				)
+				return nil
+			},
+		},
+	)
+}
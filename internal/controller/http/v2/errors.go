@@ -0,0 +1,5 @@
+package v2
+
+import "github.com/cutlery47/gostream/internal/errs"
+
+var errUnsupportedFile = errs.New(errs.Unsupported, "unsupported_file", "only mp4 videos can be uploaded")
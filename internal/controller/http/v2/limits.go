@@ -0,0 +1,14 @@
+package v2
+
+import "github.com/cutlery47/gostream/internal/controller/http/throttle"
+
+// rate limits of the v2 routes, other routes aren't limited
+var routeLimits = throttle.Routes{
+	"POST /api/v2/videos":                        throttle.Upload,
+	"POST /api/v2/uploads":                       throttle.Upload,
+	"DELETE /api/v2/videos/:id":                  throttle.Delete,
+	"GET /api/v2/videos/:id/playlists/:playlist": throttle.Playback,
+	"GET /api/v2/videos/:id/segments/:segment":   throttle.Playback,
+	"GET /api/v2/videos/:id/source":              throttle.Playback,
+	"GET /api/v2/videos/:id/captions/:lang":      throttle.Playback,
+}
@@ -0,0 +1,550 @@
+package v2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	v1 "github.com/cutlery47/gostream/internal/controller/http/v1"
+	"github.com/cutlery47/gostream/internal/playlist"
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/sign"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/cutlery47/gostream/internal/utils"
+	"github.com/cutlery47/gostream/pkg/m3u8"
+	"github.com/labstack/echo/v4"
+)
+
+// name of the cookie, identifying playback session (shared with v1)
+const sessionCookie = "gostream_session"
+
+// names of the served playlists
+const (
+	masterPlaylist = "master.m3u8"
+	// the only rendition, packaged on upload
+	sourceRendition = "source"
+)
+
+type renditionResponse struct {
+	Name string `json:"name"`
+	// bits per second
+	Bandwidth int64  `json:"bandwidth"`
+	Playlist  string `json:"playlist"`
+}
+
+type segmentResponse struct {
+	URI string `json:"uri"`
+	// seconds
+	Duration float64 `json:"duration"`
+}
+
+type captionsResponse struct {
+	Language string `json:"language"`
+	URI      string `json:"uri"`
+	Playlist string `json:"playlist"`
+}
+
+type playbackResponse struct {
+	// master playlist, signed if required
+	URL string `json:"url"`
+	// unix time, 0 if the url doesn't expire
+	Expires int64 `json:"expires"`
+}
+
+//	@Summary		List renditions
+//	@Description	Get renditions of the video along with their playlists
+//	@Tags			v2 playback
+//	@Param			id	path		string	true	"video id"
+//	@Success		200	{array}		v2.renditionResponse
+//	@Failure		404	{object}	problem.Problem
+//	@Router			/api/v2/videos/{id}/renditions [get]
+func (r *videoRoutes) renditions(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+
+	return c.JSON(200, []renditionResponse{{
+		Name:      sourceRendition,
+		Bandwidth: bandwidth(video),
+		Playlist:  videoPath(video) + "/playlists/" + sourceRendition + ".m3u8",
+	}})
+}
+
+//	@Summary		List segments
+//	@Description	Get media segments of the source rendition
+//	@Tags			v2 playback
+//	@Param			id	path		string	true	"video id"
+//	@Success		200	{array}		v2.segmentResponse
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id}/segments [get]
+func (r *videoRoutes) segments(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+
+	segments, err := r.s.Segments(c.Request().Context(), video.Name)
+	if err != nil {
+		return err
+	}
+
+	res := []segmentResponse{}
+	for _, segment := range segments {
+		res = append(res, segmentResponse{
+			URI:      videoPath(video) + "/segments/" + path.Base(segment.URI),
+			Duration: segment.Duration,
+		})
+	}
+
+	return c.JSON(200, res)
+}
+
+//	@Summary		Issue playback url
+//	@Description	Get url of the master playlist, signed if playback urls are signed
+//	@Tags			v2 playback
+//	@Param			id	path		string	true	"video id"
+//	@Success		200	{object}	v2.playbackResponse
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id}/playback [get]
+func (r *videoRoutes) playback(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+	res := playbackResponse{URL: videoPath(video) + "/playlists/" + masterPlaylist}
+
+	if r.signer != nil {
+		var ip string
+		if r.bindIP {
+			ip = c.RealIP()
+		}
+
+		claims := r.signer.Claims(tenant.Qualify(c.Request().Context(), video.Name), ip, playbackSession(c))
+
+		token, err := r.signer.Sign(claims)
+		if err != nil {
+			return err
+		}
+
+		res.URL += "?token=" + token
+		res.Expires = claims.Expires
+	}
+
+	return c.JSON(200, res)
+}
+
+//	@Summary		Retrieve playlist
+//	@Description	Get master playlist or media playlist of a rendition
+//	@Tags			v2 playback
+//	@Param			id			path		string	true	"video id"
+//	@Param			playlist	path		string	true	"master.m3u8 or <rendition>.m3u8"
+//	@Param			token		query		string	false	"signed playback token"
+//	@Param			codecs		query		string	false	"comma separated codecs, supported by the client"
+//	@Success		200			{object}	string	"Playlist"
+//	@Failure		403			{object}	problem.Problem	"Token is missing, invalid or expired"
+//	@Failure		404			{object}	problem.Problem
+//	@Failure		429			{object}	problem.Problem	"Rate limit is exceeded"
+//	@Failure		500			{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id}/playlists/{playlist} [get]
+func (r *videoRoutes) playlist(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+	opts := r.playlistOptions(c)
+
+	switch c.Param("playlist") {
+	case masterPlaylist:
+		return c.Blob(200, "application/vnd.apple.mpegurl", r.renderer.Render(master(video), opts))
+	case sourceRendition + ".m3u8":
+		// absolute, so that the segments survive resolution against the renderer base url
+		opts.Prefix = videoPath(video) + "/segments/"
+
+		blob, err := r.s.ServePlaylist(c.Request().Context(), video.Name+".m3u8", opts, nil)
+		if err != nil {
+			return err
+		}
+
+		return c.Blob(200, "application/vnd.apple.mpegurl", blob)
+	default:
+		return service.ErrManifestNotFound
+	}
+}
+
+//	@Summary		Retrieve segment
+//	@Description	Get media segment of the video
+//	@Tags			v2 playback
+//	@Param			id		path		string	true	"video id"
+//	@Param			segment	path		string	true	"name of the segment"
+//	@Param			token	query		string	false	"signed playback token"
+//	@Success		200		{object}	string	"Binary segment"
+//	@Success		302		{string}	string	"Redirect to presigned object storage url"
+//	@Failure		403		{object}	problem.Problem	"Token is missing, invalid or expired"
+//	@Failure		404		{object}	problem.Problem
+//	@Failure		429		{object}	problem.Problem	"Rate limit is exceeded"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id}/segments/{segment} [get]
+func (r *videoRoutes) segment(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+	segment := c.Param("segment")
+	ctx := c.Request().Context()
+
+	// only the media segments of the requested video, other files have their own routes and access rules
+	if utils.VideoName(segment) != video.Name || !isSegment(segment) {
+		return service.ErrChunkNotFound
+	}
+
+	if r.serve.Chunk == v1.ServeRedirect {
+		url, err := r.s.ServeURL(ctx, segment)
+		if err == nil {
+			return c.Redirect(302, url)
+		}
+
+		if !errors.Is(err, service.ErrNoRedirect) {
+			return err
+		}
+	}
+
+	file, err := r.s.Serve(ctx, segment)
+	if err != nil {
+		return err
+	}
+
+	return r.stream(c, contentType(segment), file)
+}
+
+//	@Summary		Retrieve source
+//	@Description	Get originally uploaded video file
+//	@Tags			v2 playback
+//	@Param			id		path		string	true	"video id"
+//	@Param			Range	header		string	false	"byte range of the file (e.g. bytes=1024-)"
+//	@Success		200		{object}	string	"Binary video"
+//	@Success		206		{object}	string	"Requested range of the video"
+//	@Success		302		{string}	string	"Redirect to presigned object storage url"
+//	@Failure		404		{object}	problem.Problem
+//	@Failure		416		{object}	string	"Range can't be satisfied"
+//	@Failure		429		{object}	problem.Problem	"Rate limit is exceeded"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id}/source [get]
+func (r *videoRoutes) source(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+	ctx := c.Request().Context()
+
+	// object storage handles range requests, so downloads could be resumed
+	if r.serve.Video == v1.ServeRedirect {
+		url, err := r.s.ServeURL(ctx, video.Name)
+		if err == nil {
+			return c.Redirect(302, url)
+		}
+
+		if !errors.Is(err, service.ErrNoRedirect) {
+			return err
+		}
+	}
+
+	file, err := r.s.Serve(ctx, video.Name)
+	if err != nil {
+		return err
+	}
+
+	header := c.Response().Header()
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", video.ID+".mp4"))
+
+	// local files and objects are seekable, so the downloads could be resumed with range requests
+	if content, ok := file.(io.ReadSeeker); ok {
+		defer file.Close()
+		header.Set(echo.HeaderContentType, "video/mp4")
+		http.ServeContent(c.Response(), c.Request(), video.ID+".mp4", video.UploadedAt, content)
+		return nil
+	}
+
+	if video.Size > 0 {
+		header.Set("Content-Length", strconv.FormatInt(video.Size, 10))
+	}
+
+	return r.stream(c, "video/mp4", file)
+}
+
+//	@Summary		Retrieve thumbnail
+//	@Description	Get jpeg thumbnail of the video
+//	@Tags			v2 playback
+//	@Param			id	path		string	true	"video id"
+//	@Success		200	{object}	string	"Jpeg image"
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id}/thumbnail [get]
+func (r *videoRoutes) thumbnail(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+
+	file, err := r.s.Thumbnail(c.Request().Context(), video.Name)
+	if err != nil {
+		return err
+	}
+
+	return r.stream(c, "image/jpeg", file)
+}
+
+//	@Summary		List captions
+//	@Description	Get captions of the video in every uploaded language
+//	@Tags			v2 captions
+//	@Param			id	path		string	true	"video id"
+//	@Success		200	{array}		v2.captionsResponse
+//	@Failure		404	{object}	problem.Problem
+//	@Router			/api/v2/videos/{id}/captions [get]
+func (r *videoRoutes) captions(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+
+	res := []captionsResponse{}
+	for _, lang := range video.Captions {
+		res = append(res, captionsResponse{
+			Language: lang,
+			URI:      videoPath(video) + "/captions/" + lang + ".vtt",
+			Playlist: videoPath(video) + "/captions/" + lang + ".m3u8",
+		})
+	}
+
+	return c.JSON(200, res)
+}
+
+//	@Summary		Retrieve captions
+//	@Description	Get webvtt captions or their single-segment playlist
+//	@Tags			v2 captions
+//	@Param			id		path		string	true	"video id"
+//	@Param			lang	path		string	true	"<language>.vtt or <language>.m3u8"
+//	@Param			token	query		string	false	"signed playback token"
+//	@Success		200		{object}	string	"Captions"
+//	@Failure		403		{object}	problem.Problem	"Token is missing, invalid or expired"
+//	@Failure		404		{object}	problem.Problem
+//	@Failure		429		{object}	problem.Problem	"Rate limit is exceeded"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id}/captions/{lang} [get]
+func (r *videoRoutes) captionsFile(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+	// routes of the same path share the param name
+	file := c.Param("lang")
+	lang := strings.TrimSuffix(file, path.Ext(file))
+
+	switch path.Ext(file) {
+	case ".m3u8":
+		pl, ok := captionsPlaylist(video, lang)
+		if !ok {
+			return service.ErrCaptionsNotFound
+		}
+
+		return c.Blob(200, "application/vnd.apple.mpegurl", r.renderer.Render(pl, r.playlistOptions(c)))
+	case ".vtt":
+		captions, err := r.s.Captions(c.Request().Context(), video.Name, lang)
+		if err != nil {
+			return err
+		}
+
+		return r.stream(c, "text/vtt", captions)
+	default:
+		return service.ErrCaptionsNotFound
+	}
+}
+
+//	@Summary		Upload captions
+//	@Description	Store webvtt captions of the video, replacing the ones in the same language
+//	@Tags			v2 captions
+//	@Security		Bearer
+//	@Accept			text/vtt
+//	@Param			id			path		string	true	"video id"
+//	@Param			lang		path		string	true	"bcp 47 language tag"
+//	@Param			captions	body		string	true	"webvtt file"
+//	@Success		200			{object}	v2.videoResponse
+//	@Failure		400			{object}	problem.Problem
+//	@Failure		401			{object}	problem.Problem
+//	@Failure		403			{object}	problem.Problem	"Caller doesn't own the video"
+//	@Failure		404			{object}	problem.Problem
+//	@Failure		500			{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id}/captions/{lang} [put]
+func (r *videoRoutes) putCaptions(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+
+	video, err := r.s.PutCaptions(c.Request().Context(), video.Name, c.Param("lang"), c.Request().Body)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("ETag", v1.ETag(video.Version))
+	return c.JSON(200, newVideoResponse(video))
+}
+
+//	@Summary		Delete captions
+//	@Description	Delete captions of the video in the given language
+//	@Tags			v2 captions
+//	@Security		Bearer
+//	@Param			id		path		string	true	"video id"
+//	@Param			lang	path		string	true	"bcp 47 language tag"
+//	@Success		200		{object}	v2.videoResponse
+//	@Failure		401		{object}	problem.Problem
+//	@Failure		403		{object}	problem.Problem	"Caller doesn't own the video"
+//	@Failure		404		{object}	problem.Problem
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id}/captions/{lang} [delete]
+func (r *videoRoutes) deleteCaptions(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+
+	video, err := r.s.RemoveCaptions(c.Request().Context(), video.Name, c.Param("lang"))
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("ETag", v1.ETag(video.Version))
+	return c.JSON(200, newVideoResponse(video))
+}
+
+// verifies playback token of the request, if there is one
+// verified claims let the players fetch private videos, so the token is checked before the video is resolved
+func (r *videoRoutes) tokenMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := c.QueryParam("token")
+		if r.signer == nil || token == "" {
+			return next(c)
+		}
+
+		claims, err := r.signer.Verify(token)
+		if err != nil {
+			return err
+		}
+
+		if claims.IP != "" && claims.IP != c.RealIP() {
+			return sign.ErrTokenScope
+		}
+
+		if claims.Session != "" && claims.Session != playbackSession(c) {
+			return sign.ErrTokenScope
+		}
+
+		// used for signing uris in the served playlists
+		c.Set("claims", claims)
+		c.SetRequest(c.Request().WithContext(sign.NewContext(c.Request().Context(), claims)))
+
+		return next(c)
+	}
+}
+
+// rejects requests to playback files, which don't carry a valid signed token
+func (r *videoRoutes) signedMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if r.signer == nil {
+			return next(c)
+		}
+
+		claims, ok := c.Get("claims").(sign.Claims)
+		if !ok {
+			return sign.ErrMissingToken
+		}
+
+		// token is valid only for the files of a single video
+		if claims.Video != tenant.Qualify(c.Request().Context(), c.Get("video").(storage.Video).Name) {
+			return sign.ErrTokenScope
+		}
+
+		return next(c)
+	}
+}
+
+func (r *videoRoutes) playlistOptions(c echo.Context) playlist.Options {
+	opts := playlist.Options{}
+
+	// every uri in the playlist should carry the token as well
+	if token := c.QueryParam("token"); token != "" {
+		if _, ok := c.Get("claims").(sign.Claims); ok {
+			opts.Query = url.Values{"token": {token}}
+		}
+	}
+
+	if codecs := c.QueryParam("codecs"); codecs != "" {
+		opts.Codecs = strings.Split(codecs, ",")
+	}
+
+	return opts
+}
+
+func (r *videoRoutes) stream(c echo.Context, contentType string, file io.ReadCloser) error {
+	defer file.Close()
+	return c.Stream(200, contentType, file)
+}
+
+// master playlist, listing the rendition and the captions
+// uris are absolute paths, so that they survive resolution against the renderer base url
+func master(video storage.Video) []byte {
+	variant := m3u8.Variant{
+		URI:       videoPath(video) + "/playlists/" + sourceRendition + ".m3u8",
+		Bandwidth: bandwidth(video),
+	}
+
+	pl := &m3u8.MasterPlaylist{Version: 3}
+	for i, lang := range video.Captions {
+		pl.Media = append(pl.Media, m3u8.Media{
+			Type:       "SUBTITLES",
+			GroupID:    "subs",
+			Language:   lang,
+			Name:       lang,
+			URI:        videoPath(video) + "/captions/" + lang + ".m3u8",
+			Default:    i == 0,
+			Autoselect: true,
+		})
+		variant.Subtitles = "subs"
+	}
+	pl.Variants = []m3u8.Variant{variant}
+
+	return pl.Encode()
+}
+
+// playlist of a single segment, spanning the whole video
+func captionsPlaylist(video storage.Video, lang string) ([]byte, bool) {
+	if !slices.Contains(video.Captions, lang) {
+		return nil, false
+	}
+
+	pl := &m3u8.MediaPlaylist{
+		Version:        3,
+		TargetDuration: int(math.Ceil(video.Duration)),
+		PlaylistType:   "VOD",
+		Segments:       []m3u8.Segment{{URI: videoPath(video) + "/captions/" + lang + ".vtt", Duration: video.Duration}},
+		EndList:        true,
+	}
+
+	return pl.Encode(), true
+}
+
+// average bitrate of the source video
+func bandwidth(video storage.Video) int64 {
+	if video.Duration <= 0 {
+		return 0
+	}
+	return int64(float64(video.Size) * 8 / video.Duration)
+}
+
+// media segments, including the fmp4 initialization segment
+func isSegment(filename string) bool {
+	switch path.Ext(filename) {
+	case ".ts", ".m4s":
+		return true
+	default:
+		return false
+	}
+}
+
+func contentType(filename string) string {
+	switch path.Ext(filename) {
+	case ".ts":
+		return "video/mp2t"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".mp4":
+		return "video/mp4"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func playbackSession(c echo.Context) string {
+	cookie, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
@@ -0,0 +1,31 @@
+package v2
+
+import (
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/controller/http/policy"
+)
+
+// permissions, required by each of the v2 routes
+// ownership of the videos is checked by the service
+var routePolicy = policy.Policy{
+	"POST /api/v2/videos":                        policy.Require(auth.ScopeVideosWrite),
+	"GET /api/v2/videos":                         policy.Require(auth.ScopeVideosRead),
+	"GET /api/v2/videos/:id":                     policy.Require(auth.ScopeVideosRead),
+	"PATCH /api/v2/videos/:id":                   policy.Require(auth.ScopeVideosWrite),
+	"DELETE /api/v2/videos/:id":                  policy.Require(auth.ScopeVideosDelete),
+	"GET /api/v2/videos/:id/renditions":          policy.Require(auth.ScopeVideosRead),
+	"GET /api/v2/videos/:id/segments":            policy.Require(auth.ScopeVideosRead),
+	"GET /api/v2/videos/:id/thumbnail":           policy.Require(auth.ScopeVideosRead),
+	"GET /api/v2/videos/:id/source":              policy.Require(auth.ScopeVideosRead),
+	"GET /api/v2/videos/:id/captions":            policy.Require(auth.ScopeVideosRead),
+	"PUT /api/v2/videos/:id/captions/:lang":      policy.Require(auth.ScopeVideosWrite),
+	"DELETE /api/v2/videos/:id/captions/:lang":   policy.Require(auth.ScopeVideosWrite),
+	"GET /api/v2/videos/:id/playback":            policy.Require(auth.ScopeVideosRead),
+	"GET /api/v2/videos/:id/playlists/:playlist": policy.Public,
+	"GET /api/v2/videos/:id/segments/:segment":   policy.Public,
+	"GET /api/v2/videos/:id/captions/:lang":      policy.Public,
+	"POST /api/v2/uploads":                       policy.Require(auth.ScopeVideosWrite),
+	"GET /api/v2/uploads/:id":                    policy.Require(auth.ScopeVideosWrite),
+	"PATCH /api/v2/uploads/:id":                  policy.Require(auth.ScopeVideosWrite),
+	"DELETE /api/v2/uploads/:id":                 policy.Require(auth.ScopeVideosWrite),
+}
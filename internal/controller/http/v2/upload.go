@@ -0,0 +1,188 @@
+package v2
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/cutlery47/gostream/internal/controller/http/problem"
+	v1 "github.com/cutlery47/gostream/internal/controller/http/v1"
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// header, carrying the offset of the chunk (and of the received data in the responses)
+const uploadOffsetHeader = "Upload-Offset"
+
+type uploadRoutes struct {
+	s service.Service
+}
+
+func newUploadRoutes(g *echo.Group, s service.Service) {
+	r := &uploadRoutes{
+		s: s,
+	}
+
+	g.POST("", r.create)
+	g.GET("/:id", r.get)
+	g.PATCH("/:id", r.append)
+	g.DELETE("/:id", r.cancel)
+}
+
+type uploadRequest struct {
+	// name of the mp4 file
+	Filename string `json:"filename"`
+	// size of the whole file (bytes)
+	Size        int64              `json:"size"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	Tags        []string           `json:"tags"`
+	Visibility  storage.Visibility `json:"visibility"`
+	Attributes  map[string]string  `json:"attributes"`
+}
+
+type uploadResponse struct {
+	ID string `json:"id"`
+	// bytes received so far
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+	// processed video, once the whole file is received
+	Video *videoResponse `json:"video,omitempty"`
+}
+
+func newUploadResponse(c echo.Context, session service.UploadSession, video *storage.Video) uploadResponse {
+	c.Response().Header().Set(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+
+	res := uploadResponse{ID: session.ID, Offset: session.Offset, Size: session.Size}
+	if video != nil {
+		v := newVideoResponse(*video)
+		res.Video = &v
+	}
+	return res
+}
+
+//	@Summary		Start resumable upload
+//	@Description	Create upload, which receives mp4 video in chunks, so that interrupted uploads could be resumed
+//	@Tags			v2 uploads
+//	@Security		Bearer
+//	@Accept			json
+//	@Param			upload	body		v2.uploadRequest	true	"file and metadata of the video"
+//	@Success		201		{object}	v2.uploadResponse
+//	@Failure		400		{object}	problem.Problem
+//	@Failure		401		{object}	problem.Problem
+//	@Failure		415		{object}	problem.Problem	"Not an mp4 video"
+//	@Failure		429		{object}	problem.Problem	"Rate limit is exceeded"
+//	@Failure		500		{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/uploads [post]
+func (r *uploadRoutes) create(c echo.Context) error {
+	var req uploadRequest
+
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return problem.Param("body", err.Error())
+	}
+
+	if !strings.HasSuffix(req.Filename, ".mp4") {
+		return errUnsupportedFile
+	}
+	if req.Size <= 0 {
+		return problem.Param("size", "should be a positive number of bytes")
+	}
+
+	meta := service.UploadMeta{
+		Title:       req.Title,
+		Description: req.Description,
+		Tags:        req.Tags,
+		Attributes:  req.Attributes,
+		Visibility:  req.Visibility,
+	}
+	if meta.Title == "" {
+		meta.Title = strings.TrimSuffix(req.Filename, ".mp4")
+	}
+
+	session, err := r.s.CreateUpload(c.Request().Context(), req.Filename, req.Size, meta)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", "/api/v2/uploads/"+session.ID)
+	return c.JSON(201, newUploadResponse(c, session, nil))
+}
+
+//	@Summary		Retrieve upload
+//	@Description	Get the amount of received data, from which the upload should be resumed
+//	@Tags			v2 uploads
+//	@Security		Bearer
+//	@Param			id	path		string	true	"upload id"
+//	@Success		200	{object}	v2.uploadResponse
+//	@Failure		401	{object}	problem.Problem
+//	@Failure		403	{object}	problem.Problem	"Caller doesn't own the upload"
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/uploads/{id} [get]
+func (r *uploadRoutes) get(c echo.Context) error {
+	session, err := r.s.UploadSession(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(200, newUploadResponse(c, session, nil))
+}
+
+//	@Summary		Upload chunk
+//	@Description	Append chunk of the file, starting at the offset of the received data
+//	@Description	Once the whole file is received, the video is processed and returned along with the upload
+//	@Tags			v2 uploads
+//	@Security		Bearer
+//	@Accept			application/offset+octet-stream
+//	@Param			id				path		string	true	"upload id"
+//	@Param			Upload-Offset	header		int		true	"offset of the chunk"
+//	@Param			chunk			body		string	true	"chunk of the file"
+//	@Success		200				{object}	v2.uploadResponse
+//	@Failure		400				{object}	problem.Problem
+//	@Failure		401				{object}	problem.Problem
+//	@Failure		403				{object}	problem.Problem	"Caller doesn't own the upload or quota is exceeded"
+//	@Failure		404				{object}	problem.Problem
+//	@Failure		409				{object}	problem.Problem	"Offset doesn't match the received data"
+//	@Failure		429				{object}	problem.Problem	"Too many videos are being processed"
+//	@Failure		500				{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/uploads/{id} [patch]
+func (r *uploadRoutes) append(c echo.Context) error {
+	offset, err := strconv.ParseInt(c.Request().Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		return problem.Param(uploadOffsetHeader, "should be a non-negative integer")
+	}
+
+	session, video, err := r.s.AppendUpload(c.Request().Context(), c.Param("id"), offset, c.Request().Body)
+	if err != nil {
+		return err
+	}
+
+	if video != nil {
+		c.Response().Header().Set("Location", videoPath(*video))
+		c.Response().Header().Set("ETag", v1.ETag(video.Version))
+	}
+
+	return c.JSON(200, newUploadResponse(c, session, video))
+}
+
+//	@Summary		Cancel upload
+//	@Description	Discard the upload along with the received data
+//	@Tags			v2 uploads
+//	@Security		Bearer
+//	@Param			id	path	string	true	"upload id"
+//	@Success		204
+//	@Failure		401	{object}	problem.Problem
+//	@Failure		403	{object}	problem.Problem	"Caller doesn't own the upload"
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/uploads/{id} [delete]
+func (r *uploadRoutes) cancel(c echo.Context) error {
+	if err := r.s.CancelUpload(c.Request().Context(), c.Param("id")); err != nil {
+		return err
+	}
+
+	return c.NoContent(204)
+}
@@ -0,0 +1,377 @@
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/controller/http/problem"
+	v1 "github.com/cutlery47/gostream/internal/controller/http/v1"
+	"github.com/cutlery47/gostream/internal/playlist"
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/internal/sign"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tracing"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type videoRoutes struct {
+	s service.Service
+
+	// nil, if playback urls are not signed
+	signer *sign.Signer
+	bindIP bool
+
+	serve    config.ServeConfig
+	renderer *playlist.Renderer
+}
+
+func newVideoRoutes(g *echo.Group, s service.Service, signer *sign.Signer, bindIP bool, serve config.ServeConfig, renderer *playlist.Renderer) {
+	r := &videoRoutes{
+		s:        s,
+		signer:   signer,
+		bindIP:   bindIP,
+		serve:    serve,
+		renderer: renderer,
+	}
+
+	g.POST("", r.upload)
+	g.GET("", r.list)
+
+	video := g.Group("/:id", r.tokenMiddleware, r.videoMiddleware)
+	video.GET("", r.get)
+	video.PATCH("", r.update)
+	video.DELETE("", r.delete)
+
+	video.GET("/renditions", r.renditions)
+	video.GET("/segments", r.segments)
+	video.GET("/thumbnail", r.thumbnail)
+	video.GET("/source", r.source)
+	video.GET("/captions", r.captions)
+	video.PUT("/captions/:lang", r.putCaptions)
+	video.DELETE("/captions/:lang", r.deleteCaptions)
+	video.GET("/playback", r.playback)
+
+	// files, fetched by the players
+	video.GET("/playlists/:playlist", r.playlist, r.signedMiddleware)
+	video.GET("/segments/:segment", r.segment, r.signedMiddleware)
+	video.GET("/captions/:lang", r.captionsFile, r.signedMiddleware)
+}
+
+type videoResponse struct {
+	ID          string            `json:"id"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Status      string            `json:"status"`
+	Visibility  string            `json:"visibility"`
+	Owner       string            `json:"owner,omitempty"`
+	Tags        []string          `json:"tags"`
+	Attributes  map[string]string `json:"attributes"`
+	// languages of the captions
+	Captions   []string  `json:"captions"`
+	Duration   float64   `json:"duration"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+func newVideoResponse(video storage.Video) videoResponse {
+	res := videoResponse{
+		ID:          video.ID,
+		Title:       video.Title,
+		Description: video.Description,
+		Status:      string(video.Status),
+		Visibility:  string(video.Visibility),
+		Owner:       video.Owner,
+		Tags:        video.Tags,
+		Attributes:  video.Attributes,
+		Captions:    video.Captions,
+		Duration:    video.Duration,
+		Size:        video.Size,
+		UploadedAt:  video.UploadedAt,
+	}
+
+	if res.Tags == nil {
+		res.Tags = []string{}
+	}
+	if res.Attributes == nil {
+		res.Attributes = map[string]string{}
+	}
+	if res.Captions == nil {
+		res.Captions = []string{}
+	}
+
+	return res
+}
+
+type videoPageResponse struct {
+	Videos []videoResponse `json:"videos"`
+	// empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// metadata changes, omitted fields are left as is
+type videoPatchRequest struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+	// merged into the existing attributes, null values remove them
+	Attributes map[string]*string  `json:"attributes"`
+	Visibility *storage.Visibility `json:"visibility"`
+}
+
+//	@Summary		Upload video
+//	@Description	Upload mp4 video, which is stored under a generated id
+//	@Tags			v2 videos
+//	@Security		Bearer
+//	@Accept			multipart/form-data
+//	@Param			file		formData	file	true	"mp4 video"
+//	@Param			title		formData	string	false	"title of the video (file name, if empty)"
+//	@Param			description	formData	string	false	"description of the video"
+//	@Param			tags		formData	string	false	"comma separated tags"
+//	@Param			visibility	formData	string	false	"public (default), unlisted or private"
+//	@Param			attributes	formData	string	false	"json object of custom string attributes"
+//	@Success		201			{object}	v2.videoResponse
+//	@Failure		400			{object}	problem.Problem
+//	@Failure		401			{object}	problem.Problem
+//	@Failure		403			{object}	problem.Problem	"Quota of the user or the tenant is exceeded"
+//	@Failure		415			{object}	problem.Problem	"Not an mp4 video"
+//	@Failure		429			{object}	problem.Problem	"Rate limit is exceeded or too many videos are being processed"
+//	@Failure		500			{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos [post]
+func (r *videoRoutes) upload(c echo.Context) error {
+	// whole body is received, once the form is parsed
+	_, receive := tracing.Start(c.Request().Context(), "videoRoutes.upload receive")
+	multipart, err := c.FormFile("file")
+	if err != nil {
+		tracing.End(receive, err)
+		return problem.Param("file", "mp4 file is required")
+	}
+	receive.SetAttributes(attribute.Int64("upload.size", multipart.Size))
+	tracing.End(receive, nil)
+
+	if !strings.HasSuffix(multipart.Filename, ".mp4") {
+		return errUnsupportedFile
+	}
+
+	meta := service.UploadMeta{
+		Title:       c.FormValue("title"),
+		Description: c.FormValue("description"),
+		Visibility:  storage.Visibility(c.FormValue("visibility")),
+	}
+	if meta.Title == "" {
+		meta.Title = strings.TrimSuffix(multipart.Filename, ".mp4")
+	}
+	if tags := c.FormValue("tags"); tags != "" {
+		meta.Tags = strings.Split(tags, ",")
+	}
+	if attributes := c.FormValue("attributes"); attributes != "" {
+		if err := json.Unmarshal([]byte(attributes), &meta.Attributes); err != nil {
+			return problem.Param("attributes", "should be a json object of strings")
+		}
+	}
+
+	file, err := multipart.Open()
+	if err != nil {
+		return err
+	}
+
+	video, err := r.s.UploadVideo(c.Request().Context(), file, meta)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", videoPath(video))
+	c.Response().Header().Set("ETag", v1.ETag(video.Version))
+	return c.JSON(201, newVideoResponse(video))
+}
+
+//	@Summary		List videos
+//	@Description	Get a page of videos, matching the filters
+//	@Tags			v2 videos
+//	@Param			status			query		string	false	"processing, ready or failed"
+//	@Param			visibility		query		string	false	"public (default), unlisted or private (own videos only, unless admin)"
+//	@Param			tag				query		string	false	"tag of the video"
+//	@Param			owner			query		string	false	"owner of the video"
+//	@Param			min_duration	query		number	false	"least duration (seconds)"
+//	@Param			max_duration	query		number	false	"largest duration (seconds)"
+//	@Param			q				query		string	false	"words to search in the title"
+//	@Param			sort			query		string	false	"uploaded_at (default), title or duration"
+//	@Param			order			query		string	false	"asc or desc (default)"
+//	@Param			limit			query		int		false	"page size (20 by default, 100 at most)"
+//	@Param			cursor			query		string	false	"cursor of the next page"
+//	@Success		200				{object}	v2.videoPageResponse
+//	@Failure		400				{object}	problem.Problem
+//	@Failure		500				{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos [get]
+func (r *videoRoutes) list(c echo.Context) error {
+	query := storage.VideoQuery{
+		Status:     storage.VideoStatus(c.QueryParam("status")),
+		Visibility: storage.Visibility(c.QueryParam("visibility")),
+		Tag:        c.QueryParam("tag"),
+		Owner:      c.QueryParam("owner"),
+		Search:     c.QueryParam("q"),
+		Sort:       c.QueryParam("sort"),
+		Desc:       true,
+		Limit:      v1.DefaultPageSize,
+		Cursor:     c.QueryParam("cursor"),
+	}
+
+	// unlisted and private videos are only listed on demand
+	if query.Visibility == "" {
+		query.Visibility = storage.VisibilityPublic
+	}
+
+	if query.Sort == "" {
+		query.Sort = storage.SortUploaded
+	}
+
+	switch c.QueryParam("order") {
+	case "", "desc":
+	case "asc":
+		query.Desc = false
+	default:
+		return problem.Param("order", "should be asc or desc")
+	}
+
+	var err error
+	if limit := c.QueryParam("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > v1.MaxPageSize {
+			return problem.Param("limit", fmt.Sprintf("should be 1 to %v", v1.MaxPageSize))
+		}
+	}
+
+	if min := c.QueryParam("min_duration"); min != "" {
+		if query.MinDuration, err = strconv.ParseFloat(min, 64); err != nil {
+			return problem.Param("min_duration", "should be a number")
+		}
+	}
+
+	if max := c.QueryParam("max_duration"); max != "" {
+		if query.MaxDuration, err = strconv.ParseFloat(max, 64); err != nil {
+			return problem.Param("max_duration", "should be a number")
+		}
+	}
+
+	page, err := r.s.ListVideos(c.Request().Context(), query)
+	if err != nil {
+		return err
+	}
+
+	res := videoPageResponse{
+		Videos:     []videoResponse{},
+		NextCursor: page.NextCursor,
+	}
+	for _, video := range page.Videos {
+		res.Videos = append(res.Videos, newVideoResponse(video))
+	}
+
+	return c.JSON(200, res)
+}
+
+//	@Summary		Retrieve video
+//	@Description	Get video metadata, ETag header holds its version
+//	@Tags			v2 videos
+//	@Param			id	path		string	true	"video id"
+//	@Success		200	{object}	v2.videoResponse
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id} [get]
+func (r *videoRoutes) get(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+
+	c.Response().Header().Set("ETag", v1.ETag(video.Version))
+	return c.JSON(200, newVideoResponse(video))
+}
+
+//	@Summary		Edit video metadata
+//	@Description	Update title, description, tags, attributes or visibility of the video
+//	@Description	If-Match header makes the update fail, once the video was modified since it was fetched
+//	@Tags			v2 videos
+//	@Security		Bearer
+//	@Accept			json
+//	@Param			id			path		string					true	"video id"
+//	@Param			If-Match	header		string					false	"ETag of the fetched video"
+//	@Param			metadata	body		v2.videoPatchRequest	true	"changed metadata"
+//	@Success		200			{object}	v2.videoResponse
+//	@Failure		400			{object}	problem.Problem
+//	@Failure		401			{object}	problem.Problem
+//	@Failure		403			{object}	problem.Problem	"Caller doesn't own the video"
+//	@Failure		404			{object}	problem.Problem
+//	@Failure		412			{object}	problem.Problem	"Video was modified"
+//	@Failure		500			{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id} [patch]
+func (r *videoRoutes) update(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+
+	version, err := v1.IfMatch(c.Request().Header.Get("If-Match"))
+	if err != nil {
+		return err
+	}
+
+	var req videoPatchRequest
+
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return problem.Param("body", err.Error())
+	}
+
+	patch := service.VideoPatch{
+		Title:       req.Title,
+		Description: req.Description,
+		Tags:        req.Tags,
+		Attributes:  req.Attributes,
+		Visibility:  req.Visibility,
+	}
+
+	video, err = r.s.UpdateVideo(c.Request().Context(), video.Name, patch, version)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("ETag", v1.ETag(video.Version))
+	return c.JSON(200, newVideoResponse(video))
+}
+
+//	@Summary		Delete video
+//	@Description	Delete video along with its metadata and every file of it (playlist, segments, thumbnail, captions)
+//	@Tags			v2 videos
+//	@Security		Bearer
+//	@Param			id	path	string	true	"video id"
+//	@Success		204
+//	@Failure		401	{object}	problem.Problem
+//	@Failure		403	{object}	problem.Problem	"Caller doesn't own the video"
+//	@Failure		404	{object}	problem.Problem
+//	@Failure		429	{object}	problem.Problem	"Rate limit is exceeded"
+//	@Failure		500	{object}	problem.Problem	"Internal error"
+//	@Router			/api/v2/videos/{id} [delete]
+func (r *videoRoutes) delete(c echo.Context) error {
+	video := c.Get("video").(storage.Video)
+
+	if err := r.s.RemoveVideo(c.Request().Context(), video.Name); err != nil {
+		return err
+	}
+
+	return c.NoContent(204)
+}
+
+// resolves the video of the request by its id
+func (r *videoRoutes) videoMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		video, err := r.s.VideoByID(c.Request().Context(), c.Param("id"))
+		if err != nil {
+			return err
+		}
+
+		c.Set("video", video)
+		return next(c)
+	}
+}
+
+func videoPath(video storage.Video) string {
+	return "/api/v2/videos/" + video.ID
+}
@@ -0,0 +1,26 @@
+package rtmp
+
+import (
+	"context"
+	"io"
+
+	"github.com/cutlery47/gostream/internal/live"
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/pkg/rtmp"
+)
+
+// publishing url: rtmp://<host>:<port>/live/<stream key>
+func NewServer(addr string, s service.LiveService) *rtmp.Server {
+	return &rtmp.Server{
+		Addr:    addr,
+		Handler: &handler{s: s},
+	}
+}
+
+type handler struct {
+	s service.LiveService
+}
+
+func (h *handler) Publish(app, key string) (io.WriteCloser, error) {
+	return h.s.Publish(context.Background(), key, live.Ingest{Protocol: "rtmp", Format: live.FormatFLV})
+}
@@ -0,0 +1,81 @@
+package srt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/live"
+	"github.com/cutlery47/gostream/internal/service"
+	"github.com/cutlery47/gostream/pkg/srt"
+)
+
+var errStreamID = errors.New("stream id doesn't specify a stream key to publish")
+
+// publishing url: srt://<host>:<port>?streamid=<stream key>&passphrase=<passphrase>
+// access control syntax is accepted as well: streamid=#!::r=<stream key>,m=publish
+func NewServer(addr, passphrase string, latency time.Duration, s service.LiveService) *srt.Server {
+	return &srt.Server{
+		Addr:       addr,
+		Passphrase: passphrase,
+		Latency:    latency,
+		Handler:    &handler{s: s},
+	}
+}
+
+type handler struct {
+	s service.LiveService
+}
+
+func (h *handler) Publish(conn *srt.Conn) (io.WriteCloser, error) {
+	key, err := streamKey(conn.StreamID())
+	if err != nil {
+		return nil, err
+	}
+
+	return h.s.Publish(context.Background(), key, live.Ingest{
+		Protocol: "srt",
+		Format:   live.FormatMPEGTS,
+		Conn: func() live.ConnStats {
+			stats := conn.Stats()
+			return live.ConnStats{
+				RTT:                  stats.RTT,
+				PacketsReceived:      stats.PacketsReceived,
+				PacketsLost:          stats.PacketsLost,
+				PacketsRetransmitted: stats.PacketsRetransmitted,
+				PacketsDropped:       stats.PacketsDropped,
+			}
+		},
+	})
+}
+
+func streamKey(id string) (string, error) {
+	if !strings.HasPrefix(id, "#!::") {
+		if id == "" {
+			return "", errStreamID
+		}
+		return id, nil
+	}
+
+	var key string
+	for _, pair := range strings.Split(strings.TrimPrefix(id, "#!::"), ",") {
+		k, v, _ := strings.Cut(pair, "=")
+		switch k {
+		case "r":
+			key = v
+		case "m":
+			// streams are only received
+			if v != "publish" {
+				return "", errStreamID
+			}
+		}
+	}
+
+	if key == "" {
+		return "", errStreamID
+	}
+
+	return key, nil
+}
@@ -0,0 +1,94 @@
+package drm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/cutlery47/gostream/internal/errs"
+	"github.com/cutlery47/gostream/internal/storage"
+)
+
+// EME ClearKey license server
+// https://www.w3.org/TR/encrypted-media/#clear-key
+type ClearKeyServer struct {
+	keys KeyGetter
+	// keys are only handed out to the callers, who may play their videos
+	access PlaybackChecker
+}
+
+func NewClearKeyServer(keys KeyGetter, access PlaybackChecker) *ClearKeyServer {
+	return &ClearKeyServer{keys: keys, access: access}
+}
+
+// license request, generated by the CDM
+type clearKeyRequest struct {
+	// base64url encoded key ids
+	Kids []string `json:"kids"`
+	// session type ("temporary" / "persistent-license")
+	Type string `json:"type"`
+}
+
+// license, containing a JWK set
+type clearKeyResponse struct {
+	Keys []clearKeyJWK `json:"keys"`
+	Type string        `json:"type"`
+}
+
+type clearKeyJWK struct {
+	Kty string `json:"kty"`
+	K   string `json:"k"`
+	Kid string `json:"kid"`
+}
+
+func (cs *ClearKeyServer) License(ctx context.Context, challenge []byte) ([]byte, error) {
+	var req clearKeyRequest
+	if err := json.Unmarshal(challenge, &req); err != nil || len(req.Kids) == 0 {
+		return nil, ErrInvalidLicenseRequest
+	}
+
+	res := clearKeyResponse{Type: req.Type}
+	if res.Type == "" {
+		res.Type = "temporary"
+	}
+
+	for _, kid := range req.Kids {
+		keyID, err := base64.RawURLEncoding.DecodeString(kid)
+		if err != nil {
+			return nil, ErrInvalidLicenseRequest
+		}
+
+		key, err := cs.keys.GetKey(ctx, keyID)
+		if err != nil {
+			// unknown keys are just left out of the license
+			if errors.Is(err, storage.ErrDBNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		// keys of the videos, the caller can't play, are left out just like the unknown ones
+		// (checked for the init segment, which is one of the files the key protects)
+		if err := cs.access.CheckPlayback(ctx, key.VideoName+"_init.m4s"); err != nil {
+			if errs.KindOf(err) == errs.NotFound {
+				continue
+			}
+			return nil, err
+		}
+
+		res.Keys = append(res.Keys, clearKeyJWK{
+			Kty: "oct",
+			K:   base64.RawURLEncoding.EncodeToString(key.Key),
+			Kid: kid,
+		})
+	}
+
+	if len(res.Keys) == 0 {
+		return nil, ErrKeyNotFound
+	}
+
+	return json.Marshal(res)
+}
+
+func (cs *ClearKeyServer) ContentType() string { return "application/json" }
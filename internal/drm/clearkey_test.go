@@ -0,0 +1,143 @@
+package drm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/cutlery47/gostream/internal/errs"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/cutlery47/gostream/internal/utils"
+)
+
+var errHidden = errs.New(errs.NotFound, "video_not_found", "couldn't find requested video file")
+
+type testKeys struct {
+	*storage.LocalKeyRepository
+}
+
+func (tk testKeys) GetKey(ctx context.Context, keyID []byte) (storage.ContentKey, error) {
+	return tk.ReadKey(ctx, keyID)
+}
+
+// videos, the caller may play, and the error returned for the rest of them
+type testAccess struct {
+	playable map[string]bool
+	err      error
+}
+
+func (ta testAccess) CheckPlayback(ctx context.Context, filename string) error {
+	if ta.playable[utils.VideoName(filename)] {
+		return nil
+	}
+	return ta.err
+}
+
+func newTestKey(t *testing.T, ctx context.Context, keys testKeys, videoName string) (string, storage.ContentKey) {
+	t.Helper()
+
+	key, err := NewContentKey(videoName, SchemeCENC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.CreateKey(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(key.KeyID), key
+}
+
+func licenseRequest(kids ...string) []byte {
+	req, _ := json.Marshal(clearKeyRequest{Kids: kids})
+	return req
+}
+
+func TestLicense(t *testing.T) {
+	keys := testKeys{storage.NewLocalKeyRepository(path.Join(t.TempDir(), "keys.json"))}
+	ctx := tenant.NewContext(context.Background(), "team")
+
+	kid, key := newTestKey(t, ctx, keys, "public")
+	privateKid, _ := newTestKey(t, ctx, keys, "private")
+	otherKid, _ := newTestKey(t, tenant.NewContext(context.Background(), "other"), keys, "public")
+
+	cs := NewClearKeyServer(keys, testAccess{playable: map[string]bool{"public": true}, err: errHidden})
+
+	license, err := cs.License(ctx, licenseRequest(kid))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res clearKeyResponse
+	if err := json.Unmarshal(license, &res); err != nil {
+		t.Fatal(err)
+	}
+
+	want := clearKeyJWK{Kty: "oct", K: base64.RawURLEncoding.EncodeToString(key.Key), Kid: kid}
+	if len(res.Keys) != 1 || res.Keys[0] != want || res.Type != "temporary" {
+		t.Errorf("got %+v, want the key %+v", res, want)
+	}
+
+	// keys, which can't be handed out, are left out of the license
+	license, err = cs.License(ctx, licenseRequest(privateKid, kid, otherKid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(license, &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Keys) != 1 || res.Keys[0].Kid != kid {
+		t.Errorf("got %+v, want only %v", res.Keys, kid)
+	}
+
+	cases := map[string]struct {
+		ctx       context.Context
+		challenge []byte
+		err       error
+	}{
+		"unknown kid":    {ctx, licenseRequest(base64.RawURLEncoding.EncodeToString(make([]byte, 16))), ErrKeyNotFound},
+		"wrong tenant":   {ctx, licenseRequest(otherKid), ErrKeyNotFound},
+		"default tenant": {context.Background(), licenseRequest(kid), ErrKeyNotFound},
+		"not playable":   {ctx, licenseRequest(privateKid), ErrKeyNotFound},
+		// kids are base64url encoded, without the padding
+		"padded kid":   {ctx, licenseRequest(kid + "=="), ErrInvalidLicenseRequest},
+		"std encoding": {ctx, licenseRequest("+/+/"), ErrInvalidLicenseRequest},
+		"no kids":      {ctx, licenseRequest(), ErrInvalidLicenseRequest},
+		"not json":     {ctx, []byte("kids"), ErrInvalidLicenseRequest},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := cs.License(tc.ctx, tc.challenge); !errors.Is(err, tc.err) {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestLicenseAccessError(t *testing.T) {
+	keys := testKeys{storage.NewLocalKeyRepository(path.Join(t.TempDir(), "keys.json"))}
+	kid, _ := newTestKey(t, context.Background(), keys, "video")
+
+	// failures of the check aren't taken for the video being hidden
+	failure := errors.New("connection refused")
+	cs := NewClearKeyServer(keys, testAccess{err: failure})
+
+	if _, err := cs.License(context.Background(), licenseRequest(kid)); !errors.Is(err, failure) {
+		t.Errorf("got %v, want %v", err, failure)
+	}
+}
+
+func TestPlaylistKey(t *testing.T) {
+	key := PlaylistKey(storage.ContentKey{KeyID: []byte{0, 1, 2, 255}})
+
+	if key.Method != "SAMPLE-AES-CTR" || key.KeyFormat != "org.w3.clearkey" {
+		t.Errorf("got %+v", key)
+	}
+	if want := "data:text/plain;base64,AAEC/w=="; key.URI != want {
+		t.Errorf("uri: got %q, want %q", key.URI, want)
+	}
+}
@@ -0,0 +1,82 @@
+package drm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/pkg/m3u8"
+)
+
+// common encryption scheme, applied to the packaged fmp4 output
+type Scheme string
+
+const (
+	SchemeNone Scheme = "none"
+	SchemeCENC Scheme = "cenc"
+)
+
+func ParseScheme(scheme string) (Scheme, error) {
+	switch Scheme(scheme) {
+	case "", SchemeNone:
+		return SchemeNone, nil
+	case SchemeCENC:
+		return SchemeCENC, nil
+	case "cbcs":
+		// ffmpeg's mp4 muxer only implements cenc-aes-ctr
+		return "", ErrUnsupportedScheme
+	default:
+		return "", ErrUnknownScheme
+	}
+}
+
+// hands out content keys to the clients
+// ClearKey is used for testing, commercial servers should implement the same interface
+type LicenseServer interface {
+	// processes license request of the CDM and returns the license
+	License(ctx context.Context, challenge []byte) ([]byte, error)
+	// mime type of the returned license
+	ContentType() string
+}
+
+// source of content keys
+type KeyGetter interface {
+	GetKey(ctx context.Context, keyID []byte) (storage.ContentKey, error)
+}
+
+// checks if the caller may play the files of the video (the same way, its files are served)
+type PlaybackChecker interface {
+	CheckPlayback(ctx context.Context, filename string) error
+}
+
+// generates random key and key id for the video
+func NewContentKey(videoName string, scheme Scheme) (storage.ContentKey, error) {
+	key := storage.ContentKey{
+		KeyID:     make([]byte, 16),
+		Key:       make([]byte, 16),
+		Scheme:    string(scheme),
+		VideoName: videoName,
+	}
+
+	if _, err := rand.Read(key.KeyID); err != nil {
+		return storage.ContentKey{}, err
+	}
+
+	if _, err := rand.Read(key.Key); err != nil {
+		return storage.ContentKey{}, err
+	}
+
+	return key, nil
+}
+
+// EXT-X-KEY, which makes the players start EME for the content
+// the key id is carried by the data uri, the key itself is acquired from the license server
+func PlaylistKey(key storage.ContentKey) m3u8.Key {
+	return m3u8.Key{
+		Method:            "SAMPLE-AES-CTR",
+		URI:               "data:text/plain;base64," + base64.StdEncoding.EncodeToString(key.KeyID),
+		KeyFormat:         "org.w3.clearkey",
+		KeyFormatVersions: "1",
+	}
+}
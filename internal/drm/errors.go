@@ -0,0 +1,10 @@
+package drm
+
+import "github.com/cutlery47/gostream/internal/errs"
+
+var (
+	ErrUnknownScheme         = errs.New(errs.Invalid, "unknown_scheme", "unknown encryption scheme")
+	ErrUnsupportedScheme     = errs.New(errs.Invalid, "unsupported_scheme", "encryption scheme is not supported by the packager")
+	ErrInvalidLicenseRequest = errs.New(errs.Invalid, "invalid_license_request", "malformed license request")
+	ErrKeyNotFound           = errs.New(errs.NotFound, "key_not_found", "none of the requested keys were found")
+)
@@ -0,0 +1,122 @@
+// Package errs defines errors, shared by the storage, service and controller layers.
+//
+// Every error carries a kind, which decides how it is reported to the client,
+// and a stable machine-readable code. Errors can be compared with errors.Is
+// (by code), even after they were wrapped or extended with field details.
+package errs
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// category of the error, controllers map it onto protocol status codes
+type Kind int
+
+const (
+	Internal Kind = iota
+	// request is malformed or fails validation
+	Invalid
+	NotFound
+	// request conflicts with the current state (e.g. name is taken)
+	Conflict
+	Forbidden
+	// request precondition (e.g. If-Match) doesn't hold
+	Precondition
+	// request can't be served right now, but might be later
+	Unavailable
+	NotImplemented
+	// request body is of unsupported type
+	Unsupported
+	// request lacks valid credentials
+	Unauthenticated
+	// client exceeded its rate or concurrency limits
+	Limited
+)
+
+// violation of a single request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Kind Kind
+	// stable identifier (e.g. video_not_found)
+	Code    string
+	Message string
+	// field-level validation details
+	Fields []FieldError
+	// when the request might be retried (0 if unknown)
+	RetryAfter time.Duration
+
+	// underlying cause, if any
+	err error
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if len(e.Fields) > 0 {
+		fields := make([]string, len(e.Fields))
+		for i, f := range e.Fields {
+			fields[i] = f.Field + ": " + f.Message
+		}
+		msg += " (" + strings.Join(fields, "; ") + ")"
+	}
+
+	if e.err != nil {
+		return msg + ": " + e.err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error { return e.err }
+
+// errors of the same code match each other
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// returns copy of the error, caused by err
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.err = err
+	return &c
+}
+
+// returns copy of the error, carrying field violations
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	c := *e
+	c.Fields = append(append([]FieldError(nil), e.Fields...), fields...)
+	return &c
+}
+
+// returns copy of the error, suggesting to retry after d
+func (e *Error) After(d time.Duration) *Error {
+	c := *e
+	c.RetryAfter = d
+	return &c
+}
+
+// returns the first *Error in the chain, nil if there is none
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return nil
+}
+
+// kind of the first *Error in the chain, Internal if there is none
+func KindOf(err error) Kind {
+	if e := From(err); e != nil {
+		return e.Kind
+	}
+	return Internal
+}
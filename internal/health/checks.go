@@ -0,0 +1,76 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// checks, that the binary is installed and runs
+// ffmpeg and its tools print their version with -version
+func Binary(name string) Func {
+	return func(ctx context.Context) (any, error) {
+		out, err := exec.CommandContext(ctx, name, "-version").Output()
+		if err != nil {
+			return nil, fmt.Errorf("%v isn't available: %w", name, err)
+		}
+
+		// first line names the version, e.g. "ffmpeg version 6.1.1"
+		version, _, _ := strings.Cut(string(out), "\n")
+
+		return map[string]string{"version": version}, nil
+	}
+}
+
+// checks, that each of the directories has at least minFree bytes of free disk
+func Disk(minFree int64, dirs ...string) Func {
+	return func(ctx context.Context) (any, error) {
+		free := make(map[string]int64, len(dirs))
+
+		var low []string
+		for _, dir := range dirs {
+			if dir == "" {
+				continue
+			}
+
+			available, err := freeSpace(dir)
+			if err != nil {
+				return free, err
+			}
+
+			free[dir] = available
+			if free[dir] < minFree {
+				low = append(low, dir)
+			}
+		}
+
+		if len(low) > 0 {
+			return free, fmt.Errorf("less than %v bytes are free in %v", minFree, strings.Join(low, ", "))
+		}
+
+		return free, nil
+	}
+}
+
+// returns space, available to unprivileged users
+// directories, which weren't created yet, are checked by their nearest existing parent
+func freeSpace(dir string) (int64, error) {
+	for {
+		var stat syscall.Statfs_t
+		err := syscall.Statfs(dir, &stat)
+		if err == nil {
+			return int64(stat.Bavail) * int64(stat.Bsize), nil
+		}
+
+		parent := filepath.Dir(dir)
+		if !errors.Is(err, fs.ErrNotExist) || parent == dir {
+			return 0, fmt.Errorf("%v: %w", dir, err)
+		}
+		dir = parent
+	}
+}
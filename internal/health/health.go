@@ -0,0 +1,164 @@
+// Package health reports, whether the service and its dependencies are able
+// to serve requests.
+//
+// Checks run concurrently, each one under its own timeout, so that a single
+// hanging dependency doesn't hold up the whole report.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// check statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// checks single dependency, details (if any) are reported along with the status
+type Func func(ctx context.Context) (details any, err error)
+
+// result of the single check
+type Result struct {
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Details    any    `json:"details,omitempty"`
+}
+
+type Report struct {
+	// ok, if every check passed
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+func (r Report) OK() bool { return r.Status == StatusOK }
+
+// report without the errors and details of the checks, which may reveal the internals
+func (r Report) Summary() Report {
+	summary := Report{Status: r.Status, Checks: make(map[string]Result, len(r.Checks))}
+	for name, result := range r.Checks {
+		summary.Checks[name] = Result{Status: result.Status, DurationMS: result.DurationMS}
+	}
+	return summary
+}
+
+type Checker struct {
+	timeout time.Duration
+	// reports are reused for this long, so that frequent probes don't load the dependencies
+	ttl time.Duration
+
+	names  []string
+	checks map[string]Func
+
+	// held while the checks run, concurrent callers wait for the same report
+	mu       sync.Mutex
+	report   Report
+	reported time.Time
+}
+
+// timeout applies to every check separately
+func NewChecker(timeout, ttl time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+		ttl:     ttl,
+		checks:  make(map[string]Func),
+	}
+}
+
+// registers the check, replacing the one with the same name
+func (c *Checker) Add(name string, check Func) {
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// runs all the checks at once, unless the last report is still fresh
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.reported.IsZero() && time.Since(c.reported) < c.ttl {
+		return c.report
+	}
+
+	// report is shared, so it shouldn't depend on the caller going away
+	c.report = c.runAll(context.WithoutCancel(ctx))
+	c.reported = time.Now()
+
+	return c.report
+}
+
+func (c *Checker) runAll(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.names))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, name := range c.names {
+		wg.Add(1)
+		go func(name string, check Func) {
+			defer wg.Done()
+
+			result := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Checks[name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(name, c.checks[name])
+	}
+
+	wg.Wait()
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Func) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	type outcome struct {
+		details any
+		err     error
+	}
+
+	// buffered, so that checks, which ignore the context, don't leak when abandoned
+	done := make(chan outcome, 1)
+	start := time.Now()
+
+	go func() {
+		details, err := check(ctx)
+		done <- outcome{details, err}
+	}()
+
+	var out outcome
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = ctx.Err()
+	}
+
+	result := Result{
+		Status:     StatusOK,
+		DurationMS: time.Since(start).Milliseconds(),
+		Details:    out.details,
+	}
+
+	if out.err != nil {
+		result.Status = StatusFail
+		result.Error = out.err.Error()
+		if errors.Is(out.err, context.DeadlineExceeded) {
+			result.Error = "timed out after " + c.timeout.String()
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunCached(t *testing.T) {
+	var runs atomic.Int32
+
+	c := NewChecker(time.Second, 50*time.Millisecond)
+	c.Add("db", func(ctx context.Context) (any, error) {
+		runs.Add(1)
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// cancelled caller doesn't spoil the shared report
+	if report := c.Run(ctx); !report.OK() {
+		t.Errorf("got %+v", report)
+	}
+
+	c.Run(context.Background())
+	if n := runs.Load(); n != 1 {
+		t.Errorf("checks ran %v times within the ttl", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	c.Run(context.Background())
+	if n := runs.Load(); n != 2 {
+		t.Errorf("checks ran %v times, want 2 after the ttl", n)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	c := NewChecker(time.Second, 0)
+	c.Add("db", func(ctx context.Context) (any, error) {
+		return map[string]string{"host": "db.internal"}, errors.New("dial tcp 10.0.0.5:5432: refused")
+	})
+	c.Add("disk", func(ctx context.Context) (any, error) {
+		return map[string]int{"free": 100}, nil
+	})
+
+	summary := c.Run(context.Background()).Summary()
+
+	if summary.OK() || summary.Checks["db"].Status != StatusFail || summary.Checks["disk"].Status != StatusOK {
+		t.Errorf("statuses weren't kept: %+v", summary)
+	}
+
+	for name, result := range summary.Checks {
+		if result.Error != "" || result.Details != nil {
+			t.Errorf("%v: internals are reported: %+v", name, result)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package live
+
+import "errors"
+
+var (
+	ErrFutureSegment = errors.New("requested segment is too far ahead of the live edge")
+	ErrBlockTimeout  = errors.New("playlist wasn't updated in time")
+	ErrNotLowLatency = errors.New("blocking playlist reload requires low-latency mode")
+)
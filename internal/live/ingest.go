@@ -0,0 +1,109 @@
+package live
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// containers of the published streams
+const (
+	FormatFLV    = "flv"
+	FormatMPEGTS = "mpegts"
+)
+
+// bitrate is averaged over this many seconds
+const meterWindow = 5
+
+// source of the published stream
+type Ingest struct {
+	// rtmp, srt
+	Protocol string
+	// container of the stream, fed into the packager
+	Format string
+	// transport statistics of the connection, nil if not reported
+	Conn func() ConnStats
+}
+
+// transport statistics of the ingest connection
+type ConnStats struct {
+	RTT                  time.Duration
+	PacketsReceived      uint64
+	PacketsLost          uint64
+	PacketsRetransmitted uint64
+	PacketsDropped       uint64
+}
+
+// statistics of the live stream
+type Stats struct {
+	Protocol      string
+	Since         time.Time
+	BytesReceived uint64
+	// average over the last few seconds (bits/s)
+	Bitrate float64
+	// nil, if protocol doesn't report it
+	Conn *ConnStats
+}
+
+// counts bytes of the published stream
+type Meter struct {
+	w io.WriteCloser
+
+	mu    sync.Mutex
+	total uint64
+	// bytes, received during each of the last seconds
+	buckets [meterWindow]uint64
+	// unix second of the latest bucket
+	current int64
+}
+
+func NewMeter(w io.WriteCloser) *Meter {
+	return &Meter{
+		w:       w,
+		current: time.Now().Unix(),
+	}
+}
+
+func (m *Meter) Write(b []byte) (int, error) {
+	n, err := m.w.Write(b)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advance(time.Now().Unix())
+	m.total += uint64(n)
+	m.buckets[m.current%meterWindow] += uint64(n)
+
+	return n, err
+}
+
+func (m *Meter) Close() error { return m.w.Close() }
+
+// returns total amount of bytes and the bitrate (bits/s)
+func (m *Meter) Read() (uint64, float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advance(time.Now().Unix())
+
+	// current second isn't complete yet
+	var sum uint64
+	for i, bytes := range m.buckets {
+		if int64(i) != m.current%meterWindow {
+			sum += bytes
+		}
+	}
+
+	return m.total, float64(8*sum) / (meterWindow - 1)
+}
+
+// starts buckets for the seconds, which have passed
+func (m *Meter) advance(now int64) {
+	for sec := m.current + 1; sec <= now && sec <= m.current+meterWindow; sec++ {
+		m.buckets[sec%meterWindow] = 0
+	}
+
+	if now > m.current {
+		m.current = now
+	}
+}
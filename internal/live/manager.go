@@ -0,0 +1,109 @@
+package live
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/metrics"
+)
+
+// keeps playlists of the streams, which are live at the moment
+type Manager struct {
+	mu       sync.RWMutex
+	sessions map[string]*session
+
+	cfg config.LiveConfig
+}
+
+// single publishing of the stream
+type session struct {
+	playlist *Playlist
+	ingest   Ingest
+	meter    *Meter
+	since    time.Time
+}
+
+func NewManager(cfg config.LiveConfig) *Manager {
+	return &Manager{
+		sessions: make(map[string]*session),
+		cfg:      cfg,
+	}
+}
+
+// creates empty playlist for the stream, published from the ingest
+func (m *Manager) Start(stream string, ingest Ingest, meter *Meter) *Playlist {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pl *Playlist
+	if m.cfg.PartTarget > 0 {
+		pl = NewLowLatencyPlaylist(stream, m.cfg.Window, m.cfg.DVR, m.cfg.SegmentTime, m.cfg.PartTarget.Seconds())
+	} else {
+		pl = NewPlaylist(m.cfg.Window, m.cfg.DVR, m.cfg.SegmentTime)
+	}
+
+	// stream is counted once, even if its previous session wasn't stopped
+	if old, ok := m.sessions[stream]; ok {
+		metrics.LiveStreams.WithLabelValues(old.ingest.Protocol).Dec()
+	}
+	metrics.LiveStreams.WithLabelValues(ingest.Protocol).Inc()
+
+	m.sessions[stream] = &session{
+		playlist: pl,
+		ingest:   ingest,
+		meter:    meter,
+		since:    time.Now(),
+	}
+
+	return pl
+}
+
+// forgets playlist of the stream
+func (m *Manager) Stop(stream string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, ok := m.sessions[stream]; ok {
+		metrics.LiveStreams.WithLabelValues(session.ingest.Protocol).Dec()
+	}
+
+	delete(m.sessions, stream)
+}
+
+// returns playlist of the stream, if it is live
+func (m *Manager) Get(stream string) (*Playlist, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[stream]
+	if !ok {
+		return nil, false
+	}
+
+	return session.playlist, true
+}
+
+// returns statistics of the stream, if it is live
+func (m *Manager) Stats(stream string) (Stats, bool) {
+	m.mu.RLock()
+	session, ok := m.sessions[stream]
+	m.mu.RUnlock()
+
+	if !ok {
+		return Stats{}, false
+	}
+
+	stats := Stats{
+		Protocol: session.ingest.Protocol,
+		Since:    session.since,
+	}
+	stats.BytesReceived, stats.Bitrate = session.meter.Read()
+
+	if session.ingest.Conn != nil {
+		conn := session.ingest.Conn()
+		stats.Conn = &conn
+	}
+
+	return stats, true
+}
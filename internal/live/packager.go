@@ -0,0 +1,192 @@
+package live
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/utils"
+)
+
+// how often the segment list is checked for new entries
+const pollInterval = 250 * time.Millisecond
+
+// finished segment of a live stream
+type Segment struct {
+	// name of the segment file (<prefix>_<seq>.ts)
+	Name string
+	// local path of the segment file
+	Path     string
+	Sequence uint64
+	// segment duration (seconds)
+	Duration float64
+}
+
+// cuts incoming stream into mpeg-ts segments
+// the stream is written into the packager, finished segments are read from Segments()
+type Packager struct {
+	stdin    io.WriteCloser
+	dir      string
+	listPath string
+
+	segments chan Segment
+	// closed, once ffmpeg exits
+	exited chan struct{}
+	err    error
+}
+
+// segment files are named after the prefix, segTime is their length (seconds)
+// format is the container of the incoming stream (flv, mpegts)
+func StartPackager(dir, prefix, format string, segTime float64) (*Packager, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	listPath := path.Join(dir, "segments.csv")
+	// leftovers of the previous session
+	os.Remove(listPath)
+
+	cmd := utils.SegmentLiveStream(
+		fmt.Sprintf("%v/%v_%%6d.ts", dir, prefix),
+		listPath,
+		segTime,
+		format,
+	)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &Packager{
+		stdin:    stdin,
+		dir:      dir,
+		listPath: listPath,
+		segments: make(chan Segment),
+		exited:   make(chan struct{}),
+	}
+
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			p.err = fmt.Errorf("%v: %s", err, out.String())
+		}
+		close(p.exited)
+	}()
+
+	go p.watch()
+
+	return p, nil
+}
+
+func (p *Packager) Write(b []byte) (int, error) { return p.stdin.Write(b) }
+
+// ends the stream, remaining segments are still delivered through Segments()
+func (p *Packager) Close() error { return p.stdin.Close() }
+
+// closed after the last segment was delivered
+func (p *Packager) Segments() <-chan Segment { return p.segments }
+
+// returns ffmpeg error, if any (valid after Segments() is closed)
+func (p *Packager) Err() error { return p.err }
+
+// tails the segment list, until ffmpeg exits
+func (p *Packager) watch() {
+	defer close(p.segments)
+
+	var offset int64
+	var seq uint64
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		exited := false
+		select {
+		case <-p.exited:
+			exited = true
+		case <-ticker.C:
+		}
+
+		// reading whatever was appended since the last check
+		entries, read := p.readList(offset)
+		offset += read
+
+		for _, entry := range entries {
+			name, start, end, ok := parseEntry(entry)
+			if !ok {
+				continue
+			}
+
+			p.segments <- Segment{
+				Name:     name,
+				Path:     path.Join(p.dir, name),
+				Sequence: seq,
+				Duration: end - start,
+			}
+			seq++
+		}
+
+		if exited {
+			return
+		}
+	}
+}
+
+// returns complete lines, found after the offset
+func (p *Packager) readList(offset int64) (lines []string, read int64) {
+	list, err := os.Open(p.listPath)
+	if err != nil {
+		return nil, 0
+	}
+	defer list.Close()
+
+	if _, err := list.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0
+	}
+
+	reader := bufio.NewReader(list)
+	for {
+		line, err := reader.ReadString('\n')
+		// incomplete line is read on the next check
+		if err != nil {
+			return lines, read
+		}
+
+		read += int64(len(line))
+		lines = append(lines, strings.TrimSpace(line))
+	}
+}
+
+// csv entry: <filename>,<start time>,<end time>
+func parseEntry(entry string) (name string, start, end float64, ok bool) {
+	fields := strings.Split(entry, ",")
+	if len(fields) != 3 {
+		return "", 0, 0, false
+	}
+
+	start, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	end, err = strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	return path.Base(fields[0]), start, end, true
+}
@@ -0,0 +1,406 @@
+package live
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cutlery47/gostream/pkg/m3u8"
+)
+
+// sliding window media playlist of a live stream
+type Playlist struct {
+	mu sync.RWMutex
+
+	// least amount of segments in the playlist
+	window int
+	// segments are kept in the playlist for at least this long (0 disables dvr)
+	dvr time.Duration
+	// target duration (seconds), announced once and never changed
+	target int
+
+	segments []m3u8.Segment
+	// media sequence number of the first segment in the playlist
+	sequence uint64
+	ended    bool
+
+	// segments, which have left the playlist, but may still be requested by the clients
+	expiring []expiringSegment
+
+	// closed and replaced on every update, wakes up blocked requests
+	updated chan struct{}
+
+	// low-latency mode, enabled if part target is set
+	stream string
+	// part target duration (seconds), announced once and never changed
+	partTarget float64
+	// parts of the segment being assembled
+	parts    []m3u8.Part
+	partData [][]byte
+	// actual duration of the parts, the listed one is capped by the part target
+	partsTime float64
+	// recent segments and parts, served from memory
+	files map[string][]byte
+}
+
+// media segment, assembled from the parts
+type AssembledSegment struct {
+	Name     string
+	Duration float64
+	Data     []byte
+}
+
+// blocking playlist reload request (_HLS_msn, _HLS_part)
+type Block struct {
+	MSN uint64
+	// -1, if the whole segment is awaited
+	Part int
+}
+
+type expiringSegment struct {
+	name string
+	// removal time
+	at time.Time
+}
+
+func NewPlaylist(window int, dvr time.Duration, target int) *Playlist {
+	return &Playlist{
+		window: window,
+		dvr:    dvr,
+		target: target,
+
+		updated: make(chan struct{}),
+	}
+}
+
+// playlist of partial segments (LL-HLS), which are named after the stream
+func NewLowLatencyPlaylist(stream string, window int, dvr time.Duration, target int, partTarget float64) *Playlist {
+	p := NewPlaylist(window, dvr, target)
+	p.stream = stream
+	p.partTarget = partTarget
+	p.files = make(map[string][]byte)
+
+	return p
+}
+
+// adds segment at the live edge
+// returns names of the segments, which should now be removed from the storage
+func (p *Playlist) Append(segment Segment) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.notify()
+
+	return p.push(m3u8.Segment{URI: segment.Name, Duration: segment.Duration})
+}
+
+// adds partial segment at the live edge
+// once parts make up a whole segment, it is returned, so that it could be stored
+// along with the names of the segments, which should now be removed from the storage
+func (p *Playlist) AppendPart(data []byte, duration float64) (*AssembledSegment, []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.notify()
+
+	name := p.partName(p.next(), len(p.parts))
+
+	// parts are cut on keyframes, so they may turn out longer than configured,
+	// while clients reject parts, which exceed the part target
+	p.parts = append(p.parts, m3u8.Part{URI: name, Duration: math.Min(duration, p.partTarget), Independent: true})
+	p.partData = append(p.partData, data)
+	p.partsTime += duration
+	p.files[name] = data
+
+	// segment is closed, once it is within half a part of the target duration
+	if p.partsTime < float64(p.target)-p.partTarget/2 {
+		return nil, nil
+	}
+
+	return p.assemble()
+}
+
+// assembles remaining parts into the last segment of the stream
+func (p *Playlist) Flush() (*AssembledSegment, []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.notify()
+
+	if len(p.parts) == 0 {
+		return nil, nil
+	}
+
+	return p.assemble()
+}
+
+func (p *Playlist) assemble() (*AssembledSegment, []string) {
+	segment := &AssembledSegment{
+		Name:     p.segmentName(p.next()),
+		Duration: p.partsTime,
+		// mpeg-ts parts can simply be joined
+		Data: bytes.Join(p.partData, nil),
+	}
+	p.files[segment.Name] = segment.Data
+
+	expired := p.push(m3u8.Segment{URI: segment.Name, Duration: segment.Duration, Parts: p.parts})
+	p.parts, p.partData, p.partsTime = nil, nil, 0
+
+	// parts are listed only close to the live edge (three target durations)
+	var total float64
+	for i := len(p.segments) - 1; i >= 0; i-- {
+		if total > 3*float64(p.target) {
+			p.forget(&p.segments[i])
+		}
+		total += p.segments[i].Duration
+	}
+
+	return segment, expired
+}
+
+// drops segment and its parts from memory
+// by then, the segment is already in the storage
+func (p *Playlist) forget(segment *m3u8.Segment) {
+	if p.files == nil {
+		return
+	}
+
+	delete(p.files, segment.URI)
+	for _, part := range segment.Parts {
+		delete(p.files, part.URI)
+	}
+	segment.Parts = nil
+}
+
+// appends segment, moving the window
+func (p *Playlist) push(segment m3u8.Segment) []string {
+	p.segments = append(p.segments, segment)
+
+	// segments are removed from the storage no earlier than
+	// the duration of the playlist after leaving it (RFC 8216, 6.2.2)
+	now := time.Now()
+	grace := time.Duration(p.duration() * float64(time.Second))
+
+	for p.outdated() {
+		p.forget(&p.segments[0])
+		p.expiring = append(p.expiring, expiringSegment{name: p.segments[0].URI, at: now.Add(grace)})
+		p.segments = p.segments[1:]
+		p.sequence++
+	}
+
+	var expired []string
+	for len(p.expiring) > 0 && !p.expiring[0].at.After(now) {
+		expired = append(expired, p.expiring[0].name)
+		p.expiring = p.expiring[1:]
+	}
+
+	return expired
+}
+
+// marks the playlist as finished
+// returns names of the segments, which have already left the playlist
+func (p *Playlist) End() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.notify()
+
+	p.ended = true
+
+	var expired []string
+	for _, segment := range p.expiring {
+		expired = append(expired, segment.name)
+	}
+	p.expiring = nil
+
+	return expired
+}
+
+func (p *Playlist) Encode() []byte {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.media().Encode()
+}
+
+// blocks, until the playlist contains the media segment (or its part)
+// gives up after three target durations
+func (p *Playlist) Wait(ctx context.Context, block Block) error {
+	// server control isn't announced, so the server isn't expected to hold the request either
+	if p.partTarget == 0 {
+		return ErrNotLowLatency
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.blockTimeout())
+	defer cancel()
+
+	for {
+		p.mu.RLock()
+		ready, err := p.contains(block)
+		updated := p.updated
+		p.mu.RUnlock()
+
+		if ready || err != nil {
+			return err
+		}
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return ErrBlockTimeout
+		}
+	}
+}
+
+// returns recent segment or part from memory
+// request for the hinted part blocks, until the part is produced
+func (p *Playlist) File(ctx context.Context, name string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(ctx, p.blockTimeout())
+	defer cancel()
+
+	for {
+		p.mu.RLock()
+		data, ok := p.files[name]
+		hinted := p.hinted(name)
+		updated := p.updated
+		p.mu.RUnlock()
+
+		if ok || !hinted {
+			return data, ok
+		}
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// checks if the file is served from memory (now or once it's produced)
+func (p *Playlist) Has(name string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	_, ok := p.files[name]
+	return ok || p.hinted(name)
+}
+
+func (p *Playlist) contains(block Block) (bool, error) {
+	next := p.next()
+
+	// last segment of the playlist is next-1, requests may be at most two segments ahead of it
+	if block.MSN > next+1 {
+		return false, ErrFutureSegment
+	}
+
+	if p.ended || block.MSN < next {
+		return true, nil
+	}
+
+	return block.Part >= 0 && block.MSN == next && block.Part < len(p.parts), nil
+}
+
+// checks if the name is the part, which is produced next
+func (p *Playlist) hinted(name string) bool {
+	return p.files != nil && !p.ended && name == p.partName(p.next(), len(p.parts))
+}
+
+func (p *Playlist) notify() {
+	close(p.updated)
+	p.updated = make(chan struct{})
+}
+
+func (p *Playlist) blockTimeout() time.Duration {
+	return 3 * time.Duration(p.target) * time.Second
+}
+
+// media sequence number of the segment being produced
+func (p *Playlist) next() uint64 {
+	return p.sequence + uint64(len(p.segments))
+}
+
+func (p *Playlist) segmentName(msn uint64) string {
+	return fmt.Sprintf("%v_%06d.ts", p.stream, msn)
+}
+
+func (p *Playlist) partName(msn uint64, part int) string {
+	return fmt.Sprintf("%v_%06d.%d.ts", p.stream, msn, part)
+}
+
+func (p *Playlist) media() *m3u8.MediaPlaylist {
+	pl := &m3u8.MediaPlaylist{
+		Version: 3,
+		// clients may reject playlists, whose target duration changes (RFC 8216, 6.2.1)
+		TargetDuration: p.target,
+		MediaSequence:  p.sequence,
+		Segments:       p.segments,
+		EndList:        p.ended,
+	}
+
+	if p.partTarget == 0 {
+		return pl
+	}
+
+	// required by the low-latency tags
+	pl.Version = 9
+	pl.ServerControl = &m3u8.ServerControl{
+		CanBlockReload: true,
+		PartHoldBack:   3 * p.partTarget,
+	}
+	pl.PartInf = &m3u8.PartInf{PartTarget: p.partTarget}
+	pl.Parts = p.parts
+
+	if !p.ended {
+		pl.PreloadHints = []m3u8.PreloadHint{{Type: "PART", URI: p.partName(p.next(), len(p.parts))}}
+	}
+
+	return pl
+}
+
+// complete vod playlist of the recorded stream
+func Recording(segments []Segment, target int) *m3u8.MediaPlaylist {
+	pl := &m3u8.MediaPlaylist{
+		Version:      3,
+		PlaylistType: "VOD",
+		EndList:      true,
+	}
+
+	for _, segment := range segments {
+		pl.Segments = append(pl.Segments, m3u8.Segment{URI: segment.Name, Duration: segment.Duration})
+	}
+	pl.TargetDuration = targetDuration(pl.Segments, target)
+
+	return pl
+}
+
+// longest segment duration, rounded up
+func targetDuration(segments []m3u8.Segment, least int) int {
+	target := float64(least)
+	for _, segment := range segments {
+		target = math.Max(target, segment.Duration)
+	}
+	return int(math.Ceil(target))
+}
+
+// checks if the first segment should leave the playlist
+func (p *Playlist) outdated() bool {
+	if len(p.segments) <= p.window {
+		return false
+	}
+
+	if p.dvr == 0 {
+		return true
+	}
+
+	// the rest of the segments still cover the dvr window
+	return p.duration()-p.segments[0].Duration >= p.dvr.Seconds()
+}
+
+// total duration of the playlist (seconds)
+func (p *Playlist) duration() float64 {
+	var total float64
+	for _, segment := range p.segments {
+		total += segment.Duration
+	}
+	return total
+}
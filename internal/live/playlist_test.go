@@ -0,0 +1,195 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestPlaylist() *Playlist {
+	// segments of a second, made of two parts
+	return NewLowLatencyPlaylist("stream", 10, 0, 1, 0.5)
+}
+
+func appendParts(p *Playlist, n int) {
+	for i := 0; i < n; i++ {
+		p.AppendPart([]byte{byte(i)}, 0.5)
+	}
+}
+
+func TestPartTarget(t *testing.T) {
+	p := newTestPlaylist()
+
+	// keyframe came late
+	p.AppendPart([]byte("part"), 0.625)
+	p.AppendPart([]byte("part"), 0.25)
+
+	pl := p.media()
+	if pl.PartInf.PartTarget != 0.5 {
+		t.Errorf("part target changed to %v", pl.PartInf.PartTarget)
+	}
+
+	if err := pl.Validate(); err != nil {
+		t.Errorf("invalid playlist: %v", err)
+	}
+
+	// segment keeps the actual duration
+	if len(pl.Segments) != 1 || pl.Segments[0].Duration != 0.875 {
+		t.Errorf("got segments %+v, want one of 0.875s", pl.Segments)
+	}
+}
+
+func TestPlaylistHeader(t *testing.T) {
+	p := NewPlaylist(10, 0, 2)
+
+	// long segment doesn't change the target duration
+	p.Append(Segment{Name: "0", Duration: 1.75})
+	p.Append(Segment{Name: "1", Duration: 3.25})
+
+	pl := p.media()
+	if pl.TargetDuration != 2 || pl.Version != 3 {
+		t.Errorf("got target duration %v and version %v, want 2 and 3", pl.TargetDuration, pl.Version)
+	}
+
+	// blocking reload is only served along with the low-latency tags
+	if err := p.Wait(context.Background(), Block{MSN: 2, Part: -1}); !errors.Is(err, ErrNotLowLatency) {
+		t.Errorf("got %v, want ErrNotLowLatency", err)
+	}
+
+	ll := newTestPlaylist()
+	appendParts(ll, 3)
+
+	pl = ll.media()
+	if pl.TargetDuration != 1 || pl.Version != 9 || pl.ServerControl == nil || len(pl.PreloadHints) != 1 {
+		t.Errorf("got target duration %v, version %v, server control %+v and hints %+v", pl.TargetDuration, pl.Version, pl.ServerControl, pl.PreloadHints)
+	}
+}
+
+func TestWait(t *testing.T) {
+	p := newTestPlaylist()
+	ctx := context.Background()
+
+	// awaited part is produced concurrently
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		appendParts(p, 3)
+	}()
+
+	if err := p.Wait(ctx, Block{MSN: 1, Part: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if next := p.next(); next != 1 || len(p.parts) == 0 {
+		t.Errorf("returned before the part was produced (msn %v, %v parts)", next, len(p.parts))
+	}
+
+	blocks := map[string]struct {
+		block Block
+		err   error
+	}{
+		"past segment":    {Block{MSN: 0, Part: -1}, nil},
+		"past part":       {Block{MSN: 1, Part: 0}, nil},
+		"next part":       {Block{MSN: 1, Part: 1}, ErrBlockTimeout},
+		"whole segment":   {Block{MSN: 1, Part: -1}, ErrBlockTimeout},
+		"next segment":    {Block{MSN: 2, Part: 0}, ErrBlockTimeout},
+		"too far ahead":   {Block{MSN: 3, Part: 0}, ErrFutureSegment},
+		"far in the past": {Block{MSN: 0, Part: 5}, nil},
+	}
+
+	for name, tc := range blocks {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		err := p.Wait(ctx, tc.block)
+		cancel()
+
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%v: got %v, want %v", name, err, tc.err)
+		}
+	}
+
+	// ended playlist doesn't block
+	p.End()
+	if err := p.Wait(ctx, Block{MSN: 2, Part: 0}); err != nil {
+		t.Errorf("ended playlist: %v", err)
+	}
+}
+
+func TestHintedPart(t *testing.T) {
+	p := newTestPlaylist()
+	ctx := context.Background()
+
+	hint := p.partName(0, 0)
+	if !p.Has(hint) {
+		t.Fatal("hinted part isn't served")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		p.AppendPart([]byte("data"), 0.5)
+	}()
+
+	data, ok := p.File(ctx, hint)
+	if !ok || string(data) != "data" {
+		t.Errorf("got %q, %v", data, ok)
+	}
+
+	// parts after the hinted one are unknown
+	if _, ok := p.File(ctx, p.partName(0, 5)); ok {
+		t.Error("part, which is not hinted, was awaited")
+	}
+}
+
+func TestPartExpiry(t *testing.T) {
+	p := newTestPlaylist()
+
+	// five segments, the first ones are further than three target durations from the edge
+	appendParts(p, 10)
+
+	for msn := uint64(0); msn < 5; msn++ {
+		_, kept := p.files[p.segmentName(msn)]
+		if want := msn >= 1; kept != want {
+			t.Errorf("segment %v is kept in memory: %v, want %v", msn, kept, want)
+		}
+
+		for part := 0; part < 2; part++ {
+			if _, kept := p.files[p.partName(msn, part)]; kept != (msn >= 1) {
+				t.Errorf("part %v.%v is kept in memory: %v", msn, part, kept)
+			}
+		}
+	}
+
+	// forgotten segment is still listed, but without its parts
+	pl := p.media()
+	if len(pl.Segments) != 5 || len(pl.Segments[0].Parts) != 0 || len(pl.Segments[1].Parts) != 2 {
+		t.Errorf("got segments %+v", pl.Segments)
+	}
+}
+
+func TestSegmentExpiry(t *testing.T) {
+	p := NewPlaylist(2, 0, 1)
+
+	var expired []string
+	for i := 0; i < 4; i++ {
+		expired = append(expired, p.Append(Segment{Name: fmt.Sprint(i), Duration: 0.01})...)
+	}
+
+	// segments are kept for the duration of the playlist after leaving it
+	if len(expired) != 0 {
+		t.Errorf("segments %v expired right away", expired)
+	}
+	if p.sequence != 2 || len(p.segments) != 2 {
+		t.Errorf("got sequence %v and %v segments", p.sequence, len(p.segments))
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	expired = p.Append(Segment{Name: "4", Duration: 0.01})
+	if fmt.Sprint(expired) != "[0 1]" {
+		t.Errorf("got expired %v, want [0 1]", expired)
+	}
+
+	// the rest are handed over, once the stream ends
+	if expired := p.End(); fmt.Sprint(expired) != "[2]" {
+		t.Errorf("got expired %v on end, want [2]", expired)
+	}
+}
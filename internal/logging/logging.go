@@ -0,0 +1,51 @@
+// Package logging ties log lines to the request, the tenant and the video,
+// they were written for.
+//
+// The request id is stored in the context by the http middleware, the video
+// by the services. Loggers, returned by For, carry them along with the tenant
+// of the context, so that lines of request.log, info.log and error.log can
+// be joined by the request id.
+package logging
+
+import (
+	"context"
+
+	"github.com/cutlery47/gostream/internal/tenant"
+	"go.uber.org/zap"
+)
+
+type requestIDKey struct{}
+
+type videoKey struct{}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// returns id of the request, empty if the context doesn't belong to one
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// videos are identified by their names (ids of the ones, uploaded over v2)
+func WithVideo(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, videoKey{}, name)
+}
+
+// returns logger, annotated with the request, the tenant and the video of the context
+func For(ctx context.Context, log *zap.Logger) *zap.Logger {
+	fields := make([]zap.Field, 0, 3)
+
+	if id := RequestID(ctx); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+
+	fields = append(fields, zap.String("tenant", tenant.FromContext(ctx)))
+
+	if video, _ := ctx.Value(videoKey{}).(string); video != "" {
+		fields = append(fields, zap.String("video", video))
+	}
+
+	return log.With(fields...)
+}
@@ -0,0 +1,107 @@
+// Package metrics exposes prometheus metrics of the service.
+//
+// Collectors are registered with the default registry, so that they can be
+// updated from any layer without being passed around, and are served along
+// with the go runtime and process metrics.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/errs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gostream"
+
+// storage backends
+const (
+	BackendObjects    = "object_storage"
+	BackendRepository = "repository"
+)
+
+var (
+	HTTPRequests = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the http requests by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	ServedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "served_bytes_total",
+		Help:      "Bytes served to the clients by asset type (video, playlist, segment, thumbnail, captions).",
+	}, []string{"asset"})
+
+	UploadSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Size of the uploaded source videos.",
+		// 1MiB to 16GiB
+		Buckets: prometheus.ExponentialBuckets(1<<20, 4, 8),
+	})
+
+	// uploads, which were received, but aren't stored yet
+	UploadQueue = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upload_queue_depth",
+		Help:      "Uploads, which are being processed or wait for a transcode slot.",
+	})
+
+	Transcodes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "transcodes_running",
+		Help:      "Transcodes, running at the moment.",
+	})
+
+	TranscodeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "transcode_duration_seconds",
+		Help:      "Duration of the ffmpeg runs by step (segment, thumbnail, remux).",
+		// 0.5s to ~17m
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"step"})
+
+	TranscodeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transcode_failures_total",
+		Help:      "Failed ffmpeg runs by step (segment, thumbnail, remux).",
+	}, []string{"step"})
+
+	StorageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Latency of the object storage and repository operations.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "operation"})
+
+	StorageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_errors_total",
+		Help:      "Failed object storage and repository operations.",
+	}, []string{"backend", "operation"})
+
+	LiveStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "live_streams",
+		Help:      "Streams, which are live at the moment, by ingest protocol.",
+	}, []string{"protocol"})
+)
+
+// records latency and result of a single storage operation
+// expected errors (e.g. missing files, exceeded quotas) aren't failures of the backend
+func ObserveStorage(backend, operation string, start time.Time, err error) {
+	StorageDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil && errs.KindOf(err) == errs.Internal {
+		StorageErrors.WithLabelValues(backend, operation).Inc()
+	}
+}
+
+// serves metrics of the default registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,440 @@
+// Package migrate applies the embedded sql migrations to the db.
+//
+// Applied versions are recorded in the schema_migrations table. Every run
+// holds a postgres advisory lock, so that instances, starting at once, don't
+// apply the same migrations concurrently. Each migration is applied in its
+// own transaction along with its record.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/errs"
+)
+
+var (
+	ErrSchemaOutdated = errs.New(errs.Unavailable, "schema_outdated", "db schema is older than the service expects")
+	ErrSchemaNewer    = errs.New(errs.Unavailable, "schema_newer", "db schema is newer than the service")
+)
+
+// key of the advisory lock, taken by the migration runs
+const lockKey = 0x6d69677261746521
+
+// "<version>_<name>.(up|down).sql"
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+
+	up   string
+	down string
+}
+
+// state of the migration in the db
+type Status struct {
+	Migration
+	Applied bool
+	// zero, unless applied (or if applied by the init scripts, before the runner recorded it)
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db *sql.DB
+	// ordered by version
+	migrations []Migration
+}
+
+// loads migrations from the root of fsys
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+
+		raw, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %v is named both %v and %v", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.up = string(raw)
+		} else {
+			m.down = string(raw)
+		}
+	}
+
+	m := &Migrator{db: db}
+
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %v_%v should have both up and down files", migration.Version, migration.Name)
+		}
+		m.migrations = append(m.migrations, *migration)
+	}
+
+	slices.SortFunc(m.migrations, func(a, b Migration) int { return a.Version - b.Version })
+
+	return m, nil
+}
+
+// returns version of the latest migration, known to the binary (-1 if there are none)
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return -1
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// returns version of the latest migration, applied to the db (-1 if there are none)
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return 0, err
+	}
+
+	return latestApplied(applied), nil
+}
+
+// checks, that every known migration is applied and the db doesn't have any unknown ones
+func (m *Migrator) Check(ctx context.Context) error {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return err
+	}
+
+	if version := latestApplied(applied); version > m.Latest() {
+		return ErrSchemaNewer.Wrap(fmt.Errorf("db is at version %v, the service knows up to %v", version, m.Latest()))
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			return ErrSchemaOutdated.Wrap(fmt.Errorf("migration %v_%v isn't applied", migration.Version, migration.Name))
+		}
+	}
+
+	return nil
+}
+
+// applies pending migrations in order, returns the applied ones
+func (m *Migrator) Up(ctx context.Context) (done []Migration, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn, applied map[int]time.Time) error {
+		if version := latestApplied(applied); version > m.Latest() {
+			return ErrSchemaNewer.Wrap(fmt.Errorf("db is at version %v, the service knows up to %v", version, m.Latest()))
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// reverts up to steps latest applied migrations, returns the reverted ones
+func (m *Migrator) Down(ctx context.Context, steps int) (done []Migration, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn, applied map[int]time.Time) error {
+		// down migrations of the newer versions are unknown
+		if version := latestApplied(applied); version > m.Latest() {
+			return ErrSchemaNewer.Wrap(fmt.Errorf("db is at version %v, the service knows up to %v", version, m.Latest()))
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// returns state of every known migration, followed by the unknown applied ones
+// the db is only read, so that the status can be checked with read-only credentials
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range m.migrations {
+		at, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: at})
+		delete(applied, migration.Version)
+	}
+
+	// applied by a newer binary
+	for version, at := range applied {
+		statuses = append(statuses, Status{Migration: Migration{Version: version, Name: "unknown"}, Applied: true, AppliedAt: at})
+	}
+
+	slices.SortFunc(statuses, func(a, b Status) int { return a.Version - b.Version })
+
+	return statuses, nil
+}
+
+// runs fn on a single connection, holding the advisory lock
+// session locks belong to the connection, so it isn't returned to the pool until unlocked
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, applied map[int]time.Time) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("error when taking migration lock: %v", err)
+	}
+	// the lock should be released, even if the context is done
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+
+	if err := m.prepare(ctx, conn); err != nil {
+		return err
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn, applied)
+}
+
+// creates schema_migrations table
+// migrations, already applied by the docker init scripts, are recorded as such
+func (m *Migrator) prepare(ctx context.Context, conn *sql.Conn) error {
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	create := `
+	CREATE TABLE schema_migrations (
+		version     INTEGER         PRIMARY KEY,
+		name        VARCHAR(256)    NOT NULL,
+		applied_at  TIMESTAMPTZ     NOT NULL DEFAULT now()
+	)`
+
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return err
+	}
+
+	initialized, err := m.baseline(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range initialized {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// object of the db, created by the migration
+// the schema itself, if the table is empty, and the table, if the column is
+type object struct {
+	table  string
+	column string
+}
+
+// objects, telling that the migrations were applied by the docker init scripts, before the runner existed
+// older scripts stopped at different versions, so every migration is detected on its own
+var baselineObjects = map[int]object{
+	0:  {},
+	1:  {table: "files"},
+	3:  {table: "keys"},
+	4:  {table: "streams"},
+	5:  {table: "videos"},
+	6:  {table: "videos", column: "description"},
+	7:  {table: "videos", column: "id"},
+	8:  {table: "users"},
+	9:  {table: "api_keys", column: "scopes"},
+	10: {table: "files", column: "tenant"},
+	11: {table: "usage"},
+	12: {table: "buckets"},
+}
+
+func (o object) query() (string, []any) {
+	switch {
+	case o.table == "":
+		return "SELECT to_regnamespace('file_schema') IS NOT NULL", nil
+	case o.column == "":
+		return "SELECT to_regclass($1) IS NOT NULL", []any{"file_schema." + o.table}
+	default:
+		return `SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = 'file_schema' AND table_name = $1 AND column_name = $2
+		)`, []any{o.table, o.column}
+	}
+}
+
+// returns migrations, applied by the docker init scripts
+func (m *Migrator) baseline(ctx context.Context, q querier) ([]Migration, error) {
+	return detectBaseline(m.migrations, func(o object) (bool, error) {
+		query, args := o.query()
+
+		var exists bool
+		err := q.QueryRowContext(ctx, query, args...).Scan(&exists)
+		return exists, err
+	})
+}
+
+// migrations are applied in order, so the baseline ends at the first one, which left no trace
+func detectBaseline(migrations []Migration, exists func(o object) (bool, error)) ([]Migration, error) {
+	var applied []Migration
+
+	for _, migration := range migrations {
+		o, ok := baselineObjects[migration.Version]
+		if !ok {
+			break
+		}
+
+		found, err := exists(o)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			break
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, record := migration.up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+	if !up {
+		script, record = migration.down, "DELETE FROM schema_migrations WHERE version = $1 AND name = $2"
+	}
+
+	// statements without arguments may hold the whole script
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %v_%v: %v", migration.Version, migration.Name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, record, migration.Version, migration.Name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// returns applied versions along with the time, they were applied at
+func (m *Migrator) applied(ctx context.Context, q querier) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+
+	var exists bool
+	if err := q.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	// nothing was applied by the runner yet, the ones of the init scripts are recorded on its first run
+	if !exists {
+		initialized, err := m.baseline(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, migration := range initialized {
+			applied[migration.Version] = time.Time{}
+		}
+		return applied, nil
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var at time.Time
+
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+func latestApplied(applied map[int]time.Time) int {
+	latest := -1
+	for version := range applied {
+		latest = max(latest, version)
+	}
+	return latest
+}
@@ -0,0 +1,260 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/cutlery47/gostream/migrations"
+	_ "github.com/lib/pq"
+)
+
+func versions(migrations []Migration) []int {
+	var out []int
+	for _, migration := range migrations {
+		out = append(out, migration.Version)
+	}
+	return out
+}
+
+func TestNew(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_second.up.sql":   {Data: []byte("up 10")},
+		"0010_second.down.sql": {Data: []byte("down 10")},
+		"0002_first.up.sql":    {Data: []byte("up 2")},
+		"0002_first.down.sql":  {Data: []byte("down 2")},
+		"README.md":            {Data: []byte("not a migration")},
+	}
+
+	m, err := New(nil, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := versions(m.migrations); !slices.Equal(got, []int{2, 10}) {
+		t.Errorf("got versions %v, want [2 10]", got)
+	}
+	if m.migrations[0].up != "up 2" || m.migrations[1].down != "down 10" {
+		t.Errorf("scripts were mixed up: %+v", m.migrations)
+	}
+	if m.Latest() != 10 {
+		t.Errorf("latest is %v, want 10", m.Latest())
+	}
+
+	invalid := map[string]fstest.MapFS{
+		"missing down": {
+			"0001_first.up.sql": {Data: []byte("up")},
+		},
+		"renamed": {
+			"0001_first.up.sql":   {Data: []byte("up")},
+			"0001_other.down.sql": {Data: []byte("down")},
+		},
+	}
+
+	for name, fsys := range invalid {
+		if _, err := New(nil, fsys); err == nil {
+			t.Errorf("%v: no error", name)
+		}
+	}
+
+	if m, err := New(nil, fstest.MapFS{}); err != nil || m.Latest() != -1 {
+		t.Errorf("empty: got %v, %v", m, err)
+	}
+}
+
+// every embedded migration is reversible, the baseline is made of the known ones
+func TestEmbedded(t *testing.T) {
+	m, err := New(nil, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	known := make(map[int]bool)
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+	}
+
+	for version := range baselineObjects {
+		if !known[version] {
+			t.Errorf("baseline detects unknown migration %v", version)
+		}
+	}
+}
+
+func TestDetectBaseline(t *testing.T) {
+	m, err := New(nil, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// objects, created by the init scripts of the different releases
+	dbs := map[string]struct {
+		objects []object
+		want    []int
+	}{
+		"empty": {nil, nil},
+		"streams": {
+			[]object{{}, {table: "files"}, {table: "keys"}, {table: "streams"}},
+			[]int{0, 1, 3, 4},
+		},
+		"users": {
+			[]object{
+				{}, {table: "files"}, {table: "keys"}, {table: "streams"}, {table: "videos"},
+				{table: "videos", column: "description"}, {table: "videos", column: "id"}, {table: "users"},
+			},
+			[]int{0, 1, 3, 4, 5, 6, 7, 8},
+		},
+		"whole": {
+			[]object{
+				{}, {table: "files"}, {table: "keys"}, {table: "streams"}, {table: "videos"},
+				{table: "videos", column: "description"}, {table: "videos", column: "id"}, {table: "users"},
+				{table: "api_keys", column: "scopes"}, {table: "files", column: "tenant"}, {table: "usage"}, {table: "buckets"},
+			},
+			[]int{0, 1, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+		},
+		// later tables don't matter, once the earlier migration is missing
+		"gap": {
+			[]object{{}, {table: "files"}, {table: "streams"}},
+			[]int{0, 1},
+		},
+	}
+
+	for name, tc := range dbs {
+		present := make(map[object]bool)
+		for _, o := range tc.objects {
+			present[o] = true
+		}
+
+		applied, err := detectBaseline(m.migrations, func(o object) (bool, error) { return present[o], nil })
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		if got := versions(applied); !slices.Equal(got, tc.want) {
+			t.Errorf("%v: got %v, want %v", name, got, tc.want)
+		}
+	}
+
+	failure := errors.New("connection refused")
+	if _, err := detectBaseline(m.migrations, func(o object) (bool, error) { return false, failure }); !errors.Is(err, failure) {
+		t.Errorf("got %v, want %v", err, failure)
+	}
+}
+
+// runs against a throwaway postgres db, its schema is dropped and recreated
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("MIGRATE_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MIGRATE_TEST_DSN isn't set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("DROP SCHEMA IF EXISTS file_schema CASCADE; DROP TABLE IF EXISTS schema_migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestRunner(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	m, err := New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Check(ctx); !errors.Is(err, ErrSchemaOutdated) {
+		t.Errorf("empty db: got %v, want ErrSchemaOutdated", err)
+	}
+
+	// status doesn't create anything
+	if _, err := m.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil || exists {
+		t.Errorf("status created schema_migrations (%v)", err)
+	}
+
+	done, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(m.migrations) {
+		t.Errorf("applied %v of %v migrations", len(done), len(m.migrations))
+	}
+
+	if err := m.Check(ctx); err != nil {
+		t.Error(err)
+	}
+	if done, err := m.Up(ctx); err != nil || len(done) != 0 {
+		t.Errorf("applied again: %v, %v", versions(done), err)
+	}
+
+	// every down migration reverts its up one
+	if done, err := m.Down(ctx, len(m.migrations)); err != nil || len(done) != len(m.migrations) {
+		t.Fatalf("reverted %v: %v", versions(done), err)
+	}
+	if version, err := m.Version(ctx); err != nil || version != -1 {
+		t.Errorf("got version %v, %v after reverting everything", version, err)
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("applied after reverting: %v", err)
+	}
+}
+
+func TestRunnerBaseline(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	m, err := New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// init scripts of an older release, which stopped at the users
+	for _, migration := range m.migrations {
+		if migration.Version > 8 {
+			break
+		}
+		if _, err := db.Exec(migration.up); err != nil {
+			t.Fatalf("%v: %v", migration.Version, err)
+		}
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.Applied != (status.Version <= 8) {
+			t.Errorf("migration %v is reported applied: %v", status.Version, status.Applied)
+		}
+	}
+
+	done, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) == 0 || done[0].Version != 9 {
+		t.Errorf("applied %v, want the ones after 8", versions(done))
+	}
+
+	if err := m.Check(ctx); err != nil {
+		t.Error(err)
+	}
+}
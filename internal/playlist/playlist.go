@@ -0,0 +1,170 @@
+package playlist
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// matches URI="..." attributes of EXT-X-MAP, EXT-X-KEY, EXT-X-MEDIA, etc.
+	uriAttr = regexp.MustCompile(`URI="([^"]*)"`)
+	// matches CODECS="..." attribute of variant streams
+	codecsAttr = regexp.MustCompile(`CODECS="([^"]*)"`)
+)
+
+// per request rendering parameters
+type Options struct {
+	// params appended to every uri (e.g. auth tokens)
+	Query url.Values
+	// codecs supported by the client (e.g. avc1, mp4a)
+	// variants requiring any other codec are removed, empty means no filtering
+	Codecs []string
+	// prepended to relative uris, before they are resolved against the base url of the renderer
+	Prefix string
+}
+
+// renders stored playlists for a particular request
+type Renderer struct {
+	// relative uris are resolved against it, nil leaves them relative
+	base *url.URL
+}
+
+func NewRenderer(baseURL string) (*Renderer, error) {
+	if baseURL == "" {
+		return &Renderer{}, nil
+	}
+
+	// without the trailing slash the last path element would be replaced
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Renderer{base: base}, nil
+}
+
+func (r *Renderer) Render(playlist []byte, opts Options) []byte {
+	var out bytes.Buffer
+
+	// set when variant tag was removed, so that its uri is removed as well
+	skipURI := false
+
+	codecs := clientCodecs(opts.Codecs)
+
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF"):
+			if !supported(line, codecs) {
+				skipURI = true
+				continue
+			}
+		case strings.HasPrefix(line, "#EXT-X-I-FRAME-STREAM-INF"):
+			if !supported(line, codecs) {
+				continue
+			}
+		}
+
+		if strings.HasPrefix(line, "#") {
+			// tags may reference uris through attributes
+			line = uriAttr.ReplaceAllStringFunc(line, func(attr string) string {
+				uri := uriAttr.FindStringSubmatch(attr)[1]
+				return `URI="` + r.uri(uri, opts) + `"`
+			})
+		} else {
+			if skipURI {
+				skipURI = false
+				continue
+			}
+			line = r.uri(line, opts)
+		}
+
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+
+	return out.Bytes()
+}
+
+func (r *Renderer) uri(uri string, opts Options) string {
+	u, err := url.Parse(uri)
+	// data uris (e.g. key ids of EXT-X-KEY) carry the content itself
+	if err != nil || u.Scheme == "data" {
+		return uri
+	}
+
+	if opts.Prefix != "" && !u.IsAbs() && !strings.HasPrefix(u.Path, "/") {
+		u.Path = opts.Prefix + u.Path
+	}
+
+	if r.base != nil {
+		u = r.base.ResolveReference(u)
+	}
+
+	if len(opts.Query) != 0 {
+		q := u.Query()
+		for key, vals := range opts.Query {
+			q[key] = vals
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String()
+}
+
+// checks if all the codecs of the variant are supported by the client
+func supported(tag string, codecs []string) bool {
+	if len(codecs) == 0 {
+		return true
+	}
+
+	match := codecsAttr.FindStringSubmatch(tag)
+	// nothing to filter by
+	if match == nil {
+		return true
+	}
+
+	for _, required := range strings.Split(match[1], ",") {
+		required = strings.TrimSpace(required)
+		if required == "" {
+			continue
+		}
+
+		ok := false
+		for _, codec := range codecs {
+			// client codecs may omit the profile (avc1 matches avc1.64001f)
+			if strings.HasPrefix(required, codec) {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// trimmed codecs of the client, without the empty entries (e.g. of a trailing comma), which would match anything
+func clientCodecs(codecs []string) []string {
+	var out []string
+	for _, codec := range codecs {
+		if codec = strings.TrimSpace(codec); codec != "" {
+			out = append(out, codec)
+		}
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+package playlist
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRenderURIs(t *testing.T) {
+	cases := map[string]struct {
+		base string
+		opts Options
+		uri  string
+		want string
+	}{
+		"relative":            {"", Options{}, "vid_0001.ts", "vid_0001.ts"},
+		"base":                {"https://cdn.example.com/files", Options{}, "vid_0001.ts", "https://cdn.example.com/files/vid_0001.ts"},
+		"prefix":              {"", Options{Prefix: "/api/v2/videos/id/segments/"}, "vid_0001.ts", "/api/v2/videos/id/segments/vid_0001.ts"},
+		"base and prefix":     {"https://cdn.example.com/", Options{Prefix: "/api/v2/videos/id/segments/"}, "vid_0001.ts", "https://cdn.example.com/api/v2/videos/id/segments/vid_0001.ts"},
+		"relative prefix":     {"https://cdn.example.com/api/v2/videos/id/playlists/", Options{Prefix: "../segments/"}, "vid_0001.ts", "https://cdn.example.com/api/v2/videos/id/segments/vid_0001.ts"},
+		"absolute path":       {"", Options{Prefix: "../segments/"}, "/api/v1/chunks/vid_0001.ts", "/api/v1/chunks/vid_0001.ts"},
+		"absolute uri":        {"https://cdn.example.com/", Options{Prefix: "../segments/"}, "https://other.example.com/a.ts", "https://other.example.com/a.ts"},
+		"query":               {"", Options{Query: url.Values{"token": {"t"}}}, "vid_0001.ts", "vid_0001.ts?token=t"},
+		"base, prefix, query": {"https://cdn.example.com", Options{Prefix: "/segments/", Query: url.Values{"token": {"t"}}}, "a.ts", "https://cdn.example.com/segments/a.ts?token=t"},
+		"data uri":            {"https://cdn.example.com", Options{Prefix: "/segments/", Query: url.Values{"token": {"t"}}}, "data:text/plain;base64,AAEC/w==", "data:text/plain;base64,AAEC/w=="},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r, err := NewRenderer(tc.base)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := string(r.Render([]byte(tc.uri), tc.opts)); got != tc.want+"\n" {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+
+			// uris of the tags are rendered the same way
+			tag := `#EXT-X-MAP:URI="` + tc.uri + `"`
+			if got, want := string(r.Render([]byte(tag), tc.opts)), `#EXT-X-MAP:URI="`+tc.want+"\"\n"; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+const master = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=800000,CODECS="avc1.4d401f,mp4a.40.2"
+low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=4000000,CODECS="hvc1.1.6.L93.B0,mp4a.40.2"
+hevc.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2000000,CODECS="avc1.64001f,ac-3,"
+mid.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=1200000
+unknown.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100000,CODECS="hvc1.1.6.L93.B0",URI="hevc_iframes.m3u8"
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=80000,CODECS="avc1.4d401f",URI="iframes.m3u8"
+`
+
+func TestRenderVariants(t *testing.T) {
+	cases := map[string]struct {
+		codecs []string
+		want   []string
+	}{
+		"no filtering":    {nil, []string{"low.m3u8", "hevc.m3u8", "mid.m3u8", "unknown.m3u8", "hevc_iframes.m3u8", "iframes.m3u8"}},
+		"avc only":        {[]string{"avc1", "mp4a"}, []string{"low.m3u8", "unknown.m3u8", "iframes.m3u8"}},
+		"avc and ac-3":    {[]string{"avc1", "mp4a", "ac-3"}, []string{"low.m3u8", "mid.m3u8", "unknown.m3u8", "iframes.m3u8"}},
+		"full codec":      {[]string{"avc1.4d401f", "mp4a.40.2"}, []string{"low.m3u8", "unknown.m3u8", "iframes.m3u8"}},
+		"hevc":            {[]string{"hvc1", "mp4a"}, []string{"hevc.m3u8", "unknown.m3u8", "hevc_iframes.m3u8"}},
+		"trailing comma":  {[]string{"avc1", "mp4a", ""}, []string{"low.m3u8", "unknown.m3u8", "iframes.m3u8"}},
+		"spaces":          {[]string{" avc1", "mp4a "}, []string{"low.m3u8", "unknown.m3u8", "iframes.m3u8"}},
+		"only empty":      {[]string{"", " "}, []string{"low.m3u8", "hevc.m3u8", "mid.m3u8", "unknown.m3u8", "hevc_iframes.m3u8", "iframes.m3u8"}},
+		"nothing matches": {[]string{"vp09"}, []string{"unknown.m3u8"}},
+	}
+
+	r, err := NewRenderer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			out := string(r.Render([]byte(master), Options{Codecs: tc.codecs}))
+
+			// uris are listed in the original order, each one right after its tag
+			var got []string
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			for i, line := range lines {
+				switch {
+				case strings.HasPrefix(line, "#EXT-X-STREAM-INF"):
+					if i+1 == len(lines) || strings.HasPrefix(lines[i+1], "#") {
+						t.Fatalf("variant %q has no uri", line)
+					}
+				case strings.HasPrefix(line, "#EXT-X-I-FRAME-STREAM-INF"):
+					got = append(got, uriAttr.FindStringSubmatch(line)[1])
+				case !strings.HasPrefix(line, "#"):
+					if !strings.HasPrefix(lines[i-1], "#EXT-X-STREAM-INF") {
+						t.Fatalf("uri %q doesn't follow its variant", line)
+					}
+					got = append(got, line)
+				}
+			}
+
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
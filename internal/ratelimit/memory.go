@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// how often refilled buckets are dropped
+const sweepInterval = time.Minute
+
+// keeps buckets in memory of the instance
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*rate.Limiter
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets:   make(map[string]*rate.Limiter),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	if limit.Unlimited() {
+		return 0, nil
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+		m.buckets[key] = bucket
+	}
+
+	r := bucket.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay, nil
+	}
+
+	return 0, nil
+}
+
+// drops buckets, which were refilled (missing buckets are full)
+func (m *Memory) sweep(now time.Time) {
+	for key, bucket := range m.buckets {
+		if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBurst(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i := 0; i < limit.Burst; i++ {
+		if wait, err := m.Take(ctx, "client", limit); err != nil || wait != 0 {
+			t.Fatalf("request %v: got wait %v, err %v", i, wait, err)
+		}
+	}
+
+	wait, err := m.Take(ctx, "client", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("got wait %v, want up to a second", wait)
+	}
+
+	// buckets are kept per key
+	if wait, err := m.Take(ctx, "other", limit); err != nil || wait != 0 {
+		t.Errorf("other key: got wait %v, err %v", wait, err)
+	}
+}
+
+func TestMemoryRefill(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	limit := Limit{Rate: 100, Burst: 1}
+
+	if wait, _ := m.Take(ctx, "client", limit); wait != 0 {
+		t.Fatalf("got wait %v", wait)
+	}
+
+	// rejected requests don't take tokens, so the wait doesn't grow
+	first, _ := m.Take(ctx, "client", limit)
+	second, _ := m.Take(ctx, "client", limit)
+	if first <= 0 || second > first {
+		t.Fatalf("got waits %v, %v", first, second)
+	}
+
+	time.Sleep(first + 5*time.Millisecond)
+
+	if wait, _ := m.Take(ctx, "client", limit); wait != 0 {
+		t.Errorf("bucket wasn't refilled: got wait %v", wait)
+	}
+}
+
+func TestMemoryUnlimited(t *testing.T) {
+	m := NewMemory()
+
+	for i := 0; i < 100; i++ {
+		if wait, err := m.Take(context.Background(), "client", PerMinute(0, 0)); err != nil || wait != 0 {
+			t.Fatalf("got wait %v, err %v", wait, err)
+		}
+	}
+
+	if len(m.buckets) != 0 {
+		t.Errorf("unlimited requests created %v buckets", len(m.buckets))
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	m.Take(ctx, "full", Limit{Rate: 1, Burst: 2})
+	m.Take(ctx, "empty", Limit{Rate: 1, Burst: 1})
+
+	m.sweep(time.Now())
+	if _, ok := m.buckets["empty"]; !ok {
+		t.Error("bucket, which wasn't refilled, was dropped")
+	}
+
+	m.sweep(time.Now().Add(time.Minute))
+	if len(m.buckets) != 0 {
+		t.Errorf("refilled buckets weren't dropped: %v left", len(m.buckets))
+	}
+}
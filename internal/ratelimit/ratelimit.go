@@ -0,0 +1,44 @@
+// Package ratelimit throttles clients with token buckets.
+//
+// Each client (an api key, a user or an ip) gets its own bucket per limit,
+// which is refilled at a steady rate up to its burst size. Buckets are kept
+// in memory of a single instance, or in the db, when they should be shared
+// by several instances.
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/errs"
+)
+
+// where the buckets are kept
+const (
+	BackendMemory   = "memory"
+	BackendPostgres = "postgres"
+)
+
+var ErrRateLimited = errs.New(errs.Limited, "rate_limited", "too many requests, try again later")
+
+// refill rate and size of the buckets
+type Limit struct {
+	// tokens per second, nothing is limited if zero
+	Rate  float64
+	Burst int
+}
+
+func PerMinute(n, burst int) Limit {
+	// bucket should fit at least a single request
+	return Limit{Rate: float64(n) / 60, Burst: max(burst, 1)}
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+type Limiter interface {
+	// takes a token from the bucket of the key
+	// if there is none, nothing is taken and the time until the next token is returned
+	Take(ctx context.Context, key string, limit Limit) (time.Duration, error)
+}
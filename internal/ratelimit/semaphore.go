@@ -0,0 +1,52 @@
+package ratelimit
+
+// limits amount of work, done at once
+// nil semaphore doesn't limit anything
+type Semaphore struct {
+	slots chan struct{}
+}
+
+// returns nil, if n isn't positive
+func NewSemaphore(n int) *Semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return &Semaphore{slots: make(chan struct{}, n)}
+}
+
+// takes a slot, unless all of them are taken
+func (s *Semaphore) TryAcquire() bool {
+	if s == nil {
+		return true
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Semaphore) Release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+}
+
+// returns amount of the taken slots
+func (s *Semaphore) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.slots)
+}
+
+// returns amount of the slots, 0 if unlimited
+func (s *Semaphore) Cap() int {
+	if s == nil {
+		return 0
+	}
+	return cap(s.slots)
+}
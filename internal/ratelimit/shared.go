@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/logging"
+	"github.com/cutlery47/gostream/internal/storage"
+	"go.uber.org/zap"
+)
+
+// keeps buckets in the db, shared by the instances
+type Shared struct {
+	buckets storage.BucketRepository
+	// unix nanoseconds of the last cleanup
+	lastSweep atomic.Int64
+
+	errLog *zap.Logger
+}
+
+func NewShared(errLog *zap.Logger, buckets storage.BucketRepository) *Shared {
+	s := &Shared{
+		buckets: buckets,
+		errLog:  errLog,
+	}
+	s.lastSweep.Store(time.Now().UnixNano())
+
+	return s
+}
+
+func (s *Shared) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	if limit.Unlimited() {
+		return 0, nil
+	}
+
+	if last := s.lastSweep.Load(); time.Since(time.Unix(0, last)) > sweepInterval && s.lastSweep.CompareAndSwap(last, time.Now().UnixNano()) {
+		go s.sweep()
+	}
+
+	wait, err := s.buckets.TakeToken(ctx, key, limit.Rate, limit.Burst)
+	if err != nil {
+		// unavailable db shouldn't take the whole api down along with it
+		logging.For(ctx, s.errLog).Error(fmt.Sprintf("couldn't take token of %v: %v", key, err))
+		return 0, nil
+	}
+
+	return wait, nil
+}
+
+func (s *Shared) sweep() {
+	if err := s.buckets.DeleteFullBuckets(context.Background()); err != nil {
+		s.errLog.Error(fmt.Sprintf("couldn't delete refilled buckets: %v", err))
+	}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type fakeBuckets struct {
+	wait  time.Duration
+	err   error
+	taken []string
+	swept chan struct{}
+}
+
+func (fb *fakeBuckets) TakeToken(ctx context.Context, key string, rate float64, burst int) (time.Duration, error) {
+	fb.taken = append(fb.taken, key)
+	return fb.wait, fb.err
+}
+
+func (fb *fakeBuckets) DeleteFullBuckets(ctx context.Context) error {
+	close(fb.swept)
+	return nil
+}
+
+func TestSharedTake(t *testing.T) {
+	buckets := &fakeBuckets{wait: time.Second}
+	s := NewShared(zap.NewNop(), buckets)
+
+	wait, err := s.Take(context.Background(), "client", Limit{Rate: 1, Burst: 1})
+	if err != nil || wait != time.Second {
+		t.Errorf("got wait %v, err %v", wait, err)
+	}
+
+	if _, err := s.Take(context.Background(), "client", Limit{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(buckets.taken) != 1 {
+		t.Errorf("unlimited request took a token: %v", buckets.taken)
+	}
+}
+
+func TestSharedUnavailable(t *testing.T) {
+	s := NewShared(zap.NewNop(), &fakeBuckets{wait: time.Second, err: errors.New("connection refused")})
+
+	// requests aren't limited, while the db is unavailable
+	wait, err := s.Take(context.Background(), "client", Limit{Rate: 1, Burst: 1})
+	if err != nil || wait != 0 {
+		t.Errorf("got wait %v, err %v", wait, err)
+	}
+}
+
+func TestSharedSweep(t *testing.T) {
+	buckets := &fakeBuckets{swept: make(chan struct{})}
+	s := NewShared(zap.NewNop(), buckets)
+	s.lastSweep.Store(time.Now().Add(-2 * sweepInterval).UnixNano())
+
+	if _, err := s.Take(context.Background(), "client", Limit{Rate: 1, Burst: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-buckets.swept:
+	case <-time.After(time.Second):
+		t.Fatal("refilled buckets weren't deleted")
+	}
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/logging"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/utils"
+	"github.com/cutlery47/gostream/pkg/m3u8"
+)
+
+// largest accepted captions file
+const maxCaptionsSize = 1 << 20
+
+// bcp 47 language tags (e.g. en, pt-BR, zh-Hant)
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// thumbnails and captions are stored along with the chunks of the video
+func thumbnailName(videoName string) string { return videoName + "_thumb.jpg" }
+
+func captionsName(videoName, lang string) string { return fmt.Sprintf("%v_%v.vtt", videoName, lang) }
+
+func (ss *StreamService) storeThumbnail(ctx context.Context, videoPath, chunkPath, videoName, owner string) error {
+	name := thumbnailName(videoName)
+	thumbPath := chunkPath + name
+
+	if err := runFFmpeg(ctx, ss.log, "thumbnail", utils.CreateThumbnail(videoPath, thumbPath)); err != nil {
+		return err
+	}
+
+	thumb, err := os.Open(thumbPath)
+	if err != nil {
+		return err
+	}
+	defer thumb.Close()
+
+	file, err := storage.FromFD(thumb, name)
+	if err != nil {
+		return err
+	}
+	file.Owner = owner
+
+	return ss.storage.Put(ctx, *file)
+}
+
+func (ss *StreamService) Thumbnail(ctx context.Context, name string) (io.ReadCloser, error) {
+	thumb, err := ss.storage.Get(ctx, thumbnailName(name))
+	if err != nil {
+		if errors.Is(err, storage.ErrFileNotFound) {
+			return nil, ErrThumbnailNotFound.Wrap(err)
+		}
+		return nil, err
+	}
+
+	return served(thumbnailName(name), thumb), nil
+}
+
+func (ss *StreamService) Segments(ctx context.Context, name string) ([]m3u8.Segment, error) {
+	file, err := ss.storage.Get(ctx, name+".m3u8")
+	if err != nil {
+		if errors.Is(err, storage.ErrFileNotFound) {
+			return nil, ErrManifestNotFound.Wrap(err)
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pl, err := m3u8.DecodeMedia(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return pl.Segments, nil
+}
+
+func (ss *StreamService) PutCaptions(ctx context.Context, name, lang string, captions io.Reader) (storage.Video, error) {
+	if !languageTag.MatchString(lang) {
+		return storage.Video{}, ErrInvalidLanguage
+	}
+
+	// the video should exist, before anything is stored
+	video, err := ss.Video(ctx, name)
+	if err != nil {
+		return storage.Video{}, err
+	}
+
+	if err := auth.Authorize(ctx, auth.ScopeVideosWrite, video.Owner); err != nil {
+		return storage.Video{}, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(captions, maxCaptionsSize+1))
+	if err != nil {
+		return storage.Video{}, err
+	}
+
+	// webvtt files may start with a byte order mark
+	if len(data) > maxCaptionsSize || !bytes.HasPrefix(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), []byte("WEBVTT")) {
+		return storage.Video{}, ErrInvalidCaptions
+	}
+
+	file := storage.File{
+		Raw:        io.NopCloser(bytes.NewReader(data)),
+		FileName:   captionsName(name, lang),
+		ObjectName: captionsName(name, lang),
+		Size:       int64(len(data)),
+		Owner:      video.Owner,
+	}
+
+	if err := ss.storage.Put(ctx, file); err != nil {
+		return storage.Video{}, err
+	}
+
+	return ss.updateVideo(ctx, name, func(video *storage.Video) error {
+		if err := auth.Authorize(ctx, auth.ScopeVideosWrite, video.Owner); err != nil {
+			return err
+		}
+
+		if !slices.Contains(video.Captions, lang) {
+			video.Captions = append(video.Captions, lang)
+			slices.Sort(video.Captions)
+		}
+		return nil
+	})
+}
+
+func (ss *StreamService) Captions(ctx context.Context, name, lang string) (io.ReadCloser, error) {
+	video, err := ss.Video(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(video.Captions, lang) {
+		return nil, ErrCaptionsNotFound
+	}
+
+	file, err := ss.storage.Get(ctx, captionsName(name, lang))
+	if err != nil {
+		return nil, err
+	}
+
+	return served(captionsName(name, lang), file), nil
+}
+
+func (ss *StreamService) RemoveCaptions(ctx context.Context, name, lang string) (storage.Video, error) {
+	video, err := ss.updateVideo(ctx, name, func(video *storage.Video) error {
+		if !canView(ctx, *video) {
+			return ErrVideoNotFound
+		}
+
+		if err := auth.Authorize(ctx, auth.ScopeVideosWrite, video.Owner); err != nil {
+			return err
+		}
+
+		i := slices.Index(video.Captions, lang)
+		if i < 0 {
+			return ErrCaptionsNotFound
+		}
+
+		video.Captions = slices.Delete(video.Captions, i, i+1)
+		return nil
+	})
+	if err != nil {
+		return video, err
+	}
+
+	// captions are no longer referenced, so a leftover file does no harm
+	if err := ss.storage.Remove(ctx, captionsName(name, lang)); err != nil {
+		logging.For(ctx, ss.log).Info(fmt.Sprintf("couldn't remove captions %v of %v: %v", lang, name, err))
+	}
+
+	return video, nil
+}
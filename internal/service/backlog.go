@@ -0,0 +1,18 @@
+package service
+
+// uploads and transcodes, the instance is busy with
+type Backlog struct {
+	// uploads in progress, from writing the source to storing the files
+	Uploads int
+	// running transcodes and their limit (0 if unlimited)
+	Transcodes    int
+	MaxTranscodes int
+}
+
+func (ss *StreamService) Backlog() Backlog {
+	return Backlog{
+		Uploads:       int(ss.uploads.Load()),
+		Transcodes:    ss.transcodes.Len(),
+		MaxTranscodes: ss.transcodes.Cap(),
+	}
+}
@@ -1,25 +1,39 @@
 package service
 
 import (
-	"errors"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/errs"
 )
 
 var (
-	ErrManifestNotFound      = newServiceError("couldn't find requested manifest file")
-	ErrChunkNotFound         = newServiceError("couldn't find requested chunk file")
-	ErrVideoNotFound         = newServiceError("couldn't find requested video file")
-	ErrSegmentationException = newServiceError("couldn't segment the file")
-	ErrNotImplemented        = newServiceError("feature is not implemented")
+	ErrManifestNotFound      = errs.New(errs.NotFound, "manifest_not_found", "couldn't find requested manifest file")
+	ErrChunkNotFound         = errs.New(errs.NotFound, "chunk_not_found", "couldn't find requested chunk file")
+	ErrVideoNotFound         = errs.New(errs.NotFound, "video_not_found", "couldn't find requested video file")
+	ErrSegmentationException = errs.New(errs.Internal, "segmentation_failed", "couldn't segment the file")
+	ErrInvalidManifest       = errs.New(errs.Internal, "invalid_manifest", "segmentation produced invalid manifest")
+	ErrNotImplemented        = errs.New(errs.NotImplemented, "not_implemented", "feature is not implemented")
+	ErrStreamNotFound        = errs.New(errs.NotFound, "stream_not_found", "couldn't find requested stream")
+	ErrStreamKey             = errs.New(errs.Forbidden, "invalid_stream_key", "invalid stream key")
+	ErrStreamLive            = errs.New(errs.Conflict, "stream_live", "stream is live")
+	ErrStreamOffline         = errs.New(errs.NotFound, "stream_offline", "stream is not live")
+	ErrStreamRecorded        = errs.New(errs.Conflict, "stream_recorded", "stream was recorded and can't be published again")
+	ErrPlaylistRequest       = errs.New(errs.Invalid, "segment_too_far", "requested segment is too far ahead of the live edge")
+	ErrPlaylistTimeout       = errs.New(errs.Unavailable, "playlist_timeout", "playlist wasn't updated in time")
+	ErrBlockingReload        = errs.New(errs.Invalid, "blocking_reload_unsupported", "blocking playlist reload requires low-latency mode")
+	ErrNoRedirect            = errs.New(errs.Internal, "no_redirect", "file can't be served with a redirect")
+	ErrInvalidMetadata       = errs.New(errs.Invalid, "invalid_metadata", "invalid video metadata")
+	ErrVideoModified         = errs.New(errs.Precondition, "video_modified", "video was modified, since it was fetched")
+	ErrThumbnailNotFound     = errs.New(errs.NotFound, "thumbnail_not_found", "couldn't find thumbnail of the video")
+	ErrCaptionsNotFound      = errs.New(errs.NotFound, "captions_not_found", "couldn't find captions in requested language")
+	ErrInvalidCaptions       = errs.New(errs.Invalid, "invalid_captions", "captions should be a webvtt file of at most 1MB")
+	ErrInvalidLanguage       = errs.New(errs.Invalid, "invalid_language", "invalid language tag")
+	ErrUserNotFound          = errs.New(errs.NotFound, "user_not_found", "couldn't find requested user")
+	ErrInvalidUser           = errs.New(errs.Invalid, "invalid_user", "invalid user")
+	ErrAPIKeyNotFound        = errs.New(errs.NotFound, "api_key_not_found", "couldn't find requested api key")
+	ErrUploadNotFound        = errs.New(errs.NotFound, "upload_not_found", "couldn't find requested upload")
+	ErrUploadOffset          = errs.New(errs.Conflict, "upload_offset", "chunk doesn't start at the end of the received data")
+	ErrUploadBusy            = errs.New(errs.Conflict, "upload_busy", "another chunk of the upload is being received")
+	ErrUploadSize            = errs.New(errs.Invalid, "upload_size", "uploaded data doesn't match the declared size")
+	ErrTranscodesBusy        = errs.New(errs.Limited, "transcodes_busy", "too many videos are being processed, try again later").After(30 * time.Second)
 )
-
-type ServiceError struct {
-	err error
-}
-
-func newServiceError(message string) *ServiceError {
-	return &ServiceError{
-		err: errors.New(message),
-	}
-}
-
-func (se ServiceError) Error() string { return se.err.Error() }
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/logging"
+	"github.com/cutlery47/gostream/internal/metrics"
+	"github.com/cutlery47/gostream/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// runs the ffmpeg command, tracing and measuring it as the step of the processing
+// output of the failed runs is logged
+func runFFmpeg(ctx context.Context, log *zap.Logger, step string, cmd *exec.Cmd) (err error) {
+	_, span := tracing.Start(ctx, "ffmpeg "+step,
+		attribute.String("ffmpeg.step", step),
+		attribute.String("ffmpeg.args", strings.Join(cmd.Args[1:], " ")),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	metrics.TranscodeDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.TranscodeFailures.WithLabelValues(step).Inc()
+		logging.For(ctx, log).Info(fmt.Sprintf("ffmpeg %v failed: %v", step, err), zap.String("output", string(out)))
+	}
+
+	return err
+}
@@ -0,0 +1,440 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/live"
+	"github.com/cutlery47/gostream/internal/logging"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/cutlery47/gostream/internal/tracing"
+	"github.com/cutlery47/gostream/internal/utils"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// service, responsible for live streams
+type LiveService interface {
+	CreateStream(ctx context.Context, name string) (storage.LiveStream, error)
+	GetStream(ctx context.Context, name string) (storage.LiveStream, error)
+	DeleteStream(ctx context.Context, name string) error
+	// starts packaging of the stream, published with the key
+	// stream is written into the returned writer (in the ingest format), closing it ends the stream
+	Publish(ctx context.Context, key string, ingest live.Ingest) (io.WriteCloser, error)
+	// returns ingest statistics of the live stream
+	Stats(ctx context.Context, name string) (live.Stats, error)
+}
+
+type LiveStreamService struct {
+	streams storage.StreamRepository
+	videos  storage.VideoRepository
+	storage storage.Storage
+	// playlists of the streams, which are live at the moment
+	manager *live.Manager
+
+	cfg     config.LiveConfig
+	infoLog *zap.Logger
+	errLog  *zap.Logger
+}
+
+func NewLiveStreamService(infoLog, errLog *zap.Logger, cfg config.LiveConfig, streams storage.StreamRepository, videos storage.VideoRepository, storage storage.Storage, manager *live.Manager) *LiveStreamService {
+	return &LiveStreamService{
+		streams: streams,
+		videos:  videos,
+		storage: storage,
+		manager: manager,
+
+		cfg:     cfg,
+		infoLog: infoLog,
+		errLog:  errLog,
+	}
+}
+
+func (ls *LiveStreamService) CreateStream(ctx context.Context, name string) (storage.LiveStream, error) {
+	creator, err := auth.RequireScope(ctx, auth.ScopeVideosWrite)
+	if err != nil {
+		return storage.LiveStream{}, err
+	}
+
+	// playlist of the stream would shadow the one of the video
+	if _, err := ls.videos.ReadVideo(ctx, name); err == nil {
+		return storage.LiveStream{}, storage.ErrUniueVideo
+	} else if !errors.Is(err, storage.ErrDBNotFound) {
+		return storage.LiveStream{}, err
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return storage.LiveStream{}, err
+	}
+
+	stream := storage.LiveStream{
+		Name:  name,
+		Key:   hex.EncodeToString(key),
+		State: storage.StreamIdle,
+		// recording of the stream is accounted to its creator
+		Owner: creator.UserID,
+	}
+
+	if err := ls.streams.CreateStream(ctx, stream); err != nil {
+		return storage.LiveStream{}, err
+	}
+
+	return ls.streams.ReadStream(ctx, name)
+}
+
+func (ls *LiveStreamService) GetStream(ctx context.Context, name string) (storage.LiveStream, error) {
+	stream, err := ls.streams.ReadStream(ctx, name)
+	if errors.Is(err, storage.ErrDBNotFound) {
+		return stream, ErrStreamNotFound.Wrap(err)
+	}
+
+	return stream, err
+}
+
+func (ls *LiveStreamService) DeleteStream(ctx context.Context, name string) error {
+	if _, err := auth.RequireScope(ctx, auth.ScopeVideosDelete); err != nil {
+		return err
+	}
+
+	stream, err := ls.GetStream(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// streams are deleted by their owners, just like videos
+	if err := auth.Authorize(ctx, auth.ScopeVideosDelete, stream.Owner); err != nil {
+		return err
+	}
+
+	if stream.State == storage.StreamLive {
+		return ErrStreamLive
+	}
+
+	return ls.streams.DeleteStream(ctx, name)
+}
+
+func (ls *LiveStreamService) Stats(ctx context.Context, name string) (live.Stats, error) {
+	if _, err := ls.GetStream(ctx, name); err != nil {
+		return live.Stats{}, err
+	}
+
+	stats, ok := ls.manager.Stats(tenant.Qualify(ctx, name))
+	if !ok {
+		return stats, ErrStreamOffline
+	}
+
+	return stats, nil
+}
+
+func (ls *LiveStreamService) Publish(ctx context.Context, key string, ingest live.Ingest) (io.WriteCloser, error) {
+	stream, err := ls.streams.ReadStreamByKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrDBNotFound) {
+			return nil, ErrStreamKey
+		}
+		return nil, err
+	}
+
+	// the key tells, which tenant the stream belongs to
+	ctx = tenant.NewContext(ctx, stream.Tenant)
+
+	if stream.State == storage.StreamLive {
+		return nil, ErrStreamLive
+	}
+
+	// new session would overwrite segments of the recording
+	if ls.cfg.Record && stream.State == storage.StreamEnded {
+		return nil, ErrStreamRecorded
+	}
+
+	// concurrent publishers of the same key are told apart by the db, only one of them goes live
+	from := []storage.StreamState{storage.StreamIdle}
+	if !ls.cfg.Record {
+		from = append(from, storage.StreamEnded)
+	}
+
+	if err := ls.streams.SwapStreamState(ctx, stream.Name, from, storage.StreamLive); err != nil {
+		if errors.Is(err, storage.ErrStreamState) {
+			return nil, ErrStreamLive
+		}
+		return nil, err
+	}
+
+	// with low-latency hls enabled, the packager produces parts instead of segments
+	prefix, segTime := stream.Name, float64(ls.cfg.SegmentTime)
+	if ls.cfg.PartTarget > 0 {
+		prefix, segTime = stream.Name+"_part", ls.cfg.PartTarget.Seconds()
+	}
+
+	packager, err := live.StartPackager(path.Join(ls.cfg.Path, tenant.Qualify(ctx, stream.Name)), prefix, ingest.Format, segTime)
+	if err != nil {
+		// stream can be published again
+		if stateErr := ls.streams.UpdateStreamState(ctx, stream.Name, stream.State); stateErr != nil {
+			logging.For(ctx, ls.errLog).Error(fmt.Sprintf("stream %v: couldn't restore state: %v", stream.Name, stateErr))
+		}
+		return nil, err
+	}
+
+	logging.For(ctx, ls.infoLog).Info(fmt.Sprintf("stream %v went live over %v", stream.Name, ingest.Protocol))
+
+	meter := live.NewMeter(packager)
+
+	// segments are published independently of the ingest connection
+	go ls.publish(stream, packager, ingest, meter)
+
+	return meter, nil
+}
+
+// stores segments as they are produced, while the playlist is served from memory
+func (ls *LiveStreamService) publish(stream storage.LiveStream, packager *live.Packager, ingest live.Ingest, meter *live.Meter) {
+	ctx := logging.WithVideo(tenant.NewContext(context.Background(), stream.Tenant), stream.Name)
+
+	// streams of the tenants may share names
+	pl := ls.manager.Start(tenant.Qualify(ctx, stream.Name), ingest, meter)
+	defer ls.manager.Stop(tenant.Qualify(ctx, stream.Name))
+
+	// all the segments of the stream, if it is recorded
+	var recording []live.Segment
+
+	// stores finished segment and removes the ones, which have left the window
+	finish := func(segment *live.Segment, expired []string, err error) {
+		if err != nil {
+			logging.For(ctx, ls.errLog).Error(fmt.Sprintf("stream %v: couldn't store segment: %v", stream.Name, err))
+		}
+
+		if !ls.cfg.Record {
+			ls.removeSegments(ctx, stream.Name, expired)
+		} else if segment != nil {
+			recording = append(recording, *segment)
+		}
+	}
+
+	// reported once per stream
+	var overlong bool
+
+	for chunk := range packager.Segments() {
+		if ls.cfg.PartTarget > 0 {
+			if chunk.Duration > ls.cfg.PartTarget.Seconds() && !overlong {
+				overlong = true
+				logging.For(ctx, ls.errLog).Error(fmt.Sprintf("stream %v: part of %.3fs exceeds the part target, keyframe interval of the encoder is too long", stream.Name, chunk.Duration))
+			}
+			finish(ls.appendPart(ctx, stream, pl, chunk))
+		} else {
+			// target duration of the playlist is fixed at the segment time
+			if int(math.Round(chunk.Duration)) > ls.cfg.SegmentTime && !overlong {
+				overlong = true
+				logging.For(ctx, ls.errLog).Error(fmt.Sprintf("stream %v: segment of %.3fs exceeds the target duration, keyframe interval of the encoder is too long", stream.Name, chunk.Duration))
+			}
+			finish(ls.appendSegment(ctx, stream, pl, chunk))
+		}
+	}
+
+	if err := packager.Err(); err != nil {
+		logging.For(ctx, ls.errLog).Error(fmt.Sprintf("stream %v: packager failed: %v", stream.Name, err))
+	}
+
+	// parts of the unfinished segment
+	if last, expired := pl.Flush(); last != nil {
+		segment, err := ls.putAssembled(ctx, stream, last)
+		finish(segment, expired, err)
+	}
+
+	expired := pl.End()
+
+	if ls.cfg.Record {
+		if err := ls.record(ctx, stream, recording); err != nil {
+			logging.For(ctx, ls.errLog).Error(fmt.Sprintf("stream %v: couldn't record: %v", stream.Name, err))
+		}
+	} else {
+		ls.removeSegments(ctx, stream.Name, expired)
+
+		// final playlist outlives the stream, so it is persisted
+		if err := ls.putPlaylist(ctx, stream, pl.Encode()); err != nil {
+			logging.For(ctx, ls.errLog).Error(fmt.Sprintf("stream %v: couldn't store playlist: %v", stream.Name, err))
+		}
+	}
+
+	if err := ls.streams.UpdateStreamState(ctx, stream.Name, storage.StreamEnded); err != nil {
+		logging.For(ctx, ls.errLog).Error(fmt.Sprintf("stream %v: couldn't update state: %v", stream.Name, err))
+	}
+
+	logging.For(ctx, ls.infoLog).Info(fmt.Sprintf("stream %v ended", stream.Name))
+}
+
+// turns finished stream into a vod, served the same way as uploaded videos
+// the vod belongs to the owner of the stream
+func (ls *LiveStreamService) record(ctx context.Context, stream storage.LiveStream, segments []live.Segment) (err error) {
+	name := stream.Name
+
+	ctx, span := tracing.Start(ctx, "LiveStreamService.record", attribute.String("video.name", name))
+	defer func() { tracing.End(span, err) }()
+
+	ctx = logging.WithVideo(ctx, name)
+
+	vod := live.Recording(segments, ls.cfg.SegmentTime)
+	if err := ls.putPlaylist(ctx, stream, vod.Encode()); err != nil {
+		return err
+	}
+
+	// recording is listed along with the uploaded videos
+	record := storage.Video{
+		ID:         uuid.NewString(),
+		Name:       name,
+		Title:      name,
+		Status:     storage.VideoReady,
+		Visibility: storage.VisibilityPublic,
+		Owner:      stream.Owner,
+	}
+	for _, segment := range segments {
+		record.Duration += segment.Duration
+	}
+
+	if err := ls.videos.CreateVideo(ctx, record); err != nil {
+		return err
+	}
+
+	if !ls.cfg.RecordMP4 {
+		return nil
+	}
+
+	// local segment copies are kept only for remuxing
+	defer func() {
+		for _, segment := range segments {
+			os.Remove(segment.Path)
+		}
+	}()
+
+	dir := path.Join(ls.cfg.Path, tenant.Qualify(ctx, name))
+	listPath := path.Join(dir, "concat.txt")
+	videoPath := path.Join(dir, name+".mp4")
+
+	var list bytes.Buffer
+	for _, segment := range segments {
+		fmt.Fprintf(&list, "file '%v'\n", segment.Path)
+	}
+
+	if err := os.WriteFile(listPath, list.Bytes(), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(listPath)
+
+	if err := runFFmpeg(ctx, ls.infoLog, "remux", utils.RemuxSegments(listPath, videoPath)); err != nil {
+		return ErrSegmentationException.Wrap(err)
+	}
+	defer os.Remove(videoPath)
+
+	fd, err := os.Open(videoPath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	// source video is stored under the video name, just like uploaded ones
+	video, err := storage.FromFD(fd, name)
+	if err != nil {
+		return err
+	}
+	video.Owner = stream.Owner
+
+	return ls.storage.Put(ctx, *video)
+}
+
+func (ls *LiveStreamService) appendSegment(ctx context.Context, stream storage.LiveStream, pl *live.Playlist, segment live.Segment) (*live.Segment, []string, error) {
+	if err := ls.putSegment(ctx, stream, segment); err != nil {
+		return nil, nil, fmt.Errorf("%v: %w", segment.Name, err)
+	}
+
+	return &segment, pl.Append(segment), nil
+}
+
+// parts are served from memory, only assembled segments are stored
+func (ls *LiveStreamService) appendPart(ctx context.Context, stream storage.LiveStream, pl *live.Playlist, part live.Segment) (*live.Segment, []string, error) {
+	data, err := os.ReadFile(part.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %w", part.Name, err)
+	}
+	os.Remove(part.Path)
+
+	assembled, expired := pl.AppendPart(data, part.Duration)
+	if assembled == nil {
+		return nil, expired, nil
+	}
+
+	segment, err := ls.putAssembled(ctx, stream, assembled)
+	return segment, expired, err
+}
+
+// assembled segment goes through the local file, just like the packaged ones
+func (ls *LiveStreamService) putAssembled(ctx context.Context, stream storage.LiveStream, assembled *live.AssembledSegment) (*live.Segment, error) {
+	segment := live.Segment{
+		Name:     assembled.Name,
+		Path:     path.Join(ls.cfg.Path, tenant.Qualify(ctx, stream.Name), assembled.Name),
+		Duration: assembled.Duration,
+	}
+
+	if err := os.WriteFile(segment.Path, assembled.Data, 0644); err != nil {
+		return nil, fmt.Errorf("%v: %w", segment.Name, err)
+	}
+
+	if err := ls.putSegment(ctx, stream, segment); err != nil {
+		return nil, fmt.Errorf("%v: %w", segment.Name, err)
+	}
+
+	return &segment, nil
+}
+
+// removes segments, which have left the live window
+func (ls *LiveStreamService) removeSegments(ctx context.Context, stream string, names []string) {
+	for _, name := range names {
+		if err := ls.storage.Remove(ctx, name); err != nil {
+			logging.For(ctx, ls.errLog).Error(fmt.Sprintf("stream %v: couldn't remove segment %v: %v", stream, name, err))
+		}
+	}
+}
+
+// files of the stream are accounted to its owner
+func (ls *LiveStreamService) putSegment(ctx context.Context, stream storage.LiveStream, segment live.Segment) error {
+	fd, err := os.Open(segment.Path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	// local copy is needed for remuxing the recording
+	if !ls.cfg.Record || !ls.cfg.RecordMP4 {
+		defer os.Remove(segment.Path)
+	}
+
+	file, err := storage.FromFD(fd, segment.Name)
+	if err != nil {
+		return err
+	}
+	file.Owner = stream.Owner
+
+	return ls.storage.Put(ctx, *file)
+}
+
+func (ls *LiveStreamService) putPlaylist(ctx context.Context, stream storage.LiveStream, raw []byte) error {
+	filename := stream.Name + ".m3u8"
+
+	return ls.storage.Put(ctx, storage.File{
+		Raw:        io.NopCloser(bytes.NewReader(raw)),
+		FileName:   filename,
+		ObjectName: filename,
+		Size:       int64(len(raw)),
+		Owner:      stream.Owner,
+	})
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/live"
+	"github.com/cutlery47/gostream/internal/storage"
+	"go.uber.org/zap"
+)
+
+func newTestLiveService(t *testing.T) (*LiveStreamService, storage.VideoRepository) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	videos := storage.NewLocalVideoRepository(path.Join(dir, "videos.json"))
+	keys := storage.NewLocalKeyRepository(path.Join(dir, "keys.json"))
+	local := storage.NewLocalStorage(zap.NewNop(), config.LocalConfig{
+		ManifestPath: path.Join(dir, "manifests"),
+		ChunkPath:    path.Join(dir, "chunks"),
+		VideoPath:    path.Join(dir, "videos"),
+		IndexPath:    dir,
+	}, config.QuotaConfig{}, keys, videos)
+
+	cfg := config.LiveConfig{Path: dir, SegmentTime: 2, Record: true}
+	streams := storage.NewLocalStreamRepository(path.Join(dir, "streams.json"))
+
+	return NewLiveStreamService(zap.NewNop(), zap.NewNop(), cfg, streams, videos, local, nil), videos
+}
+
+func TestRecord(t *testing.T) {
+	ctx := context.Background()
+	ls, videos := newTestLiveService(t)
+
+	stream := storage.LiveStream{Name: "show", Owner: "alice"}
+	segments := []live.Segment{{Name: "show_0.ts", Duration: 2}, {Name: "show_1.ts", Duration: 1.5}}
+
+	if err := ls.record(ctx, stream, segments); err != nil {
+		t.Fatal(err)
+	}
+
+	byName, err := videos.ReadVideo(ctx, "show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byName.ID == "" {
+		t.Fatal("recording has no id")
+	}
+
+	// v2 routes look the recording up by its id
+	byID, err := videos.ReadVideoByID(ctx, byName.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byID.Name != "show" || byID.Owner != "alice" || byID.Duration != 3.5 {
+		t.Errorf("got %+v", byID)
+	}
+}
+
+func TestDeleteStream(t *testing.T) {
+	ls, _ := newTestLiveService(t)
+
+	principal := func(id string) context.Context {
+		p := auth.Principal{UserID: id, Role: storage.RoleUploader, Scopes: auth.RoleScopes(storage.RoleUploader)}
+		return auth.NewContext(context.Background(), p)
+	}
+
+	if _, err := ls.CreateStream(principal("alice"), "show"); err != nil {
+		t.Fatal(err)
+	}
+
+	// delete scope alone doesn't allow removing streams of the others
+	if err := ls.DeleteStream(principal("bob"), "show"); !errors.Is(err, auth.ErrForbidden) {
+		t.Fatalf("got %v, want ErrForbidden", err)
+	}
+
+	if err := ls.DeleteStream(principal("alice"), "show"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ls.GetStream(context.Background(), "show"); !errors.Is(err, ErrStreamNotFound) {
+		t.Errorf("got %v, want ErrStreamNotFound", err)
+	}
+}
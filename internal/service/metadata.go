@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/errs"
+	"github.com/cutlery47/gostream/internal/storage"
+)
+
+// metadata limits
+const (
+	maxTitleLength       = 256
+	maxDescriptionLength = 5000
+	maxTags              = 32
+	maxTagLength         = 64
+	maxAttributes        = 32
+	maxAttributeLength   = 1024
+	// concurrent updates are retried this many times
+	maxUpdateAttempts = 5
+)
+
+var attributeKey = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// changes of the video metadata, nil fields are left as is
+type VideoPatch struct {
+	Title       *string
+	Description *string
+	Tags        *[]string
+	// merged into the existing attributes, nil values remove them
+	Attributes map[string]*string
+	Visibility *storage.Visibility
+}
+
+func (p VideoPatch) apply(video *storage.Video) {
+	if p.Title != nil {
+		video.Title = *p.Title
+	}
+	if p.Description != nil {
+		video.Description = *p.Description
+	}
+	if p.Tags != nil {
+		video.Tags = *p.Tags
+	}
+	if p.Visibility != nil {
+		video.Visibility = *p.Visibility
+	}
+
+	if len(p.Attributes) > 0 && video.Attributes == nil {
+		video.Attributes = make(map[string]string)
+	}
+	for key, value := range p.Attributes {
+		if value == nil {
+			delete(video.Attributes, key)
+		} else {
+			video.Attributes[key] = *value
+		}
+	}
+}
+
+// private videos of the others aren't found
+func (ss *StreamService) Video(ctx context.Context, name string) (storage.Video, error) {
+	video, err := ss.readVideo(ctx, name)
+	if err == nil && !canView(ctx, video) {
+		return storage.Video{}, ErrVideoNotFound
+	}
+	return video, err
+}
+
+func (ss *StreamService) VideoByID(ctx context.Context, id string) (storage.Video, error) {
+	video, err := ss.videos.ReadVideoByID(ctx, id)
+	if errors.Is(err, storage.ErrDBNotFound) {
+		return video, ErrVideoNotFound.Wrap(err)
+	}
+	if err == nil && !canView(ctx, video) {
+		return storage.Video{}, ErrVideoNotFound
+	}
+	return video, err
+}
+
+// reads the video, regardless of its visibility
+func (ss *StreamService) readVideo(ctx context.Context, name string) (storage.Video, error) {
+	video, err := ss.videos.ReadVideo(ctx, name)
+	if errors.Is(err, storage.ErrDBNotFound) {
+		return video, ErrVideoNotFound.Wrap(err)
+	}
+	return video, err
+}
+
+func (ss *StreamService) UpdateVideo(ctx context.Context, name string, patch VideoPatch, version int) (storage.Video, error) {
+	return ss.updateVideo(ctx, name, func(video *storage.Video) error {
+		if !canView(ctx, *video) {
+			return ErrVideoNotFound
+		}
+
+		if err := auth.Authorize(ctx, auth.ScopeVideosWrite, video.Owner); err != nil {
+			return err
+		}
+
+		if version != 0 && video.Version != version {
+			return ErrVideoModified
+		}
+
+		patch.apply(video)
+		return validateVideo(*video)
+	})
+}
+
+// applies the change to the latest version of the video record, retrying on concurrent updates
+func (ss *StreamService) updateVideo(ctx context.Context, name string, change func(video *storage.Video) error) (video storage.Video, err error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		if video, err = ss.readVideo(ctx, name); err != nil {
+			return video, err
+		}
+
+		if err := change(&video); err != nil {
+			return video, err
+		}
+
+		err = ss.videos.UpdateVideo(ctx, video)
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			continue
+		}
+		if err != nil {
+			return video, err
+		}
+
+		video.Version++
+		return video, nil
+	}
+
+	return video, ErrVideoModified
+}
+
+// reports every invalid field at once
+func validateVideo(video storage.Video) error {
+	var fields []errs.FieldError
+	invalid := func(field, format string, args ...any) {
+		fields = append(fields, errs.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if video.Title == "" || utf8.RuneCountInString(video.Title) > maxTitleLength {
+		invalid("title", "should be 1 to %v characters long", maxTitleLength)
+	}
+
+	if utf8.RuneCountInString(video.Description) > maxDescriptionLength {
+		invalid("description", "should be at most %v characters long", maxDescriptionLength)
+	}
+
+	switch video.Visibility {
+	case storage.VisibilityPublic, storage.VisibilityUnlisted, storage.VisibilityPrivate:
+	default:
+		invalid("visibility", "should be public, unlisted or private")
+	}
+
+	if len(video.Tags) > maxTags {
+		invalid("tags", "at most %v tags are allowed", maxTags)
+	}
+	for i, tag := range video.Tags {
+		// tags are passed comma-separated on upload
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength || strings.Contains(tag, ",") {
+			invalid(fmt.Sprintf("tags[%v]", i), "should be 1 to %v characters long, without commas", maxTagLength)
+		}
+	}
+
+	if len(video.Attributes) > maxAttributes {
+		invalid("attributes", "at most %v attributes are allowed", maxAttributes)
+	}
+	for key, value := range video.Attributes {
+		if !attributeKey.MatchString(key) {
+			invalid("attributes."+key, "key should consist of 1 to 64 letters, digits, '_', '.' or '-'")
+		} else if utf8.RuneCountInString(value) > maxAttributeLength {
+			invalid("attributes."+key, "should be at most %v characters long", maxAttributeLength)
+		}
+	}
+
+	if len(fields) > 0 {
+		// map iteration order is random
+		slices.SortFunc(fields, func(a, b errs.FieldError) int { return strings.Compare(a.Field, b.Field) })
+		return ErrInvalidMetadata.WithFields(fields...)
+	}
+
+	return nil
+}
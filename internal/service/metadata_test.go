@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/errs"
+	"github.com/cutlery47/gostream/internal/storage"
+)
+
+func TestValidateVideo(t *testing.T) {
+	valid := storage.Video{
+		Title:      "Clip",
+		Visibility: storage.VisibilityPublic,
+		Tags:       []string{"music"},
+		Attributes: map[string]string{"lang": "en"},
+	}
+
+	many := func(n int) []string {
+		tags := make([]string, n)
+		for i := range tags {
+			tags[i] = "tag"
+		}
+		return tags
+	}
+
+	cases := map[string]struct {
+		change func(video *storage.Video)
+		// invalid fields, in the reported order
+		fields []string
+	}{
+		"valid": {func(v *storage.Video) {}, nil},
+		// limits are counted in characters, not bytes
+		"longest title":      {func(v *storage.Video) { v.Title = strings.Repeat("я", maxTitleLength) }, nil},
+		"empty title":        {func(v *storage.Video) { v.Title = "" }, []string{"title"}},
+		"long title":         {func(v *storage.Video) { v.Title = strings.Repeat("a", maxTitleLength+1) }, []string{"title"}},
+		"long description":   {func(v *storage.Video) { v.Description = strings.Repeat("a", maxDescriptionLength+1) }, []string{"description"}},
+		"unknown visibility": {func(v *storage.Video) { v.Visibility = "hidden" }, []string{"visibility"}},
+		"most tags":          {func(v *storage.Video) { v.Tags = many(maxTags) }, nil},
+		"too many tags":      {func(v *storage.Video) { v.Tags = many(maxTags + 1) }, []string{"tags"}},
+		"empty tag":          {func(v *storage.Video) { v.Tags = []string{"music", ""} }, []string{"tags[1]"}},
+		"tag with comma":     {func(v *storage.Video) { v.Tags = []string{"a,b"} }, []string{"tags[0]"}},
+		"long tag":           {func(v *storage.Video) { v.Tags = []string{strings.Repeat("a", maxTagLength+1)} }, []string{"tags[0]"}},
+		"attribute key":      {func(v *storage.Video) { v.Attributes = map[string]string{"bad key": "x"} }, []string{"attributes.bad key"}},
+		"long attribute": {func(v *storage.Video) {
+			v.Attributes = map[string]string{"lang": strings.Repeat("a", maxAttributeLength+1)}
+		}, []string{"attributes.lang"}},
+		"empty attribute key": {func(v *storage.Video) { v.Attributes = map[string]string{"": "x"} }, []string{"attributes."}},
+		// every field is reported at once, sorted by name
+		"several": {
+			func(v *storage.Video) {
+				v.Title, v.Visibility = "", "hidden"
+				v.Attributes = map[string]string{"b!": "x", "a!": "y"}
+			},
+			[]string{"attributes.a!", "attributes.b!", "title", "visibility"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			video := valid
+			tc.change(&video)
+
+			err := validateVideo(video)
+			if tc.fields == nil {
+				if err != nil {
+					t.Fatalf("got %v", err)
+				}
+				return
+			}
+
+			e := errs.From(err)
+			if !errors.Is(err, ErrInvalidMetadata) || e == nil {
+				t.Fatalf("got %v, want ErrInvalidMetadata", err)
+			}
+
+			var got []string
+			for _, field := range e.Fields {
+				got = append(got, field.Field)
+			}
+			if strings.Join(got, " | ") != strings.Join(tc.fields, " | ") {
+				t.Errorf("got fields %q, want %q", got, tc.fields)
+			}
+		})
+	}
+}
+
+func TestUpdateVideo(t *testing.T) {
+	videos := storage.NewLocalVideoRepository(path.Join(t.TempDir(), "videos.json"))
+	ss := &StreamService{videos: videos}
+
+	ctx := uploader("alice")
+	if err := videos.CreateVideo(ctx, storage.Video{Name: "clip", Title: "Clip", Owner: "alice", Visibility: storage.VisibilityPublic, Attributes: map[string]string{"lang": "en", "year": "2024"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	title := "New title"
+	patch := VideoPatch{Title: &title, Attributes: map[string]*string{"year": nil, "genre": &title}}
+
+	video, err := ss.UpdateVideo(ctx, "clip", patch, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// attributes are merged, the version is the one of the stored record
+	want := map[string]string{"lang": "en", "genre": title}
+	if video.Title != title || video.Version != 2 || !maps.Equal(video.Attributes, want) {
+		t.Errorf("got %+v", video)
+	}
+	if stored, _ := videos.ReadVideo(ctx, "clip"); stored.Version != video.Version || stored.Title != title {
+		t.Errorf("stored %+v", stored)
+	}
+
+	empty := ""
+	cases := map[string]struct {
+		ctx     context.Context
+		name    string
+		patch   VideoPatch
+		version int
+		err     error
+	}{
+		// the version, the client has fetched, is outdated
+		"stale version": {ctx, "clip", VideoPatch{Title: &title}, 1, ErrVideoModified},
+		"invalid":       {ctx, "clip", VideoPatch{Title: &empty}, 2, ErrInvalidMetadata},
+		"other user":    {uploader("bob"), "clip", VideoPatch{Title: &title}, 2, auth.ErrForbidden},
+		"unknown video": {ctx, "missing", VideoPatch{Title: &title}, 0, ErrVideoNotFound},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ss.UpdateVideo(tc.ctx, tc.name, tc.patch, tc.version); !errors.Is(err, tc.err) {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+		})
+	}
+
+	// rejected updates aren't stored, any version matches 0
+	if video, err := ss.UpdateVideo(ctx, "clip", VideoPatch{Description: &title}, 0); err != nil || video.Version != 3 {
+		t.Errorf("got %+v, %v", video, err)
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"io"
+	"path"
+
+	"github.com/cutlery47/gostream/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// type of the served file, used as a metric label
+func assetType(filename string) string {
+	switch path.Ext(filename) {
+	case "", ".mp4":
+		return "video"
+	case ".m3u8":
+		return "playlist"
+	case ".ts", ".m4s":
+		return "segment"
+	case ".jpg":
+		return "thumbnail"
+	case ".vtt":
+		return "captions"
+	default:
+		return "other"
+	}
+}
+
+// counts bytes of the file, as they are read by the client
+type servedReader struct {
+	io.ReadCloser
+	served prometheus.Counter
+}
+
+func (r *servedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.served.Add(float64(n))
+	return n, err
+}
+
+// seekable files stay seekable, so that they could be served in ranges
+type servedSeeker struct {
+	*servedReader
+	io.Seeker
+}
+
+func served(filename string, file io.ReadCloser) io.ReadCloser {
+	r := &servedReader{ReadCloser: file, served: metrics.ServedBytes.WithLabelValues(assetType(filename))}
+	if seeker, ok := file.(io.Seeker); ok {
+		return &servedSeeker{servedReader: r, Seeker: seeker}
+	}
+	return r
+}
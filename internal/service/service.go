@@ -1,59 +1,317 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/drm"
+	"github.com/cutlery47/gostream/internal/live"
+	"github.com/cutlery47/gostream/internal/logging"
+	"github.com/cutlery47/gostream/internal/metrics"
+	"github.com/cutlery47/gostream/internal/playlist"
+	"github.com/cutlery47/gostream/internal/ratelimit"
 	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/cutlery47/gostream/internal/tracing"
 	"github.com/cutlery47/gostream/internal/utils"
+	"github.com/cutlery47/gostream/pkg/m3u8"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
 // service, responsible for all data manipulations
 type Service interface {
-	Upload(ctx context.Context, videoReader io.ReadCloser, videoName string) error
+	Upload(ctx context.Context, videoReader io.ReadCloser, videoName string, meta UploadMeta) error
+	// same as Upload, but stores the video under a generated id
+	UploadVideo(ctx context.Context, videoReader io.ReadCloser, meta UploadMeta) (storage.Video, error)
+	// starts resumable upload of the file of the given size
+	CreateUpload(ctx context.Context, filename string, size int64, meta UploadMeta) (UploadSession, error)
+	UploadSession(ctx context.Context, id string) (UploadSession, error)
+	// appends the chunk, which should start at the offset of the upload
+	// once the whole file is received, the video is processed and returned
+	AppendUpload(ctx context.Context, id string, offset int64, chunk io.Reader) (UploadSession, *storage.Video, error)
+	CancelUpload(ctx context.Context, id string) error
 	Remove(ctx context.Context, filename string) error
+	// removes the video along with every file of it (playlist, segments, thumbnail, captions)
+	RemoveVideo(ctx context.Context, name string) error
+	// returns single page of the videos, matching the query
+	ListVideos(ctx context.Context, query storage.VideoQuery) (storage.VideoPage, error)
+	Video(ctx context.Context, name string) (storage.Video, error)
+	VideoByID(ctx context.Context, id string) (storage.Video, error)
+	// edits video metadata, if the video is still of the given version (0 skips the check)
+	UpdateVideo(ctx context.Context, name string, patch VideoPatch, version int) (storage.Video, error)
 	Serve(ctx context.Context, filename string) (io.ReadCloser, error)
+	// returns playlist, rendered for a particular client
+	// block holds the request, until the live playlist is updated (nil doesn't block)
+	ServePlaylist(ctx context.Context, filename string, opts playlist.Options, block *live.Block) ([]byte, error)
+	// returns short-lived url, from which the file can be fetched bypassing the service
+	ServeURL(ctx context.Context, filename string) (string, error)
+	// checks if the caller may play the files of the video, the file belongs to
+	CheckPlayback(ctx context.Context, filename string) error
+	// returns segments of the stored video playlist
+	Segments(ctx context.Context, name string) ([]m3u8.Segment, error)
+	Thumbnail(ctx context.Context, name string) (io.ReadCloser, error)
+	// stores webvtt captions of the video in the given language, replacing the existing ones
+	PutCaptions(ctx context.Context, name, lang string, captions io.Reader) (storage.Video, error)
+	Captions(ctx context.Context, name, lang string) (io.ReadCloser, error)
+	RemoveCaptions(ctx context.Context, name, lang string) (storage.Video, error)
+	// returns usage of the user (the caller, if empty) and of the whole tenant
+	Usage(ctx context.Context, userID string) (user, tenant Usage, err error)
+}
+
+// description of the uploaded video
+type UploadMeta struct {
+	// video name is used, if empty
+	Title       string
+	Description string
+	Tags        []string
+	Attributes  map[string]string
+	// public, if empty
+	Visibility storage.Visibility
 }
 
 type StreamService struct {
 	storage storage.Storage
+	videos  storage.VideoRepository
+	// videos can't take the names of the live streams
+	streams storage.StreamRepository
+
+	// encryption scheme of the packaged output
+	scheme drm.Scheme
+	// lifetime of urls returned by ServeURL
+	urlTTL time.Duration
+	// renders stored playlists on serve
+	renderer *playlist.Renderer
+	// playlists of the live streams are served from memory
+	live *live.Manager
+	// limits ffmpeg processes, run by uploads at once
+	transcodes *ratelimit.Semaphore
+	// uploads, being processed at the moment
+	uploads atomic.Int64
+	// resumable uploads, receiving a chunk at the moment
+	appending sync.Map
 
-	cfg config.LocalConfig
-	log *zap.Logger
+	cfg   config.LocalConfig
+	quota config.QuotaConfig
+	log   *zap.Logger
 }
 
-func NewStreamService(log *zap.Logger, cfg config.LocalConfig, storage storage.Storage) *StreamService {
+func NewStreamService(log *zap.Logger, cfg config.LocalConfig, quota config.QuotaConfig, storage storage.Storage, videos storage.VideoRepository, streams storage.StreamRepository, scheme drm.Scheme, urlTTL time.Duration, renderer *playlist.Renderer, live *live.Manager, transcodes *ratelimit.Semaphore) *StreamService {
 	return &StreamService{
-		storage: storage,
+		storage:    storage,
+		videos:     videos,
+		streams:    streams,
+		scheme:     scheme,
+		urlTTL:     urlTTL,
+		renderer:   renderer,
+		live:       live,
+		transcodes: transcodes,
+
+		cfg:   cfg,
+		quota: quota,
+		log:   log,
+	}
+}
 
-		cfg: cfg,
-		log: log,
+func (ss *StreamService) Upload(ctx context.Context, videoReader io.ReadCloser, videoName string, meta UploadMeta) error {
+	return ss.upload(ctx, videoReader, uuid.NewString(), videoName, meta)
+}
+
+func (ss *StreamService) UploadVideo(ctx context.Context, videoReader io.ReadCloser, meta UploadMeta) (storage.Video, error) {
+	// files of the video are named after its id, so they never collide
+	id := uuid.NewString()
+	if err := ss.upload(ctx, videoReader, id, id, meta); err != nil {
+		return storage.Video{}, err
 	}
+
+	return ss.Video(ctx, id)
 }
 
-func (ss *StreamService) Upload(ctx context.Context, videoReader io.ReadCloser, videoName string) error {
+func (ss *StreamService) upload(ctx context.Context, videoReader io.ReadCloser, id, videoName string, meta UploadMeta) (err error) {
+	ctx, span := tracing.Start(ctx, "StreamService.Upload", attribute.String("video.name", videoName))
+	defer func() { tracing.End(span, err) }()
+
+	ctx = logging.WithVideo(ctx, videoName)
+
+	uploader, err := auth.RequireScope(ctx, auth.ScopeVideosWrite)
+	if err != nil {
+		return err
+	}
+
+	record := storage.Video{
+		ID:          id,
+		Name:        videoName,
+		Title:       meta.Title,
+		Description: meta.Description,
+		Tags:        meta.Tags,
+		Attributes:  meta.Attributes,
+		Visibility:  meta.Visibility,
+		Owner:       uploader.UserID,
+		Status:      storage.VideoProcessing,
+	}
+	if record.Title == "" {
+		record.Title = videoName
+	}
+	if record.Visibility == "" {
+		record.Visibility = storage.VisibilityPublic
+	}
+
+	if err := validateVideo(record); err != nil {
+		return err
+	}
+
+	// playlists of the live streams are served first, so the video would never be played
+	if _, err := ss.streams.ReadStream(ctx, videoName); err == nil {
+		return storage.ErrUniqueStream
+	} else if !errors.Is(err, storage.ErrDBNotFound) {
+		return err
+	}
+
+	metrics.UploadQueue.Inc()
+	defer metrics.UploadQueue.Dec()
+
+	ss.uploads.Add(1)
+	defer ss.uploads.Add(-1)
+
+	// slot is held until the thumbnail is created
+	if !ss.transcodes.TryAcquire() {
+		return ErrTranscodesBusy
+	}
+	defer ss.transcodes.Release()
+
+	metrics.Transcodes.Inc()
+	defer metrics.Transcodes.Dec()
+
+	// video is listed while it is being processed
+	// the record also claims the name, so that concurrent uploads of it don't share the reservation
+	if err := ss.videos.CreateVideo(ctx, record); err != nil {
+		return err
+	}
+
+	// uploads, which would exceed the quotas anyway, are rejected before any processing
+	// quota of the video is then held, until it is stored or the upload fails
+	if err := ss.storage.Reserve(ctx, videoName, uploader.UserID, storage.Usage{Videos: 1}); err != nil {
+		if delErr := ss.videos.DeleteVideo(ctx, videoName); delErr != nil {
+			logging.For(ctx, ss.log).Info(fmt.Sprintf("couldn't delete record of %v: %v", videoName, delErr))
+		}
+		return err
+	}
+
+	defer func() {
+		// upload might have been cancelled along with ctx
+		bgCtx := tenant.NewContext(context.Background(), tenant.FromContext(ctx))
+
+		// reservation is already consumed, if the video was stored
+		if relErr := ss.storage.Release(bgCtx, videoName); relErr != nil {
+			logging.For(ctx, ss.log).Info(fmt.Sprintf("couldn't release quota of %v: %v", videoName, relErr))
+		}
+
+		if err == nil {
+			return
+		}
+
+		// failed video can be uploaded again under the same name
+		_, failErr := ss.updateVideo(bgCtx, videoName, func(video *storage.Video) error {
+			video.Status = storage.VideoFailed
+			return nil
+		})
+		if failErr != nil {
+			logging.For(ctx, ss.log).Info(fmt.Sprintf("couldn't mark video %v as failed: %v", videoName, failErr))
+		}
+	}()
+
+	// files of the tenants are processed in their own subdirectories
+	localName := tenant.Qualify(ctx, videoName)
+
 	// create necessary directories if don't exist
-	createDirs(ss.cfg.VideoPath, ss.cfg.ManifestPath, ss.cfg.ChunkPath, videoName)
+	createDirs(ss.cfg.VideoPath, ss.cfg.ManifestPath, ss.cfg.ChunkPath, localName)
 
-	videoPath := fmt.Sprintf("%v/%v.mp4", ss.cfg.VideoPath, videoName)
+	videoPath := fmt.Sprintf("%v/%v.mp4", ss.cfg.VideoPath, localName)
 	video, err := createVideo(videoReader, videoPath)
 	if err != nil {
 		return err
 	}
 
+	info, err := video.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the quotas are enforced by the storage, once the size of the derived files is known
+	if err := ss.storage.Reserve(ctx, videoName, uploader.UserID, storage.Usage{Bytes: info.Size(), Videos: 1}); err != nil {
+		return err
+	}
+
 	// creating all the files locally
-	manifestPath := fmt.Sprintf("%v/%v.m3u8", ss.cfg.ManifestPath, videoName)
-	chunkPath := fmt.Sprintf("%v/%v/", ss.cfg.ChunkPath, videoName)
-	manifest, chunks, err := createManifestAndChunks(ss.log, manifestPath, chunkPath, videoPath, videoName)
+	manifestPath := fmt.Sprintf("%v/%v.m3u8", ss.cfg.ManifestPath, localName)
+	chunkPath := fmt.Sprintf("%v/%v/", ss.cfg.ChunkPath, localName)
+
+	var cmd *exec.Cmd
+	var key *storage.ContentKey
+
+	if ss.scheme == drm.SchemeNone {
+		cmd = utils.SegmentVideoAndCreateManifest(
+			videoPath,
+			// precise manifest path
+			manifestPath,
+			// chunk file path + template for segmentation
+			fmt.Sprintf("%v/%v_%%4d.ts", chunkPath, videoName),
+		)
+	} else {
+		// each video is encrypted with its own key
+		contentKey, err := drm.NewContentKey(videoName, ss.scheme)
+		if err != nil {
+			return err
+		}
+		key = &contentKey
+
+		cmd = utils.SegmentEncryptVideoAndCreateManifest(
+			videoPath,
+			manifestPath,
+			fmt.Sprintf("%v/%v_%%4d.m4s", chunkPath, videoName),
+			// fmp4 initialization segment
+			fmt.Sprintf("%v_init.m4s", videoName),
+			hex.EncodeToString(key.Key),
+			hex.EncodeToString(key.KeyID),
+		)
+	}
+
+	// segmentation + .m3u8 creation
+	// results in manifest file and chunks creation
+	if err := runFFmpeg(ctx, ss.log, "segment", cmd); err != nil {
+		return ErrSegmentationException.Wrap(err)
+	}
+
+	// ffmpeg doesn't signal the encryption in the playlist, so players wouldn't request the key
+	if key != nil {
+		if err := addKey(manifestPath, drm.PlaylistKey(*key)); err != nil {
+			return err
+		}
+	}
+
+	manifest, chunks, err := createManifestAndChunks(logging.For(ctx, ss.log), manifestPath, chunkPath)
 	if err != nil {
 		return err
 	}
 
+	if record.Duration, err = manifestDuration(manifestPath); err != nil {
+		return err
+	}
+
 	// values to be filled and passed to the storage
 	var sVideo *storage.File
 	var sManifest *storage.File
@@ -67,29 +325,184 @@ func (ss *StreamService) Upload(ctx context.Context, videoReader io.ReadCloser,
 	if sVideo, err = storage.FromFD(video, videoName); err != nil {
 		return err
 	}
+	record.Size = sVideo.Size
+	sVideo.Owner = uploader.UserID
+	metrics.UploadSize.Observe(float64(record.Size))
 
 	if sManifest, err = storage.FromFD(manifest, nameFromPath(manifest.Name())); err != nil {
 		return err
 	}
+	sManifest.Owner = uploader.UserID
 
 	for _, chunk := range chunks {
 		sChunk, err := storage.FromFD(chunk, nameFromPath(chunk.Name()))
 		if err != nil {
 			return err
 		}
+		sChunk.Owner = uploader.UserID
 
 		sChunks = append(sChunks, *sChunk)
 	}
 
-	return ss.storage.Store(ctx, *sVideo, *sManifest, sChunks)
+	// key is stored along with the video, so that the video is never left without it
+	if err := ss.storage.Store(ctx, *sVideo, *sManifest, sChunks, key); err != nil {
+		return err
+	}
+
+	// video is playable without a thumbnail
+	if err := ss.storeThumbnail(ctx, videoPath, chunkPath, videoName, uploader.UserID); err != nil {
+		logging.For(ctx, ss.log).Info(fmt.Sprintf("couldn't create thumbnail of %v: %v", videoName, err))
+	}
+
+	// metadata might have been edited in the meantime
+	_, err = ss.updateVideo(ctx, videoName, func(video *storage.Video) error {
+		video.Duration = record.Duration
+		video.Size = record.Size
+		video.Status = storage.VideoReady
+		return nil
+	})
+	return err
 }
 
-func (ss *StreamService) Remove(ctx context.Context, filename string) error {
+func (ss *StreamService) Remove(ctx context.Context, filename string) (err error) {
+	ctx, span := tracing.Start(ctx, "StreamService.Remove", attribute.String("file.name", filename))
+	defer func() { tracing.End(span, err) }()
+
+	// videos are stored under their bare names
+	if path.Ext(filename) == "" {
+		return ss.RemoveVideo(ctx, filename)
+	}
+
+	ctx = logging.WithVideo(ctx, utils.VideoName(filename))
+
+	if err := ss.authorizeRemoval(ctx, utils.VideoName(filename)); err != nil {
+		return err
+	}
+
 	return ss.storage.Remove(ctx, filename)
 }
 
-func (ss *StreamService) Serve(ctx context.Context, filename string) (io.ReadCloser, error) {
-	return ss.storage.Get(ctx, filename)
+func (ss *StreamService) RemoveVideo(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "StreamService.RemoveVideo", attribute.String("video.name", name))
+	defer func() { tracing.End(span, err) }()
+
+	ctx = logging.WithVideo(ctx, name)
+
+	if err := ss.authorizeRemoval(ctx, name); err != nil {
+		return err
+	}
+
+	if err := ss.storage.RemoveVideo(ctx, name); err != nil {
+		if errors.Is(err, storage.ErrFileNotFound) {
+			return ErrVideoNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// files of a video belong to its owner, files without a video record only to admins
+func (ss *StreamService) authorizeRemoval(ctx context.Context, name string) error {
+	video, err := ss.Video(ctx, name)
+	if err != nil && !errors.Is(err, ErrVideoNotFound) {
+		return err
+	}
+
+	return auth.Authorize(ctx, auth.ScopeVideosDelete, video.Owner)
+}
+
+func (ss *StreamService) ListVideos(ctx context.Context, query storage.VideoQuery) (storage.VideoPage, error) {
+	query, ok := listable(ctx, query)
+	if !ok {
+		return storage.VideoPage{}, nil
+	}
+
+	return ss.videos.ListVideos(ctx, query)
+}
+
+func (ss *StreamService) Serve(ctx context.Context, filename string) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "StreamService.Serve", attribute.String("file.name", filename))
+	defer func() { tracing.End(span, err) }()
+
+	ctx = logging.WithVideo(ctx, utils.VideoName(filename))
+
+	if err := ss.CheckPlayback(ctx, filename); err != nil {
+		return nil, err
+	}
+
+	// recent segments and parts of live streams are kept in memory
+	if pl, ok := ss.live.Get(tenant.Qualify(ctx, utils.VideoName(filename))); ok {
+		if data, ok := pl.File(ctx, filename); ok {
+			return served(filename, io.NopCloser(bytes.NewReader(data))), nil
+		}
+	}
+
+	file, err := ss.storage.Get(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return served(filename, file), nil
+}
+
+func (ss *StreamService) ServePlaylist(ctx context.Context, filename string, opts playlist.Options, block *live.Block) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "StreamService.ServePlaylist", attribute.String("file.name", filename))
+	defer func() { tracing.End(span, err) }()
+
+	ctx = logging.WithVideo(ctx, utils.VideoName(filename))
+
+	if err := ss.CheckPlayback(ctx, filename); err != nil {
+		return nil, err
+	}
+
+	if pl, ok := ss.live.Get(tenant.Qualify(ctx, utils.VideoName(filename))); ok {
+		if block != nil {
+			if err := pl.Wait(ctx, *block); err != nil {
+				if errors.Is(err, live.ErrFutureSegment) {
+					return nil, ErrPlaylistRequest.Wrap(err)
+				}
+				if errors.Is(err, live.ErrNotLowLatency) {
+					return nil, ErrBlockingReload
+				}
+				return nil, ErrPlaylistTimeout.Wrap(err)
+			}
+		}
+
+		out := ss.renderer.Render(pl.Encode(), opts)
+		metrics.ServedBytes.WithLabelValues(assetType(filename)).Add(float64(len(out)))
+
+		return out, nil
+	}
+
+	file, err := ss.storage.Get(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	out := ss.renderer.Render(raw, opts)
+	metrics.ServedBytes.WithLabelValues(assetType(filename)).Add(float64(len(out)))
+
+	return out, nil
+}
+
+func (ss *StreamService) ServeURL(ctx context.Context, filename string) (string, error) {
+	if err := ss.CheckPlayback(ctx, filename); err != nil {
+		return "", err
+	}
+
+	// files, kept in memory, aren't in the object storage yet
+	if pl, ok := ss.live.Get(tenant.Qualify(ctx, utils.VideoName(filename))); ok && pl.Has(filename) {
+		return "", ErrNoRedirect
+	}
+
+	return ss.storage.GetURL(ctx, filename, ss.urlTTL)
 }
 
 func createVideo(videoReader io.ReadCloser, videoPath string) (*os.File, error) {
@@ -111,29 +524,18 @@ func createVideo(videoReader io.ReadCloser, videoPath string) (*os.File, error)
 	return video, nil
 }
 
-func createManifestAndChunks(infoLog *zap.Logger, manifestPath, chunkPath, videoPath, videoName string) (*os.File, []*os.File, error) {
-	// segmentation + .m3u8 creation
-	// results in manifest file and chunks creation
-	cmd := utils.SegmentVideoAndCreateManifest(
-		videoPath,
-		// precise manifest path
-		manifestPath,
-		// chunk file path + template for segmentation
-		fmt.Sprintf("%v/%v_%%4d.ts", chunkPath, videoName),
-	)
-
-	// check if segmentation went smoothely
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		infoLog.Info(string(out))
-		return nil, nil, ErrSegmentationException
+func createManifestAndChunks(infoLog *zap.Logger, manifestPath, chunkPath string) (*os.File, []*os.File, error) {
+	// making sure ffmpeg produced a playable manifest
+	if err := validateManifest(manifestPath, chunkPath); err != nil {
+		infoLog.Info(fmt.Sprintf("invalid manifest %v: %v", manifestPath, err))
+		return nil, nil, ErrInvalidManifest.Wrap(err)
 	}
 
 	var manifest *os.File
 	var chunks []*os.File
 
 	// retrieving manifest data
-	manifest, err = os.Open(manifestPath)
+	manifest, err := os.Open(manifestPath)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -154,6 +556,78 @@ func createManifestAndChunks(infoLog *zap.Logger, manifestPath, chunkPath, video
 	return manifest, chunks, nil
 }
 
+// total duration of the vod playlist (seconds)
+func manifestDuration(manifestPath string) (float64, error) {
+	raw, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return 0, err
+	}
+
+	pl, err := m3u8.DecodeMedia(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	var duration float64
+	for _, segment := range pl.Segments {
+		duration += segment.Duration
+	}
+
+	return duration, nil
+}
+
+// signals the key of the whole vod playlist (it takes effect starting with the first segment)
+func addKey(manifestPath string, key m3u8.Key) error {
+	raw, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	pl, err := m3u8.DecodeMedia(raw)
+	if err != nil {
+		return err
+	}
+
+	if len(pl.Segments) == 0 {
+		return nil
+	}
+	pl.Segments[0].Keys = append(pl.Segments[0].Keys, key)
+
+	return os.WriteFile(manifestPath, pl.Encode(), 0644)
+}
+
+// checks manifest syntax and presence of all the referenced chunks
+func validateManifest(manifestPath, chunkPath string) error {
+	raw, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	pl, err := m3u8.DecodeMedia(raw)
+	if err != nil {
+		return err
+	}
+
+	if err := pl.Validate(); err != nil {
+		return err
+	}
+
+	for _, segment := range pl.Segments {
+		uris := []string{segment.URI}
+		if segment.Map != nil {
+			uris = append(uris, segment.Map.URI)
+		}
+
+		for _, uri := range uris {
+			if _, err := os.Stat(chunkPath + path.Base(uri)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func createDirs(vidPath, manPath, chunkPath, objName string) {
 	chunkFilePath := fmt.Sprintf("%v/%v", chunkPath, objName)
 	utils.MKDir(chunkPath).Run()
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/cutlery47/gostream/pkg/m3u8"
+)
+
+// playlist, as written by ffmpeg for cenc encrypted fmp4 segments
+const encryptedManifest = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="video_init.m4s"
+#EXTINF:2.000000,
+video_0000.m4s
+#EXTINF:1.500000,
+video_0001.m4s
+#EXT-X-ENDLIST
+`
+
+func TestAddKey(t *testing.T) {
+	manifestPath := path.Join(t.TempDir(), "video.m3u8")
+	if err := os.WriteFile(manifestPath, []byte(encryptedManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	key := m3u8.Key{Method: "SAMPLE-AES-CTR", URI: "data:text/plain;base64,AAEC/w==", KeyFormat: "org.w3.clearkey", KeyFormatVersions: "1"}
+	if err := addKey(manifestPath, key); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag := `#EXT-X-KEY:METHOD=SAMPLE-AES-CTR,URI="data:text/plain;base64,AAEC/w==",KEYFORMAT="org.w3.clearkey",KEYFORMATVERSIONS="1"`
+	if strings.Count(string(raw), "#EXT-X-KEY") != 1 || !strings.Contains(string(raw), tag) {
+		t.Fatalf("got\n%s", raw)
+	}
+
+	// the key precedes the first segment, the rest of the playlist is kept
+	pl, err := m3u8.DecodeMedia(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pl.Segments) != 2 || len(pl.Segments[0].Keys) != 1 || pl.Segments[0].Map == nil || !pl.EndList || pl.PlaylistType != "VOD" {
+		t.Errorf("got %+v", pl)
+	}
+	if err := pl.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/google/uuid"
+)
+
+// uploads, which haven't received any data for this long, are removed
+const uploadTTL = 24 * time.Hour
+
+// resumable upload, receiving the video in chunks
+// the video is processed, once the whole file is received, and is stored under the id of the upload
+type UploadSession struct {
+	ID       string
+	Owner    string
+	Filename string
+	Meta     UploadMeta
+	// size of the whole file
+	Size int64
+	// bytes received so far (not stored, the received file is the source of truth)
+	Offset    int64 `json:"-"`
+	CreatedAt time.Time
+}
+
+func (ss *StreamService) CreateUpload(ctx context.Context, filename string, size int64, meta UploadMeta) (UploadSession, error) {
+	uploader, err := auth.RequireScope(ctx, auth.ScopeVideosWrite)
+	if err != nil {
+		return UploadSession{}, err
+	}
+
+	if size <= 0 {
+		return UploadSession{}, ErrUploadSize
+	}
+
+	session := UploadSession{
+		ID:        uuid.NewString(),
+		Owner:     uploader.UserID,
+		Filename:  filename,
+		Meta:      meta,
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+
+	// metadata is rejected before any data is sent
+	record := storage.Video{Title: meta.Title, Description: meta.Description, Tags: meta.Tags, Attributes: meta.Attributes, Visibility: meta.Visibility}
+	if record.Title == "" {
+		record.Title = session.ID
+	}
+	if record.Visibility == "" {
+		record.Visibility = storage.VisibilityPublic
+	}
+	if err := validateVideo(record); err != nil {
+		return UploadSession{}, err
+	}
+
+	ss.removeExpiredUploads()
+
+	sessionPath, dataPath := ss.uploadPaths(ctx, session.ID)
+	if err := os.MkdirAll(path.Dir(sessionPath), 0755); err != nil {
+		return UploadSession{}, err
+	}
+
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return UploadSession{}, err
+	}
+
+	if err := os.WriteFile(dataPath, nil, 0644); err != nil {
+		return UploadSession{}, err
+	}
+
+	return session, os.WriteFile(sessionPath, raw, 0644)
+}
+
+func (ss *StreamService) UploadSession(ctx context.Context, id string) (UploadSession, error) {
+	return ss.readUpload(ctx, id)
+}
+
+// appends the chunk, which should start at the offset
+// once the whole file is received, the video is processed and returned
+// failed processing can be retried by appending an empty chunk at the end of the file
+func (ss *StreamService) AppendUpload(ctx context.Context, id string, offset int64, chunk io.Reader) (UploadSession, *storage.Video, error) {
+	// chunks of the upload are appended one at a time
+	key := tenant.Qualify(ctx, id)
+	if _, busy := ss.appending.LoadOrStore(key, struct{}{}); busy {
+		return UploadSession{}, nil, ErrUploadBusy
+	}
+	defer ss.appending.Delete(key)
+
+	session, err := ss.readUpload(ctx, id)
+	if err != nil {
+		return session, nil, err
+	}
+
+	if offset != session.Offset {
+		return session, nil, ErrUploadOffset
+	}
+
+	_, dataPath := ss.uploadPaths(ctx, id)
+
+	if session.Offset < session.Size {
+		if session.Offset, err = appendChunk(dataPath, session, chunk); err != nil {
+			return session, nil, err
+		}
+	}
+
+	if session.Offset < session.Size {
+		return session, nil, nil
+	}
+
+	data, err := os.Open(dataPath)
+	if err != nil {
+		return session, nil, err
+	}
+	defer data.Close()
+
+	// the session is kept, until the video is processed
+	if err := ss.upload(ctx, data, session.ID, session.ID, session.Meta); err != nil {
+		return session, nil, err
+	}
+
+	if err := ss.removeUpload(ctx, id); err != nil {
+		return session, nil, err
+	}
+
+	video, err := ss.Video(ctx, session.ID)
+	return session, &video, err
+}
+
+func (ss *StreamService) CancelUpload(ctx context.Context, id string) error {
+	if _, err := ss.readUpload(ctx, id); err != nil {
+		return err
+	}
+
+	return ss.removeUpload(ctx, id)
+}
+
+// writes the chunk at the end of the received data, returning the new offset
+// the data, received before the chunk was interrupted, is kept
+func appendChunk(dataPath string, session UploadSession, chunk io.Reader) (int64, error) {
+	file, err := os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return session.Offset, err
+	}
+	defer file.Close()
+
+	// one byte more than expected shows that the chunk is too large
+	remaining := session.Size - session.Offset
+	n, err := io.Copy(file, io.LimitReader(chunk, remaining+1))
+
+	if n > remaining {
+		if err := file.Truncate(session.Size); err != nil {
+			return session.Offset, err
+		}
+		return session.Size, ErrUploadSize
+	}
+
+	return session.Offset + n, err
+}
+
+// reads the session of the caller
+func (ss *StreamService) readUpload(ctx context.Context, id string) (UploadSession, error) {
+	// ids are used as file names
+	if parsed, err := uuid.Parse(id); err != nil || parsed.String() != id {
+		return UploadSession{}, ErrUploadNotFound
+	}
+
+	sessionPath, dataPath := ss.uploadPaths(ctx, id)
+
+	raw, err := os.ReadFile(sessionPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return UploadSession{}, ErrUploadNotFound.Wrap(err)
+	}
+	if err != nil {
+		return UploadSession{}, err
+	}
+
+	var session UploadSession
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return UploadSession{}, err
+	}
+
+	if err := auth.Authorize(ctx, auth.ScopeVideosWrite, session.Owner); err != nil {
+		return UploadSession{}, err
+	}
+
+	info, err := os.Stat(dataPath)
+	if err != nil {
+		return UploadSession{}, err
+	}
+	session.Offset = info.Size()
+
+	return session, nil
+}
+
+func (ss *StreamService) removeUpload(ctx context.Context, id string) error {
+	sessionPath, dataPath := ss.uploadPaths(ctx, id)
+
+	if err := os.Remove(dataPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Remove(sessionPath)
+}
+
+// removes the uploads, which haven't received any data within the ttl
+func (ss *StreamService) removeExpiredUploads() {
+	dir := path.Join(ss.cfg.VideoPath, "uploads")
+
+	filepath.WalkDir(dir, func(dataPath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(dataPath, ".part") {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err == nil && time.Since(info.ModTime()) > uploadTTL {
+			os.Remove(strings.TrimSuffix(dataPath, ".part") + ".json")
+			os.Remove(dataPath)
+		}
+		return nil
+	})
+}
+
+// uploads of the tenants are kept in their own subdirectories
+func (ss *StreamService) uploadPaths(ctx context.Context, id string) (sessionPath, dataPath string) {
+	base := path.Join(ss.cfg.VideoPath, "uploads", tenant.Qualify(ctx, id))
+	return base + ".json", base + ".part"
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+)
+
+func uploader(id string) context.Context {
+	p := auth.Principal{UserID: id, Role: storage.RoleUploader, Scopes: auth.RoleScopes(storage.RoleUploader)}
+	return auth.NewContext(context.Background(), p)
+}
+
+func TestAppendUpload(t *testing.T) {
+	ss := &StreamService{cfg: config.LocalConfig{VideoPath: t.TempDir()}}
+	ctx := uploader("alice")
+
+	session, err := ss.CreateUpload(ctx, "clip.mp4", 10, UploadMeta{Title: "Clip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := []struct {
+		offset int64
+		data   string
+		want   int64
+		err    error
+	}{
+		{0, "0123", 4, nil},
+		// the chunk was already received
+		{0, "0123", 4, ErrUploadOffset},
+		{6, "6789", 4, ErrUploadOffset},
+		{4, "45", 6, nil},
+		// the rest of the chunk doesn't fit into the file
+		{6, "6789ab", 10, ErrUploadSize},
+	}
+
+	for _, chunk := range chunks {
+		got, video, err := ss.AppendUpload(ctx, session.ID, chunk.offset, strings.NewReader(chunk.data))
+		if !errors.Is(err, chunk.err) {
+			t.Fatalf("%q at %v: got %v, want %v", chunk.data, chunk.offset, err, chunk.err)
+		}
+		if video != nil {
+			t.Fatalf("%q at %v: video is processed before the file is received", chunk.data, chunk.offset)
+		}
+
+		// the offset is read back from the received data
+		status, err := ss.UploadSession(ctx, session.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Offset != chunk.want || (chunk.err == nil && got.Offset != chunk.want) {
+			t.Fatalf("%q at %v: got offset %v, want %v", chunk.data, chunk.offset, status.Offset, chunk.want)
+		}
+	}
+
+	_, dataPath := ss.uploadPaths(ctx, session.ID)
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "0123456789" {
+		t.Errorf("got %q", data)
+	}
+}
+
+func TestUploadAccess(t *testing.T) {
+	ss := &StreamService{cfg: config.LocalConfig{VideoPath: t.TempDir()}}
+	ctx := uploader("alice")
+
+	session, err := ss.CreateUpload(ctx, "clip.mp4", 10, UploadMeta{Title: "Clip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		ctx context.Context
+		id  string
+		err error
+	}{
+		"owner":      {ctx, session.ID, nil},
+		"other user": {uploader("bob"), session.ID, auth.ErrForbidden},
+		// uploads are kept apart, the same as the videos
+		"other tenant": {tenant.NewContext(ctx, "team"), session.ID, ErrUploadNotFound},
+		"unknown":      {ctx, "5f0c2b8e-3c1d-4a6e-9b7f-2d8e1a4c6b3f", ErrUploadNotFound},
+		// ids are used as file names
+		"not uuid":     {ctx, "../videos", ErrUploadNotFound},
+		"uppercase id": {ctx, strings.ToUpper(session.ID), ErrUploadNotFound},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ss.UploadSession(tc.ctx, tc.id); !errors.Is(err, tc.err) {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+		})
+	}
+
+	if err := ss.CancelUpload(uploader("bob"), session.ID); !errors.Is(err, auth.ErrForbidden) {
+		t.Errorf("cancelled by the other user: got %v", err)
+	}
+	if err := ss.CancelUpload(ctx, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.UploadSession(ctx, session.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("got %v after cancelling, want ErrUploadNotFound", err)
+	}
+}
+
+func TestCreateUpload(t *testing.T) {
+	ss := &StreamService{cfg: config.LocalConfig{VideoPath: t.TempDir()}}
+	ctx := uploader("alice")
+
+	if _, err := ss.CreateUpload(ctx, "clip.mp4", 0, UploadMeta{}); !errors.Is(err, ErrUploadSize) {
+		t.Errorf("empty file: got %v, want ErrUploadSize", err)
+	}
+
+	// metadata is checked before any data is sent
+	if _, err := ss.CreateUpload(ctx, "clip.mp4", 10, UploadMeta{Visibility: "hidden"}); err == nil {
+		t.Error("invalid visibility was accepted")
+	}
+
+	if _, err := ss.CreateUpload(context.Background(), "clip.mp4", 10, UploadMeta{}); !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Errorf("anonymous: got %v, want ErrUnauthenticated", err)
+	}
+
+	// stale uploads are removed, once another one is created
+	stale, err := ss.CreateUpload(ctx, "stale.mp4", 10, UploadMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dataPath := ss.uploadPaths(ctx, stale.ID)
+	expired := time.Now().Add(-uploadTTL - time.Minute)
+	if err := os.Chtimes(dataPath, expired, expired); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ss.CreateUpload(ctx, "clip.mp4", 10, UploadMeta{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.UploadSession(ctx, stale.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("got %v for the stale upload, want ErrUploadNotFound", err)
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/storage"
+)
+
+// stored bytes and videos along with the quotas (0 is unlimited)
+type Usage struct {
+	storage.Usage
+
+	MaxBytes  int64
+	MaxVideos int
+}
+
+func (ss *StreamService) Usage(ctx context.Context, userID string) (user, tenant Usage, err error) {
+	if userID == "" {
+		principal, err := auth.Require(ctx)
+		if err != nil {
+			return user, tenant, err
+		}
+		userID = principal.UserID
+	}
+
+	// usage of the others is only shown to admins
+	if err := auth.Authorize(ctx, "", userID); err != nil {
+		return user, tenant, err
+	}
+
+	if user.Usage, err = ss.storage.Usage(ctx, userID); err != nil {
+		return user, tenant, err
+	}
+
+	if tenant.Usage, err = ss.storage.TenantUsage(ctx); err != nil {
+		return user, tenant, err
+	}
+
+	user.MaxBytes, user.MaxVideos = ss.quota.UserBytes, ss.quota.UserVideos
+	tenant.MaxBytes, tenant.MaxVideos = ss.quota.TenantBytes, ss.quota.TenantVideos
+
+	return user, tenant, nil
+}
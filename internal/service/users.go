@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/errs"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/google/uuid"
+)
+
+// service, responsible for users and their api keys
+type UserService interface {
+	// only admins can create users, user belongs to the tenant of the context
+	CreateUser(ctx context.Context, name string, role storage.Role) (storage.User, error)
+	User(ctx context.Context, id string) (storage.User, error)
+	// returns the key itself along with its record, the key can't be retrieved later
+	// key is restricted to the scopes, unless they are nil
+	CreateAPIKey(ctx context.Context, userID, name string, scopes []auth.Scope) (string, storage.APIKey, error)
+	APIKeys(ctx context.Context, userID string) ([]storage.APIKey, error)
+	RemoveAPIKey(ctx context.Context, userID, id string) error
+}
+
+var (
+	userName = regexp.MustCompile(`^[a-z0-9_.-]{1,64}$`)
+	keyName  = regexp.MustCompile(`^[\pL\pN _.-]{0,64}$`)
+)
+
+type AccountService struct {
+	users storage.UserRepository
+}
+
+func NewAccountService(users storage.UserRepository) *AccountService {
+	return &AccountService{users: users}
+}
+
+func (as *AccountService) CreateUser(ctx context.Context, name string, role storage.Role) (storage.User, error) {
+	if _, err := auth.RequireScope(ctx, auth.ScopeAdmin); err != nil {
+		return storage.User{}, err
+	}
+
+	var fields []errs.FieldError
+	if !userName.MatchString(name) {
+		fields = append(fields, errs.FieldError{Field: "name", Message: "should be 1 to 64 lowercase letters, digits, '_', '.' or '-'"})
+	}
+	if !auth.ValidRole(role) {
+		fields = append(fields, errs.FieldError{Field: "role", Message: "should be viewer, uploader, editor or admin"})
+	}
+	if len(fields) > 0 {
+		return storage.User{}, ErrInvalidUser.WithFields(fields...)
+	}
+
+	user := storage.User{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Role:      role,
+		Tenant:    tenant.FromContext(ctx),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := as.users.CreateUser(ctx, user); err != nil {
+		return storage.User{}, err
+	}
+
+	return user, nil
+}
+
+func (as *AccountService) User(ctx context.Context, id string) (storage.User, error) {
+	if err := auth.Authorize(ctx, "", id); err != nil {
+		return storage.User{}, err
+	}
+
+	user, err := as.users.ReadUser(ctx, id)
+	if errors.Is(err, storage.ErrDBNotFound) {
+		return user, ErrUserNotFound.Wrap(err)
+	}
+	return user, err
+}
+
+func (as *AccountService) CreateAPIKey(ctx context.Context, userID, name string, scopes []auth.Scope) (string, storage.APIKey, error) {
+	user, err := as.User(ctx, userID)
+	if err != nil {
+		return "", storage.APIKey{}, err
+	}
+
+	var fields []errs.FieldError
+	if !keyName.MatchString(name) {
+		fields = append(fields, errs.FieldError{Field: "name", Message: "should be at most 64 letters, digits, spaces, '_', '.' or '-'"})
+	}
+
+	// key can't grant more, than the role of its user
+	owner := auth.Principal{Role: user.Role, Scopes: auth.RoleScopes(user.Role)}
+	for i, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			fields = append(fields, errs.FieldError{Field: fmt.Sprintf("scopes[%v]", i), Message: "unknown scope"})
+		} else if !owner.Can(scope) {
+			fields = append(fields, errs.FieldError{Field: fmt.Sprintf("scopes[%v]", i), Message: "not granted by the role of the user"})
+		}
+	}
+
+	if len(fields) > 0 {
+		return "", storage.APIKey{}, ErrInvalidUser.WithFields(fields...)
+	}
+
+	// nor more, than the credentials it is created with
+	p, _ := auth.FromContext(ctx)
+	granted := scopes
+	if granted == nil {
+		granted = owner.Scopes
+	}
+	for _, scope := range granted {
+		if !p.Can(scope) {
+			return "", storage.APIKey{}, auth.ErrInsufficientScope
+		}
+	}
+
+	key, record, err := auth.NewAPIKey(userID, name, scopes)
+	if err != nil {
+		return "", storage.APIKey{}, err
+	}
+
+	if err := as.users.CreateAPIKey(ctx, record); err != nil {
+		if errors.Is(err, storage.ErrDBNotFound) {
+			err = ErrUserNotFound.Wrap(err)
+		}
+		return "", storage.APIKey{}, err
+	}
+
+	return key, record, nil
+}
+
+func (as *AccountService) APIKeys(ctx context.Context, userID string) ([]storage.APIKey, error) {
+	if err := auth.Authorize(ctx, "", userID); err != nil {
+		return nil, err
+	}
+
+	return as.users.ListAPIKeys(ctx, userID)
+}
+
+func (as *AccountService) RemoveAPIKey(ctx context.Context, userID, id string) error {
+	if err := auth.Authorize(ctx, "", userID); err != nil {
+		return err
+	}
+
+	err := as.users.DeleteAPIKey(ctx, userID, id)
+	if errors.Is(err, storage.ErrDBNotFound) {
+		return ErrAPIKeyNotFound.Wrap(err)
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cutlery47/gostream/internal/auth"
+	"github.com/cutlery47/gostream/internal/sign"
+	"github.com/cutlery47/gostream/internal/storage"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/cutlery47/gostream/internal/utils"
+)
+
+// checks if the caller may see the video
+// private videos are only shown to their owners and admins, or played with a token, signed for them
+func canView(ctx context.Context, video storage.Video) bool {
+	if video.Visibility != storage.VisibilityPrivate {
+		return true
+	}
+
+	if claims, ok := sign.FromContext(ctx); ok && claims.Video == tenant.Qualify(ctx, video.Name) {
+		return true
+	}
+
+	p, ok := auth.FromContext(ctx)
+	return ok && p.Authorized(auth.ScopeVideosRead, video.Owner)
+}
+
+// unlisted and private videos are only listed to their owners (admins see every one of them)
+func listable(ctx context.Context, query storage.VideoQuery) (storage.VideoQuery, bool) {
+	if query.Visibility == "" {
+		query.Visibility = storage.VisibilityPublic
+	}
+
+	if query.Visibility == storage.VisibilityPublic {
+		return query, true
+	}
+
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return query, false
+	}
+
+	if p.Admin() {
+		return query, true
+	}
+
+	if query.Owner != "" && query.Owner != p.UserID {
+		return query, false
+	}
+
+	query.Owner = p.UserID
+	return query, p.UserID != ""
+}
+
+// checks if the caller may play the files of the video
+// files of live streams and of the videos, uploaded before they were recorded, are served to anyone
+func (ss *StreamService) CheckPlayback(ctx context.Context, filename string) error {
+	name := utils.VideoName(filename)
+
+	if _, ok := ss.live.Get(tenant.Qualify(ctx, name)); ok {
+		return nil
+	}
+
+	video, err := ss.videos.ReadVideo(ctx, name)
+	if errors.Is(err, storage.ErrDBNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !canView(ctx, video) {
+		return ErrVideoNotFound
+	}
+
+	return nil
+}
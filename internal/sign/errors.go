@@ -0,0 +1,10 @@
+package sign
+
+import "github.com/cutlery47/gostream/internal/errs"
+
+var (
+	ErrMissingToken = errs.New(errs.Forbidden, "missing_token", "playback url is not signed")
+	ErrInvalidToken = errs.New(errs.Forbidden, "invalid_token", "playback url signature is invalid")
+	ErrExpiredToken = errs.New(errs.Forbidden, "expired_token", "playback url has expired")
+	ErrTokenScope   = errs.New(errs.Forbidden, "token_scope", "playback url was issued for another video or client")
+)
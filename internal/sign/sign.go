@@ -0,0 +1,110 @@
+package sign
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// data, covered by the url signature
+type Claims struct {
+	// video the url grants access to
+	Video string `json:"v"`
+	// unix time after which the url is rejected
+	Expires int64 `json:"e"`
+	// client ip the url is bound to (optional)
+	IP string `json:"ip,omitempty"`
+	// playback session the url is bound to (optional)
+	Session string `json:"s,omitempty"`
+}
+
+// issues and verifies hmac signed playback tokens
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func New(secret string, ttl time.Duration) *Signer {
+	return &Signer{
+		secret: []byte(secret),
+		ttl:    ttl,
+	}
+}
+
+// returns claims for the video, expiring after the configured ttl
+func (s *Signer) Claims(video, ip, session string) Claims {
+	return Claims{
+		Video:   video,
+		Expires: time.Now().Add(s.ttl).Unix(),
+		IP:      ip,
+		Session: session,
+	}
+}
+
+// token format: base64url(json claims) + "." + base64url(hmac-sha256)
+func (s *Signer) Sign(claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// checks token signature and expiry, returning its claims
+func (s *Signer) Verify(token string) (Claims, error) {
+	var claims Claims
+
+	if token == "" {
+		return claims, ErrMissingToken
+	}
+
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, ErrInvalidToken
+	}
+
+	rawSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(rawSig, s.mac(encoded)) {
+		return claims, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+
+	if time.Now().Unix() > claims.Expires {
+		return claims, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+func (s *Signer) mac(data string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+type claimsKey struct{}
+
+// adds verified claims of the request to its context
+func NewContext(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func FromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
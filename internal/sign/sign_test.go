@@ -0,0 +1,70 @@
+package sign
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	s := New("secret", time.Minute)
+
+	claims := s.Claims("video", "203.0.113.7", "session")
+
+	token, err := s.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != claims {
+		t.Errorf("got %+v, want %+v", got, claims)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	s := New("secret", time.Minute)
+
+	valid := mustSign(t, s, s.Claims("video", "", ""))
+	expired := mustSign(t, s, Claims{Video: "video", Expires: time.Now().Add(-time.Second).Unix()})
+	foreign := mustSign(t, New("other secret", time.Minute), s.Claims("video", "", ""))
+
+	payload, sig, _ := strings.Cut(valid, ".")
+	// claims of another video, carrying the signature of the valid ones
+	forged, _, _ := strings.Cut(mustSign(t, s, s.Claims("other", "", "")), ".")
+
+	tokens := map[string]struct {
+		token string
+		err   error
+	}{
+		"missing":           {"", ErrMissingToken},
+		"no signature":      {payload, ErrInvalidToken},
+		"malformed sig":     {payload + ".!!!", ErrInvalidToken},
+		"foreign secret":    {foreign, ErrInvalidToken},
+		"swapped claims":    {forged + "." + sig, ErrInvalidToken},
+		"malformed payload": {"!!!." + sig, ErrInvalidToken},
+		"expired":           {expired, ErrExpiredToken},
+	}
+
+	for name, tc := range tokens {
+		if _, err := s.Verify(tc.token); !errors.Is(err, tc.err) {
+			t.Errorf("%v: got %v, want %v", name, err, tc.err)
+		}
+	}
+}
+
+func mustSign(t *testing.T, s *Signer, claims Claims) string {
+	t.Helper()
+
+	token, err := s.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
@@ -1,10 +1,19 @@
 package storage
 
-import "errors"
+import "github.com/cutlery47/gostream/internal/errs"
 
 var (
-	ErrNotImplemented        = errors.New("feature is not yet implemented")
-	ErrUnsupportedFileFormat = errors.New("unsupported file format")
-	ErrUniueVideo            = errors.New("video with provided name already exists")
-	ErrDBNotFound            = errors.New("data was not found in the db")
+	ErrNotImplemented        = errs.New(errs.NotImplemented, "not_implemented", "feature is not yet implemented")
+	ErrUnsupportedFileFormat = errs.New(errs.Invalid, "unsupported_file_format", "unsupported file format")
+	ErrUniueVideo            = errs.New(errs.Conflict, "video_exists", "video with provided name already exists")
+	ErrDBNotFound            = errs.New(errs.NotFound, "record_not_found", "data was not found in the db")
+	ErrFileNotFound          = errs.New(errs.NotFound, "file_not_found", "file was not found in the storage")
+	ErrUniqueStream          = errs.New(errs.Conflict, "stream_exists", "stream with provided name already exists")
+	ErrStreamState           = errs.New(errs.Conflict, "stream_state", "stream has changed its state concurrently")
+	ErrInvalidQuery          = errs.New(errs.Invalid, "invalid_query", "invalid listing query")
+	ErrInvalidCursor         = errs.New(errs.Invalid, "invalid_cursor", "invalid or outdated page cursor")
+	ErrVersionMismatch       = errs.New(errs.Conflict, "version_mismatch", "record was modified concurrently")
+	ErrUniqueUser            = errs.New(errs.Conflict, "user_exists", "user with provided name already exists")
+	ErrUserQuota             = errs.New(errs.Forbidden, "user_quota_exceeded", "storage quota of the user is exceeded")
+	ErrTenantQuota           = errs.New(errs.Forbidden, "tenant_quota_exceeded", "storage quota of the tenant is exceeded")
 )
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/cutlery47/gostream/internal/tenant"
+)
+
+// json file based key repository, used along with the local storage
+// keys are indexed by their hex encoded ids, qualified with the tenant
+type LocalKeyRepository struct {
+	index *jsonIndex[ContentKey]
+}
+
+func NewLocalKeyRepository(path string) *LocalKeyRepository {
+	return &LocalKeyRepository{index: newJSONIndex[ContentKey](path)}
+}
+
+func (lr *LocalKeyRepository) CreateKey(ctx context.Context, key ContentKey) error {
+	return lr.index.update(func(keys map[string]ContentKey) error {
+		keys[tenant.Qualify(ctx, hex.EncodeToString(key.KeyID))] = key
+		return nil
+	})
+}
+
+func (lr *LocalKeyRepository) ReadKey(ctx context.Context, keyID []byte) (key ContentKey, err error) {
+	err = lr.index.view(func(keys map[string]ContentKey) error {
+		var ok bool
+		if key, ok = keys[tenant.Qualify(ctx, hex.EncodeToString(keyID))]; !ok {
+			return ErrDBNotFound
+		}
+		return nil
+	})
+
+	return key, err
+}
+
+func (lr *LocalKeyRepository) DeleteKeys(ctx context.Context, videoName string) error {
+	return lr.index.update(func(keys map[string]ContentKey) error {
+		for id, key := range keys {
+			if tenant.Owns(ctx, id) && key.VideoName == videoName {
+				delete(keys, id)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// json file, holding records of a single kind, keyed by string
+// used as a database replacement along with the local storage
+type jsonIndex[T any] struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newJSONIndex[T any](path string) *jsonIndex[T] {
+	return &jsonIndex[T]{path: path}
+}
+
+// runs fn over the records, without saving them
+func (ji *jsonIndex[T]) view(fn func(records map[string]T) error) error {
+	ji.mu.Lock()
+	defer ji.mu.Unlock()
+
+	records, err := ji.load()
+	if err != nil {
+		return err
+	}
+
+	return fn(records)
+}
+
+// runs fn over the records and saves them, if fn succeeded
+func (ji *jsonIndex[T]) update(fn func(records map[string]T) error) error {
+	ji.mu.Lock()
+	defer ji.mu.Unlock()
+
+	records, err := ji.load()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(records); err != nil {
+		return err
+	}
+
+	return ji.save(records)
+}
+
+func (ji *jsonIndex[T]) load() (map[string]T, error) {
+	records := make(map[string]T)
+
+	data, err := os.ReadFile(ji.path)
+	if err != nil {
+		// nothing was stored yet
+		if errors.Is(err, os.ErrNotExist) {
+			return records, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (ji *jsonIndex[T]) save(records map[string]T) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	// index may contain secrets, so only the owner should be able to read it
+	return os.WriteFile(ji.path, data, 0600)
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"io"
 	"os"
+	"time"
 )
 
 type File struct {
@@ -14,6 +15,8 @@ type File struct {
 	ObjectName string
 	// file location in the obj storage
 	Location Location
+	// user, whose quota the file is accounted to (empty for none)
+	Owner string
 
 	Size int64
 }
@@ -39,3 +42,170 @@ type Location struct {
 	// object storage key
 	Object string
 }
+
+// content encryption key of a single video
+type ContentKey struct {
+	// 16-byte key id, as written into the tenc box
+	KeyID []byte
+	// 16-byte aes key
+	Key []byte
+	// encryption scheme (cenc)
+	Scheme string
+	// name of the video encrypted with the key
+	VideoName string
+}
+
+type StreamState string
+
+const (
+	// stream was created, but nothing was published yet
+	StreamIdle StreamState = "idle"
+	// stream is being published
+	StreamLive StreamState = "live"
+	// publishing has finished
+	StreamEnded StreamState = "ended"
+)
+
+// live stream, published through one of the ingest servers
+type LiveStream struct {
+	// stream name, used for its playlist and chunks
+	Name string
+	// secret, used by the encoder to publish the stream
+	Key   string
+	State StreamState
+	// time of the last state change
+	UpdatedAt time.Time
+	// tenant of the stream, found out by its key
+	Tenant string
+	// user, who created the stream, its recording belongs to them
+	Owner string
+}
+
+type VideoStatus string
+
+const (
+	// video is being segmented
+	VideoProcessing VideoStatus = "processing"
+	// video can be played
+	VideoReady VideoStatus = "ready"
+	// processing has failed, video can be uploaded again
+	VideoFailed VideoStatus = "failed"
+)
+
+type Visibility string
+
+const (
+	// video is listed and can be played by anyone
+	VisibilityPublic Visibility = "public"
+	// video isn't listed, but can be played by anyone with the link
+	VisibilityUnlisted Visibility = "unlisted"
+	// video can only be played by its owner
+	VisibilityPrivate Visibility = "private"
+)
+
+// uploaded (or recorded) video
+type Video struct {
+	// stable uuid of the video
+	ID string
+	// name, under which the video and its playlist are stored
+	Name        string
+	Title       string
+	Description string
+	Status      VideoStatus
+	Visibility  Visibility
+	Owner       string
+	Tags        []string
+	// custom key/value metadata
+	Attributes map[string]string
+	// languages of the uploaded captions
+	Captions []string
+	// seconds
+	Duration float64
+	// size of the source video (bytes)
+	Size       int64
+	UploadedAt time.Time
+	// incremented on every update
+	Version int
+}
+
+// sort orders of the video listing
+const (
+	SortUploaded = "uploaded_at"
+	SortTitle    = "title"
+	SortDuration = "duration"
+)
+
+// filters and pagination of the video listing
+// zero values don't filter anything
+type VideoQuery struct {
+	Status     VideoStatus
+	Visibility Visibility
+	Tag        string
+	Owner      string
+	// seconds
+	MinDuration float64
+	MaxDuration float64
+	// words, which should be found in the title
+	Search string
+
+	Sort string
+	Desc bool
+	// page size
+	Limit int
+	// returned along with the previous page
+	Cursor string
+}
+
+// single page of the video listing
+type VideoPage struct {
+	Videos []Video
+	// empty on the last page
+	NextCursor string
+}
+
+// stored bytes and videos of an owner or a tenant
+type Usage struct {
+	// size of all the stored files (source videos, playlists, segments, thumbnails, captions)
+	Bytes int64
+	// amount of the stored source videos
+	Videos int
+}
+
+type Role string
+
+const (
+	// viewer can only read videos
+	RoleViewer Role = "viewer"
+	// uploader can upload videos and edit or delete their own ones
+	RoleUploader Role = "uploader"
+	// editor can also edit metadata of any video
+	RoleEditor Role = "editor"
+	// admin can manage users and do anything with any video
+	RoleAdmin Role = "admin"
+)
+
+// account, owning videos and api keys
+type User struct {
+	ID string
+	// unique login name
+	Name      string
+	Role      Role
+	Tenant    string
+	CreatedAt time.Time
+}
+
+// long-lived credential of a user
+type APIKey struct {
+	// public part of the key, used for the lookup
+	ID     string
+	UserID string
+	// label, set by the user
+	Name string
+	// hex encoded sha256 of the secret part
+	Hash string
+	// subset of the user scopes, the key is restricted to (nil for all of them)
+	Scopes []string
+	// tenant of the user, found out by the key
+	Tenant    string
+	CreatedAt time.Time
+}
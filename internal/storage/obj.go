@@ -5,9 +5,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/url"
+	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/tenant"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
@@ -21,10 +26,22 @@ type ObjectStorage interface {
 	Get(ctx context.Context, location Location) (io.ReadCloser, error)
 	// deletes object from the object storage
 	Delete(ctx context.Context, location Location) error
+	// returns temporary url, granting direct read access to the object
+	PresignedGet(ctx context.Context, location Location, expiry time.Duration) (*url.URL, error)
 }
 
+// isolation of the tenant objects
+const (
+	// objects are stored under the "<tenant>/" key prefix
+	TenancyPrefix = "prefix"
+	// objects are stored in the "<bucket>-<tenant>" buckets
+	TenancyBucket = "bucket"
+)
+
 type MinioS3 struct {
 	cl *minio.Client
+	// buckets of the tenants, which are known to exist
+	buckets *sync.Map
 
 	conf config.S3Config
 }
@@ -40,8 +57,9 @@ func NewS3(conf config.S3Config) (*MinioS3, error) {
 	}
 
 	s3 := &MinioS3{
-		cl:   minioClient,
-		conf: conf,
+		cl:      minioClient,
+		buckets: &sync.Map{},
+		conf:    conf,
 	}
 
 	ctx := context.Background()
@@ -54,9 +72,12 @@ func NewS3(conf config.S3Config) (*MinioS3, error) {
 }
 
 func (s3 MinioS3) Store(ctx context.Context, file File) (Location, error) {
-	bucket := s3.determineBucket(file.ObjectName)
+	bucket, object, err := s3.locate(ctx, file.ObjectName)
+	if err != nil {
+		return Location{}, err
+	}
 
-	info, err := s3.cl.PutObject(ctx, bucket, file.ObjectName, file.Raw, file.Size, minio.PutObjectOptions{})
+	info, err := s3.cl.PutObject(ctx, bucket, object, file.Raw, file.Size, minio.PutObjectOptions{})
 	if err != nil {
 		return Location{}, err
 	}
@@ -88,6 +109,64 @@ func (s3 MinioS3) Delete(ctx context.Context, loc Location) error {
 	return s3.cl.RemoveObject(ctx, loc.Bucket, loc.Object, minio.RemoveObjectOptions{})
 }
 
+func (s3 MinioS3) PresignedGet(ctx context.Context, loc Location, expiry time.Duration) (*url.URL, error) {
+	return s3.cl.PresignedGetObject(ctx, loc.Bucket, loc.Object, expiry, nil)
+}
+
+// returns bucket and key of the object, isolated according to the tenancy mode
+// objects of the default tenant are stored as is
+func (s3 MinioS3) locate(ctx context.Context, objectName string) (bucket, object string, err error) {
+	bucket, object = s3.determineBucket(objectName), objectName
+
+	id := tenant.FromContext(ctx)
+	if id == tenant.Default {
+		return bucket, object, nil
+	}
+
+	if s3.conf.Tenancy != TenancyBucket {
+		return bucket, path.Join(id, object), nil
+	}
+
+	bucket = bucket + "-" + id
+
+	// buckets of the tenants are created on their first upload
+	if _, ok := s3.buckets.Load(bucket); !ok {
+		if err := s3.createBuckets(ctx, bucket); err != nil {
+			return "", "", err
+		}
+		s3.buckets.Store(bucket, true)
+	}
+
+	return bucket, object, nil
+}
+
+// object, written and deleted to check, that the buckets are writable
+const probeObject = ".probe"
+
+// checks, that the buckets exist and are writable
+// buckets of the tenants are created on demand, so only the base ones are checked
+func (s3 MinioS3) Ping(ctx context.Context) error {
+	for _, bucket := range []string{s3.conf.VidBucket, s3.conf.ManBucket, s3.conf.ChunkBucket} {
+		exists, err := s3.cl.BucketExists(ctx, bucket)
+		if err != nil {
+			return fmt.Errorf("bucket %v: %w", bucket, err)
+		}
+		if !exists {
+			return fmt.Errorf("bucket %v doesn't exist", bucket)
+		}
+
+		if _, err := s3.cl.PutObject(ctx, bucket, probeObject, strings.NewReader("ok"), 2, minio.PutObjectOptions{}); err != nil {
+			return fmt.Errorf("bucket %v isn't writable: %w", bucket, err)
+		}
+
+		if err := s3.cl.RemoveObject(ctx, bucket, probeObject, minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("bucket %v: %w", bucket, err)
+		}
+	}
+
+	return nil
+}
+
 func (s3 MinioS3) determineBucket(filename string) (bucket string) {
 	if strings.HasSuffix(filename, ".mp4") {
 		return s3.conf.VidBucket
@@ -97,7 +176,12 @@ func (s3 MinioS3) determineBucket(filename string) (bucket string) {
 		return s3.conf.ManBucket
 	}
 
-	if strings.HasSuffix(filename, ".ts") {
+	if strings.HasSuffix(filename, ".ts") || strings.HasSuffix(filename, ".m4s") {
+		return s3.conf.ChunkBucket
+	}
+
+	// thumbnails and captions are kept along with the chunks
+	if strings.HasSuffix(filename, ".jpg") || strings.HasSuffix(filename, ".vtt") {
 		return s3.conf.ChunkBucket
 	}
 
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"path"
+	"time"
+
+	"github.com/cutlery47/gostream/config"
+)
+
+// how long the quota of an upload stays reserved
+// uploads, taking longer, are still checked, once their files are stored
+const reservationTTL = 6 * time.Hour
+
+// returns usage with the bytes and videos added
+func (u Usage) Add(bytes int64, videos int) Usage {
+	return Usage{Bytes: u.Bytes + bytes, Videos: u.Videos + videos}
+}
+
+func (u Usage) exceeds(maxBytes int64, maxVideos int) bool {
+	return (maxBytes > 0 && u.Bytes > maxBytes) || (maxVideos > 0 && u.Videos > maxVideos)
+}
+
+// checks usage of the owner and the tenant against the quotas
+// files without an owner are only accounted to the tenant
+func CheckQuota(quota config.QuotaConfig, owner string, user, tenant Usage) error {
+	if owner != "" && user.exceeds(quota.UserBytes, quota.UserVideos) {
+		return ErrUserQuota
+	}
+
+	if tenant.exceeds(quota.TenantBytes, quota.TenantVideos) {
+		return ErrTenantQuota
+	}
+
+	return nil
+}
+
+// source videos are stored under their bare names, every other file has an extension
+func videoCount(filename string) int {
+	if path.Ext(filename) == "" {
+		return 1
+	}
+	return 0
+}
@@ -3,27 +3,121 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/cutlery47/gostream/internal/utils"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
 
+// every query is scoped by the tenant of its context
+// except for the lookups by secrets (api keys, stream keys), which find out the tenant themselves
 type Repository interface {
-	// creates all the entries in db
-	CreateAll(ctx context.Context, video, manifest File, chunks []File) error
+	// creates all the entries in db along with the content key (nil, if the video isn't encrypted),
+	// if they fit into the quotas of the owner and the tenant
+	CreateAll(ctx context.Context, video, manifest File, chunks []File, key *ContentKey) error
+	// creates single entry or updates location of the existing one
+	Upsert(ctx context.Context, file File) error
 	// returns object storage location of a certain file
 	Read(ctx context.Context, filename string) (Location, error)
 	// deletes file from db and returns its object storage location
 	Delete(ctx context.Context, filename string) (Location, error)
+	// deletes every file of the video along with its record and returns the deleted files
+	DeleteAll(ctx context.Context, name string) ([]File, error)
+
+	UsageRepository
+	KeyRepository
+	StreamRepository
+	VideoRepository
+	UserRepository
+	BucketRepository
+}
+
+// usage is updated along with the stored files
+type UsageRepository interface {
+	// returns usage of the owner
+	ReadUsage(ctx context.Context, owner string) (Usage, error)
+	// returns usage of the whole tenant
+	ReadTenantUsage(ctx context.Context) (Usage, error)
+	// reserves usage for the upload of the video, if it fits into the quotas along with the other reservations
+	// reservation of the same video is replaced, CreateAll of the video deletes it
+	CreateReservation(ctx context.Context, name, owner string, usage Usage) error
+	DeleteReservation(ctx context.Context, name string) error
+}
+
+// stores content encryption keys
+type KeyRepository interface {
+	// stores content key of a video
+	CreateKey(ctx context.Context, key ContentKey) error
+	// returns content key by its id
+	ReadKey(ctx context.Context, keyID []byte) (ContentKey, error)
+	// deletes content keys of the video
+	DeleteKeys(ctx context.Context, videoName string) error
+}
+
+// stores live streams and their states
+type StreamRepository interface {
+	CreateStream(ctx context.Context, stream LiveStream) error
+	ReadStream(ctx context.Context, name string) (LiveStream, error)
+	// returns stream, which can be published with the key, along with its tenant
+	ReadStreamByKey(ctx context.Context, key string) (LiveStream, error)
+	UpdateStreamState(ctx context.Context, name string, state StreamState) error
+	// sets state of the stream, only if its current state is one of from (ErrStreamState otherwise)
+	SwapStreamState(ctx context.Context, name string, from []StreamState, to StreamState) error
+	DeleteStream(ctx context.Context, name string) error
+}
+
+// stores video records, used for listing
+type VideoRepository interface {
+	// creates video record, replacing a failed one with the same name
+	CreateVideo(ctx context.Context, video Video) error
+	ReadVideo(ctx context.Context, name string) (Video, error)
+	ReadVideoByID(ctx context.Context, id string) (Video, error)
+	// updates video record, if its stored version still equals video.Version
+	// (ErrVersionMismatch otherwise), the stored version is then incremented
+	UpdateVideo(ctx context.Context, video Video) error
+	DeleteVideo(ctx context.Context, name string) error
+	// returns single page of the videos, matching the query
+	ListVideos(ctx context.Context, query VideoQuery) (VideoPage, error)
+}
+
+// stores users and their api keys
+type UserRepository interface {
+	CreateUser(ctx context.Context, user User) error
+	ReadUser(ctx context.Context, id string) (User, error)
+	CreateAPIKey(ctx context.Context, key APIKey) error
+	// returns api key along with the tenant of its user
+	ReadAPIKey(ctx context.Context, id string) (APIKey, error)
+	// returns api keys of the user, oldest first
+	ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID, id string) error
+}
+
+// keeps token buckets of the rate limits, shared by the instances
+// keys aren't scoped by the tenant, callers include it themselves
+type BucketRepository interface {
+	// takes a token from the bucket of the key, refilled at rate tokens per second up to burst
+	// if there is none, nothing is taken and the time until the next token is returned
+	TakeToken(ctx context.Context, key string, rate float64, burst int) (time.Duration, error)
+	// deletes buckets, which were refilled (missing buckets are full)
+	DeleteFullBuckets(ctx context.Context) error
 }
 
 type FileRepository struct {
 	db *sql.DB
+
+	quota config.QuotaConfig
 }
 
-func NewFileRepository(conf config.DBConfig) (*FileRepository, error) {
+// opens connection pool of the db and makes sure, it is reachable
+func OpenDB(conf config.DBConfig) (*sql.DB, error) {
 	connStr := fmt.Sprintf("postgres://%v:%v@%v:%v/%v?sslmode=%v", conf.User, conf.Password, conf.Host, conf.Port, conf.DBName, conf.SSLMode)
 	// openning db connection
 	db, err := sql.Open("postgres", connStr)
@@ -31,10 +125,29 @@ func NewFileRepository(conf config.DBConfig) (*FileRepository, error) {
 		return nil, fmt.Errorf("error when connecting to db: %v", err)
 	}
 
-	return &FileRepository{db: db}, nil
+	// sql.Open doesn't connect, so unreachable db would go unnoticed until the first query
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error when connecting to db: %v", err)
+	}
+
+	return db, nil
+}
+
+// schema of the db is expected to be migrated
+func NewFileRepository(db *sql.DB, quota config.QuotaConfig) *FileRepository {
+	return &FileRepository{db: db, quota: quota}
 }
 
-func (fr *FileRepository) CreateAll(ctx context.Context, video File, manifest File, chunks []File) error {
+// checks the connection
+func (fr *FileRepository) Ping(ctx context.Context) error {
+	return fr.db.PingContext(ctx)
+}
+
+func (fr *FileRepository) CreateAll(ctx context.Context, video File, manifest File, chunks []File, key *ContentKey) error {
 	tx, err := fr.db.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
 		return err
@@ -62,6 +175,102 @@ func (fr *FileRepository) CreateAll(ctx context.Context, video File, manifest Fi
 		}
 	}
 
+	// key references the video, so it's inserted after it
+	if key != nil {
+		if err := fr.insertKey(ctx, tx, *key); err != nil {
+			return err
+		}
+	}
+
+	size := video.Size + manifest.Size
+	for _, chunk := range chunks {
+		size += chunk.Size
+	}
+
+	if err := fr.addUsage(ctx, tx, video.Owner, size, videoCount(video.FileName)); err != nil {
+		return err
+	}
+
+	// reserved usage is replaced with the actual one
+	if err := fr.deleteReservation(ctx, tx, video.FileName); err != nil {
+		return err
+	}
+
+	if err := fr.checkQuota(ctx, tx, video.Owner); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (fr *FileRepository) Upsert(ctx context.Context, file File) error {
+	tx, err := fr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// replaced file is no longer accounted
+	existing :=
+		`
+		SELECT size, owner
+		FROM file_schema.files
+		WHERE name = $1 AND tenant = $2
+		FOR UPDATE
+		`
+
+	var oldSize int64
+	var oldOwner string
+
+	err = tx.QueryRowContext(ctx, existing, file.FileName, tenant.FromContext(ctx)).Scan(&oldSize, &oldOwner)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	query :=
+		`
+		INSERT INTO file_schema.files
+		(id, name, bucket, object, tenant, size, owner)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (tenant, name) DO UPDATE
+		SET bucket = EXCLUDED.bucket, object = EXCLUDED.object, size = EXCLUDED.size, owner = EXCLUDED.owner
+		RETURNING id, (xmax = 0) AS inserted;
+		`
+
+	var id uuid.UUID
+	var inserted bool
+
+	res := tx.QueryRowContext(ctx, query, uuid.New(), file.FileName, file.Location.Bucket, file.Location.Object, tenant.FromContext(ctx), file.Size, file.Owner)
+	if err := res.Scan(&id, &inserted); err != nil {
+		return err
+	}
+
+	if !inserted {
+		if err := fr.addUsage(ctx, tx, oldOwner, -oldSize, -videoCount(file.FileName)); err != nil {
+			return err
+		}
+	}
+
+	if err := fr.addUsage(ctx, tx, file.Owner, file.Size, videoCount(file.FileName)); err != nil {
+		return err
+	}
+
+	// metadata is created only along with the file
+	if inserted {
+		insertMeta :=
+			`
+			INSERT INTO file_schema.files_meta
+			(file_id)
+			VALUES
+			($1);
+			`
+
+		if _, err := tx.ExecContext(ctx, insertMeta, id); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
@@ -70,40 +279,952 @@ func (fr *FileRepository) Read(ctx context.Context, filename string) (location L
 		`
 		SELECT bucket, object 
 		FROM file_schema.files
-		WHERE name = $1
+		WHERE name = $1 AND tenant = $2
 		`
 
-	res := fr.db.QueryRowContext(ctx, query, filename)
-	if err := res.Err(); err != nil {
-		return location, err
-	}
-
+	res := fr.db.QueryRowContext(ctx, query, filename, tenant.FromContext(ctx))
 	if err := res.Scan(&location.Bucket, &location.Object); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrFileNotFound.Wrap(err)
+		}
 		return location, err
 	}
 
-	return location, err
+	return location, nil
 }
 
 func (fr *FileRepository) Delete(ctx context.Context, filename string) (location Location, err error) {
+	tx, err := fr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return location, err
+	}
+	defer tx.Rollback()
+
 	query :=
 		`
-		DELETE file_schema.files AS f
-		WHERE f.name = $1
-		RETURNING f.bucket, f.object;
+		DELETE FROM file_schema.files AS f
+		WHERE f.name = $1 AND f.tenant = $2
+		RETURNING f.bucket, f.object, f.size, f.owner;
 		`
 
-	res := fr.db.QueryRowContext(ctx, query, filename)
-	if err := res.Err(); err != nil {
+	var size int64
+	var owner string
+
+	res := tx.QueryRowContext(ctx, query, filename, tenant.FromContext(ctx))
+	if err := res.Scan(&location.Bucket, &location.Object, &size, &owner); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrFileNotFound.Wrap(err)
+		}
 		return location, err
 	}
 
-	if err := res.Scan(&location.Bucket, &location.Object); err != nil {
+	if err := fr.addUsage(ctx, tx, owner, -size, -videoCount(filename)); err != nil {
 		return location, err
 	}
 
-	return location, err
+	return location, tx.Commit()
+}
+
+func (fr *FileRepository) DeleteAll(ctx context.Context, name string) (deleted []File, err error) {
+	tx, err := fr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// files of the video start with its name, the others are filtered out below
+	query :=
+		`
+		SELECT name, bucket, object, size, owner
+		FROM file_schema.files
+		WHERE tenant = $1 AND name LIKE $2 ESCAPE '\'
+		FOR UPDATE
+		`
+
+	rows, err := tx.QueryContext(ctx, query, tenant.FromContext(ctx), escapeLike(name)+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file File
+		if err := rows.Scan(&file.FileName, &file.Location.Bucket, &file.Location.Object, &file.Size, &file.Owner); err != nil {
+			return nil, err
+		}
+
+		if utils.VideoName(file.FileName) == name {
+			deleted = append(deleted, file)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(deleted))
+	// usage of each owner is released at once
+	released := make(map[string]Usage)
+	for _, file := range deleted {
+		names = append(names, file.FileName)
+		released[file.Owner] = released[file.Owner].Add(file.Size, videoCount(file.FileName))
+	}
+
+	// content keys are deleted along with the source file
+	deleteFiles :=
+		`
+		DELETE FROM file_schema.files
+		WHERE tenant = $1 AND name = ANY($2)
+		`
+
+	if _, err := tx.ExecContext(ctx, deleteFiles, tenant.FromContext(ctx), pq.Array(names)); err != nil {
+		return nil, err
+	}
+
+	for owner, usage := range released {
+		if err := fr.addUsage(ctx, tx, owner, -usage.Bytes, -usage.Videos); err != nil {
+			return nil, err
+		}
+	}
+
+	deleteVideo :=
+		`
+		DELETE FROM file_schema.videos
+		WHERE name = $1 AND tenant = $2
+		`
+
+	res, err := tx.ExecContext(ctx, deleteVideo, name, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	// neither files nor the record were found
+	if affected == 0 && len(deleted) == 0 {
+		return nil, ErrFileNotFound
+	}
+
+	return deleted, tx.Commit()
+}
+
+func (fr *FileRepository) ReadUsage(ctx context.Context, owner string) (usage Usage, err error) {
+	query :=
+		`
+		SELECT bytes, videos
+		FROM file_schema.usage
+		WHERE tenant = $1 AND owner = $2
+		`
+
+	err = fr.db.QueryRowContext(ctx, query, tenant.FromContext(ctx), owner).Scan(&usage.Bytes, &usage.Videos)
+	if errors.Is(err, sql.ErrNoRows) {
+		// nothing was stored yet
+		return usage, nil
+	}
+
+	return usage, err
+}
+
+func (fr *FileRepository) ReadTenantUsage(ctx context.Context) (usage Usage, err error) {
+	return fr.tenantUsage(ctx, fr.db)
+}
+
+func (fr *FileRepository) CreateReservation(ctx context.Context, name, owner string, usage Usage) error {
+	tx, err := fr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query :=
+		`
+		INSERT INTO file_schema.reservations
+		(tenant, name, owner, bytes, videos, expires_at)
+		VALUES
+		($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant, name) DO UPDATE
+		SET owner = EXCLUDED.owner, bytes = EXCLUDED.bytes, videos = EXCLUDED.videos, expires_at = EXCLUDED.expires_at
+		`
+
+	if _, err := tx.ExecContext(ctx, query, tenant.FromContext(ctx), name, owner, usage.Bytes, usage.Videos, time.Now().Add(reservationTTL)); err != nil {
+		return err
+	}
+
+	if err := fr.checkQuota(ctx, tx, owner); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (fr *FileRepository) DeleteReservation(ctx context.Context, name string) error {
+	tx, err := fr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fr.deleteReservation(ctx, tx, name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (fr *FileRepository) TakeToken(ctx context.Context, key string, rate float64, burst int) (wait time.Duration, err error) {
+	tx, err := fr.db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// missing bucket is full
+	create :=
+		`
+		INSERT INTO file_schema.buckets
+		(key, tokens, updated_at, full_at)
+		VALUES
+		($1, $2, clock_timestamp(), clock_timestamp())
+		ON CONFLICT (key) DO NOTHING;
+		`
+
+	if _, err := tx.ExecContext(ctx, create, key, burst); err != nil {
+		return 0, err
+	}
+
+	// clock of the db is shared by the instances
+	read :=
+		`
+		SELECT tokens, EXTRACT(EPOCH FROM clock_timestamp() - updated_at)
+		FROM file_schema.buckets
+		WHERE key = $1
+		FOR UPDATE;
+		`
+
+	var tokens, elapsed float64
+	if err := tx.QueryRowContext(ctx, read, key).Scan(&tokens, &elapsed); err != nil {
+		return 0, err
+	}
+
+	tokens = min(float64(burst), tokens+max(elapsed, 0)*rate)
+	if tokens < 1 {
+		return time.Duration((1 - tokens) / rate * float64(time.Second)), nil
+	}
+	tokens--
+
+	update :=
+		`
+		UPDATE file_schema.buckets
+		SET tokens = $2, updated_at = clock_timestamp(), full_at = clock_timestamp() + make_interval(secs => $3)
+		WHERE key = $1;
+		`
+
+	if _, err := tx.ExecContext(ctx, update, key, tokens, (float64(burst)-tokens)/rate); err != nil {
+		return 0, err
+	}
+
+	return 0, tx.Commit()
+}
+
+func (fr *FileRepository) DeleteFullBuckets(ctx context.Context) error {
+	query :=
+		`
+		DELETE FROM file_schema.buckets
+		WHERE full_at < clock_timestamp();
+		`
+
+	_, err := fr.db.ExecContext(ctx, query)
+	return err
+}
+
+func (fr *FileRepository) CreateKey(ctx context.Context, key ContentKey) error {
+	return fr.insertKey(ctx, fr.db, key)
+}
+
+func (fr *FileRepository) ReadKey(ctx context.Context, keyID []byte) (key ContentKey, err error) {
+	query :=
+		`
+		SELECT kid, key, scheme, video_name
+		FROM file_schema.keys
+		WHERE kid = $1 AND tenant = $2
+		`
+
+	res := fr.db.QueryRowContext(ctx, query, keyID, tenant.FromContext(ctx))
+	if err := res.Scan(&key.KeyID, &key.Key, &key.Scheme, &key.VideoName); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrDBNotFound
+		}
+		return key, err
+	}
+
+	return key, nil
+}
+
+func (fr *FileRepository) DeleteKeys(ctx context.Context, videoName string) error {
+	query :=
+		`
+		DELETE FROM file_schema.keys
+		WHERE video_name = $1 AND tenant = $2
+		`
+
+	_, err := fr.db.ExecContext(ctx, query, videoName, tenant.FromContext(ctx))
+	return err
+}
+
+func (fr *FileRepository) CreateStream(ctx context.Context, stream LiveStream) error {
+	query :=
+		`
+		INSERT INTO file_schema.streams
+		(name, key, state, tenant, owner)
+		VALUES
+		($1, $2, $3, $4, $5);
+		`
+
+	if _, err := fr.db.ExecContext(ctx, query, stream.Name, stream.Key, stream.State, tenant.FromContext(ctx), stream.Owner); err != nil {
+		if pgerr, ok := err.(*pq.Error); ok && pgerr.Code == "23505" {
+			err = ErrUniqueStream
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (fr *FileRepository) ReadStream(ctx context.Context, name string) (LiveStream, error) {
+	query :=
+		`
+		SELECT name, key, state, updated_at, tenant, owner
+		FROM file_schema.streams
+		WHERE name = $1 AND tenant = $2
+		`
+
+	return fr.scanStream(fr.db.QueryRowContext(ctx, query, name, tenant.FromContext(ctx)))
+}
+
+func (fr *FileRepository) ReadStreamByKey(ctx context.Context, key string) (LiveStream, error) {
+	query :=
+		`
+		SELECT name, key, state, updated_at, tenant, owner
+		FROM file_schema.streams
+		WHERE key = $1
+		`
+
+	return fr.scanStream(fr.db.QueryRowContext(ctx, query, key))
+}
+
+func (fr *FileRepository) UpdateStreamState(ctx context.Context, name string, state StreamState) error {
+	query :=
+		`
+		UPDATE file_schema.streams
+		SET state = $2, updated_at = current_timestamp
+		WHERE name = $1 AND tenant = $3
+		`
+
+	res, err := fr.db.ExecContext(ctx, query, name, state, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return fr.checkAffected(res)
+}
+
+func (fr *FileRepository) SwapStreamState(ctx context.Context, name string, from []StreamState, to StreamState) error {
+	query :=
+		`
+		UPDATE file_schema.streams
+		SET state = $2, updated_at = current_timestamp
+		WHERE name = $1 AND tenant = $3 AND state = ANY($4)
+		`
+
+	states := make([]string, len(from))
+	for i, state := range from {
+		states[i] = string(state)
+	}
+
+	res, err := fr.db.ExecContext(ctx, query, name, to, tenant.FromContext(ctx), pq.Array(states))
+	if err != nil {
+		return err
+	}
+
+	if err := fr.checkAffected(res); errors.Is(err, ErrDBNotFound) {
+		return ErrStreamState
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (fr *FileRepository) DeleteStream(ctx context.Context, name string) error {
+	query :=
+		`
+		DELETE FROM file_schema.streams
+		WHERE name = $1 AND tenant = $2
+		`
+
+	res, err := fr.db.ExecContext(ctx, query, name, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return fr.checkAffected(res)
+}
+
+func (fr *FileRepository) CreateVideo(ctx context.Context, video Video) error {
+	query :=
+		`
+		INSERT INTO file_schema.videos AS v
+		(name, title, description, status, visibility, owner, tags, attributes, duration, size, captions, id, tenant)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (tenant, name) DO UPDATE
+		SET title = EXCLUDED.title, description = EXCLUDED.description, status = EXCLUDED.status,
+			visibility = EXCLUDED.visibility, owner = EXCLUDED.owner, tags = EXCLUDED.tags, attributes = EXCLUDED.attributes,
+			duration = EXCLUDED.duration, size = EXCLUDED.size, captions = EXCLUDED.captions, id = EXCLUDED.id,
+			uploaded_at = current_timestamp, version = v.version + 1
+		WHERE v.status = 'failed'
+		`
+
+	res, err := fr.db.ExecContext(ctx, query, append(videoValues(video), video.ID, tenant.FromContext(ctx))...)
+	if err != nil {
+		// id is taken within the tenant
+		if pgerr, ok := err.(*pq.Error); ok && pgerr.Code == "23505" {
+			err = ErrUniueVideo
+		}
+		return err
+	}
+
+	// conflicting video wasn't failed
+	if err := fr.checkAffected(res); err != nil {
+		return ErrUniueVideo
+	}
+
+	return nil
+}
+
+func (fr *FileRepository) ReadVideo(ctx context.Context, name string) (video Video, err error) {
+	query := fmt.Sprintf(
+		`
+		SELECT %v
+		FROM file_schema.videos
+		WHERE name = $1 AND tenant = $2
+		`,
+		videoColumns,
+	)
+
+	row := fr.db.QueryRowContext(ctx, query, name, tenant.FromContext(ctx))
+	if err := row.Scan(videoFields(&video)...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrDBNotFound
+		}
+		return video, err
+	}
+
+	return video, nil
+}
+
+func (fr *FileRepository) ReadVideoByID(ctx context.Context, id string) (video Video, err error) {
+	// malformed ids can't be found anyway
+	if _, err := uuid.Parse(id); err != nil {
+		return video, ErrDBNotFound
+	}
+
+	query := fmt.Sprintf(
+		`
+		SELECT %v
+		FROM file_schema.videos
+		WHERE id = $1 AND tenant = $2
+		`,
+		videoColumns,
+	)
+
+	row := fr.db.QueryRowContext(ctx, query, id, tenant.FromContext(ctx))
+	if err := row.Scan(videoFields(&video)...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrDBNotFound
+		}
+		return video, err
+	}
+
+	return video, nil
+}
+
+func (fr *FileRepository) UpdateVideo(ctx context.Context, video Video) error {
+	query :=
+		`
+		UPDATE file_schema.videos
+		SET title = $2, description = $3, status = $4, visibility = $5, owner = $6, tags = $7, attributes = $8,
+			duration = $9, size = $10, captions = $11, version = version + 1
+		WHERE name = $1 AND version = $12 AND tenant = $13
+		`
+
+	res, err := fr.db.ExecContext(ctx, query, append(videoValues(video), video.Version, tenant.FromContext(ctx))...)
+	if err != nil {
+		return err
+	}
+
+	if err := fr.checkAffected(res); err == nil {
+		return nil
+	}
+
+	// video is either missing or was updated by someone else
+	if _, err := fr.ReadVideo(ctx, video.Name); err != nil {
+		return err
+	}
+
+	return ErrVersionMismatch
+}
+
+func (fr *FileRepository) DeleteVideo(ctx context.Context, name string) error {
+	query :=
+		`
+		DELETE FROM file_schema.videos
+		WHERE name = $1 AND tenant = $2
+		`
+
+	res, err := fr.db.ExecContext(ctx, query, name, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return fr.checkAffected(res)
+}
+
+// sort orders and the columns, they are based on
+var videoSortColumns = map[string]string{
+	SortUploaded: "uploaded_at",
+	SortTitle:    "title",
+	SortDuration: "duration",
+}
+
+func (fr *FileRepository) ListVideos(ctx context.Context, query VideoQuery) (page VideoPage, err error) {
+	column, ok := videoSortColumns[query.Sort]
+	if !ok {
+		return page, ErrInvalidQuery
+	}
+
+	var conds []string
+	var args []any
+
+	// adds query argument, returning its placeholder
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conds = append(conds, "tenant = "+arg(tenant.FromContext(ctx)))
+
+	if query.Status != "" {
+		conds = append(conds, "status = "+arg(query.Status))
+	}
+	if query.Visibility != "" {
+		conds = append(conds, "visibility = "+arg(query.Visibility))
+	}
+	if query.Tag != "" {
+		conds = append(conds, arg(query.Tag)+" = ANY(tags)")
+	}
+	if query.Owner != "" {
+		conds = append(conds, "owner = "+arg(query.Owner))
+	}
+	if query.MinDuration > 0 {
+		conds = append(conds, "duration >= "+arg(query.MinDuration))
+	}
+	if query.MaxDuration > 0 {
+		conds = append(conds, "duration <= "+arg(query.MaxDuration))
+	}
+	if query.Search != "" {
+		conds = append(conds, "search @@ plainto_tsquery('simple', "+arg(query.Search)+")")
+	}
+
+	order, cmp := "ASC", ">"
+	if query.Desc {
+		order, cmp = "DESC", "<"
+	}
+
+	// keyset pagination: only the rows past the last one of the previous page
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return page, err
+		}
+
+		var value any
+		switch query.Sort {
+		case SortUploaded:
+			value = cursor.UploadedAt
+		case SortTitle:
+			value = cursor.Title
+		case SortDuration:
+			value = cursor.Duration
+		}
+
+		conds = append(conds, fmt.Sprintf("(%v, name) %v (%v, %v)", column, cmp, arg(value), arg(cursor.Name)))
+	}
+
+	// one extra row tells, if there is a next page
+	list := fmt.Sprintf(
+		`
+		SELECT %v
+		FROM file_schema.videos
+		WHERE %v
+		ORDER BY %v %v, name %v
+		LIMIT %v
+		`,
+		videoColumns, strings.Join(conds, " AND "), column, order, order, arg(query.Limit+1),
+	)
+
+	rows, err := fr.db.QueryContext(ctx, list, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var videos []Video
+	for rows.Next() {
+		var video Video
+		if err := rows.Scan(videoFields(&video)...); err != nil {
+			return page, err
+		}
+		videos = append(videos, video)
+	}
+
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	return newVideoPage(videos, query), nil
+}
+
+func (fr *FileRepository) CreateUser(ctx context.Context, user User) error {
+	query :=
+		`
+		INSERT INTO file_schema.users
+		(id, name, role, created_at, tenant)
+		VALUES
+		($1, $2, $3, $4, $5)
+		`
+
+	if _, err := fr.db.ExecContext(ctx, query, user.ID, user.Name, user.Role, user.CreatedAt, tenant.FromContext(ctx)); err != nil {
+		if pgerr, ok := err.(*pq.Error); ok && pgerr.Code == "23505" {
+			err = ErrUniqueUser
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (fr *FileRepository) ReadUser(ctx context.Context, id string) (user User, err error) {
+	// malformed ids can't be found anyway
+	if _, err := uuid.Parse(id); err != nil {
+		return user, ErrDBNotFound
+	}
+
+	query :=
+		`
+		SELECT id, name, role, tenant, created_at
+		FROM file_schema.users
+		WHERE id = $1 AND tenant = $2
+		`
+
+	row := fr.db.QueryRowContext(ctx, query, id, tenant.FromContext(ctx))
+	if err := row.Scan(&user.ID, &user.Name, &user.Role, &user.Tenant, &user.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrDBNotFound
+		}
+		return user, err
+	}
+
+	return user, nil
+}
+
+func (fr *FileRepository) CreateAPIKey(ctx context.Context, key APIKey) error {
+	if _, err := uuid.Parse(key.UserID); err != nil {
+		return ErrDBNotFound
+	}
+
+	// key is only created for the users of the tenant
+	query :=
+		`
+		INSERT INTO file_schema.api_keys
+		(id, user_id, name, hash, scopes, created_at)
+		SELECT $1, id, $3, $4, $5, $6
+		FROM file_schema.users
+		WHERE id = $2 AND tenant = $7
+		`
+
+	res, err := fr.db.ExecContext(ctx, query, key.ID, key.UserID, key.Name, key.Hash, pq.Array(key.Scopes), key.CreatedAt, tenant.FromContext(ctx))
+	if err != nil {
+		// user was deleted in the meantime
+		if pgerr, ok := err.(*pq.Error); ok && pgerr.Code == "23503" {
+			err = ErrDBNotFound
+		}
+		return err
+	}
+
+	return fr.checkAffected(res)
+}
+
+func (fr *FileRepository) ReadAPIKey(ctx context.Context, id string) (key APIKey, err error) {
+	query :=
+		`
+		SELECT k.id, k.user_id, k.name, k.hash, k.scopes, u.tenant, k.created_at
+		FROM file_schema.api_keys AS k
+		JOIN file_schema.users AS u ON u.id = k.user_id
+		WHERE k.id = $1
+		`
+
+	row := fr.db.QueryRowContext(ctx, query, id)
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Hash, pq.Array(&key.Scopes), &key.Tenant, &key.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrDBNotFound
+		}
+		return key, err
+	}
+
+	return key, nil
+}
+
+func (fr *FileRepository) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, nil
+	}
+
+	query :=
+		`
+		SELECT k.id, k.user_id, k.name, k.hash, k.scopes, u.tenant, k.created_at
+		FROM file_schema.api_keys AS k
+		JOIN file_schema.users AS u ON u.id = k.user_id
+		WHERE k.user_id = $1 AND u.tenant = $2
+		ORDER BY k.created_at, k.id
+		`
+
+	rows, err := fr.db.QueryContext(ctx, query, userID, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Hash, pq.Array(&key.Scopes), &key.Tenant, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (fr *FileRepository) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrDBNotFound
+	}
+
+	query :=
+		`
+		DELETE FROM file_schema.api_keys AS k
+		USING file_schema.users AS u
+		WHERE k.id = $1 AND k.user_id = $2 AND u.id = k.user_id AND u.tenant = $3
+		`
+
+	res, err := fr.db.ExecContext(ctx, query, id, userID, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	return fr.checkAffected(res)
+}
+
+// selected video columns, in the order of videoFields
+const videoColumns = "id, name, title, description, status, visibility, owner, tags, attributes, duration, size, captions, uploaded_at, version"
+
+func videoFields(video *Video) []any {
+	return []any{
+		&video.ID, &video.Name, &video.Title, &video.Description, &video.Status, &video.Visibility, &video.Owner,
+		pq.Array(&video.Tags), (*attributes)(&video.Attributes), &video.Duration, &video.Size, pq.Array(&video.Captions),
+		&video.UploadedAt, &video.Version,
+	}
+}
+
+// stored video columns, in the order of CreateVideo and UpdateVideo placeholders
+func videoValues(video Video) []any {
+	return []any{
+		video.Name, video.Title, video.Description, video.Status, video.Visibility, video.Owner,
+		pq.Array(nonNil(video.Tags)), attributes(video.Attributes), video.Duration, video.Size, pq.Array(nonNil(video.Captions)),
+	}
+}
+
+// custom video attributes, stored as jsonb
+type attributes map[string]string
+
+func (a attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(a)
+}
+
+func (a *attributes) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, a)
+	case string:
+		return json.Unmarshal([]byte(data), a)
+	case nil:
+		*a = nil
+		return nil
+	}
+	return fmt.Errorf("can't scan %T into attributes", src)
+}
+
+// empty array is stored instead of NULL
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func (fr *FileRepository) scanStream(row *sql.Row) (stream LiveStream, err error) {
+	if err := row.Scan(&stream.Name, &stream.Key, &stream.State, &stream.UpdatedAt, &stream.Tenant, &stream.Owner); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrDBNotFound
+		}
+		return stream, err
+	}
+
+	return stream, nil
+}
+
+// returns ErrDBNotFound, if nothing was affected by the query
+func (fr *FileRepository) checkAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrDBNotFound
+	}
+
+	return nil
+}
+
+// escapes wildcards of the LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// either a db or a transaction
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// either a db or a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (fr *FileRepository) tenantUsage(ctx context.Context, q querier) (usage Usage, err error) {
+	query :=
+		`
+		SELECT COALESCE(SUM(bytes), 0), COALESCE(SUM(videos), 0)
+		FROM file_schema.usage
+		WHERE tenant = $1
+		`
+
+	err = q.QueryRowContext(ctx, query, tenant.FromContext(ctx)).Scan(&usage.Bytes, &usage.Videos)
+	return usage, err
+}
+
+// adds bytes and videos to the usage of the owner
+func (fr *FileRepository) addUsage(ctx context.Context, tx *sql.Tx, owner string, bytes int64, videos int) error {
+	if bytes == 0 && videos == 0 {
+		return nil
+	}
+
+	query :=
+		`
+		INSERT INTO file_schema.usage AS u
+		(tenant, owner, bytes, videos)
+		VALUES
+		($1, $2, $3, $4)
+		ON CONFLICT (tenant, owner) DO UPDATE
+		SET bytes = u.bytes + EXCLUDED.bytes, videos = u.videos + EXCLUDED.videos
+		`
+
+	_, err := tx.ExecContext(ctx, query, tenant.FromContext(ctx), owner, bytes, videos)
+	return err
+}
+
+// checks usage of the owner and the tenant, including the changes of the transaction
+func (fr *FileRepository) checkQuota(ctx context.Context, tx *sql.Tx, owner string) error {
+	// concurrent uploads of the tenant are checked one by one
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "quota:"+tenant.FromContext(ctx)); err != nil {
+		return err
+	}
+
+	query :=
+		`
+		SELECT bytes, videos
+		FROM file_schema.usage
+		WHERE tenant = $1 AND owner = $2
+		`
+
+	var user Usage
+	if err := tx.QueryRowContext(ctx, query, tenant.FromContext(ctx), owner).Scan(&user.Bytes, &user.Videos); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	tenantUsage, err := fr.tenantUsage(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	// usage, reserved by the uploads in progress, is counted as stored
+	reserved :=
+		`
+		SELECT COALESCE(SUM(bytes) FILTER (WHERE owner = $2), 0), COALESCE(SUM(videos) FILTER (WHERE owner = $2), 0),
+			COALESCE(SUM(bytes), 0), COALESCE(SUM(videos), 0)
+		FROM file_schema.reservations
+		WHERE tenant = $1 AND expires_at > now()
+		`
+
+	var userReserved, tenantReserved Usage
+	if err := tx.QueryRowContext(ctx, reserved, tenant.FromContext(ctx), owner).Scan(&userReserved.Bytes, &userReserved.Videos, &tenantReserved.Bytes, &tenantReserved.Videos); err != nil {
+		return err
+	}
+
+	return CheckQuota(fr.quota, owner, user.Add(userReserved.Bytes, userReserved.Videos), tenantUsage.Add(tenantReserved.Bytes, tenantReserved.Videos))
+}
+
+// expired reservations are cleaned up along the way
+func (fr *FileRepository) deleteReservation(ctx context.Context, tx *sql.Tx, name string) error {
+	query :=
+		`
+		DELETE FROM file_schema.reservations
+		WHERE (tenant = $1 AND name = $2) OR expires_at <= now()
+		`
+
+	_, err := tx.ExecContext(ctx, query, tenant.FromContext(ctx), name)
+	return err
+}
+
+func (fr *FileRepository) insertKey(ctx context.Context, e execer, key ContentKey) error {
+	query :=
+		`
+		INSERT INTO file_schema.keys
+		(kid, key, scheme, video_name, tenant)
+		VALUES
+		($1, $2, $3, $4, $5);
+		`
 
+	_, err := e.ExecContext(ctx, query, key.KeyID, key.Key, key.Scheme, key.VideoName, tenant.FromContext(ctx))
+	return err
 }
 
 func (fr *FileRepository) insertFile(ctx context.Context, tx *sql.Tx, file File) error {
@@ -113,9 +1234,9 @@ func (fr *FileRepository) insertFile(ctx context.Context, tx *sql.Tx, file File)
 	insertFile :=
 		`
 		INSERT INTO file_schema.files
-		(id, name, bucket, object)
+		(id, name, bucket, object, tenant, size, owner)
 		VALUES
-		($1, $2, $3, $4);
+		($1, $2, $3, $4, $5, $6, $7);
 		`
 
 	// query for metadata insertion (along with file)
@@ -127,7 +1248,7 @@ func (fr *FileRepository) insertFile(ctx context.Context, tx *sql.Tx, file File)
 		($1);
 		`
 
-	if _, err := tx.ExecContext(ctx, insertFile, id, file.FileName, file.Location.Bucket, file.Location.Object); err != nil {
+	if _, err := tx.ExecContext(ctx, insertFile, id, file.FileName, file.Location.Bucket, file.Location.Object, tenant.FromContext(ctx), file.Size, file.Owner); err != nil {
 		return err
 	}
 
@@ -2,24 +2,52 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/url"
 	"os"
+	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/logging"
+	"github.com/cutlery47/gostream/internal/metrics"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"github.com/cutlery47/gostream/internal/tracing"
 	"github.com/cutlery47/gostream/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
 // abstracts out file manipulation
 type Storage interface {
-	// stores files
-	Store(ctx context.Context, video, manifest File, chunks []File) error
+	// stores files of the uploaded video along with its content key (nil, if the video isn't encrypted),
+	// if they fit into the quotas of its owner and tenant
+	Store(ctx context.Context, video, manifest File, chunks []File, key *ContentKey) error
+	// stores single file, replacing the existing one with the same name
+	Put(ctx context.Context, file File) error
 	// retrieves file
 	Get(ctx context.Context, filename string) (io.ReadCloser, error)
+	// returns temporary url, from which the file can be retrieved directly
+	GetURL(ctx context.Context, filename string, expiry time.Duration) (string, error)
 	// removes file
 	Remove(ctx context.Context, filename string) error
+	// removes every file of the video (source, playlist, segments, thumbnail, captions) along with its record
+	RemoveVideo(ctx context.Context, name string) error
+	// retrieves content key by its id
+	GetKey(ctx context.Context, keyID []byte) (ContentKey, error)
+	// returns usage of the owner
+	Usage(ctx context.Context, owner string) (Usage, error)
+	// returns usage of the whole tenant
+	TenantUsage(ctx context.Context) (Usage, error)
+	// reserves quota for the upload of the video, until its files are stored or the reservation is released
+	// reservation of the same video is replaced, so it can grow, as the upload goes on
+	Reserve(ctx context.Context, name, owner string, usage Usage) error
+	Release(ctx context.Context, name string) error
 }
 
 // db + obj storage based storage
@@ -43,21 +71,24 @@ func NewDistibutedStorage(infoLog, errLog *zap.Logger, cfg config.StorageConfig,
 }
 
 // todo: make s3 uploads "transactional"
-func (ds *DistibutedStorage) Store(ctx context.Context, video, manifest File, chunks []File) error {
+func (ds *DistibutedStorage) Store(ctx context.Context, video, manifest File, chunks []File, key *ContentKey) (err error) {
+	ctx, span := tracing.Start(ctx, "DistibutedStorage.Store", attribute.Int("files", len(chunks)+2))
+	defer func() { tracing.End(span, err) }()
+
 	// remove locally stored files
 	defer ds.truncateLocalDir()
 
-	vidLocation, err := ds.s3.Store(ctx, video)
+	vidLocation, err := measure(ctx, metrics.BackendObjects, "store", func(ctx context.Context) (Location, error) { return ds.s3.Store(ctx, video) })
 	if err != nil {
 		return err
 	}
 
-	manLocation, err := ds.s3.Store(ctx, manifest)
+	manLocation, err := measure(ctx, metrics.BackendObjects, "store", func(ctx context.Context) (Location, error) { return ds.s3.Store(ctx, manifest) })
 	if err != nil {
 		return err
 	}
 
-	chunkLocations, err := ds.s3.StoreMultiple(ctx, chunks...)
+	chunkLocations, err := measure(ctx, metrics.BackendObjects, "store_multiple", func(ctx context.Context) ([]Location, error) { return ds.s3.StoreMultiple(ctx, chunks...) })
 	if err != nil {
 		return err
 	}
@@ -70,25 +101,135 @@ func (ds *DistibutedStorage) Store(ctx context.Context, video, manifest File, ch
 	}
 
 	// store data in the db
-	return ds.repo.CreateAll(ctx, video, manifest, chunks)
+	if err := observe(ctx, metrics.BackendRepository, "create_all", func(ctx context.Context) error { return ds.repo.CreateAll(ctx, video, manifest, chunks, key) }); err != nil {
+		// objects, which aren't referenced in the db, would take space unaccounted
+		ds.removeObjects(ctx, append([]File{video, manifest}, chunks...))
+		return err
+	}
+
+	return nil
 }
 
-func (ds *DistibutedStorage) Get(ctx context.Context, filename string) (io.ReadCloser, error) {
-	fileLocation, err := ds.repo.Read(ctx, filename)
+func (ds *DistibutedStorage) Put(ctx context.Context, file File) (err error) {
+	ctx, span := tracing.Start(ctx, "DistibutedStorage.Put", attribute.String("file", file.FileName))
+	defer func() { tracing.End(span, err) }()
+
+	location, err := measure(ctx, metrics.BackendObjects, "store", func(ctx context.Context) (Location, error) { return ds.s3.Store(ctx, file) })
+	if err != nil {
+		return err
+	}
+
+	file.Location = location
+
+	return observe(ctx, metrics.BackendRepository, "upsert", func(ctx context.Context) error { return ds.repo.Upsert(ctx, file) })
+}
+
+func (ds *DistibutedStorage) Get(ctx context.Context, filename string) (_ io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "DistibutedStorage.Get", attribute.String("file", filename))
+	defer func() { tracing.End(span, err) }()
+
+	fileLocation, err := measure(ctx, metrics.BackendRepository, "read", func(ctx context.Context) (Location, error) { return ds.repo.Read(ctx, filename) })
 	if err != nil {
 		return nil, err
 	}
 
-	return ds.s3.Get(ctx, fileLocation)
+	// latency of the object storage is measured until the first byte
+	return measure(ctx, metrics.BackendObjects, "get", func(ctx context.Context) (io.ReadCloser, error) { return ds.s3.Get(ctx, fileLocation) })
 }
 
-func (ds *DistibutedStorage) Remove(ctx context.Context, filename string) error {
-	fileLocation, err := ds.repo.Delete(ctx, filename)
+func (ds *DistibutedStorage) GetURL(ctx context.Context, filename string, expiry time.Duration) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "DistibutedStorage.GetURL", attribute.String("file", filename))
+	defer func() { tracing.End(span, err) }()
+
+	fileLocation, err := measure(ctx, metrics.BackendRepository, "read", func(ctx context.Context) (Location, error) { return ds.repo.Read(ctx, filename) })
+	if err != nil {
+		return "", err
+	}
+
+	presigned, err := measure(ctx, metrics.BackendObjects, "presign", func(ctx context.Context) (*url.URL, error) { return ds.s3.PresignedGet(ctx, fileLocation, expiry) })
+	if err != nil {
+		return "", err
+	}
+
+	return presigned.String(), nil
+}
+
+func (ds *DistibutedStorage) Remove(ctx context.Context, filename string) (err error) {
+	ctx, span := tracing.Start(ctx, "DistibutedStorage.Remove", attribute.String("file", filename))
+	defer func() { tracing.End(span, err) }()
+
+	fileLocation, err := measure(ctx, metrics.BackendRepository, "delete", func(ctx context.Context) (Location, error) { return ds.repo.Delete(ctx, filename) })
+	if err != nil {
+		return err
+	}
+
+	return observe(ctx, metrics.BackendObjects, "delete", func(ctx context.Context) error { return ds.s3.Delete(ctx, fileLocation) })
+}
+
+func (ds *DistibutedStorage) RemoveVideo(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "DistibutedStorage.RemoveVideo", attribute.String("video", name))
+	defer func() { tracing.End(span, err) }()
+
+	files, err := measure(ctx, metrics.BackendRepository, "delete_all", func(ctx context.Context) ([]File, error) { return ds.repo.DeleteAll(ctx, name) })
 	if err != nil {
 		return err
 	}
 
-	return ds.s3.Delete(ctx, fileLocation)
+	// objects are no longer referenced, so the ones left behind are only logged
+	ds.removeObjects(ctx, files)
+
+	return nil
+}
+
+func (ds *DistibutedStorage) GetKey(ctx context.Context, keyID []byte) (ContentKey, error) {
+	return measure(ctx, metrics.BackendRepository, "read_key", func(ctx context.Context) (ContentKey, error) { return ds.repo.ReadKey(ctx, keyID) })
+}
+
+func (ds *DistibutedStorage) Usage(ctx context.Context, owner string) (Usage, error) {
+	return measure(ctx, metrics.BackendRepository, "read_usage", func(ctx context.Context) (Usage, error) { return ds.repo.ReadUsage(ctx, owner) })
+}
+
+func (ds *DistibutedStorage) TenantUsage(ctx context.Context) (Usage, error) {
+	return measure(ctx, metrics.BackendRepository, "read_tenant_usage", func(ctx context.Context) (Usage, error) { return ds.repo.ReadTenantUsage(ctx) })
+}
+
+func (ds *DistibutedStorage) Reserve(ctx context.Context, name, owner string, usage Usage) error {
+	return observe(ctx, metrics.BackendRepository, "create_reservation", func(ctx context.Context) error {
+		return ds.repo.CreateReservation(ctx, name, owner, usage)
+	})
+}
+
+func (ds *DistibutedStorage) Release(ctx context.Context, name string) error {
+	return observe(ctx, metrics.BackendRepository, "delete_reservation", func(ctx context.Context) error { return ds.repo.DeleteReservation(ctx, name) })
+}
+
+func (ds *DistibutedStorage) removeObjects(ctx context.Context, files []File) {
+	for _, file := range files {
+		if err := observe(ctx, metrics.BackendObjects, "delete", func(ctx context.Context) error { return ds.s3.Delete(ctx, file.Location) }); err != nil {
+			logging.For(ctx, ds.errLog).Error(fmt.Sprintf("couldn't remove object %v/%v: %v", file.Location.Bucket, file.Location.Object, err))
+		}
+	}
+}
+
+// runs operation of the backend within its own span, recording its latency and errors
+func observe(ctx context.Context, backend, operation string, fn func(ctx context.Context) error) error {
+	_, err := measure(ctx, backend, operation, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// same as observe, but for operations returning a value
+func measure[T any](ctx context.Context, backend, operation string, fn func(ctx context.Context) (T, error)) (T, error) {
+	ctx, span := tracing.Start(ctx, backend+"."+operation)
+	start := time.Now()
+
+	res, err := fn(ctx)
+
+	metrics.ObserveStorage(backend, operation, start, err)
+	tracing.End(span, err)
+
+	return res, err
 }
 
 func (ds *DistibutedStorage) truncateLocalDir() error {
@@ -107,51 +248,317 @@ func (ds *DistibutedStorage) truncateLocalDir() error {
 	return nil
 }
 
+// file, accounted in the local usage index
+type localFile struct {
+	Owner string
+	Size  int64
+}
+
+// quota, held by the upload in progress
+type localReservation struct {
+	Owner   string
+	Usage   Usage
+	Expires time.Time
+}
+
 // local file system based storage
 type LocalStorage struct {
-	errLog *zap.Logger
+	keys   KeyRepository
+	videos VideoRepository
+	// stored files, keyed by their names, qualified with the tenant
+	files *jsonIndex[localFile]
+
+	// reservations of the uploads, keyed by the qualified video names
+	// locked after the files, whenever both are needed
+	mu           sync.Mutex
+	reservations map[string]localReservation
 
-	cfg config.LocalConfig
+	errLog *zap.Logger
+	cfg    config.LocalConfig
+	quota  config.QuotaConfig
 }
 
-func NewLocalStorage(errLog *zap.Logger, cfg config.LocalConfig) *LocalStorage {
+func NewLocalStorage(errLog *zap.Logger, cfg config.LocalConfig, quota config.QuotaConfig, keys KeyRepository, videos VideoRepository) *LocalStorage {
 	return &LocalStorage{
-		errLog: errLog,
-		cfg:    cfg,
+		keys:         keys,
+		videos:       videos,
+		files:        newJSONIndex[localFile](path.Join(cfg.IndexPath, "files.json")),
+		reservations: make(map[string]localReservation),
+		errLog:       errLog,
+		cfg:          cfg,
+		quota:        quota,
 	}
 }
 
-func (ls *LocalStorage) Store(ctx context.Context, video, manifest File, chunks []File) error {
+func (ls *LocalStorage) Store(ctx context.Context, video, manifest File, chunks []File, key *ContentKey) error {
 	// when storing files locally, there is no need to write file to any other storage
-	return nil
+	// files are only accounted
+	all := append([]File{video, manifest}, chunks...)
+
+	err := ls.files.update(func(files map[string]localFile) error {
+		for _, file := range all {
+			files[tenant.Qualify(ctx, file.FileName)] = localFile{Owner: file.Owner, Size: file.Size}
+		}
+
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+
+		// reserved usage is replaced with the actual one
+		delete(ls.reservations, tenant.Qualify(ctx, video.FileName))
+
+		if err := ls.checkQuota(ctx, files, video.Owner); err != nil {
+			return err
+		}
+
+		// files aren't accounted, unless the key of the video is stored
+		if key != nil {
+			return ls.keys.CreateKey(ctx, *key)
+		}
+
+		return nil
+	})
+	if err != nil {
+		// files, which weren't accounted, would take space unnoticed
+		for _, file := range all {
+			if rmErr := os.Remove(file.ObjectName); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) {
+				logging.For(ctx, ls.errLog).Error(fmt.Sprintf("couldn't remove file %v: %v", file.ObjectName, rmErr))
+			}
+		}
+	}
+
+	return err
+}
+
+func (ls *LocalStorage) Put(ctx context.Context, file File) error {
+	filePath, err := ls.determinePath(ctx, file.FileName)
+	if err != nil {
+		return err
+	}
+
+	// file is already where it should be
+	if filePath == file.ObjectName {
+		return ls.account(ctx, file)
+	}
+
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if file.Size, err = io.Copy(dst, file.Raw); err != nil {
+		return err
+	}
+
+	return ls.account(ctx, file)
 }
 
 func (ls *LocalStorage) Get(ctx context.Context, filename string) (io.ReadCloser, error) {
-	filePath, err := ls.determinePath(filename)
+	filePath, err := ls.determinePath(ctx, filename)
 	if err != nil {
 		return nil, err
 	}
 
-	return os.Open(filePath)
+	file, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrFileNotFound.Wrap(err)
+	}
+
+	return file, err
+}
+
+func (ls *LocalStorage) GetURL(ctx context.Context, filename string, expiry time.Duration) (string, error) {
+	// local files are only reachable through the app
+	return "", ErrNotImplemented
 }
 
 func (ls *LocalStorage) Remove(ctx context.Context, filename string) error {
-	filePath, err := ls.determinePath(filename)
+	filePath, err := ls.determinePath(ctx, filename)
 	if err != nil {
 		return err
 	}
 
-	return os.Remove(filePath)
+	err = os.Remove(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrFileNotFound.Wrap(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return ls.files.update(func(files map[string]localFile) error {
+		delete(files, tenant.Qualify(ctx, filename))
+		return nil
+	})
+}
+
+func (ls *LocalStorage) RemoveVideo(ctx context.Context, name string) error {
+	var removed []string
+
+	// files are released from the index at once, so that the usage never counts a part of the video
+	err := ls.files.update(func(files map[string]localFile) error {
+		for key := range files {
+			if !tenant.Owns(ctx, key) {
+				continue
+			}
+
+			if _, filename := tenant.Split(key); utils.VideoName(filename) == name {
+				removed = append(removed, filename)
+				delete(files, key)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range removed {
+		filePath, err := ls.determinePath(ctx, filename)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logging.For(ctx, ls.errLog).Error(fmt.Sprintf("couldn't remove file %v: %v", filePath, err))
+		}
+	}
+
+	if err := ls.keys.DeleteKeys(ctx, name); err != nil {
+		return err
+	}
+
+	err = ls.videos.DeleteVideo(ctx, name)
+	if errors.Is(err, ErrDBNotFound) {
+		if len(removed) == 0 {
+			return ErrFileNotFound
+		}
+		return nil
+	}
+
+	return err
+}
+
+func (ls *LocalStorage) GetKey(ctx context.Context, keyID []byte) (ContentKey, error) {
+	return ls.keys.ReadKey(ctx, keyID)
+}
+
+func (ls *LocalStorage) Usage(ctx context.Context, owner string) (usage Usage, err error) {
+	err = ls.files.view(func(files map[string]localFile) error {
+		usage = localUsage(ctx, files, &owner)
+		return nil
+	})
+
+	return usage, err
+}
+
+func (ls *LocalStorage) TenantUsage(ctx context.Context) (usage Usage, err error) {
+	err = ls.files.view(func(files map[string]localFile) error {
+		usage = localUsage(ctx, files, nil)
+		return nil
+	})
+
+	return usage, err
+}
+
+func (ls *LocalStorage) Reserve(ctx context.Context, name, owner string, usage Usage) error {
+	return ls.files.view(func(files map[string]localFile) error {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+
+		key := tenant.Qualify(ctx, name)
+		prev, reserved := ls.reservations[key]
+
+		ls.reservations[key] = localReservation{Owner: owner, Usage: usage, Expires: time.Now().Add(reservationTTL)}
+
+		if err := ls.checkQuota(ctx, files, owner); err != nil {
+			if reserved {
+				ls.reservations[key] = prev
+			} else {
+				delete(ls.reservations, key)
+			}
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (ls *LocalStorage) Release(ctx context.Context, name string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	delete(ls.reservations, tenant.Qualify(ctx, name))
+	return nil
+}
+
+// checks usage of the owner and the tenant, along with the reserved one
+// ls.mu should be held
+func (ls *LocalStorage) checkQuota(ctx context.Context, files map[string]localFile, owner string) error {
+	user, tenantUsage := localUsage(ctx, files, &owner), localUsage(ctx, files, nil)
+
+	for key, reservation := range ls.reservations {
+		if time.Now().After(reservation.Expires) {
+			delete(ls.reservations, key)
+			continue
+		}
+
+		if !tenant.Owns(ctx, key) {
+			continue
+		}
+
+		tenantUsage = tenantUsage.Add(reservation.Usage.Bytes, reservation.Usage.Videos)
+		if reservation.Owner == owner {
+			user = user.Add(reservation.Usage.Bytes, reservation.Usage.Videos)
+		}
+	}
+
+	return CheckQuota(ls.quota, owner, user, tenantUsage)
+}
+
+// records single file, replacing the existing one
+func (ls *LocalStorage) account(ctx context.Context, file File) error {
+	return ls.files.update(func(files map[string]localFile) error {
+		files[tenant.Qualify(ctx, file.FileName)] = localFile{Owner: file.Owner, Size: file.Size}
+		return nil
+	})
+}
+
+// sums up files of the tenant (of a single owner, unless it is nil)
+func localUsage(ctx context.Context, files map[string]localFile, owner *string) (usage Usage) {
+	for key, file := range files {
+		if !tenant.Owns(ctx, key) || (owner != nil && file.Owner != *owner) {
+			continue
+		}
+
+		_, name := tenant.Split(key)
+		usage = usage.Add(file.Size, videoCount(name))
+	}
+
+	return usage
 }
 
 // used to detect where given file is stored
-func (ls *LocalStorage) determinePath(filename string) (filePath string, err error) {
+// files of the tenants are kept in their own subdirectories
+func (ls *LocalStorage) determinePath(ctx context.Context, filename string) (filePath string, err error) {
+	qualified := tenant.Qualify(ctx, filename)
+
 	if strings.HasSuffix(filename, ".mp4") {
-		filePath = fmt.Sprintf("%v/%v", ls.cfg.VideoPath, filename)
+		filePath = fmt.Sprintf("%v/%v", ls.cfg.VideoPath, qualified)
+	} else if path.Ext(filename) == "" {
+		// videos are registered under their bare names
+		filePath = fmt.Sprintf("%v/%v.mp4", ls.cfg.VideoPath, qualified)
 	} else if strings.HasSuffix(filename, ".m3u8") {
-		filePath = fmt.Sprintf("%v/%v", ls.cfg.ManifestPath, filename)
-	} else if strings.HasSuffix(filename, ".ts") {
-		subdir := utils.RemoveSuffix(filename, "_")
+		filePath = fmt.Sprintf("%v/%v", ls.cfg.ManifestPath, qualified)
+	} else if strings.HasSuffix(filename, ".ts") || strings.HasSuffix(filename, ".m4s") ||
+		strings.HasSuffix(filename, ".jpg") || strings.HasSuffix(filename, ".vtt") {
+		// thumbnails and captions are kept along with the chunks
+		subdir := tenant.Qualify(ctx, utils.RemoveSuffix(filename, "_"))
 		filePath = fmt.Sprintf("%v/%v/%v", ls.cfg.ChunkPath, subdir, filename)
 	} else {
 		return filePath, ErrUnsupportedFileFormat
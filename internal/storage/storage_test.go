@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/tenant"
+	"go.uber.org/zap"
+)
+
+func newTestStorage(t *testing.T, quota config.QuotaConfig) *LocalStorage {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := config.LocalConfig{
+		ManifestPath: path.Join(dir, "manifests"),
+		ChunkPath:    path.Join(dir, "chunks"),
+		VideoPath:    path.Join(dir, "videos"),
+		IndexPath:    dir,
+	}
+
+	keys := NewLocalKeyRepository(path.Join(dir, "keys.json"))
+	videos := NewLocalVideoRepository(path.Join(dir, "videos.json"))
+
+	return NewLocalStorage(zap.NewNop(), cfg, quota, keys, videos)
+}
+
+// writes the file, where the storage looks for it
+func testFile(t *testing.T, ctx context.Context, ls *LocalStorage, name, owner string, size int64) File {
+	t.Helper()
+
+	filePath, err := ls.determinePath(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filePath, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return File{FileName: name, ObjectName: filePath, Owner: owner, Size: size}
+}
+
+// stores video of 100 bytes along with its playlist (10) and 2 segments (20 each)
+func storeTestVideo(t *testing.T, ctx context.Context, ls *LocalStorage, name, owner string, key *ContentKey) error {
+	t.Helper()
+
+	video := testFile(t, ctx, ls, name, owner, 100)
+	manifest := testFile(t, ctx, ls, name+".m3u8", owner, 10)
+	chunks := []File{
+		testFile(t, ctx, ls, name+"_0001.ts", owner, 20),
+		testFile(t, ctx, ls, name+"_0002.ts", owner, 20),
+	}
+
+	return ls.Store(ctx, video, manifest, chunks, key)
+}
+
+func putTestFile(t *testing.T, ctx context.Context, ls *LocalStorage, name, owner string, size int) {
+	t.Helper()
+
+	file := File{FileName: name, Owner: owner, Raw: io.NopCloser(strings.NewReader(strings.Repeat("x", size)))}
+	if err := ls.Put(ctx, file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkUsage(t *testing.T, ctx context.Context, ls *LocalStorage, owner string, want Usage) {
+	t.Helper()
+
+	got, err := ls.Usage(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != want {
+		t.Errorf("usage of %q = %+v, want %+v", owner, got, want)
+	}
+}
+
+func TestStoreAccounting(t *testing.T) {
+	ctx := context.Background()
+	ls := newTestStorage(t, config.QuotaConfig{})
+
+	if err := storeTestVideo(t, ctx, ls, "first", "alice", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := storeTestVideo(t, ctx, ls, "second", "bob", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	checkUsage(t, ctx, ls, "alice", Usage{Bytes: 150, Videos: 1})
+	checkUsage(t, ctx, ls, "bob", Usage{Bytes: 150, Videos: 1})
+
+	// replaced file is no longer accounted
+	putTestFile(t, ctx, ls, "first_thumb.jpg", "alice", 5)
+	putTestFile(t, ctx, ls, "first_thumb.jpg", "alice", 7)
+	checkUsage(t, ctx, ls, "alice", Usage{Bytes: 157, Videos: 1})
+
+	usage, err := ls.TenantUsage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Usage{Bytes: 307, Videos: 2}); usage != want {
+		t.Errorf("tenant usage = %+v, want %+v", usage, want)
+	}
+
+	// other tenants are accounted on their own
+	other := tenant.NewContext(ctx, "other")
+	if err := storeTestVideo(t, other, ls, "first", "alice", nil); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, other, ls, "alice", Usage{Bytes: 150, Videos: 1})
+	checkUsage(t, ctx, ls, "alice", Usage{Bytes: 157, Videos: 1})
+}
+
+func TestRemoveAccounting(t *testing.T) {
+	ctx := context.Background()
+	ls := newTestStorage(t, config.QuotaConfig{})
+
+	// video, whose name starts with the name of the removed one, shouldn't be touched
+	for _, name := range []string{"video", "video_2"} {
+		key := &ContentKey{KeyID: []byte("kid_" + name), VideoName: name}
+		if err := storeTestVideo(t, ctx, ls, name, "alice", key); err != nil {
+			t.Fatal(err)
+		}
+		if err := ls.videos.CreateVideo(ctx, Video{ID: name, Name: name, Owner: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	putTestFile(t, ctx, ls, "video_thumb.jpg", "alice", 5)
+	putTestFile(t, ctx, ls, "video_en.vtt", "alice", 3)
+
+	// single file is released on its own
+	if err := ls.Remove(ctx, "video_en.vtt"); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, ctx, ls, "alice", Usage{Bytes: 305, Videos: 2})
+
+	if err := ls.RemoveVideo(ctx, "video"); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, ctx, ls, "alice", Usage{Bytes: 150, Videos: 1})
+
+	for _, name := range []string{"video", "video.m3u8", "video_0001.ts", "video_0002.ts", "video_thumb.jpg"} {
+		if _, err := ls.Get(ctx, name); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("%v: got %v, want ErrFileNotFound", name, err)
+		}
+	}
+
+	if _, err := ls.Get(ctx, "video_2_0001.ts"); err != nil {
+		t.Errorf("video_2_0001.ts: %v", err)
+	}
+
+	if _, err := ls.videos.ReadVideo(ctx, "video"); !errors.Is(err, ErrDBNotFound) {
+		t.Errorf("video record: got %v, want ErrDBNotFound", err)
+	}
+
+	if _, err := ls.GetKey(ctx, []byte("kid_video")); !errors.Is(err, ErrDBNotFound) {
+		t.Errorf("content key: got %v, want ErrDBNotFound", err)
+	}
+
+	if _, err := ls.GetKey(ctx, []byte("kid_video_2")); err != nil {
+		t.Errorf("content key of video_2: %v", err)
+	}
+
+	if err := ls.RemoveVideo(ctx, "video"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("removed twice: got %v, want ErrFileNotFound", err)
+	}
+}
+
+func TestStoreQuota(t *testing.T) {
+	ctx := context.Background()
+	ls := newTestStorage(t, config.QuotaConfig{UserVideos: 1, TenantBytes: 400})
+
+	if err := storeTestVideo(t, ctx, ls, "first", "alice", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// key of the rejected video isn't stored either
+	key := &ContentKey{KeyID: []byte("kid"), VideoName: "second"}
+	if err := storeTestVideo(t, ctx, ls, "second", "alice", key); !errors.Is(err, ErrUserQuota) {
+		t.Fatalf("got %v, want ErrUserQuota", err)
+	}
+	checkUsage(t, ctx, ls, "alice", Usage{Bytes: 150, Videos: 1})
+
+	if _, err := ls.GetKey(ctx, key.KeyID); !errors.Is(err, ErrDBNotFound) {
+		t.Errorf("content key: got %v, want ErrDBNotFound", err)
+	}
+
+	if err := storeTestVideo(t, ctx, ls, "third", "bob", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storeTestVideo(t, ctx, ls, "fourth", "carol", nil); !errors.Is(err, ErrTenantQuota) {
+		t.Fatalf("got %v, want ErrTenantQuota", err)
+	}
+	checkUsage(t, ctx, ls, "carol", Usage{})
+}
+
+func TestReservations(t *testing.T) {
+	ctx := context.Background()
+	ls := newTestStorage(t, config.QuotaConfig{UserVideos: 1, UserBytes: 200})
+
+	if err := ls.Reserve(ctx, "first", "alice", Usage{Videos: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent upload doesn't fit along with the reserved one
+	if err := ls.Reserve(ctx, "second", "alice", Usage{Videos: 1}); !errors.Is(err, ErrUserQuota) {
+		t.Fatalf("got %v, want ErrUserQuota", err)
+	}
+
+	// reservation of the others doesn't count
+	if err := ls.Reserve(ctx, "other", "bob", Usage{Videos: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// failed growth keeps the previous reservation
+	if err := ls.Reserve(ctx, "first", "alice", Usage{Bytes: 300, Videos: 1}); !errors.Is(err, ErrUserQuota) {
+		t.Fatalf("got %v, want ErrUserQuota", err)
+	}
+	if err := ls.Reserve(ctx, "second", "alice", Usage{Videos: 1}); !errors.Is(err, ErrUserQuota) {
+		t.Fatalf("reservation was lost: got %v, want ErrUserQuota", err)
+	}
+
+	if err := ls.Reserve(ctx, "first", "alice", Usage{Bytes: 100, Videos: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// stored video replaces its reservation
+	if err := storeTestVideo(t, ctx, ls, "first", "alice", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.Release(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, ctx, ls, "alice", Usage{Bytes: 150, Videos: 1})
+
+	if err := ls.RemoveVideo(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ls.Reserve(ctx, "second", "alice", Usage{Videos: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// released reservation frees the quota
+	if err := ls.Release(ctx, "second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.Reserve(ctx, "third", "alice", Usage{Videos: 1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVideoCount(t *testing.T) {
+	counts := map[string]int{
+		"video":           1,
+		"video.m3u8":      0,
+		"video_0001.ts":   0,
+		"video_init.m4s":  0,
+		"video_thumb.jpg": 0,
+		"video_en.vtt":    0,
+	}
+
+	for name, want := range counts {
+		if got := videoCount(name); got != want {
+			t.Errorf("videoCount(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/tenant"
+)
+
+// json file based live stream repository, used along with the local storage
+// streams are keyed by their names, qualified with the tenant
+type LocalStreamRepository struct {
+	index *jsonIndex[LiveStream]
+}
+
+func NewLocalStreamRepository(path string) *LocalStreamRepository {
+	return &LocalStreamRepository{index: newJSONIndex[LiveStream](path)}
+}
+
+func (lr *LocalStreamRepository) CreateStream(ctx context.Context, stream LiveStream) error {
+	key := tenant.Qualify(ctx, stream.Name)
+
+	return lr.index.update(func(streams map[string]LiveStream) error {
+		if _, ok := streams[key]; ok {
+			return ErrUniqueStream
+		}
+
+		stream.Tenant = tenant.FromContext(ctx)
+		streams[key] = stream
+		return nil
+	})
+}
+
+func (lr *LocalStreamRepository) ReadStream(ctx context.Context, name string) (stream LiveStream, err error) {
+	err = lr.index.view(func(streams map[string]LiveStream) error {
+		var ok bool
+		if stream, ok = streams[tenant.Qualify(ctx, name)]; !ok {
+			return ErrDBNotFound
+		}
+		return nil
+	})
+
+	return stream, err
+}
+
+func (lr *LocalStreamRepository) ReadStreamByKey(ctx context.Context, key string) (stream LiveStream, err error) {
+	// keys are unique across the tenants, so the stream tells its tenant
+	err = lr.index.view(func(streams map[string]LiveStream) error {
+		for qualified, s := range streams {
+			if s.Key == key {
+				stream = s
+				stream.Tenant, _ = tenant.Split(qualified)
+				return nil
+			}
+		}
+		return ErrDBNotFound
+	})
+
+	return stream, err
+}
+
+func (lr *LocalStreamRepository) UpdateStreamState(ctx context.Context, name string, state StreamState) error {
+	key := tenant.Qualify(ctx, name)
+
+	return lr.index.update(func(streams map[string]LiveStream) error {
+		stream, ok := streams[key]
+		if !ok {
+			return ErrDBNotFound
+		}
+
+		stream.State = state
+		stream.UpdatedAt = time.Now().UTC()
+		streams[key] = stream
+
+		return nil
+	})
+}
+
+func (lr *LocalStreamRepository) SwapStreamState(ctx context.Context, name string, from []StreamState, to StreamState) error {
+	key := tenant.Qualify(ctx, name)
+
+	return lr.index.update(func(streams map[string]LiveStream) error {
+		stream, ok := streams[key]
+		if !ok {
+			return ErrDBNotFound
+		}
+
+		if !slices.Contains(from, stream.State) {
+			return ErrStreamState
+		}
+
+		stream.State = to
+		stream.UpdatedAt = time.Now().UTC()
+		streams[key] = stream
+
+		return nil
+	})
+}
+
+func (lr *LocalStreamRepository) DeleteStream(ctx context.Context, name string) error {
+	key := tenant.Qualify(ctx, name)
+
+	return lr.index.update(func(streams map[string]LiveStream) error {
+		if _, ok := streams[key]; !ok {
+			return ErrDBNotFound
+		}
+
+		delete(streams, key)
+		return nil
+	})
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/cutlery47/gostream/internal/tenant"
+)
+
+// json file based user repository, used along with the local storage
+// users are keyed by their ids, qualified with the tenant, while api keys are looked up across the tenants
+type LocalUserRepository struct {
+	users *jsonIndex[User]
+	keys  *jsonIndex[APIKey]
+}
+
+func NewLocalUserRepository(usersPath, keysPath string) *LocalUserRepository {
+	return &LocalUserRepository{
+		users: newJSONIndex[User](usersPath),
+		keys:  newJSONIndex[APIKey](keysPath),
+	}
+}
+
+func (lr *LocalUserRepository) CreateUser(ctx context.Context, user User) error {
+	return lr.users.update(func(users map[string]User) error {
+		for key, u := range users {
+			if u.Name == user.Name && tenant.Owns(ctx, key) {
+				return ErrUniqueUser
+			}
+		}
+
+		user.Tenant = tenant.FromContext(ctx)
+		users[tenant.Qualify(ctx, user.ID)] = user
+		return nil
+	})
+}
+
+func (lr *LocalUserRepository) ReadUser(ctx context.Context, id string) (user User, err error) {
+	err = lr.users.view(func(users map[string]User) error {
+		var ok bool
+		if user, ok = users[tenant.Qualify(ctx, id)]; !ok {
+			return ErrDBNotFound
+		}
+		user.Tenant = tenant.FromContext(ctx)
+		return nil
+	})
+
+	return user, err
+}
+
+func (lr *LocalUserRepository) CreateAPIKey(ctx context.Context, key APIKey) error {
+	if _, err := lr.ReadUser(ctx, key.UserID); err != nil {
+		return err
+	}
+
+	return lr.keys.update(func(keys map[string]APIKey) error {
+		key.Tenant = tenant.FromContext(ctx)
+		keys[key.ID] = key
+		return nil
+	})
+}
+
+func (lr *LocalUserRepository) ReadAPIKey(ctx context.Context, id string) (key APIKey, err error) {
+	err = lr.keys.view(func(keys map[string]APIKey) error {
+		var ok bool
+		if key, ok = keys[id]; !ok {
+			return ErrDBNotFound
+		}
+		// keys, created before the tenants were introduced
+		if key.Tenant == "" {
+			key.Tenant = tenant.Default
+		}
+		return nil
+	})
+
+	return key, err
+}
+
+func (lr *LocalUserRepository) ListAPIKeys(ctx context.Context, userID string) (list []APIKey, err error) {
+	// keys of the users of other tenants are never listed
+	if _, err := lr.ReadUser(ctx, userID); err != nil {
+		return nil, nil
+	}
+
+	err = lr.keys.view(func(keys map[string]APIKey) error {
+		for _, key := range keys {
+			if key.UserID == userID {
+				list = append(list, key)
+			}
+		}
+		return nil
+	})
+
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	return list, err
+}
+
+func (lr *LocalUserRepository) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	if _, err := lr.ReadUser(ctx, userID); err != nil {
+		return err
+	}
+
+	return lr.keys.update(func(keys map[string]APIKey) error {
+		if key, ok := keys[id]; !ok || key.UserID != userID {
+			return ErrDBNotFound
+		}
+
+		delete(keys, id)
+		return nil
+	})
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/tenant"
+)
+
+// position of the last video on the page
+type videoCursor struct {
+	Sort       string    `json:"s"`
+	Name       string    `json:"n"`
+	UploadedAt time.Time `json:"u,omitempty"`
+	Title      string    `json:"t,omitempty"`
+	Duration   float64   `json:"d,omitempty"`
+}
+
+func encodeCursor(sort string, video Video) string {
+	data, _ := json.Marshal(videoCursor{
+		Sort:       sort,
+		Name:       video.Name,
+		UploadedAt: video.UploadedAt,
+		Title:      video.Title,
+		Duration:   video.Duration,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursor is only valid for the sort order, it was issued for
+func decodeCursor(cursor, sort string) (videoCursor, error) {
+	var vc videoCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return vc, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(data, &vc); err != nil || vc.Sort != sort {
+		return vc, ErrInvalidCursor
+	}
+
+	return vc, nil
+}
+
+func validSort(sort string) bool {
+	return sort == SortUploaded || sort == SortTitle || sort == SortDuration
+}
+
+// cuts the extra video, fetched to find out if there is a next page
+func newVideoPage(videos []Video, query VideoQuery) VideoPage {
+	if len(videos) <= query.Limit {
+		return VideoPage{Videos: videos}
+	}
+
+	videos = videos[:query.Limit]
+	return VideoPage{
+		Videos:     videos,
+		NextCursor: encodeCursor(query.Sort, videos[len(videos)-1]),
+	}
+}
+
+// json file based video repository, used along with the local storage
+// videos are keyed by their names, qualified with the tenant
+type LocalVideoRepository struct {
+	index *jsonIndex[Video]
+}
+
+func NewLocalVideoRepository(path string) *LocalVideoRepository {
+	return &LocalVideoRepository{index: newJSONIndex[Video](path)}
+}
+
+func (lr *LocalVideoRepository) CreateVideo(ctx context.Context, video Video) error {
+	key := tenant.Qualify(ctx, video.Name)
+
+	return lr.index.update(func(videos map[string]Video) error {
+		existing, ok := videos[key]
+		if ok && existing.Status != VideoFailed {
+			return ErrUniueVideo
+		}
+
+		// ids are unique per tenant as well
+		for k, v := range videos {
+			if k != key && v.ID == video.ID && tenant.Owns(ctx, k) {
+				return ErrUniueVideo
+			}
+		}
+
+		video.UploadedAt = time.Now().UTC()
+		video.Version = existing.Version + 1
+		videos[key] = video
+		return nil
+	})
+}
+
+func (lr *LocalVideoRepository) ReadVideo(ctx context.Context, name string) (video Video, err error) {
+	err = lr.index.view(func(videos map[string]Video) error {
+		var ok bool
+		if video, ok = videos[tenant.Qualify(ctx, name)]; !ok {
+			return ErrDBNotFound
+		}
+		return nil
+	})
+
+	return video, err
+}
+
+func (lr *LocalVideoRepository) ReadVideoByID(ctx context.Context, id string) (video Video, err error) {
+	err = lr.index.view(func(videos map[string]Video) error {
+		for key, v := range videos {
+			if v.ID == id && tenant.Owns(ctx, key) {
+				video = v
+				return nil
+			}
+		}
+		return ErrDBNotFound
+	})
+
+	return video, err
+}
+
+func (lr *LocalVideoRepository) UpdateVideo(ctx context.Context, video Video) error {
+	key := tenant.Qualify(ctx, video.Name)
+
+	return lr.index.update(func(videos map[string]Video) error {
+		existing, ok := videos[key]
+		if !ok {
+			return ErrDBNotFound
+		}
+
+		if existing.Version != video.Version {
+			return ErrVersionMismatch
+		}
+
+		// id never changes
+		video.ID = existing.ID
+		video.UploadedAt = existing.UploadedAt
+		video.Version++
+		videos[key] = video
+		return nil
+	})
+}
+
+func (lr *LocalVideoRepository) DeleteVideo(ctx context.Context, name string) error {
+	key := tenant.Qualify(ctx, name)
+
+	return lr.index.update(func(videos map[string]Video) error {
+		if _, ok := videos[key]; !ok {
+			return ErrDBNotFound
+		}
+
+		delete(videos, key)
+		return nil
+	})
+}
+
+func (lr *LocalVideoRepository) ListVideos(ctx context.Context, query VideoQuery) (page VideoPage, err error) {
+	if !validSort(query.Sort) {
+		return page, ErrInvalidQuery
+	}
+
+	var after *Video
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor, query.Sort)
+		if err != nil {
+			return page, err
+		}
+
+		after = &Video{Name: cursor.Name, UploadedAt: cursor.UploadedAt, Title: cursor.Title, Duration: cursor.Duration}
+	}
+
+	var found []Video
+	err = lr.index.view(func(videos map[string]Video) error {
+		for key, video := range videos {
+			if !tenant.Owns(ctx, key) || !matchVideo(video, query) {
+				continue
+			}
+
+			// only the videos past the cursor
+			if after != nil && compareVideos(video, *after, query.Sort, query.Desc) <= 0 {
+				continue
+			}
+
+			found = append(found, video)
+		}
+		return nil
+	})
+	if err != nil {
+		return page, err
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return compareVideos(found[i], found[j], query.Sort, query.Desc) < 0
+	})
+
+	if len(found) > query.Limit+1 {
+		found = found[:query.Limit+1]
+	}
+
+	return newVideoPage(found, query), nil
+}
+
+func matchVideo(video Video, query VideoQuery) bool {
+	if query.Status != "" && video.Status != query.Status {
+		return false
+	}
+
+	if query.Visibility != "" && video.Visibility != query.Visibility {
+		return false
+	}
+
+	if query.Owner != "" && video.Owner != query.Owner {
+		return false
+	}
+
+	if query.MinDuration > 0 && video.Duration < query.MinDuration {
+		return false
+	}
+
+	if query.MaxDuration > 0 && video.Duration > query.MaxDuration {
+		return false
+	}
+
+	if query.Tag != "" && !contains(video.Tags, query.Tag) {
+		return false
+	}
+
+	// every word of the search should be found in the title
+	title := strings.ToLower(video.Title)
+	for _, word := range strings.Fields(strings.ToLower(query.Search)) {
+		if !strings.Contains(title, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// orders videos by the sort field, then by name
+func compareVideos(a, b Video, sort string, desc bool) int {
+	var res int
+
+	switch sort {
+	case SortUploaded:
+		res = a.UploadedAt.Compare(b.UploadedAt)
+	case SortTitle:
+		res = strings.Compare(a.Title, b.Title)
+	case SortDuration:
+		if a.Duration < b.Duration {
+			res = -1
+		} else if a.Duration > b.Duration {
+			res = 1
+		}
+	}
+
+	if res == 0 {
+		res = strings.Compare(a.Name, b.Name)
+	}
+
+	if desc {
+		return -res
+	}
+	return res
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
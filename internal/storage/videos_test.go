@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/cutlery47/gostream/internal/tenant"
+)
+
+var uploaded = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// repository with the videos, stored as given (CreateVideo would stamp the upload time)
+func newTestVideos(t *testing.T, videos ...Video) *LocalVideoRepository {
+	t.Helper()
+
+	lr := NewLocalVideoRepository(path.Join(t.TempDir(), "videos.json"))
+	err := lr.index.update(func(index map[string]Video) error {
+		for _, video := range videos {
+			index[video.Name] = video
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return lr
+}
+
+func names(videos []Video) []string {
+	res := make([]string, len(videos))
+	for i, video := range videos {
+		res[i] = video.Name
+	}
+	return res
+}
+
+func TestCursor(t *testing.T) {
+	video := Video{Name: "clip", Title: "Clip", Duration: 1.5, UploadedAt: uploaded}
+
+	cursor, err := decodeCursor(encodeCursor(SortTitle, video), SortTitle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := videoCursor{Sort: SortTitle, Name: "clip", Title: "Clip", Duration: 1.5, UploadedAt: uploaded}
+	if cursor != want {
+		t.Errorf("got %+v, want %+v", cursor, want)
+	}
+
+	invalid := map[string]string{
+		// issued for the other order
+		"other sort":  encodeCursor(SortDuration, video),
+		"not base64":  "clip!",
+		"not json":    base64.RawURLEncoding.EncodeToString([]byte("clip")),
+		"padded":      encodeCursor(SortTitle, video) + "==",
+		"empty":       "",
+		"wrong types": base64.RawURLEncoding.EncodeToString([]byte(`{"s": 1}`)),
+	}
+
+	for name, raw := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decodeCursor(raw, SortTitle); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestCompareVideos(t *testing.T) {
+	a := Video{Name: "a", Title: "Same", Duration: 2, UploadedAt: uploaded}
+	b := Video{Name: "b", Title: "Same", Duration: 2, UploadedAt: uploaded}
+	c := Video{Name: "c", Title: "Other", Duration: 1, UploadedAt: uploaded.Add(-time.Hour)}
+
+	for _, sort := range []string{SortUploaded, SortTitle, SortDuration} {
+		// equal keys are ordered by name, reversed along with the order
+		if compareVideos(a, b, sort, false) >= 0 || compareVideos(a, b, sort, true) <= 0 {
+			t.Errorf("%v: equal keys aren't ordered by name", sort)
+		}
+		if compareVideos(c, a, sort, false) >= 0 || compareVideos(c, a, sort, true) <= 0 {
+			t.Errorf("%v: keys aren't compared first", sort)
+		}
+		if compareVideos(a, a, sort, false) != 0 {
+			t.Errorf("%v: video differs from itself", sort)
+		}
+	}
+}
+
+func TestListVideosFilters(t *testing.T) {
+	lr := newTestVideos(t,
+		Video{Name: "live", Title: "Live Set at the Club", Tags: []string{"music", "live"}, Duration: 3600, Status: VideoReady, Visibility: VisibilityPublic, Owner: "alice"},
+		Video{Name: "studio", Title: "Studio set", Tags: []string{"music"}, Duration: 300, Status: VideoReady, Visibility: VisibilityPrivate, Owner: "bob"},
+		Video{Name: "talk", Title: "Conference talk", Tags: []string{"tech"}, Duration: 1800, Status: VideoProcessing, Visibility: VisibilityPublic, Owner: "alice"},
+		// videos of the other tenants aren't listed
+		Video{Name: "team/set", Title: "Set", Tags: []string{"music"}, Duration: 300, Status: VideoReady, Visibility: VisibilityPublic},
+	)
+
+	cases := map[string]struct {
+		query VideoQuery
+		want  []string
+	}{
+		"all":            {VideoQuery{}, []string{"talk", "live", "studio"}},
+		"tag":            {VideoQuery{Tag: "music"}, []string{"live", "studio"}},
+		"tag case":       {VideoQuery{Tag: "Music"}, []string{}},
+		"search":         {VideoQuery{Search: "set"}, []string{"live", "studio"}},
+		"search words":   {VideoQuery{Search: "CLUB live"}, []string{"live"}},
+		"search missing": {VideoQuery{Search: "set talk"}, []string{}},
+		"min duration":   {VideoQuery{MinDuration: 1800}, []string{"talk", "live"}},
+		"max duration":   {VideoQuery{MaxDuration: 1800}, []string{"talk", "studio"}},
+		"duration range": {VideoQuery{MinDuration: 301, MaxDuration: 3599}, []string{"talk"}},
+		"status":         {VideoQuery{Status: VideoReady}, []string{"live", "studio"}},
+		"visibility":     {VideoQuery{Visibility: VisibilityPrivate}, []string{"studio"}},
+		"owner":          {VideoQuery{Owner: "alice", Tag: "music"}, []string{"live"}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tc.query.Sort, tc.query.Limit = SortTitle, 10
+
+			page, err := lr.ListVideos(context.Background(), tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := names(page.Videos); fmt.Sprint(got) != fmt.Sprint(tc.want) || page.NextCursor != "" {
+				t.Errorf("got %v (next %q), want %v", got, page.NextCursor, tc.want)
+			}
+		})
+	}
+
+	page, err := lr.ListVideos(tenant.NewContext(context.Background(), "team"), VideoQuery{Sort: SortTitle, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(page.Videos); len(got) != 1 || got[0] != "team/set" {
+		t.Errorf("tenant: got %v", got)
+	}
+
+	if _, err := lr.ListVideos(context.Background(), VideoQuery{Sort: "size", Limit: 10}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("unknown sort: got %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestListVideosPages(t *testing.T) {
+	// most of the videos share the sort keys, so that the pages are split between equal keys
+	var videos []Video
+	for i := range 11 {
+		videos = append(videos, Video{
+			Name:       fmt.Sprintf("video%02d", i),
+			Title:      []string{"A", "B"}[i%2],
+			Duration:   float64(i / 4),
+			UploadedAt: uploaded.Add(time.Duration(i/3) * time.Minute),
+		})
+	}
+	lr := newTestVideos(t, videos...)
+
+	for _, sort := range []string{SortUploaded, SortTitle, SortDuration} {
+		for _, desc := range []bool{false, true} {
+			for _, limit := range []int{1, 2, 3, 4, 10, 11, 12} {
+				t.Run(fmt.Sprintf("%v desc=%v limit=%v", sort, desc, limit), func(t *testing.T) {
+					query := VideoQuery{Sort: sort, Desc: desc, Limit: limit}
+
+					var walked []Video
+					for pages := 0; ; pages++ {
+						if pages > len(videos) {
+							t.Fatal("pagination doesn't end")
+						}
+
+						page, err := lr.ListVideos(context.Background(), query)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if len(page.Videos) > limit {
+							t.Fatalf("got %v videos on the page of %v", len(page.Videos), limit)
+						}
+
+						walked = append(walked, page.Videos...)
+						if page.NextCursor == "" {
+							break
+						}
+						query.Cursor = page.NextCursor
+					}
+
+					// every video is listed once, in the order of the whole listing
+					if len(walked) != len(videos) {
+						t.Fatalf("got %v videos, want %v: %v", len(walked), len(videos), names(walked))
+					}
+					for i := 1; i < len(walked); i++ {
+						if compareVideos(walked[i-1], walked[i], sort, desc) >= 0 {
+							t.Fatalf("%v is listed after %v: %v", walked[i].Name, walked[i-1].Name, names(walked))
+						}
+					}
+				})
+			}
+		}
+	}
+}
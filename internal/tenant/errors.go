@@ -0,0 +1,9 @@
+package tenant
+
+import "github.com/cutlery47/gostream/internal/errs"
+
+var (
+	ErrInvalidTenant  = errs.New(errs.Invalid, "invalid_tenant", "tenant should be 1 to 32 lowercase letters, digits or '-'")
+	ErrUnknownTenant  = errs.New(errs.NotFound, "unknown_tenant", "tenant is not served by the deployment")
+	ErrTenantMismatch = errs.New(errs.Forbidden, "tenant_mismatch", "credentials belong to another tenant")
+)
@@ -0,0 +1,64 @@
+package tenant
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/cutlery47/gostream/config"
+)
+
+// finds out, which tenant the request is addressed to
+type Resolver struct {
+	conf config.TenantConfig
+}
+
+func NewResolver(conf config.TenantConfig) *Resolver {
+	return &Resolver{conf: conf}
+}
+
+// returns tenant, named by the header or the subdomain of the request ("" if none)
+func (r *Resolver) Resolve(req *http.Request) (string, error) {
+	id := req.Header.Get(r.conf.Header)
+	if id == "" {
+		id = r.subdomain(req.Host)
+	}
+
+	if id == "" {
+		return "", nil
+	}
+
+	if !Valid(id) {
+		return "", ErrInvalidTenant
+	}
+
+	if !r.Allowed(id) {
+		return "", ErrUnknownTenant
+	}
+
+	return id, nil
+}
+
+// checks if the deployment serves the tenant (every tenant is served, unless they are listed)
+func (r *Resolver) Allowed(id string) bool {
+	return id == Default || len(r.conf.Allowed) == 0 || slices.Contains(r.conf.Allowed, id)
+}
+
+// "<tenant>.<domain>" hosts are addressed to the tenant
+func (r *Resolver) subdomain(host string) string {
+	if r.conf.Domain == "" {
+		return ""
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	sub, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(r.conf.Domain))
+	if !ok || strings.Contains(sub, ".") {
+		return ""
+	}
+
+	return sub
+}
@@ -0,0 +1,77 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cutlery47/gostream/config"
+)
+
+func TestResolve(t *testing.T) {
+	conf := config.TenantConfig{Header: "X-Tenant", Domain: "Videos.example.com", Allowed: []string{"team", "acme"}}
+
+	cases := map[string]struct {
+		conf   config.TenantConfig
+		host   string
+		header string
+		want   string
+		err    error
+	}{
+		"none":   {conf, "videos.example.com", "", "", nil},
+		"header": {conf, "videos.example.com", "team", "team", nil},
+		// the header wins over the subdomain
+		"header and subdomain": {conf, "acme.videos.example.com", "team", "team", nil},
+		"subdomain":            {conf, "acme.videos.example.com", "", "acme", nil},
+		"subdomain with port":  {conf, "acme.videos.example.com:8080", "", "acme", nil},
+		"subdomain case":       {conf, "ACME.Videos.Example.com", "", "acme", nil},
+		"nested subdomain":     {conf, "cdn.acme.videos.example.com", "", "", nil},
+		"other domain":         {conf, "acme.example.org", "", "", nil},
+		// the domain itself isn't a subdomain
+		"lookalike domain": {conf, "acmevideos.example.com", "", "", nil},
+		"no domain":        {config.TenantConfig{Header: "X-Tenant"}, "acme.videos.example.com", "", "", nil},
+		// the default tenant is always served
+		"default":       {conf, "videos.example.com", Default, Default, nil},
+		"not allowed":   {conf, "videos.example.com", "other", "", ErrUnknownTenant},
+		"unlisted":      {config.TenantConfig{Header: "X-Tenant"}, "videos.example.com", "other", "other", nil},
+		"invalid":       {conf, "videos.example.com", "Team", "", ErrInvalidTenant},
+		"path":          {conf, "videos.example.com", "team/../acme", "", ErrInvalidTenant},
+		"too long":      {conf, "videos.example.com", "a234567890123456789012345678901234", "", ErrInvalidTenant},
+		"bad subdomain": {conf, "-team.videos.example.com", "", "", ErrInvalidTenant},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v2/videos", nil)
+			req.Host = tc.host
+			if tc.header != "" {
+				req.Header.Set("X-Tenant", tc.header)
+			}
+
+			got, err := NewResolver(tc.conf).Resolve(req)
+			if got != tc.want || !errors.Is(err, tc.err) {
+				t.Errorf("got %q, %v, want %q, %v", got, err, tc.want, tc.err)
+			}
+		})
+	}
+}
+
+func TestQualify(t *testing.T) {
+	ctx := NewContext(context.Background(), "team")
+
+	if got := Qualify(ctx, "clip"); got != "team/clip" {
+		t.Errorf("got %v", got)
+	}
+	// records of the default tenant keep the single-tenant layout
+	if got := Qualify(context.Background(), "clip"); got != "clip" {
+		t.Errorf("default: got %v", got)
+	}
+
+	if id, name := Split("team/clip"); id != "team" || name != "clip" {
+		t.Errorf("got %v, %v", id, name)
+	}
+	if !Owns(ctx, "team/clip") || Owns(ctx, "clip") || Owns(context.Background(), "team/clip") || !Owns(context.Background(), "clip") {
+		t.Error("names are owned by the other tenants")
+	}
+}
@@ -0,0 +1,64 @@
+// Package tenant isolates teams, sharing a single deployment.
+//
+// Every request is resolved to a tenant (from its credentials, a header or
+// the subdomain), which is then carried by its context. Names of the videos,
+// streams and users are unique per tenant, and every stored record, file and
+// object belongs to the tenant of the context it was created with.
+package tenant
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// tenant of the requests, which don't name any
+// its records keep the layout of the single-tenant deployments
+const Default = "default"
+
+// tenant ids are used in object storage buckets, so they follow the same rules
+var tenantID = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+
+func Valid(id string) bool {
+	return tenantID.MatchString(id)
+}
+
+type tenantKey struct{}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// returns tenant of the context, Default if none was set
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	if id == "" {
+		return Default
+	}
+	return id
+}
+
+// prefixes name with the tenant of the context ("<tenant>/<name>")
+// names of the default tenant are left as is
+func Qualify(ctx context.Context, name string) string {
+	id := FromContext(ctx)
+	if id == Default {
+		return name
+	}
+	return id + "/" + name
+}
+
+// splits qualified name into the tenant and the name itself
+func Split(qualified string) (id, name string) {
+	id, name, ok := strings.Cut(qualified, "/")
+	if !ok {
+		return Default, qualified
+	}
+	return id, name
+}
+
+// checks if the qualified name belongs to the tenant of the context
+func Owns(ctx context.Context, qualified string) bool {
+	id, _ := Split(qualified)
+	return id == FromContext(ctx)
+}
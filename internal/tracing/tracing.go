@@ -0,0 +1,100 @@
+// Package tracing traces requests with opentelemetry.
+//
+// Spans are started by the http middleware (continuing the W3C trace
+// context of the caller, if any), the services, the storage and around every
+// ffmpeg run. They are exported over otlp/http, printed to stdout, or
+// dropped, when tracing is disabled.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/cutlery47/gostream/config"
+	"github.com/cutlery47/gostream/internal/errs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// span exporters
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+const tracerName = "github.com/cutlery47/gostream"
+
+// sets up the global tracer provider and the W3C propagators
+// returned function flushes the spans, which weren't exported yet
+func Init(conf config.TraceConfig) (shutdown func(context.Context) error, err error) {
+	// trace context is passed on, even if the spans aren't exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+
+	switch conf.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if conf.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(conf.Endpoint))
+		}
+		if conf.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		// nothing is sent until the first batch is exported
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %v", conf.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(conf.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// starts span, which is a child of the span of the context (if any)
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// ends span, recording the error
+// only unexpected errors mark the span as failed, the rest (e.g. missing files) are just recorded
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		if e := errs.From(err); e != nil {
+			span.SetAttributes(attribute.String("error.code", e.Code))
+		}
+		if errs.KindOf(err) == errs.Internal {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
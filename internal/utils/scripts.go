@@ -2,6 +2,7 @@ package utils
 
 import (
 	"os/exec"
+	"strconv"
 )
 
 // creates directory if one doesn't exits
@@ -17,3 +18,23 @@ func FindVideo(path string) *exec.Cmd {
 func SegmentVideoAndCreateManifest(vidPath, manPath, chunkPath string) *exec.Cmd {
 	return exec.Command("/bin/bash", "scripts/segment.sh", vidPath, manPath, chunkPath)
 }
+
+// same as SegmentVideoAndCreateManifest, but produces cenc encrypted fmp4 chunks
+func SegmentEncryptVideoAndCreateManifest(vidPath, manPath, chunkPath, initName, keyHex, kidHex string) *exec.Cmd {
+	return exec.Command("/bin/bash", "scripts/segment_cenc.sh", vidPath, manPath, chunkPath, initName, keyHex, kidHex)
+}
+
+// segments live stream, written to the stdin of the command
+func SegmentLiveStream(chunkPath, listPath string, segTime float64, format string) *exec.Cmd {
+	return exec.Command("/bin/bash", "scripts/live.sh", chunkPath, listPath, strconv.FormatFloat(segTime, 'f', -1, 64), format)
+}
+
+// joins segments from the concat list into a single mp4
+func RemuxSegments(listPath, vidPath string) *exec.Cmd {
+	return exec.Command("/bin/bash", "scripts/remux.sh", listPath, vidPath)
+}
+
+// extracts a representative frame of the video as a jpeg
+func CreateThumbnail(vidPath, thumbPath string) *exec.Cmd {
+	return exec.Command("/bin/bash", "scripts/thumbnail.sh", vidPath, thumbPath)
+}
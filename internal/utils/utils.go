@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"path"
 	"strings"
 )
 
@@ -37,3 +38,22 @@ func BufferReader(reader io.Reader) (*bytes.Buffer, error) {
 
 	return buf, nil
 }
+
+// returns name of the video the file belongs to
+// (video.mp4, video.m3u8, video_0001.ts, video_thumb.jpg and video_en.vtt all belong to "video")
+func VideoName(filename string) string {
+	ext := path.Ext(filename)
+	name := strings.TrimSuffix(filename, ext)
+
+	switch ext {
+	// chunks and captions are named after the video + sequence number or language
+	case ".ts", ".m4s", ".vtt":
+		if idx := strings.LastIndex(name, "_"); idx != -1 {
+			name = name[:idx]
+		}
+	case ".jpg":
+		name = strings.TrimSuffix(name, "_thumb")
+	}
+
+	return name
+}
@@ -0,0 +1 @@
+DROP SCHEMA file_schema CASCADE;
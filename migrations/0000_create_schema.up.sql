@@ -1,7 +1,3 @@
-CREATE DATABASE gostream;
-
-\connect gostream
-
 CREATE SCHEMA file_schema;
 
 CREATE DOMAIN file_schema.uuid_key AS UUID 
@@ -16,4 +12,4 @@ CHECK (
 );
 
 CREATE DOMAIN file_schema.timestamp AS TIMESTAMP WITH TIME ZONE
-DEFAULT (current_timestamp AT TIME ZONE 'UTC');
\ No newline at end of file
+DEFAULT (current_timestamp AT TIME ZONE 'UTC');
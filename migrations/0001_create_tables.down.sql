@@ -0,0 +1,2 @@
+DROP TABLE file_schema.files_meta;
+DROP TABLE file_schema.files;
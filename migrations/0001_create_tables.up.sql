@@ -1,5 +1,3 @@
-\connect gostream
-
 CREATE TABLE file_schema.files (
     id          UUID                    PRIMARY KEY,
     name        file_schema.string,
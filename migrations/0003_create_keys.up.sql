@@ -0,0 +1,6 @@
+CREATE TABLE file_schema.keys (
+    kid         BYTEA                   PRIMARY KEY,
+    key         BYTEA                   NOT NULL,
+    scheme      file_schema.string,
+    video_name  file_schema.string      REFERENCES file_schema.files (name) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+CREATE TABLE file_schema.streams (
+    name        file_schema.string      PRIMARY KEY,
+    key         file_schema.string      UNIQUE,
+    state       file_schema.string      DEFAULT 'idle',
+    updated_at  file_schema.timestamp
+);
@@ -0,0 +1,20 @@
+CREATE TABLE file_schema.videos (
+    name        file_schema.string      PRIMARY KEY,
+    title       file_schema.string,
+    status      file_schema.string      DEFAULT 'processing',
+    owner       VARCHAR(256)            NOT NULL DEFAULT '',
+    tags        TEXT[]                  NOT NULL DEFAULT '{}',
+    duration    DOUBLE PRECISION        NOT NULL DEFAULT 0,
+    size        BIGINT                  NOT NULL DEFAULT 0,
+    uploaded_at file_schema.timestamp,
+    -- title search
+    search      TSVECTOR                GENERATED ALWAYS AS (to_tsvector('simple', title)) STORED
+);
+
+-- keyset pagination over each of the sort orders
+CREATE INDEX videos_uploaded_at_idx ON file_schema.videos (uploaded_at, name);
+CREATE INDEX videos_title_idx ON file_schema.videos (title, name);
+CREATE INDEX videos_duration_idx ON file_schema.videos (duration, name);
+
+CREATE INDEX videos_tags_idx ON file_schema.videos USING GIN (tags);
+CREATE INDEX videos_search_idx ON file_schema.videos USING GIN (search);
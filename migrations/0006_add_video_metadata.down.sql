@@ -0,0 +1,5 @@
+ALTER TABLE file_schema.videos
+    DROP COLUMN description,
+    DROP COLUMN attributes,
+    DROP COLUMN visibility,
+    DROP COLUMN version;
@@ -0,0 +1,6 @@
+ALTER TABLE file_schema.videos
+    ADD COLUMN description TEXT                NOT NULL DEFAULT '',
+    ADD COLUMN attributes  JSONB               NOT NULL DEFAULT '{}',
+    ADD COLUMN visibility  VARCHAR(16)         NOT NULL DEFAULT 'public',
+    -- incremented on every update, used for optimistic concurrency
+    ADD COLUMN version     INTEGER             NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+ALTER TABLE file_schema.videos
+    DROP CONSTRAINT videos_id_key,
+    DROP COLUMN id,
+    DROP COLUMN captions;
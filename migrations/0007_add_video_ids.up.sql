@@ -0,0 +1,5 @@
+-- stable ids of the videos, names are only used for the stored files
+ALTER TABLE file_schema.videos
+    ADD COLUMN id       UUID                NOT NULL DEFAULT gen_random_uuid(),
+    ADD COLUMN captions TEXT[]              NOT NULL DEFAULT '{}',
+    ADD CONSTRAINT videos_id_key UNIQUE (id);
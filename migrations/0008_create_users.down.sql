@@ -0,0 +1,2 @@
+DROP TABLE file_schema.api_keys;
+DROP TABLE file_schema.users;
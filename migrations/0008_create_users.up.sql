@@ -0,0 +1,17 @@
+CREATE TABLE file_schema.users (
+    id          UUID                    PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        VARCHAR(64)             NOT NULL UNIQUE,
+    role        VARCHAR(16)             NOT NULL DEFAULT 'user',
+    created_at  file_schema.timestamp
+);
+
+CREATE TABLE file_schema.api_keys (
+    id          VARCHAR(32)             PRIMARY KEY,
+    user_id     UUID                    NOT NULL REFERENCES file_schema.users (id) ON DELETE CASCADE,
+    name        VARCHAR(64)             NOT NULL DEFAULT '',
+    -- sha256 of the secret part, the secret itself is never stored
+    hash        CHAR(64)                NOT NULL,
+    created_at  file_schema.timestamp
+);
+
+CREATE INDEX api_keys_user_id_idx ON file_schema.api_keys (user_id);
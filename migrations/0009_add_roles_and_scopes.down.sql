@@ -0,0 +1,4 @@
+ALTER TABLE file_schema.api_keys DROP COLUMN scopes;
+
+ALTER TABLE file_schema.users ALTER COLUMN role SET DEFAULT 'user';
+UPDATE file_schema.users SET role = 'user' WHERE role = 'uploader';
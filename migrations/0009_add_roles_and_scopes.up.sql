@@ -0,0 +1,6 @@
+-- users were allowed to upload and edit their own videos
+UPDATE file_schema.users SET role = 'uploader' WHERE role = 'user';
+ALTER TABLE file_schema.users ALTER COLUMN role SET DEFAULT 'uploader';
+
+-- NULL keeps all the scopes of the user
+ALTER TABLE file_schema.api_keys ADD COLUMN scopes TEXT[];
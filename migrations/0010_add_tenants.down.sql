@@ -0,0 +1,38 @@
+-- fails, if the tenants share any of the names, as they would no longer be unique
+
+ALTER TABLE file_schema.keys DROP CONSTRAINT keys_video_name_fkey;
+
+ALTER TABLE file_schema.users
+    DROP CONSTRAINT users_name_key,
+    DROP COLUMN tenant,
+    ADD CONSTRAINT users_name_key UNIQUE (name);
+
+DROP INDEX file_schema.videos_uploaded_at_idx;
+DROP INDEX file_schema.videos_title_idx;
+DROP INDEX file_schema.videos_duration_idx;
+
+CREATE INDEX videos_uploaded_at_idx ON file_schema.videos (uploaded_at, name);
+CREATE INDEX videos_title_idx ON file_schema.videos (title, name);
+CREATE INDEX videos_duration_idx ON file_schema.videos (duration, name);
+
+ALTER TABLE file_schema.videos
+    DROP CONSTRAINT videos_pkey,
+    DROP CONSTRAINT videos_id_key,
+    DROP COLUMN tenant,
+    ADD PRIMARY KEY (name),
+    ADD CONSTRAINT videos_id_key UNIQUE (id);
+
+ALTER TABLE file_schema.streams
+    DROP CONSTRAINT streams_pkey,
+    DROP COLUMN tenant,
+    ADD PRIMARY KEY (name);
+
+ALTER TABLE file_schema.files
+    DROP CONSTRAINT unique_filename,
+    DROP COLUMN tenant,
+    ADD CONSTRAINT unique_filename UNIQUE (name);
+
+ALTER TABLE file_schema.keys
+    DROP COLUMN tenant,
+    ADD CONSTRAINT keys_video_name_fkey FOREIGN KEY (video_name)
+        REFERENCES file_schema.files (name) ON DELETE CASCADE;
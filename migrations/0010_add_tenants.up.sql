@@ -0,0 +1,41 @@
+-- every record belongs to a tenant, the existing ones to the default one
+-- names (and video ids) become unique per tenant
+
+ALTER TABLE file_schema.keys DROP CONSTRAINT keys_video_name_fkey;
+
+ALTER TABLE file_schema.files
+    ADD COLUMN tenant   VARCHAR(32)         NOT NULL DEFAULT 'default',
+    DROP CONSTRAINT unique_filename,
+    ADD CONSTRAINT unique_filename UNIQUE (tenant, name);
+
+ALTER TABLE file_schema.keys
+    ADD COLUMN tenant   VARCHAR(32)         NOT NULL DEFAULT 'default',
+    ADD CONSTRAINT keys_video_name_fkey FOREIGN KEY (tenant, video_name)
+        REFERENCES file_schema.files (tenant, name) ON DELETE CASCADE;
+
+-- stream keys stay unique across the tenants, as they identify the stream on ingest
+ALTER TABLE file_schema.streams
+    ADD COLUMN tenant   VARCHAR(32)         NOT NULL DEFAULT 'default',
+    DROP CONSTRAINT streams_pkey,
+    ADD PRIMARY KEY (tenant, name);
+
+ALTER TABLE file_schema.videos
+    ADD COLUMN tenant   VARCHAR(32)         NOT NULL DEFAULT 'default',
+    DROP CONSTRAINT videos_pkey,
+    DROP CONSTRAINT videos_id_key,
+    ADD PRIMARY KEY (tenant, name),
+    ADD CONSTRAINT videos_id_key UNIQUE (tenant, id);
+
+-- listing is always scoped by the tenant
+DROP INDEX file_schema.videos_uploaded_at_idx;
+DROP INDEX file_schema.videos_title_idx;
+DROP INDEX file_schema.videos_duration_idx;
+
+CREATE INDEX videos_uploaded_at_idx ON file_schema.videos (tenant, uploaded_at, name);
+CREATE INDEX videos_title_idx ON file_schema.videos (tenant, title, name);
+CREATE INDEX videos_duration_idx ON file_schema.videos (tenant, duration, name);
+
+ALTER TABLE file_schema.users
+    ADD COLUMN tenant   VARCHAR(32)         NOT NULL DEFAULT 'default',
+    DROP CONSTRAINT users_name_key,
+    ADD CONSTRAINT users_name_key UNIQUE (tenant, name);
@@ -0,0 +1,5 @@
+DROP TABLE file_schema.usage;
+
+ALTER TABLE file_schema.files
+    DROP COLUMN size,
+    DROP COLUMN owner;
@@ -0,0 +1,27 @@
+-- every stored file is accounted to its owner
+ALTER TABLE file_schema.files
+    ADD COLUMN size     BIGINT              NOT NULL DEFAULT 0,
+    ADD COLUMN owner    VARCHAR(256)        NOT NULL DEFAULT '';
+
+-- usage of each owner, updated along with the files
+CREATE TABLE file_schema.usage (
+    tenant      VARCHAR(32)             NOT NULL,
+    owner       VARCHAR(256)            NOT NULL,
+    bytes       BIGINT                  NOT NULL DEFAULT 0,
+    -- stored source videos
+    videos      INTEGER                 NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (tenant, owner)
+);
+
+-- only sizes of the source videos are known for the files, stored before the accounting
+UPDATE file_schema.files AS f
+SET size = v.size, owner = v.owner
+FROM file_schema.videos AS v
+WHERE v.tenant = f.tenant AND v.name = f.name;
+
+INSERT INTO file_schema.usage
+(tenant, owner, bytes, videos)
+SELECT tenant, owner, SUM(size), COUNT(*) FILTER (WHERE name NOT LIKE '%.%')
+FROM file_schema.files
+GROUP BY tenant, owner;
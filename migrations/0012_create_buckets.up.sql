@@ -0,0 +1,11 @@
+-- token buckets of the rate limits, shared by the instances
+CREATE TABLE file_schema.buckets (
+    -- "<limit>:<tenant>:<client>"
+    key         VARCHAR(512)            PRIMARY KEY,
+    tokens      DOUBLE PRECISION        NOT NULL,
+    updated_at  TIMESTAMPTZ             NOT NULL,
+    -- when the bucket is refilled, so that it can be deleted
+    full_at     TIMESTAMPTZ             NOT NULL
+);
+
+CREATE INDEX buckets_full_at_idx ON file_schema.buckets (full_at);
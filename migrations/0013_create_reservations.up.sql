@@ -0,0 +1,14 @@
+-- quota, held by the uploads in progress
+-- reservation is deleted along with storing the files of the upload
+CREATE TABLE file_schema.reservations (
+    tenant      VARCHAR(32)             NOT NULL,
+    -- name of the uploaded video
+    name        VARCHAR(256)            NOT NULL,
+    owner       VARCHAR(256)            NOT NULL,
+    bytes       BIGINT                  NOT NULL DEFAULT 0,
+    videos      INTEGER                 NOT NULL DEFAULT 0,
+    -- reservations of the crashed uploads are ignored after a while
+    expires_at  TIMESTAMPTZ             NOT NULL,
+
+    PRIMARY KEY (tenant, name)
+);
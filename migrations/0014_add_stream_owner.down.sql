@@ -0,0 +1,2 @@
+ALTER TABLE file_schema.streams
+    DROP COLUMN owner;
@@ -0,0 +1,3 @@
+-- recordings of the streams are accounted to the users, who created them
+ALTER TABLE file_schema.streams
+    ADD COLUMN owner    VARCHAR(256)        NOT NULL DEFAULT '';
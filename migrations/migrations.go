@@ -0,0 +1,11 @@
+// Package migrations embeds the sql migrations of the db.
+//
+// Each migration is a pair of "<version>_<name>.up.sql" and
+// "<version>_<name>.down.sql" files. Versions only grow, applied migrations
+// are never edited.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
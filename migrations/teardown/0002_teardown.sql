@@ -1,3 +0,0 @@
-\connect :DB_NAME
-
-DROP SCHEMA file_schema CASCADE;
\ No newline at end of file
@@ -0,0 +1,145 @@
+// Package client is a thin http client of the gostream api.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Client struct {
+	baseURL string
+	token   string
+	tenant  string
+	http    *http.Client
+}
+
+// baseURL is the root of the server (e.g. http://localhost:8080)
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// problem details, returned by the api
+type Error struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+	// stable machine-readable code (e.g. video_not_found)
+	Code      string `json:"code"`
+	RequestID string `json:"request_id"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Title
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request id: %v)", e.RequestID)
+	}
+	return msg
+}
+
+// builds request to the path, relative to the base url
+func (c *Client) request(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.tenant != "" {
+		req.Header.Set("X-Tenant", c.tenant)
+	}
+
+	return req, nil
+}
+
+// sends the request, returns the body of successful responses
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 400 {
+		defer res.Body.Close()
+		return nil, decodeError(res)
+	}
+
+	return res, nil
+}
+
+// sends json request (if in isn't nil) and decodes json response into out (if it isn't nil)
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	req, err := c.request(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func decodeError(res *http.Response) error {
+	e := &Error{Status: res.StatusCode}
+
+	raw, _ := io.ReadAll(io.LimitReader(res.Body, 1<<16))
+	if err := json.Unmarshal(raw, e); err != nil {
+		// not a problem, e.g. returned by a proxy
+		e.Detail = strings.TrimSpace(string(raw))
+	}
+
+	if e.RequestID == "" {
+		e.RequestID = res.Header.Get("X-Request-ID")
+	}
+
+	return e
+}
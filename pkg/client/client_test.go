@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer gsk_key" {
+			t.Errorf("authorization: got %q", got)
+		}
+		if got := r.Header.Get("X-Tenant"); got != "team" {
+			t.Errorf("tenant: got %q", got)
+		}
+		w.Write([]byte(`{"user_id": "alice", "role": "uploader", "tenant": "team"}`))
+	}))
+	defer srv.Close()
+
+	// trailing slash of the base url is dropped
+	c := New(srv.URL+"/", Token("gsk_key"), Tenant("team"))
+
+	p, err := c.Me(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.UserID != "alice" || p.Tenant != "team" {
+		t.Errorf("got %+v", p)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	cases := map[string]struct {
+		contentType string
+		body        string
+		want        Error
+		msg         string
+	}{
+		"problem": {
+			"application/problem+json",
+			`{"title": "Not Found", "status": 404, "detail": "couldn't find requested video file", "code": "video_not_found", "request_id": "req-1"}`,
+			Error{Title: "Not Found", Status: 404, Detail: "couldn't find requested video file", Code: "video_not_found", RequestID: "req-1"},
+			"Not Found: couldn't find requested video file (request id: req-1)",
+		},
+		// e.g. returned by a proxy
+		"plain text": {
+			"text/plain",
+			"bad gateway\n",
+			Error{Status: 404, Detail: "bad gateway", RequestID: "req-2"},
+			"Not Found: bad gateway (request id: req-2)",
+		},
+		"empty": {
+			"text/plain",
+			"",
+			Error{Status: 404, RequestID: "req-2"},
+			"Not Found (request id: req-2)",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				w.Header().Set("X-Request-ID", "req-2")
+				w.WriteHeader(404)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			_, err := New(srv.URL).Video(context.Background(), "id")
+
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("got %v, want *Error", err)
+			}
+			if *e != tc.want {
+				t.Errorf("got %+v, want %+v", *e, tc.want)
+			}
+			if e.Error() != tc.msg {
+				t.Errorf("got %q, want %q", e.Error(), tc.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// user id, resolved to the caller
+const Me = "me"
+
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// only returned when the key is created
+	Key string `json:"key,omitempty"`
+	// empty, if the key has all the user scopes
+	Scopes    []string  `json:"scopes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// principal, the client is authenticated as
+type Principal struct {
+	UserID string   `json:"user_id,omitempty"`
+	Name   string   `json:"name"`
+	Role   string   `json:"role"`
+	Scopes []string `json:"scopes"`
+	KeyID  string   `json:"key_id,omitempty"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+func (c *Client) Me(ctx context.Context) (Principal, error) {
+	var principal Principal
+	err := c.do(ctx, http.MethodGet, "/api/v1/auth/me", nil, nil, &principal)
+	return principal, err
+}
+
+// creates api key of the user, restricted to the scopes (all of the user scopes, if empty)
+func (c *Client) CreateKey(ctx context.Context, userID, name string, scopes []string) (APIKey, error) {
+	req := struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes,omitempty"`
+	}{name, scopes}
+
+	var key APIKey
+	err := c.do(ctx, http.MethodPost, keysPath(userID), nil, req, &key)
+	return key, err
+}
+
+func (c *Client) Keys(ctx context.Context, userID string) ([]APIKey, error) {
+	var keys []APIKey
+	err := c.do(ctx, http.MethodGet, keysPath(userID), nil, nil, &keys)
+	return keys, err
+}
+
+func (c *Client) DeleteKey(ctx context.Context, userID, keyID string) error {
+	return c.do(ctx, http.MethodDelete, keysPath(userID)+"/"+url.PathEscape(keyID), nil, nil, nil)
+}
+
+func keysPath(userID string) string {
+	return "/api/v1/users/" + url.PathEscape(userID) + "/keys"
+}
@@ -0,0 +1,25 @@
+package client
+
+import "net/http"
+
+type Option func(*Client)
+
+// api key or bearer token, sent with every request
+func Token(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// tenant, the requests are made on behalf of
+func Tenant(tenant string) Option {
+	return func(c *Client) {
+		c.tenant = tenant
+	}
+}
+
+func HTTPClient(http *http.Client) Option {
+	return func(c *Client) {
+		c.http = http
+	}
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+var (
+	// size of the chunks, sent by ResumeUpload
+	chunkSize int64 = 8 << 20
+	// pause before the first retry of a failed chunk, growing with each retry
+	retryInterval = time.Second
+)
+
+// resumable upload, receiving the video in chunks
+type UploadSession struct {
+	ID string `json:"id"`
+	// bytes received so far, the next chunk should start here
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+	// processed video, once the whole file is received
+	Video *Video `json:"video,omitempty"`
+}
+
+// starts resumable upload of the mp4 video of the given size
+func (c *Client) CreateUpload(ctx context.Context, filename string, size int64, meta UploadMeta) (UploadSession, error) {
+	req := struct {
+		Filename    string            `json:"filename"`
+		Size        int64             `json:"size"`
+		Title       string            `json:"title,omitempty"`
+		Description string            `json:"description,omitempty"`
+		Tags        []string          `json:"tags,omitempty"`
+		Visibility  string            `json:"visibility,omitempty"`
+		Attributes  map[string]string `json:"attributes,omitempty"`
+	}{path.Base(filename), size, meta.Title, meta.Description, meta.Tags, meta.Visibility, meta.Attributes}
+
+	var session UploadSession
+	err := c.do(ctx, http.MethodPost, "/api/v2/uploads", nil, req, &session)
+	return session, err
+}
+
+func (c *Client) UploadStatus(ctx context.Context, id string) (UploadSession, error) {
+	var session UploadSession
+	err := c.do(ctx, http.MethodGet, uploadPath(id), nil, nil, &session)
+	return session, err
+}
+
+// sends chunk of the file, starting at the offset
+// the returned session holds the video, once the whole file is received
+func (c *Client) AppendUpload(ctx context.Context, id string, offset int64, chunk io.Reader) (UploadSession, error) {
+	var session UploadSession
+
+	req, err := c.request(ctx, http.MethodPatch, uploadPath(id), nil, chunk)
+	if err != nil {
+		return session, err
+	}
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	res, err := c.send(req)
+	if err != nil {
+		return session, err
+	}
+	defer res.Body.Close()
+
+	return session, json.NewDecoder(res.Body).Decode(&session)
+}
+
+func (c *Client) CancelUpload(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, uploadPath(id), nil, nil, nil)
+}
+
+// sends the rest of the file to the upload in chunks, starting from the offset, received by the server
+// failed chunks are retried a few times, after checking the offset again
+func (c *Client) ResumeUpload(ctx context.Context, id string, file io.ReaderAt) (Video, error) {
+	const retries = 3
+
+	session, err := c.UploadStatus(ctx, id)
+	if err != nil {
+		return Video{}, err
+	}
+
+	failures := 0
+	for {
+		end := min(session.Offset+chunkSize, session.Size)
+
+		next, err := c.AppendUpload(ctx, id, session.Offset, io.NewSectionReader(file, session.Offset, end-session.Offset))
+		if err == nil {
+			if next.Video != nil {
+				return *next.Video, nil
+			}
+
+			session, failures = next, 0
+			continue
+		}
+
+		// errors of the server aren't fixed by retrying
+		var e *Error
+		if errors.As(err, &e) && e.Status != http.StatusConflict && e.Status != http.StatusTooManyRequests && e.Status < 500 {
+			return Video{}, err
+		}
+
+		failures++
+		if failures > retries {
+			return Video{}, fmt.Errorf("upload %v stopped at %v of %v bytes: %w", id, session.Offset, session.Size, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return Video{}, ctx.Err()
+		case <-time.After(time.Duration(failures) * retryInterval):
+		}
+
+		// part of the chunk may have been received
+		if session, err = c.UploadStatus(ctx, id); err != nil {
+			return Video{}, err
+		}
+	}
+}
+
+func uploadPath(id string) string {
+	return "/api/v2/uploads/" + url.PathEscape(id)
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// upload server, receiving the file into data
+type testUploads struct {
+	mu   sync.Mutex
+	data []byte
+	size int64
+	// status of the next chunks, after the given number of their bytes is received
+	failures []int
+	appends  int
+}
+
+func (tu *testUploads) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tu.mu.Lock()
+	defer tu.mu.Unlock()
+
+	respond := func(status int, video *Video) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(UploadSession{ID: "u1", Offset: int64(len(tu.data)), Size: tu.size, Video: video})
+	}
+
+	switch r.Method + " " + r.URL.Path {
+	case "POST /api/v2/uploads":
+		var req struct {
+			Filename string `json:"filename"`
+			Size     int64  `json:"size"`
+			Title    string `json:"title"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		tu.size = req.Size
+		respond(201, nil)
+	case "GET /api/v2/uploads/u1":
+		respond(200, nil)
+	case "PATCH /api/v2/uploads/u1":
+		tu.appends++
+
+		offset, _ := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if offset != int64(len(tu.data)) {
+			respond(409, nil)
+			return
+		}
+
+		chunk, _ := io.ReadAll(r.Body)
+		if len(tu.failures) > 0 {
+			// the connection broke after a part of the chunk
+			tu.data = append(tu.data, chunk[:tu.failures[0]]...)
+			tu.failures = tu.failures[1:]
+			respond(502, nil)
+			return
+		}
+
+		tu.data = append(tu.data, chunk...)
+		if int64(len(tu.data)) == tu.size {
+			respond(200, &Video{ID: "u1", Status: StatusReady})
+			return
+		}
+		respond(200, nil)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestResumeUpload(t *testing.T) {
+	defer func(size int64, interval time.Duration) { chunkSize, retryInterval = size, interval }(chunkSize, retryInterval)
+	chunkSize, retryInterval = 4, time.Millisecond
+
+	const file = "0123456789"
+
+	cases := map[string]struct {
+		failures []int
+		// chunks sent, including the failed ones, which are resumed from the received part
+		appends int
+		err     bool
+	}{
+		"at once":         {appends: 3},
+		"partial chunk":   {failures: []int{2}, appends: 3},
+		"failed retries":  {failures: []int{0, 0, 0, 0}, appends: 4, err: true},
+		"recovered twice": {failures: []int{1, 3}, appends: 4},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			uploads := &testUploads{failures: tc.failures}
+			srv := httptest.NewServer(uploads)
+			defer srv.Close()
+
+			c := New(srv.URL)
+			ctx := context.Background()
+
+			session, err := c.CreateUpload(ctx, "/home/alice/clip.mp4", int64(len(file)), UploadMeta{Title: "Clip"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			video, err := c.ResumeUpload(ctx, session.ID, strings.NewReader(file))
+			if tc.err {
+				var e *Error
+				if !errors.As(err, &e) || e.Status != 502 {
+					t.Errorf("got %v, want the last error of the server", err)
+				}
+			} else if err != nil || video.ID != "u1" {
+				t.Fatalf("got %+v, %v", video, err)
+			}
+
+			if !tc.err && string(uploads.data) != file {
+				t.Errorf("server received %q", uploads.data)
+			}
+			if uploads.appends != tc.appends {
+				t.Errorf("sent %v chunks, want %v", uploads.appends, tc.appends)
+			}
+		})
+	}
+}
+
+func TestResumeUploadRejected(t *testing.T) {
+	appends := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"id": "u1", "offset": 0, "size": 10}`))
+			return
+		}
+		appends++
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(403)
+		w.Write([]byte(`{"title": "Forbidden", "status": 403, "code": "quota_exceeded"}`))
+	}))
+	defer srv.Close()
+
+	// errors of the client aren't retried
+	_, err := New(srv.URL).ResumeUpload(context.Background(), "u1", strings.NewReader("0123456789"))
+
+	var e *Error
+	if !errors.As(err, &e) || e.Code != "quota_exceeded" || appends != 1 {
+		t.Errorf("got %v after %v chunks", err, appends)
+	}
+}
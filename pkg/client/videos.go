@@ -0,0 +1,298 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processing states of the videos
+const (
+	StatusProcessing = "processing"
+	StatusReady      = "ready"
+	StatusFailed     = "failed"
+)
+
+type Video struct {
+	ID          string            `json:"id"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Status      string            `json:"status"`
+	Visibility  string            `json:"visibility"`
+	Owner       string            `json:"owner,omitempty"`
+	Tags        []string          `json:"tags"`
+	Attributes  map[string]string `json:"attributes"`
+	// languages of the captions
+	Captions   []string  `json:"captions"`
+	Duration   float64   `json:"duration"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type VideoPage struct {
+	Videos []Video `json:"videos"`
+	// empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// filters of the video list, zero values are omitted
+type VideoQuery struct {
+	Status      string
+	Visibility  string
+	Tag         string
+	Owner       string
+	MinDuration float64
+	MaxDuration float64
+	// words to search in the title
+	Search string
+	// uploaded_at, title or duration
+	Sort  string
+	Order string
+	Limit int
+	// cursor of the next page
+	Cursor string
+}
+
+func (q VideoQuery) values() url.Values {
+	values := url.Values{}
+
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+
+	set("status", q.Status)
+	set("visibility", q.Visibility)
+	set("tag", q.Tag)
+	set("owner", q.Owner)
+	set("q", q.Search)
+	set("sort", q.Sort)
+	set("order", q.Order)
+	set("cursor", q.Cursor)
+
+	if q.MinDuration > 0 {
+		values.Set("min_duration", strconv.FormatFloat(q.MinDuration, 'f', -1, 64))
+	}
+	if q.MaxDuration > 0 {
+		values.Set("max_duration", strconv.FormatFloat(q.MaxDuration, 'f', -1, 64))
+	}
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	return values
+}
+
+// metadata of the uploaded video, empty fields are left to the server defaults
+type UploadMeta struct {
+	Title       string
+	Description string
+	Tags        []string
+	// public, unlisted or private
+	Visibility string
+	Attributes map[string]string
+}
+
+// signed url of the master playlist
+type Playback struct {
+	URL string `json:"url"`
+	// unix time, 0 if the url doesn't expire
+	Expires int64 `json:"expires"`
+}
+
+// uploads mp4 video, read from r
+// the body is streamed, so r is read as the request is sent
+func (c *Client) Upload(ctx context.Context, filename string, r io.Reader, meta UploadMeta) (Video, error) {
+	var video Video
+
+	attributes, err := json.Marshal(meta.Attributes)
+	if err != nil {
+		return video, err
+	}
+
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeForm(form, filename, r, meta, attributes))
+	}()
+
+	req, err := c.request(ctx, http.MethodPost, "/api/v2/videos", nil, pr)
+	if err != nil {
+		pr.Close()
+		return video, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	res, err := c.send(req)
+	// unblocks the writer, if the request failed before the body was sent
+	pr.Close()
+	if err != nil {
+		return video, err
+	}
+	defer res.Body.Close()
+
+	return video, json.NewDecoder(res.Body).Decode(&video)
+}
+
+func writeForm(form *multipart.Writer, filename string, r io.Reader, meta UploadMeta, attributes []byte) error {
+	fields := [][2]string{
+		{"title", meta.Title},
+		{"description", meta.Description},
+		{"tags", strings.Join(meta.Tags, ",")},
+		{"visibility", meta.Visibility},
+	}
+	if len(meta.Attributes) > 0 {
+		fields = append(fields, [2]string{"attributes", string(attributes)})
+	}
+
+	// fields go first, so that the server doesn't wait for the whole file to see them
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+
+	part, err := form.CreateFormFile("file", path.Base(filename))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(part, r); err != nil {
+		return err
+	}
+
+	return form.Close()
+}
+
+func (c *Client) Videos(ctx context.Context, query VideoQuery) (VideoPage, error) {
+	var page VideoPage
+	err := c.do(ctx, http.MethodGet, "/api/v2/videos", query.values(), nil, &page)
+	return page, err
+}
+
+func (c *Client) Video(ctx context.Context, id string) (Video, error) {
+	var video Video
+	err := c.do(ctx, http.MethodGet, videoPath(id), nil, nil, &video)
+	return video, err
+}
+
+func (c *Client) DeleteVideo(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, videoPath(id), nil, nil, nil)
+}
+
+// polls the video, until it's processed
+func (c *Client) WaitVideo(ctx context.Context, id string, interval time.Duration) (Video, error) {
+	for {
+		video, err := c.Video(ctx, id)
+		if err != nil || video.Status != StatusProcessing {
+			return video, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return video, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// download of the original video
+type Download struct {
+	Body io.ReadCloser
+	// offset of the first byte of the body, 0 unless the server honored the range
+	Offset int64
+	// size of the whole file, -1 if unknown
+	Size int64
+}
+
+// downloads original video, starting from the offset
+// offset is only honored by the servers, supporting range requests,
+// others send the whole file, which is reported by Download.Offset
+func (c *Client) Download(ctx context.Context, id string, offset int64) (Download, error) {
+	req, err := c.request(ctx, http.MethodGet, videoPath(id)+"/source", nil, nil)
+	if err != nil {
+		return Download{}, err
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+	}
+
+	res, err := c.send(req)
+	if err != nil {
+		return Download{}, err
+	}
+
+	download := Download{Body: res.Body, Size: res.ContentLength}
+
+	// anything but a partial content response is the whole file
+	if res.StatusCode != http.StatusPartialContent {
+		return download, nil
+	}
+
+	// "bytes <first>-<last>/<size>", the size may be "*"
+	var first, last int64
+	var total string
+	if _, err := fmt.Sscanf(res.Header.Get("Content-Range"), "bytes %d-%d/%s", &first, &last, &total); err != nil || first != offset {
+		res.Body.Close()
+		return Download{}, fmt.Errorf("server sent range %q, while bytes from %v were requested", res.Header.Get("Content-Range"), offset)
+	}
+
+	download.Offset = offset
+	download.Size = -1
+	if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+		download.Size = size
+	}
+
+	return download, nil
+}
+
+func (c *Client) Playback(ctx context.Context, id string) (Playback, error) {
+	var playback Playback
+	err := c.do(ctx, http.MethodGet, videoPath(id)+"/playback", nil, nil, &playback)
+	return playback, err
+}
+
+// fetches playlist of the video ("master.m3u8" or "<rendition>.m3u8")
+// playlists are fetched with the token of the playback url, if the server signs them
+func (c *Client) Playlist(ctx context.Context, id, playlist string) ([]byte, error) {
+	playback, err := c.Playback(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	master, err := url.Parse(playback.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.request(ctx, http.MethodGet, path.Join(path.Dir(master.Path), playlist), master.Query(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return io.ReadAll(res.Body)
+}
+
+func videoPath(id string) string {
+	return "/api/v2/videos/" + url.PathEscape(id)
+}
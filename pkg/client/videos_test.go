@@ -0,0 +1,266 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v2/videos" {
+			t.Errorf("got %v %v", r.Method, r.URL.Path)
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, _ := io.ReadAll(file)
+
+		if header.Filename != "clip.mp4" || string(data) != "video" {
+			t.Errorf("got file %q of %q", header.Filename, data)
+		}
+
+		fields := map[string]string{"title": "Clip", "tags": "a,b", "visibility": "private", "attributes": `{"lang":"en"}`, "description": ""}
+		for field, want := range fields {
+			if got := r.FormValue(field); got != want {
+				t.Errorf("%v: got %q, want %q", field, got, want)
+			}
+		}
+
+		w.WriteHeader(201)
+		w.Write([]byte(`{"id": "id", "title": "Clip", "status": "processing"}`))
+	}))
+	defer srv.Close()
+
+	meta := UploadMeta{Title: "Clip", Tags: []string{"a", "b"}, Visibility: "private", Attributes: map[string]string{"lang": "en"}}
+
+	video, err := New(srv.URL).Upload(context.Background(), "/home/alice/clip.mp4", strings.NewReader("video"), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.ID != "id" || video.Status != StatusProcessing {
+		t.Errorf("got %+v", video)
+	}
+}
+
+func TestVideos(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := url.Values{
+			"tag":          {"music"},
+			"q":            {"live set"},
+			"min_duration": {"1.5"},
+			"sort":         {"title"},
+			"limit":        {"2"},
+			"cursor":       {"abc"},
+		}
+		if got := r.URL.Query(); got.Encode() != want.Encode() {
+			t.Errorf("got query %v, want %v", got, want)
+		}
+
+		w.Write([]byte(`{"videos": [{"id": "1"}, {"id": "2"}], "next_cursor": "def"}`))
+	}))
+	defer srv.Close()
+
+	page, err := New(srv.URL).Videos(context.Background(), VideoQuery{Tag: "music", Search: "live set", MinDuration: 1.5, Sort: "title", Limit: 2, Cursor: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Videos) != 2 || page.NextCursor != "def" {
+		t.Errorf("got %+v", page)
+	}
+}
+
+func TestWaitVideo(t *testing.T) {
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := StatusProcessing
+		if polls == 3 {
+			status = StatusReady
+		}
+		json.NewEncoder(w).Encode(Video{ID: "id", Status: status})
+	}))
+	defer srv.Close()
+
+	video, err := New(srv.URL).WaitVideo(context.Background(), "id", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.Status != StatusReady || polls != 3 {
+		t.Errorf("got %v after %v polls", video.Status, polls)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	content := []byte("0123456789")
+
+	cases := map[string]struct {
+		handler http.HandlerFunc
+		offset  int64
+		// offset and body of the download
+		want     int64
+		body     string
+		size     int64
+		mismatch bool
+	}{
+		"whole file": {
+			handler: serveContent(content),
+			body:    "0123456789", size: 10,
+		},
+		"resumed": {
+			handler: serveContent(content), offset: 4,
+			want: 4, body: "456789", size: 10,
+		},
+		// the whole file is sent, so it should be written from the start
+		"range ignored": {
+			handler: func(w http.ResponseWriter, r *http.Request) { w.Write(content) },
+			offset:  4,
+			body:    "0123456789", size: 10,
+		},
+		"unknown size": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Range", "bytes 4-9/*")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[4:])
+			},
+			offset: 4,
+			want:   4, body: "456789", size: -1,
+		},
+		"other range": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Range", "bytes 2-9/10")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[2:])
+			},
+			offset:   4,
+			mismatch: true,
+		},
+		"no content range": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[4:])
+			},
+			offset:   4,
+			mismatch: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+
+			dl, err := New(srv.URL).Download(context.Background(), "id", tc.offset)
+			if tc.mismatch {
+				if err == nil {
+					dl.Body.Close()
+					t.Fatal("mismatching range was accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dl.Body.Close()
+
+			body, err := io.ReadAll(dl.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if dl.Offset != tc.want || string(body) != tc.body || dl.Size != tc.size {
+				t.Errorf("got offset %v, size %v and %q, want %v, %v and %q", dl.Offset, dl.Size, body, tc.want, tc.size, tc.body)
+			}
+		})
+	}
+}
+
+// serves ranges the same way the source route does
+func serveContent(content []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/videos/id/source" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "id.mp4", time.Time{}, bytes.NewReader(content))
+	}
+}
+
+func TestPlaylist(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/videos/id/playback":
+			w.Write([]byte(`{"url": "/api/v2/videos/id/playlists/master.m3u8?token=signed", "expires": 1}`))
+		case "/api/v2/videos/id/playlists/source.m3u8":
+			// playlists are fetched with the token of the playback url
+			if token := r.URL.Query().Get("token"); token != "signed" {
+				http.Error(w, "token: "+token, http.StatusForbidden)
+				return
+			}
+			w.Write([]byte("#EXTM3U\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	raw, err := New(srv.URL).Playlist(context.Background(), "id", "source.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "#EXTM3U\n" {
+		t.Errorf("got %q", raw)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "POST /api/v1/users/me/keys":
+			var req struct {
+				Name   string   `json:"name"`
+				Scopes []string `json:"scopes"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name != "ci" || len(req.Scopes) != 1 {
+				t.Errorf("got %+v, %v", req, err)
+			}
+			w.WriteHeader(201)
+			w.Write([]byte(`{"id": "k1", "name": "ci", "key": "gsk_k1_secret", "scopes": ["videos:read"]}`))
+		// user ids are escaped
+		case "GET /api/v1/users/alice%2Fbob/keys":
+			w.Write([]byte(`[{"id": "k1"}, {"id": "k2"}]`))
+		case "DELETE /api/v1/users/me/keys/k1":
+			w.WriteHeader(204)
+		default:
+			t.Errorf("unexpected %v %v", r.Method, r.URL.EscapedPath())
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	key, err := c.CreateKey(ctx, Me, "ci", []string{"videos:read"})
+	if err != nil || key.Key != "gsk_k1_secret" {
+		t.Errorf("got %+v, %v", key, err)
+	}
+
+	keys, err := c.Keys(ctx, "alice/bob")
+	if err != nil || len(keys) != 2 {
+		t.Errorf("got %+v, %v", keys, err)
+	}
+
+	if err := c.DeleteKey(ctx, Me, "k1"); err != nil {
+		t.Error(err)
+	}
+}
@@ -6,25 +6,70 @@ import (
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// formats of the stdout output (files are always written as json)
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+const (
+	defaultMaxSize    = 100
+	defaultMaxBackups = 5
+	defaultMaxAge     = 30
+)
+
+type options struct {
+	level  zapcore.Level
+	format string
+
+	// size in megabytes, age in days
+	maxSize    int
+	maxBackups int
+	maxAge     int
+	compress   bool
+}
+
 // shamelessly copied from https://betterstack.com/community/guides/logging/go/zap/#examining-zap-s-logging-api
 // (idk what halfa dis does bru)
-func New(filepath string, isErr bool) *zap.Logger {
+// error loggers never log below the error level
+func New(filepath string, isErr bool, opts ...Option) *zap.Logger {
+	o := options{
+		level:      zap.InfoLevel,
+		format:     FormatConsole,
+		maxSize:    defaultMaxSize,
+		maxBackups: defaultMaxBackups,
+		maxAge:     defaultMaxAge,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// lumberjack opens the file on the first write, so unwritable paths are caught here
 	fd, err := os.OpenFile(filepath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
 		log.Printf("logger.New (path: %v): %v", filepath, err)
 		return nil
 	}
+	fd.Close()
 
 	stdout := zapcore.AddSync(os.Stdout)
-	file := zapcore.AddSync(fd)
 
-	var level zap.AtomicLevel
-	if isErr {
+	// file is rotated, once it grows over the max size
+	file := zapcore.AddSync(&lumberjack.Logger{
+		Filename:   filepath,
+		MaxSize:    o.maxSize,
+		MaxBackups: o.maxBackups,
+		MaxAge:     o.maxAge,
+		Compress:   o.compress,
+	})
+
+	level := zap.NewAtomicLevelAt(o.level)
+	if isErr && o.level < zap.ErrorLevel {
 		level = zap.NewAtomicLevelAt(zap.ErrorLevel)
-	} else {
-		level = zap.NewAtomicLevelAt(zap.InfoLevel)
 	}
 
 	prodConfig := zap.NewProductionEncoderConfig()
@@ -35,6 +80,9 @@ func New(filepath string, isErr bool) *zap.Logger {
 	devConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 
 	consoleEncoder := zapcore.NewConsoleEncoder(devConfig)
+	if o.format == FormatJSON {
+		consoleEncoder = zapcore.NewJSONEncoder(prodConfig)
+	}
 	fileEncoder := zapcore.NewJSONEncoder(prodConfig)
 
 	core := zapcore.NewTee(
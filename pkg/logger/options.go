@@ -0,0 +1,31 @@
+package logger
+
+import (
+	"go.uber.org/zap/zapcore"
+)
+
+type Option func(*options)
+
+func Level(level zapcore.Level) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// format of the stdout output (console / json)
+func Format(format string) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// rotates the file, once it grows over maxSize megabytes
+// at most maxBackups rotated files are kept for maxAge days (0 keeps them all)
+func Rotate(maxSize, maxBackups, maxAge int, compress bool) Option {
+	return func(o *options) {
+		o.maxSize = maxSize
+		o.maxBackups = maxBackups
+		o.maxAge = maxAge
+		o.compress = compress
+	}
+}
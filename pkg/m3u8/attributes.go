@@ -0,0 +1,182 @@
+package m3u8
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// layout of EXT-X-PROGRAM-DATE-TIME and DATERANGE dates
+const dateLayout = "2006-01-02T15:04:05.999Z07:00"
+
+var errAttributeList = errors.New("malformed attribute list")
+
+// splits attribute list, keeping the values in their raw (quoted) form
+func parseAttributes(list string) ([]Attribute, error) {
+	var attrs []Attribute
+
+	for len(list) > 0 {
+		eq := strings.IndexByte(list, '=')
+		if eq <= 0 {
+			return nil, errAttributeList
+		}
+
+		key := strings.TrimSpace(list[:eq])
+		if !validAttributeName(key) {
+			return nil, errAttributeList
+		}
+		list = list[eq+1:]
+
+		var value string
+		if strings.HasPrefix(list, `"`) {
+			// quoted strings may contain commas
+			end := strings.IndexByte(list[1:], '"')
+			if end == -1 {
+				return nil, errAttributeList
+			}
+			value = list[:end+2]
+			list = list[end+2:]
+		} else {
+			end := strings.IndexByte(list, ',')
+			if end == -1 {
+				end = len(list)
+			}
+			value = strings.TrimSpace(list[:end])
+			list = list[end:]
+
+			// enumerated strings and numbers don't contain quotes or whitespace
+			if value == "" || strings.ContainsAny(value, "\" \t") {
+				return nil, errAttributeList
+			}
+		}
+
+		attrs = append(attrs, Attribute{Key: key, Value: value})
+
+		if strings.HasPrefix(list, ",") {
+			list = list[1:]
+		} else if len(list) > 0 {
+			return nil, errAttributeList
+		}
+	}
+
+	return attrs, nil
+}
+
+// attribute names consist of uppercase letters, digits and dashes
+func validAttributeName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, c := range name {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func unquote(value string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(value, `"`), `"`)
+}
+
+func parseInt(value string) (int64, error) {
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func parseFloat(value string) (float64, error) {
+	return strconv.ParseFloat(value, 64)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// <n>[@<o>]
+func parseByteRange(value string) (*ByteRange, error) {
+	length, offset, hasOffset := strings.Cut(value, "@")
+
+	n, err := parseInt(length)
+	if err != nil {
+		return nil, err
+	}
+
+	br := &ByteRange{Length: n}
+	if hasOffset {
+		o, err := parseInt(offset)
+		if err != nil {
+			return nil, err
+		}
+		br.Offset = &o
+	}
+
+	return br, nil
+}
+
+func (br ByteRange) String() string {
+	if br.Offset == nil {
+		return strconv.FormatInt(br.Length, 10)
+	}
+	return strconv.FormatInt(br.Length, 10) + "@" + strconv.FormatInt(*br.Offset, 10)
+}
+
+func parseDate(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func formatDate(value time.Time) string {
+	return value.Format(dateLayout)
+}
+
+// accumulates attribute list for encoding
+type attrWriter struct {
+	b strings.Builder
+}
+
+func (aw *attrWriter) raw(key, value string) {
+	if aw.b.Len() > 0 {
+		aw.b.WriteByte(',')
+	}
+	aw.b.WriteString(key)
+	aw.b.WriteByte('=')
+	aw.b.WriteString(value)
+}
+
+// enumerated string / hex sequence, omitted if empty
+func (aw *attrWriter) enum(key, value string) {
+	if value != "" {
+		aw.raw(key, value)
+	}
+}
+
+// quoted string, omitted if empty
+func (aw *attrWriter) quoted(key, value string) {
+	if value != "" {
+		aw.raw(key, `"`+value+`"`)
+	}
+}
+
+// decimal integer, omitted if zero
+func (aw *attrWriter) integer(key string, value int64) {
+	if value != 0 {
+		aw.raw(key, strconv.FormatInt(value, 10))
+	}
+}
+
+// decimal float, omitted if zero
+func (aw *attrWriter) float(key string, value float64) {
+	if value != 0 {
+		aw.raw(key, formatFloat(value))
+	}
+}
+
+// YES, omitted if false
+func (aw *attrWriter) yes(key string, value bool) {
+	if value {
+		aw.raw(key, "YES")
+	}
+}
+
+func (aw *attrWriter) String() string { return aw.b.String() }
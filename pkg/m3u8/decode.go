@@ -0,0 +1,763 @@
+package m3u8
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// tags, which may only appear in master playlists
+var masterTags = map[string]bool{
+	"#EXT-X-MEDIA":              true,
+	"#EXT-X-STREAM-INF":         true,
+	"#EXT-X-I-FRAME-STREAM-INF": true,
+	"#EXT-X-SESSION-DATA":       true,
+	"#EXT-X-SESSION-KEY":        true,
+}
+
+// tags, which apply to media segments, unknown tags before them belong to the playlist
+var segmentTags = map[string]bool{
+	"#EXTINF":                  true,
+	"#EXT-X-BYTERANGE":         true,
+	"#EXT-X-DISCONTINUITY":     true,
+	"#EXT-X-KEY":               true,
+	"#EXT-X-MAP":               true,
+	"#EXT-X-PROGRAM-DATE-TIME": true,
+	"#EXT-X-DATERANGE":         true,
+	"#EXT-X-PART":              true,
+}
+
+type decoder struct {
+	master MasterPlaylist
+	media  MediaPlaylist
+
+	isMaster bool
+	isMedia  bool
+
+	// unknown tags among the playlist tags
+	header []string
+	// set after the first media segment tag
+	inSegments bool
+
+	// segment, whose tags are being read
+	segment Segment
+	// set after EXTINF, until the segment uri is read
+	hasSegment bool
+	// set after EXT-X-STREAM-INF, until the variant uri is read
+	variant *Variant
+}
+
+// decodes either master or media playlist
+func Decode(data []byte) (Playlist, error) {
+	d := &decoder{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// playlists of long events may have quite long lines (daterange payloads)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			if text != "#EXTM3U" {
+				return nil, &SyntaxError{Line: line, Err: ErrMissingHeader}
+			}
+			continue
+		}
+
+		if err := d.decodeLine(text); err != nil {
+			return nil, &SyntaxError{Line: line, Err: err}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if line == 0 {
+		return nil, &SyntaxError{Line: 1, Err: ErrMissingHeader}
+	}
+
+	if d.hasSegment || d.variant != nil || d.dangling() {
+		return nil, &SyntaxError{Line: line, Err: ErrMissingURI}
+	}
+
+	if d.isMaster && d.isMedia {
+		return nil, ErrMixedPlaylist
+	}
+
+	if d.isMaster {
+		d.master.Unknown = append(d.header, d.segment.Unknown...)
+		return &d.master, nil
+	}
+
+	d.media.HeaderUnknown = d.header
+	// leftover tags (e.g. after the last segment)
+	d.media.Unknown = d.segment.Unknown
+	// parts of the unfinished segment
+	d.media.Parts = d.segment.Parts
+
+	return &d.media, nil
+}
+
+func DecodeMedia(data []byte) (*MediaPlaylist, error) {
+	pl, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	media, ok := pl.(*MediaPlaylist)
+	if !ok {
+		return nil, ErrNotMedia
+	}
+
+	return media, nil
+}
+
+func DecodeMaster(data []byte) (*MasterPlaylist, error) {
+	pl, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	master, ok := pl.(*MasterPlaylist)
+	if !ok {
+		return nil, ErrNotMaster
+	}
+
+	return master, nil
+}
+
+func (d *decoder) decodeLine(line string) error {
+	if line == "" {
+		return nil
+	}
+
+	// uri line
+	if !strings.HasPrefix(line, "#") {
+		return d.decodeURI(line)
+	}
+
+	tag, value, _ := strings.Cut(line, ":")
+
+	if masterTags[tag] {
+		d.isMaster = true
+	}
+	if segmentTags[tag] {
+		d.inSegments = true
+	}
+
+	switch tag {
+	case "#EXT-X-VERSION":
+		version, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		d.master.Version = version
+		d.media.Version = version
+	case "#EXT-X-INDEPENDENT-SEGMENTS":
+		d.master.IndependentSegments = true
+		d.media.IndependentSegments = true
+	case "#EXT-X-START":
+		start, err := decodeStart(value)
+		if err != nil {
+			return err
+		}
+		d.master.Start = start
+		d.media.Start = start
+
+	// media playlist tags
+	case "#EXT-X-TARGETDURATION":
+		d.isMedia = true
+		duration, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		d.media.TargetDuration = duration
+	case "#EXT-X-MEDIA-SEQUENCE":
+		d.isMedia = true
+		seq, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		d.media.MediaSequence = seq
+	case "#EXT-X-DISCONTINUITY-SEQUENCE":
+		d.isMedia = true
+		seq, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		d.media.DiscontinuitySequence = seq
+	case "#EXT-X-PLAYLIST-TYPE":
+		d.isMedia = true
+		d.media.PlaylistType = value
+	case "#EXT-X-I-FRAMES-ONLY":
+		d.isMedia = true
+		d.media.IFramesOnly = true
+	case "#EXT-X-ENDLIST":
+		d.isMedia = true
+		d.media.EndList = true
+
+	// media segment tags
+	case "#EXTINF":
+		d.isMedia = true
+		duration, title, _ := strings.Cut(value, ",")
+		dur, err := parseFloat(duration)
+		if err != nil {
+			return err
+		}
+		d.segment.Duration = dur
+		d.segment.Title = title
+		d.hasSegment = true
+	case "#EXT-X-BYTERANGE":
+		d.isMedia = true
+		br, err := parseByteRange(value)
+		if err != nil {
+			return err
+		}
+		d.segment.ByteRange = br
+	case "#EXT-X-DISCONTINUITY":
+		d.isMedia = true
+		d.segment.Discontinuity = true
+	case "#EXT-X-KEY":
+		d.isMedia = true
+		key, err := decodeKey(value)
+		if err != nil {
+			return err
+		}
+		d.segment.Keys = append(d.segment.Keys, key)
+	case "#EXT-X-MAP":
+		d.isMedia = true
+		m, err := decodeMap(value)
+		if err != nil {
+			return err
+		}
+		d.segment.Map = m
+	case "#EXT-X-PROGRAM-DATE-TIME":
+		d.isMedia = true
+		pdt, err := parseDate(value)
+		if err != nil {
+			return err
+		}
+		d.segment.ProgramDateTime = pdt
+	case "#EXT-X-DATERANGE":
+		d.isMedia = true
+		dr, err := decodeDateRange(value)
+		if err != nil {
+			return err
+		}
+		d.segment.DateRanges = append(d.segment.DateRanges, dr)
+
+	// low-latency tags
+	case "#EXT-X-SERVER-CONTROL":
+		d.isMedia = true
+		sc, err := decodeServerControl(value)
+		if err != nil {
+			return err
+		}
+		d.media.ServerControl = sc
+	case "#EXT-X-PART-INF":
+		d.isMedia = true
+		attrs, err := parseAttributes(value)
+		if err != nil {
+			return err
+		}
+		d.media.PartInf = &PartInf{}
+		for _, attr := range attrs {
+			if attr.Key == "PART-TARGET" {
+				if d.media.PartInf.PartTarget, err = parseFloat(attr.Value); err != nil {
+					return err
+				}
+			}
+		}
+	case "#EXT-X-SKIP":
+		d.isMedia = true
+		skip, err := decodeSkip(value)
+		if err != nil {
+			return err
+		}
+		d.media.Skip = skip
+	case "#EXT-X-PART":
+		d.isMedia = true
+		part, err := decodePart(value)
+		if err != nil {
+			return err
+		}
+		d.segment.Parts = append(d.segment.Parts, part)
+	case "#EXT-X-PRELOAD-HINT":
+		d.isMedia = true
+		hint, err := decodePreloadHint(value)
+		if err != nil {
+			return err
+		}
+		d.media.PreloadHints = append(d.media.PreloadHints, hint)
+	case "#EXT-X-RENDITION-REPORT":
+		d.isMedia = true
+		report, err := decodeRenditionReport(value)
+		if err != nil {
+			return err
+		}
+		d.media.RenditionReports = append(d.media.RenditionReports, report)
+
+	// master playlist tags
+	case "#EXT-X-MEDIA":
+		media, err := decodeMedia(value)
+		if err != nil {
+			return err
+		}
+		d.master.Media = append(d.master.Media, media)
+	case "#EXT-X-STREAM-INF":
+		variant, err := decodeVariant(value)
+		if err != nil {
+			return err
+		}
+		d.variant = &variant
+	case "#EXT-X-I-FRAME-STREAM-INF":
+		variant, err := decodeIFrameVariant(value)
+		if err != nil {
+			return err
+		}
+		d.master.IFrameVariants = append(d.master.IFrameVariants, variant)
+	case "#EXT-X-SESSION-DATA":
+		data, err := decodeSessionData(value)
+		if err != nil {
+			return err
+		}
+		d.master.SessionData = append(d.master.SessionData, data)
+	case "#EXT-X-SESSION-KEY":
+		key, err := decodeKey(value)
+		if err != nil {
+			return err
+		}
+		d.master.SessionKeys = append(d.master.SessionKeys, key)
+
+	default:
+		// comments and unknown tags are kept as is
+		if d.inSegments {
+			d.segment.Unknown = append(d.segment.Unknown, line)
+		} else {
+			d.header = append(d.header, line)
+		}
+	}
+
+	return nil
+}
+
+// segment tags, which aren't followed by an uri, would be lost (only parts may end the playlist)
+func (d *decoder) dangling() bool {
+	s := d.segment
+	return s.ByteRange != nil || s.Discontinuity || s.Keys != nil || s.Map != nil ||
+		!s.ProgramDateTime.IsZero() || s.DateRanges != nil
+}
+
+func (d *decoder) decodeURI(uri string) error {
+	if d.variant != nil {
+		d.variant.URI = uri
+		d.master.Variants = append(d.master.Variants, *d.variant)
+		d.variant = nil
+		return nil
+	}
+
+	if !d.hasSegment {
+		return errors.New("uri is not preceded by EXTINF or EXT-X-STREAM-INF")
+	}
+
+	d.segment.URI = uri
+	d.media.Segments = append(d.media.Segments, d.segment)
+
+	d.segment = Segment{}
+	d.hasSegment = false
+
+	return nil
+}
+
+func decodeStart(value string) (*Start, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return nil, err
+	}
+
+	start := &Start{}
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "TIME-OFFSET":
+			if start.TimeOffset, err = parseFloat(attr.Value); err != nil {
+				return nil, err
+			}
+		case "PRECISE":
+			start.Precise = attr.Value == "YES"
+		}
+	}
+
+	return start, nil
+}
+
+func decodeKey(value string) (Key, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return Key{}, err
+	}
+
+	var key Key
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "METHOD":
+			key.Method = attr.Value
+		case "URI":
+			key.URI = unquote(attr.Value)
+		case "IV":
+			key.IV = attr.Value
+		case "KEYFORMAT":
+			key.KeyFormat = unquote(attr.Value)
+		case "KEYFORMATVERSIONS":
+			key.KeyFormatVersions = unquote(attr.Value)
+		}
+	}
+
+	return key, nil
+}
+
+func decodeMap(value string) (*Map, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Map{}
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "URI":
+			m.URI = unquote(attr.Value)
+		case "BYTERANGE":
+			if m.ByteRange, err = parseByteRange(unquote(attr.Value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func decodeDateRange(value string) (DateRange, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return DateRange{}, err
+	}
+
+	var dr DateRange
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "ID":
+			dr.ID = unquote(attr.Value)
+		case "CLASS":
+			dr.Class = unquote(attr.Value)
+		case "START-DATE":
+			if dr.StartDate, err = parseDate(unquote(attr.Value)); err != nil {
+				return dr, err
+			}
+		case "END-DATE":
+			end, err := parseDate(unquote(attr.Value))
+			if err != nil {
+				return dr, err
+			}
+			dr.EndDate = &end
+		case "DURATION":
+			duration, err := parseFloat(attr.Value)
+			if err != nil {
+				return dr, err
+			}
+			dr.Duration = &duration
+		case "PLANNED-DURATION":
+			duration, err := parseFloat(attr.Value)
+			if err != nil {
+				return dr, err
+			}
+			dr.PlannedDuration = &duration
+		case "SCTE35-CMD":
+			dr.SCTE35Cmd = attr.Value
+		case "SCTE35-OUT":
+			dr.SCTE35Out = attr.Value
+		case "SCTE35-IN":
+			dr.SCTE35In = attr.Value
+		case "END-ON-NEXT":
+			dr.EndOnNext = attr.Value == "YES"
+		default:
+			dr.ClientAttributes = append(dr.ClientAttributes, attr)
+		}
+	}
+
+	return dr, nil
+}
+
+func decodeMedia(value string) (Media, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return Media{}, err
+	}
+
+	var media Media
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "TYPE":
+			media.Type = attr.Value
+		case "URI":
+			media.URI = unquote(attr.Value)
+		case "GROUP-ID":
+			media.GroupID = unquote(attr.Value)
+		case "LANGUAGE":
+			media.Language = unquote(attr.Value)
+		case "ASSOC-LANGUAGE":
+			media.AssocLanguage = unquote(attr.Value)
+		case "NAME":
+			media.Name = unquote(attr.Value)
+		case "DEFAULT":
+			media.Default = attr.Value == "YES"
+		case "AUTOSELECT":
+			media.Autoselect = attr.Value == "YES"
+		case "FORCED":
+			media.Forced = attr.Value == "YES"
+		case "INSTREAM-ID":
+			media.InstreamID = unquote(attr.Value)
+		case "CHARACTERISTICS":
+			media.Characteristics = unquote(attr.Value)
+		case "CHANNELS":
+			media.Channels = unquote(attr.Value)
+		}
+	}
+
+	return media, nil
+}
+
+func decodeVariant(value string) (Variant, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return Variant{}, err
+	}
+
+	var variant Variant
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "BANDWIDTH":
+			if variant.Bandwidth, err = parseInt(attr.Value); err != nil {
+				return variant, err
+			}
+		case "AVERAGE-BANDWIDTH":
+			if variant.AverageBandwidth, err = parseInt(attr.Value); err != nil {
+				return variant, err
+			}
+		case "CODECS":
+			variant.Codecs = unquote(attr.Value)
+		case "RESOLUTION":
+			variant.Resolution = attr.Value
+		case "FRAME-RATE":
+			if variant.FrameRate, err = parseFloat(attr.Value); err != nil {
+				return variant, err
+			}
+		case "HDCP-LEVEL":
+			variant.HDCPLevel = attr.Value
+		case "AUDIO":
+			variant.Audio = unquote(attr.Value)
+		case "VIDEO":
+			variant.Video = unquote(attr.Value)
+		case "SUBTITLES":
+			variant.Subtitles = unquote(attr.Value)
+		case "CLOSED-CAPTIONS":
+			variant.ClosedCaptions = unquote(attr.Value)
+		}
+	}
+
+	return variant, nil
+}
+
+func decodeIFrameVariant(value string) (IFrameVariant, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return IFrameVariant{}, err
+	}
+
+	var variant IFrameVariant
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "URI":
+			variant.URI = unquote(attr.Value)
+		case "BANDWIDTH":
+			if variant.Bandwidth, err = parseInt(attr.Value); err != nil {
+				return variant, err
+			}
+		case "AVERAGE-BANDWIDTH":
+			if variant.AverageBandwidth, err = parseInt(attr.Value); err != nil {
+				return variant, err
+			}
+		case "CODECS":
+			variant.Codecs = unquote(attr.Value)
+		case "RESOLUTION":
+			variant.Resolution = attr.Value
+		case "HDCP-LEVEL":
+			variant.HDCPLevel = attr.Value
+		case "VIDEO":
+			variant.Video = unquote(attr.Value)
+		}
+	}
+
+	return variant, nil
+}
+
+func decodeSessionData(value string) (SessionData, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return SessionData{}, err
+	}
+
+	var data SessionData
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "DATA-ID":
+			data.DataID = unquote(attr.Value)
+		case "VALUE":
+			data.Value = unquote(attr.Value)
+		case "URI":
+			data.URI = unquote(attr.Value)
+		case "LANGUAGE":
+			data.Language = unquote(attr.Value)
+		}
+	}
+
+	return data, nil
+}
+
+func decodeServerControl(value string) (*ServerControl, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &ServerControl{}
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "CAN-SKIP-UNTIL":
+			sc.CanSkipUntil, err = parseFloat(attr.Value)
+		case "CAN-SKIP-DATERANGES":
+			sc.CanSkipDateRanges = attr.Value == "YES"
+		case "HOLD-BACK":
+			sc.HoldBack, err = parseFloat(attr.Value)
+		case "PART-HOLD-BACK":
+			sc.PartHoldBack, err = parseFloat(attr.Value)
+		case "CAN-BLOCK-RELOAD":
+			sc.CanBlockReload = attr.Value == "YES"
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sc, nil
+}
+
+func decodeSkip(value string) (*Skip, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := &Skip{}
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "SKIPPED-SEGMENTS":
+			if skip.SkippedSegments, err = strconv.ParseUint(attr.Value, 10, 64); err != nil {
+				return nil, err
+			}
+		case "RECENTLY-REMOVED-DATERANGES":
+			skip.RecentlyRemovedDateRanges = unquote(attr.Value)
+		}
+	}
+
+	return skip, nil
+}
+
+func decodePart(value string) (Part, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return Part{}, err
+	}
+
+	var part Part
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "URI":
+			part.URI = unquote(attr.Value)
+		case "DURATION":
+			part.Duration, err = parseFloat(attr.Value)
+		case "INDEPENDENT":
+			part.Independent = attr.Value == "YES"
+		case "BYTERANGE":
+			part.ByteRange, err = parseByteRange(unquote(attr.Value))
+		case "GAP":
+			part.Gap = attr.Value == "YES"
+		}
+
+		if err != nil {
+			return part, err
+		}
+	}
+
+	return part, nil
+}
+
+func decodePreloadHint(value string) (PreloadHint, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return PreloadHint{}, err
+	}
+
+	var hint PreloadHint
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "TYPE":
+			hint.Type = attr.Value
+		case "URI":
+			hint.URI = unquote(attr.Value)
+		case "BYTERANGE-START":
+			hint.ByteRangeStart, err = parseInt(attr.Value)
+		case "BYTERANGE-LENGTH":
+			hint.ByteRangeLength, err = parseInt(attr.Value)
+		}
+
+		if err != nil {
+			return hint, err
+		}
+	}
+
+	return hint, nil
+}
+
+func decodeRenditionReport(value string) (RenditionReport, error) {
+	attrs, err := parseAttributes(value)
+	if err != nil {
+		return RenditionReport{}, err
+	}
+
+	var report RenditionReport
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "URI":
+			report.URI = unquote(attr.Value)
+		case "LAST-MSN":
+			if report.LastMSN, err = strconv.ParseUint(attr.Value, 10, 64); err != nil {
+				return report, err
+			}
+		case "LAST-PART":
+			part, err := strconv.ParseUint(attr.Value, 10, 64)
+			if err != nil {
+				return report, err
+			}
+			report.LastPart = &part
+		}
+	}
+
+	return report, nil
+}
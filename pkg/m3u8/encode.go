@@ -0,0 +1,277 @@
+package m3u8
+
+import (
+	"bytes"
+	"strconv"
+)
+
+func (p *MasterPlaylist) Encode() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("#EXTM3U\n")
+	writeHeader(&buf, p.Version, p.IndependentSegments, p.Start)
+
+	for _, data := range p.SessionData {
+		aw := &attrWriter{}
+		aw.quoted("DATA-ID", data.DataID)
+		aw.quoted("VALUE", data.Value)
+		aw.quoted("URI", data.URI)
+		aw.quoted("LANGUAGE", data.Language)
+		writeTag(&buf, "#EXT-X-SESSION-DATA", aw.String())
+	}
+
+	for _, key := range p.SessionKeys {
+		writeTag(&buf, "#EXT-X-SESSION-KEY", encodeKey(key))
+	}
+
+	for _, media := range p.Media {
+		aw := &attrWriter{}
+		aw.enum("TYPE", media.Type)
+		aw.quoted("GROUP-ID", media.GroupID)
+		aw.quoted("NAME", media.Name)
+		aw.quoted("LANGUAGE", media.Language)
+		aw.quoted("ASSOC-LANGUAGE", media.AssocLanguage)
+		aw.yes("DEFAULT", media.Default)
+		aw.yes("AUTOSELECT", media.Autoselect)
+		aw.yes("FORCED", media.Forced)
+		aw.quoted("INSTREAM-ID", media.InstreamID)
+		aw.quoted("CHARACTERISTICS", media.Characteristics)
+		aw.quoted("CHANNELS", media.Channels)
+		aw.quoted("URI", media.URI)
+		writeTag(&buf, "#EXT-X-MEDIA", aw.String())
+	}
+
+	for _, variant := range p.Variants {
+		aw := &attrWriter{}
+		aw.integer("BANDWIDTH", variant.Bandwidth)
+		aw.integer("AVERAGE-BANDWIDTH", variant.AverageBandwidth)
+		aw.quoted("CODECS", variant.Codecs)
+		aw.enum("RESOLUTION", variant.Resolution)
+		aw.float("FRAME-RATE", variant.FrameRate)
+		aw.enum("HDCP-LEVEL", variant.HDCPLevel)
+		aw.quoted("AUDIO", variant.Audio)
+		aw.quoted("VIDEO", variant.Video)
+		aw.quoted("SUBTITLES", variant.Subtitles)
+		// NONE is an enumerated string, group ids are quoted
+		if variant.ClosedCaptions == "NONE" {
+			aw.enum("CLOSED-CAPTIONS", variant.ClosedCaptions)
+		} else {
+			aw.quoted("CLOSED-CAPTIONS", variant.ClosedCaptions)
+		}
+		writeTag(&buf, "#EXT-X-STREAM-INF", aw.String())
+		buf.WriteString(variant.URI + "\n")
+	}
+
+	for _, variant := range p.IFrameVariants {
+		aw := &attrWriter{}
+		aw.integer("BANDWIDTH", variant.Bandwidth)
+		aw.integer("AVERAGE-BANDWIDTH", variant.AverageBandwidth)
+		aw.quoted("CODECS", variant.Codecs)
+		aw.enum("RESOLUTION", variant.Resolution)
+		aw.enum("HDCP-LEVEL", variant.HDCPLevel)
+		aw.quoted("VIDEO", variant.Video)
+		aw.quoted("URI", variant.URI)
+		writeTag(&buf, "#EXT-X-I-FRAME-STREAM-INF", aw.String())
+	}
+
+	for _, line := range p.Unknown {
+		buf.WriteString(line + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+func (p *MediaPlaylist) Encode() []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("#EXTM3U\n")
+	writeHeader(&buf, p.Version, p.IndependentSegments, p.Start)
+
+	writeTag(&buf, "#EXT-X-TARGETDURATION", strconv.Itoa(p.TargetDuration))
+	if p.ServerControl != nil {
+		aw := &attrWriter{}
+		aw.float("CAN-SKIP-UNTIL", p.ServerControl.CanSkipUntil)
+		aw.yes("CAN-SKIP-DATERANGES", p.ServerControl.CanSkipDateRanges)
+		aw.float("HOLD-BACK", p.ServerControl.HoldBack)
+		aw.float("PART-HOLD-BACK", p.ServerControl.PartHoldBack)
+		aw.yes("CAN-BLOCK-RELOAD", p.ServerControl.CanBlockReload)
+		writeTag(&buf, "#EXT-X-SERVER-CONTROL", aw.String())
+	}
+	if p.PartInf != nil {
+		writeTag(&buf, "#EXT-X-PART-INF", "PART-TARGET="+formatFloat(p.PartInf.PartTarget))
+	}
+	if p.MediaSequence != 0 {
+		writeTag(&buf, "#EXT-X-MEDIA-SEQUENCE", strconv.FormatUint(p.MediaSequence, 10))
+	}
+	if p.DiscontinuitySequence != 0 {
+		writeTag(&buf, "#EXT-X-DISCONTINUITY-SEQUENCE", strconv.FormatUint(p.DiscontinuitySequence, 10))
+	}
+	if p.PlaylistType != "" {
+		writeTag(&buf, "#EXT-X-PLAYLIST-TYPE", p.PlaylistType)
+	}
+	if p.IFramesOnly {
+		buf.WriteString("#EXT-X-I-FRAMES-ONLY\n")
+	}
+
+	if p.Skip != nil {
+		aw := &attrWriter{}
+		aw.raw("SKIPPED-SEGMENTS", strconv.FormatUint(p.Skip.SkippedSegments, 10))
+		aw.quoted("RECENTLY-REMOVED-DATERANGES", p.Skip.RecentlyRemovedDateRanges)
+		writeTag(&buf, "#EXT-X-SKIP", aw.String())
+	}
+
+	for _, line := range p.HeaderUnknown {
+		buf.WriteString(line + "\n")
+	}
+
+	for _, segment := range p.Segments {
+		encodeSegment(&buf, segment)
+	}
+
+	for _, part := range p.Parts {
+		writeTag(&buf, "#EXT-X-PART", encodePart(part))
+	}
+
+	for _, line := range p.Unknown {
+		buf.WriteString(line + "\n")
+	}
+
+	for _, hint := range p.PreloadHints {
+		aw := &attrWriter{}
+		aw.enum("TYPE", hint.Type)
+		aw.quoted("URI", hint.URI)
+		aw.integer("BYTERANGE-START", hint.ByteRangeStart)
+		aw.integer("BYTERANGE-LENGTH", hint.ByteRangeLength)
+		writeTag(&buf, "#EXT-X-PRELOAD-HINT", aw.String())
+	}
+
+	for _, report := range p.RenditionReports {
+		aw := &attrWriter{}
+		aw.quoted("URI", report.URI)
+		aw.raw("LAST-MSN", strconv.FormatUint(report.LastMSN, 10))
+		if report.LastPart != nil {
+			aw.raw("LAST-PART", strconv.FormatUint(*report.LastPart, 10))
+		}
+		writeTag(&buf, "#EXT-X-RENDITION-REPORT", aw.String())
+	}
+
+	if p.EndList {
+		buf.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	return buf.Bytes()
+}
+
+func encodeSegment(buf *bytes.Buffer, segment Segment) {
+	if segment.Discontinuity {
+		buf.WriteString("#EXT-X-DISCONTINUITY\n")
+	}
+
+	for _, key := range segment.Keys {
+		writeTag(buf, "#EXT-X-KEY", encodeKey(key))
+	}
+
+	if segment.Map != nil {
+		aw := &attrWriter{}
+		aw.quoted("URI", segment.Map.URI)
+		if segment.Map.ByteRange != nil {
+			aw.quoted("BYTERANGE", segment.Map.ByteRange.String())
+		}
+		writeTag(buf, "#EXT-X-MAP", aw.String())
+	}
+
+	if !segment.ProgramDateTime.IsZero() {
+		writeTag(buf, "#EXT-X-PROGRAM-DATE-TIME", formatDate(segment.ProgramDateTime))
+	}
+
+	for _, dr := range segment.DateRanges {
+		writeTag(buf, "#EXT-X-DATERANGE", encodeDateRange(dr))
+	}
+
+	for _, part := range segment.Parts {
+		writeTag(buf, "#EXT-X-PART", encodePart(part))
+	}
+
+	writeTag(buf, "#EXTINF", formatFloat(segment.Duration)+","+segment.Title)
+
+	if segment.ByteRange != nil {
+		writeTag(buf, "#EXT-X-BYTERANGE", segment.ByteRange.String())
+	}
+
+	// after EXTINF, so that the tags aren't taken for the playlist ones
+	for _, line := range segment.Unknown {
+		buf.WriteString(line + "\n")
+	}
+
+	buf.WriteString(segment.URI + "\n")
+}
+
+func encodePart(part Part) string {
+	aw := &attrWriter{}
+	aw.raw("DURATION", formatFloat(part.Duration))
+	aw.quoted("URI", part.URI)
+	aw.yes("INDEPENDENT", part.Independent)
+	if part.ByteRange != nil {
+		aw.quoted("BYTERANGE", part.ByteRange.String())
+	}
+	aw.yes("GAP", part.Gap)
+	return aw.String()
+}
+
+func encodeKey(key Key) string {
+	aw := &attrWriter{}
+	aw.enum("METHOD", key.Method)
+	aw.quoted("URI", key.URI)
+	aw.enum("IV", key.IV)
+	aw.quoted("KEYFORMAT", key.KeyFormat)
+	aw.quoted("KEYFORMATVERSIONS", key.KeyFormatVersions)
+	return aw.String()
+}
+
+func encodeDateRange(dr DateRange) string {
+	aw := &attrWriter{}
+	aw.quoted("ID", dr.ID)
+	aw.quoted("CLASS", dr.Class)
+	aw.quoted("START-DATE", formatDate(dr.StartDate))
+	if dr.EndDate != nil {
+		aw.quoted("END-DATE", formatDate(*dr.EndDate))
+	}
+	if dr.Duration != nil {
+		aw.raw("DURATION", formatFloat(*dr.Duration))
+	}
+	if dr.PlannedDuration != nil {
+		aw.raw("PLANNED-DURATION", formatFloat(*dr.PlannedDuration))
+	}
+	for _, attr := range dr.ClientAttributes {
+		aw.raw(attr.Key, attr.Value)
+	}
+	aw.enum("SCTE35-CMD", dr.SCTE35Cmd)
+	aw.enum("SCTE35-OUT", dr.SCTE35Out)
+	aw.enum("SCTE35-IN", dr.SCTE35In)
+	aw.yes("END-ON-NEXT", dr.EndOnNext)
+	return aw.String()
+}
+
+func writeHeader(buf *bytes.Buffer, version int, independent bool, start *Start) {
+	if version != 0 {
+		writeTag(buf, "#EXT-X-VERSION", strconv.Itoa(version))
+	}
+
+	if independent {
+		buf.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	}
+
+	if start != nil {
+		aw := &attrWriter{}
+		aw.raw("TIME-OFFSET", formatFloat(start.TimeOffset))
+		aw.yes("PRECISE", start.Precise)
+		writeTag(buf, "#EXT-X-START", aw.String())
+	}
+}
+
+func writeTag(buf *bytes.Buffer, tag, value string) {
+	buf.WriteString(tag)
+	buf.WriteByte(':')
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,27 @@
+package m3u8
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMissingHeader   = errors.New("playlist doesn't start with #EXTM3U")
+	ErrMixedPlaylist   = errors.New("playlist contains both master and media tags")
+	ErrMissingURI      = errors.New("tag is not followed by an uri")
+	ErrMissingDuration = errors.New("media playlist doesn't specify target duration")
+	ErrTargetDuration  = errors.New("segment is longer than target duration")
+	ErrMissingPartInf  = errors.New("media playlist contains parts, but doesn't specify part target")
+	ErrPartTarget      = errors.New("part is longer than part target duration")
+	ErrNotMedia        = errors.New("playlist is not a media playlist")
+	ErrNotMaster       = errors.New("playlist is not a master playlist")
+)
+
+// error, bound to a certain line of the playlist
+type SyntaxError struct {
+	Line int
+	Err  error
+}
+
+func (se *SyntaxError) Error() string { return fmt.Sprintf("m3u8: line %d: %v", se.Line, se.Err) }
+func (se *SyntaxError) Unwrap() error { return se.Err }
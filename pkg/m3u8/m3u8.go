@@ -0,0 +1,239 @@
+// Package m3u8 decodes and encodes HLS playlists (RFC 8216).
+//
+// Every tag defined by the RFC has a typed representation. Tags the package
+// doesn't know about are kept verbatim, so that decoding and encoding a
+// playlist doesn't lose any information.
+package m3u8
+
+import "time"
+
+type ListType int
+
+const (
+	MASTER ListType = iota
+	MEDIA
+)
+
+// either *MasterPlaylist or *MediaPlaylist
+type Playlist interface {
+	Type() ListType
+	Encode() []byte
+}
+
+// playlist, listing variant streams of the presentation
+type MasterPlaylist struct {
+	Version             int
+	IndependentSegments bool
+	Start               *Start
+
+	SessionData    []SessionData
+	SessionKeys    []Key
+	Media          []Media
+	Variants       []Variant
+	IFrameVariants []IFrameVariant
+
+	// tags, not defined by the RFC (written after the known ones)
+	Unknown []string
+}
+
+// playlist, listing media segments of a single rendition
+type MediaPlaylist struct {
+	Version               int
+	TargetDuration        int
+	MediaSequence         uint64
+	DiscontinuitySequence uint64
+	// VOD / EVENT, empty if not specified
+	PlaylistType        string
+	IFramesOnly         bool
+	IndependentSegments bool
+	Start               *Start
+
+	// low-latency extensions
+	ServerControl *ServerControl
+	PartInf       *PartInf
+	Skip          *Skip
+
+	Segments []Segment
+	// partial segments of the segment, which is not finished yet
+	Parts            []Part
+	PreloadHints     []PreloadHint
+	RenditionReports []RenditionReport
+	EndList          bool
+
+	// tags, not defined by the RFC, which don't precede any segment
+	Unknown []string
+	// tags, not defined by the RFC, among the playlist tags (written before the segments)
+	HeaderUnknown []string
+}
+
+func (*MasterPlaylist) Type() ListType { return MASTER }
+func (*MediaPlaylist) Type() ListType  { return MEDIA }
+
+type Segment struct {
+	URI      string
+	Duration float64
+	Title    string
+
+	ByteRange     *ByteRange
+	Discontinuity bool
+	// keys, which take effect starting with this segment
+	Keys []Key
+	// media initialization section, which takes effect starting with this segment
+	Map             *Map
+	ProgramDateTime time.Time
+	DateRanges      []DateRange
+	// partial segments, the segment consists of
+	Parts []Part
+
+	// tags, not defined by the RFC, preceding the segment uri
+	Unknown []string
+}
+
+// EXT-X-BYTERANGE / BYTERANGE attribute
+type ByteRange struct {
+	Length int64
+	// nil, if sub-range starts right after the previous one
+	Offset *int64
+}
+
+// EXT-X-KEY / EXT-X-SESSION-KEY
+type Key struct {
+	// NONE, AES-128, SAMPLE-AES (and SAMPLE-AES-CTR used for cenc)
+	Method            string
+	URI               string
+	IV                string
+	KeyFormat         string
+	KeyFormatVersions string
+}
+
+// EXT-X-MAP
+type Map struct {
+	URI       string
+	ByteRange *ByteRange
+}
+
+// EXT-X-DATERANGE
+type DateRange struct {
+	ID              string
+	Class           string
+	StartDate       time.Time
+	EndDate         *time.Time
+	Duration        *float64
+	PlannedDuration *float64
+	SCTE35Cmd       string
+	SCTE35Out       string
+	SCTE35In        string
+	EndOnNext       bool
+	// X-<client-attribute> values in their original (possibly quoted) form
+	ClientAttributes []Attribute
+}
+
+// EXT-X-START
+type Start struct {
+	TimeOffset float64
+	Precise    bool
+}
+
+// EXT-X-MEDIA
+type Media struct {
+	// AUDIO, VIDEO, SUBTITLES, CLOSED-CAPTIONS
+	Type            string
+	URI             string
+	GroupID         string
+	Language        string
+	AssocLanguage   string
+	Name            string
+	Default         bool
+	Autoselect      bool
+	Forced          bool
+	InstreamID      string
+	Characteristics string
+	Channels        string
+}
+
+// EXT-X-STREAM-INF + uri
+type Variant struct {
+	URI              string
+	Bandwidth        int64
+	AverageBandwidth int64
+	Codecs           string
+	// WIDTHxHEIGHT
+	Resolution string
+	FrameRate  float64
+	HDCPLevel  string
+	Audio      string
+	Video      string
+	Subtitles  string
+	// group id, or NONE
+	ClosedCaptions string
+}
+
+// EXT-X-I-FRAME-STREAM-INF
+type IFrameVariant struct {
+	URI              string
+	Bandwidth        int64
+	AverageBandwidth int64
+	Codecs           string
+	Resolution       string
+	HDCPLevel        string
+	Video            string
+}
+
+// EXT-X-SESSION-DATA
+type SessionData struct {
+	DataID   string
+	Value    string
+	URI      string
+	Language string
+}
+
+// EXT-X-PART
+type Part struct {
+	URI         string
+	Duration    float64
+	Independent bool
+	ByteRange   *ByteRange
+	Gap         bool
+}
+
+// EXT-X-PART-INF
+type PartInf struct {
+	PartTarget float64
+}
+
+// EXT-X-SERVER-CONTROL
+type ServerControl struct {
+	CanSkipUntil      float64
+	CanSkipDateRanges bool
+	HoldBack          float64
+	PartHoldBack      float64
+	CanBlockReload    bool
+}
+
+// EXT-X-SKIP
+type Skip struct {
+	SkippedSegments           uint64
+	RecentlyRemovedDateRanges string
+}
+
+// EXT-X-PRELOAD-HINT
+type PreloadHint struct {
+	// PART / MAP
+	Type            string
+	URI             string
+	ByteRangeStart  int64
+	ByteRangeLength int64
+}
+
+// EXT-X-RENDITION-REPORT
+type RenditionReport struct {
+	URI      string
+	LastMSN  uint64
+	LastPart *uint64
+}
+
+// single entry of an attribute list
+type Attribute struct {
+	Key   string
+	Value string
+}
@@ -0,0 +1,240 @@
+package m3u8
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// playlists in canonical form, which should be encoded byte for byte
+var canonical = map[string]string{
+	"media": `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-START:TIME-OFFSET=-12.5,PRECISE=YES
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:42
+#EXT-X-DISCONTINUITY-SEQUENCE:3
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-KEY:METHOD=SAMPLE-AES-CTR,URI="https://example.com/license",KEYFORMAT="org.w3.clearkey",KEYFORMATVERSIONS="1"
+#EXT-X-MAP:URI="video_init.m4s"
+#EXT-X-PROGRAM-DATE-TIME:2024-10-01T12:00:00.5Z
+#EXTINF:5.005,first segment
+video_0001.m4s
+#EXTINF:6,
+#EXT-X-BYTERANGE:1024@2048
+video_0002.m4s
+#EXT-X-DISCONTINUITY
+#EXT-X-KEY:METHOD=NONE
+#EXT-X-MAP:URI="other_init.m4s",BYTERANGE="720@0"
+#EXT-X-DATERANGE:ID="ad-1",CLASS="com.example.ad",START-DATE="2024-10-01T12:00:11Z",DURATION=30,X-AD-ID="1234",SCTE35-OUT=0xFC002F,END-ON-NEXT=YES
+#EXTINF:4.2,
+#EXT-X-BYTERANGE:512
+other_0001.m4s
+#EXT-X-CUSTOM-TAG:foo
+#EXT-X-ENDLIST
+`,
+	"low-latency": `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:CAN-SKIP-UNTIL=24,HOLD-BACK=12,PART-HOLD-BACK=3,CAN-BLOCK-RELOAD=YES
+#EXT-X-PART-INF:PART-TARGET=1.004
+#EXT-X-MEDIA-SEQUENCE:266
+#EXT-X-SKIP:SKIPPED-SEGMENTS=3
+#EXTINF:4,
+live_000266.ts
+#EXT-X-PART:DURATION=1,URI="live_000267.0.ts",INDEPENDENT=YES
+#EXT-X-PART:DURATION=1,URI="live_000267.1.ts"
+#EXT-X-PART:DURATION=1,URI="live_000267.2.ts",BYTERANGE="1024@0",GAP=YES
+#EXT-X-PART:DURATION=1,URI="live_000267.3.ts"
+#EXTINF:4,
+live_000267.ts
+#EXT-X-PART:DURATION=1,URI="live_000268.0.ts",INDEPENDENT=YES
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="live_000268.1.ts"
+#EXT-X-RENDITION-REPORT:URI="../1M/live.m3u8",LAST-MSN=268,LAST-PART=0
+`,
+	"master": `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-SESSION-DATA:DATA-ID="com.example.title",VALUE="Big, Buck Bunny",LANGUAGE="en"
+#EXT-X-SESSION-KEY:METHOD=SAMPLE-AES,URI="skd://key",KEYFORMAT="com.apple.streamingkeydelivery",KEYFORMATVERSIONS="1"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,CHANNELS="2",URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="Deutsch",LANGUAGE="de",FORCED=YES,CHARACTERISTICS="public.accessibility.transcribes-spoken-dialog",URI="subs/de.m3u8"
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="CC1",INSTREAM-ID="CC1"
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,AVERAGE-BANDWIDTH=4500000,CODECS="avc1.640028,mp4a.40.2",RESOLUTION=1920x1080,FRAME-RATE=29.97,HDCP-LEVEL=TYPE-0,AUDIO="aac",SUBTITLES="subs",CLOSED-CAPTIONS="cc"
+1080p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=800000,CODECS="avc1.4d401e,mp4a.40.2",RESOLUTION=640x360,AUDIO="aac",CLOSED-CAPTIONS=NONE
+360p.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=300000,CODECS="avc1.640028",RESOLUTION=1920x1080,URI="1080p_iframes.m3u8"
+#EXT-X-UNKNOWN-MASTER-TAG
+`,
+}
+
+// ffmpeg segment muxer output
+const ffmpegPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-ALLOW-CACHE:YES
+#EXT-X-TARGETDURATION:3
+#EXTINF:2.002000,
+video_0000.ts
+#EXTINF:2.502500,
+video_0001.ts
+#EXTINF:1.001000,
+video_0002.ts
+#EXT-X-ENDLIST
+`
+
+func TestCanonicalRoundTrip(t *testing.T) {
+	for name, src := range canonical {
+		t.Run(name, func(t *testing.T) {
+			pl, err := Decode([]byte(src))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			if got := string(pl.Encode()); got != src {
+				t.Errorf("round trip mismatch\n--- got\n%v\n--- want\n%v", got, src)
+			}
+		})
+	}
+}
+
+func TestSemanticRoundTrip(t *testing.T) {
+	first, err := DecodeMedia([]byte(ffmpegPlaylist))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	second, err := DecodeMedia(first.Encode())
+	if err != nil {
+		t.Fatalf("decode encoded: %v", err)
+	}
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("playlists differ after round trip\n%+v\n%+v", first, second)
+	}
+
+	if len(first.Segments) != 3 || !first.EndList || first.TargetDuration != 3 {
+		t.Errorf("unexpected playlist: %+v", first)
+	}
+
+	// unknown tags are kept along with the playlist tags
+	if want := []string{"#EXT-X-ALLOW-CACHE:YES"}; !reflect.DeepEqual(first.HeaderUnknown, want) || first.Segments[0].Unknown != nil {
+		t.Errorf("unknown tags: got %v and %v, want %v", first.HeaderUnknown, first.Segments[0].Unknown, want)
+	}
+
+	if err := first.Validate(); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+}
+
+func TestUnknownPlacement(t *testing.T) {
+	src := "#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-HEADER\n#EXT-X-PROGRAM-DATE-TIME:2024-10-01T12:00:00Z\n#EXT-X-SEGMENT\n#EXTINF:2,\na.ts\n#EXT-X-TRAILER\n"
+
+	first, err := DecodeMedia([]byte(src))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	second, err := DecodeMedia(first.Encode())
+	if err != nil {
+		t.Fatalf("decode encoded: %v", err)
+	}
+
+	for _, pl := range []*MediaPlaylist{first, second} {
+		if want := []string{"#EXT-X-HEADER"}; !reflect.DeepEqual(pl.HeaderUnknown, want) {
+			t.Errorf("header tags: got %v, want %v", pl.HeaderUnknown, want)
+		}
+		if want := []string{"#EXT-X-SEGMENT"}; !reflect.DeepEqual(pl.Segments[0].Unknown, want) {
+			t.Errorf("segment tags: got %v, want %v", pl.Segments[0].Unknown, want)
+		}
+		if want := []string{"#EXT-X-TRAILER"}; !reflect.DeepEqual(pl.Unknown, want) {
+			t.Errorf("trailing tags: got %v, want %v", pl.Unknown, want)
+		}
+	}
+}
+
+func TestDecodeTypes(t *testing.T) {
+	if _, err := DecodeMaster([]byte(canonical["master"])); err != nil {
+		t.Errorf("master: %v", err)
+	}
+
+	if _, err := DecodeMaster([]byte(canonical["media"])); !errors.Is(err, ErrNotMaster) {
+		t.Errorf("media as master: got %v, want %v", err, ErrNotMaster)
+	}
+
+	if _, err := DecodeMedia([]byte(canonical["master"])); !errors.Is(err, ErrNotMedia) {
+		t.Errorf("master as media: got %v, want %v", err, ErrNotMedia)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := map[string]struct {
+		src string
+		err error
+	}{
+		"empty":          {"", ErrMissingHeader},
+		"no header":      {"#EXT-X-VERSION:3\n", ErrMissingHeader},
+		"dangling inf":   {"#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXTINF:2,\n", ErrMissingURI},
+		"dangling map":   {"#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-MAP:URI=\"init.mp4\"\n", ErrMissingURI},
+		"dangling steam": {"#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n", ErrMissingURI},
+		"mixed":          {"#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-STREAM-INF:BANDWIDTH=1\na.m3u8\n", ErrMixedPlaylist},
+		"inner quote":    {"#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-PART:DURATION=1,URI=0\"0\n", errAttributeList},
+		"blank value":    {"#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-PRELOAD-HINT:TYPE= ,URI=\"a.mp4\"\n", errAttributeList},
+		"empty value":    {"#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-PART:DURATION=,URI=\"a.mp4\"\n", errAttributeList},
+		"lowercase name": {"#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-PART:duration=1,URI=\"a.mp4\"\n", errAttributeList},
+		"empty name":     {"#EXTM3U\n#EXT-X-STREAM-INF:=1\na.m3u8\n", errAttributeList},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decode([]byte(tc.src)); !errors.Is(err, tc.err) {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+// playlists, accepted by the decoder, should survive encoding
+func FuzzDecode(f *testing.F) {
+	for _, src := range canonical {
+		f.Add(src)
+	}
+	f.Add(ffmpegPlaylist)
+
+	f.Fuzz(func(t *testing.T, src string) {
+		first, err := Decode([]byte(src))
+		if err != nil {
+			return
+		}
+
+		encoded := first.Encode()
+		second, err := Decode(encoded)
+		if err != nil {
+			t.Fatalf("decoding the encoded playlist: %v\n%s", err, encoded)
+		}
+
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("playlist changed:\n%#v\n%#v", first, second)
+		}
+		if reencoded := second.Encode(); string(reencoded) != string(encoded) {
+			t.Errorf("encoding changed:\n%s\n%s", encoded, reencoded)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	pl := &MediaPlaylist{
+		TargetDuration: 2,
+		Segments:       []Segment{{URI: "a.ts", Duration: 2.4}, {URI: "b.ts", Duration: 2.6}},
+	}
+
+	if err := pl.Validate(); !errors.Is(err, ErrTargetDuration) {
+		t.Errorf("got %v, want %v", err, ErrTargetDuration)
+	}
+
+	pl.TargetDuration = 0
+	if err := pl.Validate(); !errors.Is(err, ErrMissingDuration) {
+		t.Errorf("got %v, want %v", err, ErrMissingDuration)
+	}
+}
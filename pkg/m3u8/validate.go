@@ -0,0 +1,53 @@
+package m3u8
+
+import (
+	"fmt"
+	"math"
+)
+
+// checks media playlist against the constraints of RFC 8216
+func (p *MediaPlaylist) Validate() error {
+	if p.TargetDuration <= 0 {
+		return ErrMissingDuration
+	}
+
+	for i, segment := range p.Segments {
+		if segment.URI == "" {
+			return fmt.Errorf("segment %d: %w", i, ErrMissingURI)
+		}
+
+		// rounded segment duration must not exceed the target duration
+		if int(math.Round(segment.Duration)) > p.TargetDuration {
+			return fmt.Errorf("segment %d (%v): %w", i, segment.URI, ErrTargetDuration)
+		}
+
+		if err := p.validateParts(segment.Parts); err != nil {
+			return fmt.Errorf("segment %d (%v): %w", i, segment.URI, err)
+		}
+	}
+
+	return p.validateParts(p.Parts)
+}
+
+// parts must not exceed the part target duration
+func (p *MediaPlaylist) validateParts(parts []Part) error {
+	if len(parts) == 0 {
+		return nil
+	}
+
+	if p.PartInf == nil {
+		return ErrMissingPartInf
+	}
+
+	for _, part := range parts {
+		if part.URI == "" {
+			return ErrMissingURI
+		}
+
+		if part.Duration > p.PartInf.PartTarget {
+			return fmt.Errorf("part %v: %w", part.URI, ErrPartTarget)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+)
+
+// amf0 type markers
+const (
+	amfNumber      = 0x00
+	amfBoolean     = 0x01
+	amfString      = 0x02
+	amfObject      = 0x03
+	amfNull        = 0x05
+	amfUndefined   = 0x06
+	amfECMAArray   = 0x08
+	amfObjectEnd   = 0x09
+	amfStrictArray = 0x0A
+	amfDate        = 0x0B
+	amfLongString  = 0x0C
+)
+
+// nesting of objects and arrays, accepted from the clients
+const maxAMFDepth = 32
+
+var (
+	errAMFType  = errors.New("rtmp: unsupported amf0 type")
+	errAMFDepth = errors.New("rtmp: amf0 values are nested too deep")
+)
+
+// decodes all the amf0 values of the payload
+// numbers are decoded as float64, objects and ecma arrays as map[string]any
+func decodeAMF(payload []byte) ([]any, error) {
+	r := bytes.NewReader(payload)
+
+	var values []any
+	for r.Len() > 0 {
+		value, err := decodeAMFValue(r, 0)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func decodeAMFValue(r *bytes.Reader, depth int) (any, error) {
+	if depth > maxAMFDepth {
+		return nil, errAMFDepth
+	}
+
+	marker, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch marker {
+	case amfNumber:
+		var bits uint64
+		if err := binary.Read(r, binary.BigEndian, &bits); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(bits), nil
+	case amfBoolean:
+		b, err := r.ReadByte()
+		return b != 0, err
+	case amfString:
+		return decodeAMFString(r)
+	case amfLongString:
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		// length is declared by the client, the payload tells how much there really is
+		if int64(length) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		buf := make([]byte, length)
+		_, err := io.ReadFull(r, buf)
+		return string(buf), err
+	case amfObject:
+		return decodeAMFObject(r, depth)
+	case amfECMAArray:
+		// approximate element count, the array is terminated like an object
+		if _, err := r.Seek(4, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		return decodeAMFObject(r, depth)
+	case amfStrictArray:
+		var count uint32
+		if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+			return nil, err
+		}
+		// every element takes at least a byte
+		if int64(count) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		values := make([]any, 0, count)
+		for i := uint32(0); i < count; i++ {
+			value, err := decodeAMFValue(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case amfDate:
+		// float64 timestamp + int16 timezone
+		var bits uint64
+		if err := binary.Read(r, binary.BigEndian, &bits); err != nil {
+			return nil, err
+		}
+		_, err := r.Seek(2, io.SeekCurrent)
+		return math.Float64frombits(bits), err
+	case amfNull, amfUndefined:
+		return nil, nil
+	default:
+		return nil, errAMFType
+	}
+}
+
+func decodeAMFString(r *bytes.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, length)
+	_, err := io.ReadFull(r, buf)
+	return string(buf), err
+}
+
+func decodeAMFObject(r *bytes.Reader, depth int) (map[string]any, error) {
+	obj := make(map[string]any)
+
+	for {
+		key, err := decodeAMFString(r)
+		if err != nil {
+			return nil, err
+		}
+
+		// empty key followed by the end marker terminates the object
+		if key == "" {
+			marker, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if marker == amfObjectEnd {
+				return obj, nil
+			}
+			if err := r.UnreadByte(); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := decodeAMFValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = value
+	}
+}
+
+// encodes values into amf0
+// supported types: float64, int, bool, string, map[string]any and nil
+func encodeAMF(values ...any) []byte {
+	var buf bytes.Buffer
+	for _, value := range values {
+		encodeAMFValue(&buf, value)
+	}
+	return buf.Bytes()
+}
+
+func encodeAMFValue(buf *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case float64:
+		buf.WriteByte(amfNumber)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case int:
+		encodeAMFValue(buf, float64(v))
+	case bool:
+		buf.WriteByte(amfBoolean)
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case string:
+		buf.WriteByte(amfString)
+		encodeAMFString(buf, v)
+	case map[string]any:
+		buf.WriteByte(amfObject)
+
+		// keeping the output deterministic
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			encodeAMFString(buf, key)
+			encodeAMFValue(buf, v[key])
+		}
+		buf.Write([]byte{0x00, 0x00, amfObjectEnd})
+	default:
+		buf.WriteByte(amfNull)
+	}
+}
+
+func encodeAMFString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
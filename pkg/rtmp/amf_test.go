@@ -0,0 +1,109 @@
+package rtmp
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestAMFRoundTrip(t *testing.T) {
+	values := []any{
+		"connect",
+		1.0,
+		map[string]any{
+			"app":      "live",
+			"tcUrl":    "rtmp://localhost/live",
+			"fpad":     false,
+			"audio":    3191.0,
+			"nested":   map[string]any{"level": "status"},
+			"optional": nil,
+		},
+		nil,
+		true,
+	}
+
+	decoded, err := decodeAMF(encodeAMF(values...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, values) {
+		t.Errorf("got %#v, want %#v", decoded, values)
+	}
+}
+
+func TestAMFDecodeTypes(t *testing.T) {
+	payloads := map[string]struct {
+		payload []byte
+		want    any
+	}{
+		"ecma array": {
+			[]byte{amfECMAArray, 0, 0, 0, 1, 0, 5, 'w', 'i', 'd', 't', 'h', amfNumber, 0x40, 0x9E, 0, 0, 0, 0, 0, 0, 0, 0, amfObjectEnd},
+			map[string]any{"width": 1920.0},
+		},
+		"strict array": {
+			[]byte{amfStrictArray, 0, 0, 0, 2, amfBoolean, 1, amfNull},
+			[]any{true, nil},
+		},
+		"long string": {
+			[]byte{amfLongString, 0, 0, 0, 3, 'k', 'e', 'y'},
+			"key",
+		},
+		"date": {
+			[]byte{amfDate, 0x3F, 0xF0, 0, 0, 0, 0, 0, 0, 0, 0},
+			1.0,
+		},
+		"undefined": {
+			[]byte{amfUndefined},
+			nil,
+		},
+		// key, starting like the end of the object
+		"empty key": {
+			[]byte{amfObject, 0, 0, amfString, 0, 1, 'v', 0, 0, amfObjectEnd},
+			map[string]any{"": "v"},
+		},
+	}
+
+	for name, tc := range payloads {
+		values, err := decodeAMF(tc.payload)
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+			continue
+		}
+
+		if len(values) != 1 || !reflect.DeepEqual(values[0], tc.want) {
+			t.Errorf("%v: got %#v, want %#v", name, values, tc.want)
+		}
+	}
+}
+
+func TestAMFDecodeErrors(t *testing.T) {
+	// arrays of a single array each
+	var nested []byte
+	for i := 0; i < 1000; i++ {
+		nested = append(nested, amfStrictArray, 0, 0, 0, 1)
+	}
+
+	payloads := map[string]struct {
+		payload []byte
+		err     error
+	}{
+		"unsupported type":   {[]byte{0x10}, errAMFType},
+		"truncated number":   {[]byte{amfNumber, 0x40}, io.ErrUnexpectedEOF},
+		"truncated string":   {[]byte{amfString, 0, 5, 'a'}, io.ErrUnexpectedEOF},
+		"unterminated":       {[]byte{amfObject, 0, 1, 'k', amfNull}, io.EOF},
+		"truncated array":    {[]byte{amfStrictArray, 0, 0, 0, 2, amfNull}, io.ErrUnexpectedEOF},
+		"oversized array":    {[]byte{amfStrictArray, 0xFF, 0xFF, 0xFF, 0xFF, amfNull}, io.ErrUnexpectedEOF},
+		"oversized lstring":  {[]byte{amfLongString, 0xFF, 0xFF, 0xFF, 0xFF, 'a'}, io.ErrUnexpectedEOF},
+		"truncated boolean":  {[]byte{amfBoolean}, io.EOF},
+		"truncated ecma len": {[]byte{amfECMAArray, 0}, io.EOF},
+		"nested too deep":    {append(nested, amfNull), errAMFDepth},
+	}
+
+	for name, tc := range payloads {
+		if _, err := decodeAMF(tc.payload); !errors.Is(err, tc.err) {
+			t.Errorf("%v: got %v, want %v", name, err, tc.err)
+		}
+	}
+}
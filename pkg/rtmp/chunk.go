@@ -0,0 +1,291 @@
+package rtmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// rtmp message types
+const (
+	msgSetChunkSize     = 1
+	msgAbort            = 2
+	msgAck              = 3
+	msgUserControl      = 4
+	msgWindowAckSize    = 5
+	msgSetPeerBandwidth = 6
+	msgAudio            = 8
+	msgVideo            = 9
+	msgDataAMF0         = 18
+	msgCommandAMF0      = 20
+)
+
+const (
+	defaultChunkSize = 128
+	// chunk size, announced to the clients
+	outChunkSize = 4096
+	// largest chunk size, accepted from the clients
+	maxChunkSize = 1 << 24
+	// largest message, accepted from the clients
+	maxMessageSize = 16 << 20
+	// chunk streams, a client may open (encoders use a handful of them)
+	maxChunkStreams = 32
+	// payloads are read in pieces of this size at most,
+	// so that memory is only taken by the data, which has actually arrived
+	readPieceSize     = 64 << 10
+	extendedTimestamp = 0xFFFFFF
+)
+
+var (
+	errChunkSize    = errors.New("rtmp: invalid chunk size")
+	errMessageSize  = errors.New("rtmp: message is too large")
+	errChunkHeader  = errors.New("rtmp: chunk continues unknown message")
+	errChunkStreams = errors.New("rtmp: too many chunk streams")
+)
+
+type message struct {
+	typeID    uint8
+	streamID  uint32
+	timestamp uint32
+	payload   []byte
+}
+
+// state of a single chunk stream
+type chunkStream struct {
+	timestamp uint32
+	delta     uint32
+	length    uint32
+	typeID    uint8
+	streamID  uint32
+	// previous header carried extended timestamp
+	extended bool
+	// payload of the message being assembled
+	buf    []byte
+	active bool
+}
+
+// reads messages, split into chunks
+type chunkReader struct {
+	r         *bufio.Reader
+	chunkSize uint32
+	streams   map[uint32]*chunkStream
+	// total amount of bytes read, used for acknowledgements
+	read uint32
+}
+
+func newChunkReader(r *bufio.Reader) *chunkReader {
+	return &chunkReader{
+		r:         r,
+		chunkSize: defaultChunkSize,
+		streams:   make(map[uint32]*chunkStream),
+	}
+}
+
+func (cr *chunkReader) readFull(buf []byte) error {
+	n, err := io.ReadFull(cr.r, buf)
+	cr.read += uint32(n)
+	return err
+}
+
+// reads n bytes onto the end of buf, growing it as the data arrives
+func (cr *chunkReader) readAppend(buf []byte, n uint32) ([]byte, error) {
+	for n > 0 {
+		piece := min(n, readPieceSize)
+
+		start := len(buf)
+		buf = append(buf, make([]byte, piece)...)
+		if err := cr.readFull(buf[start:]); err != nil {
+			return buf, err
+		}
+
+		n -= piece
+	}
+
+	return buf, nil
+}
+
+// reads chunks until a whole message is assembled
+func (cr *chunkReader) readMessage() (*message, error) {
+	for {
+		msg, err := cr.readChunk()
+		if err != nil || msg != nil {
+			return msg, err
+		}
+	}
+}
+
+func (cr *chunkReader) readChunk() (*message, error) {
+	var basic [1]byte
+	if err := cr.readFull(basic[:]); err != nil {
+		return nil, err
+	}
+
+	format := basic[0] >> 6
+	csid := uint32(basic[0] & 0x3F)
+
+	switch csid {
+	case 0:
+		var ext [1]byte
+		if err := cr.readFull(ext[:]); err != nil {
+			return nil, err
+		}
+		csid = uint32(ext[0]) + 64
+	case 1:
+		var ext [2]byte
+		if err := cr.readFull(ext[:]); err != nil {
+			return nil, err
+		}
+		csid = uint32(ext[1])*256 + uint32(ext[0]) + 64
+	}
+
+	cs, ok := cr.streams[csid]
+	if !ok {
+		if format != 0 {
+			return nil, errChunkHeader
+		}
+		if len(cr.streams) >= maxChunkStreams {
+			return nil, errChunkStreams
+		}
+		cs = &chunkStream{}
+		cr.streams[csid] = cs
+	}
+
+	var header [11]byte
+	var ts uint32
+
+	switch format {
+	case 0:
+		if err := cr.readFull(header[:11]); err != nil {
+			return nil, err
+		}
+		ts = uint24(header[0:3])
+		cs.length = uint24(header[3:6])
+		cs.typeID = header[6]
+		cs.streamID = binary.LittleEndian.Uint32(header[7:11])
+	case 1:
+		if err := cr.readFull(header[:7]); err != nil {
+			return nil, err
+		}
+		ts = uint24(header[0:3])
+		cs.length = uint24(header[3:6])
+		cs.typeID = header[6]
+	case 2:
+		if err := cr.readFull(header[:3]); err != nil {
+			return nil, err
+		}
+		ts = uint24(header[0:3])
+	case 3:
+		// same header as the previous chunk
+		if cs.extended {
+			ts = extendedTimestamp
+		} else {
+			ts = cs.delta
+		}
+	}
+
+	if format != 3 {
+		cs.extended = ts == extendedTimestamp
+	}
+
+	if cs.extended {
+		var ext [4]byte
+		if err := cr.readFull(ext[:]); err != nil {
+			return nil, err
+		}
+		ts = binary.BigEndian.Uint32(ext[:])
+	}
+
+	// timestamp is only advanced by the first chunk of the message
+	if !cs.active {
+		if format == 0 {
+			cs.timestamp = ts
+			cs.delta = 0
+		} else {
+			cs.delta = ts
+			cs.timestamp += ts
+		}
+
+		if cs.length > maxMessageSize {
+			return nil, errMessageSize
+		}
+
+		// payload of the previous message is owned by its reader
+		cs.buf = nil
+		cs.active = true
+	}
+
+	size := min(cs.length-uint32(len(cs.buf)), cr.chunkSize)
+
+	var err error
+	if cs.buf, err = cr.readAppend(cs.buf, size); err != nil {
+		return nil, err
+	}
+
+	if uint32(len(cs.buf)) < cs.length {
+		return nil, nil
+	}
+
+	cs.active = false
+
+	return &message{
+		typeID:    cs.typeID,
+		streamID:  cs.streamID,
+		timestamp: cs.timestamp,
+		payload:   cs.buf,
+	}, nil
+}
+
+// splits messages into chunks, always using type 0 headers
+type chunkWriter struct {
+	w         *bufio.Writer
+	chunkSize uint32
+}
+
+func (cw *chunkWriter) writeMessage(csid uint32, msg *message) error {
+	var header [12]byte
+
+	header[0] = byte(csid & 0x3F)
+	putUint24(header[1:4], msg.timestamp)
+	putUint24(header[4:7], uint32(len(msg.payload)))
+	header[7] = msg.typeID
+	binary.LittleEndian.PutUint32(header[8:12], msg.streamID)
+
+	if _, err := cw.w.Write(header[:]); err != nil {
+		return err
+	}
+
+	payload := msg.payload
+	for {
+		size := uint32(len(payload))
+		if size > cw.chunkSize {
+			size = cw.chunkSize
+		}
+
+		if _, err := cw.w.Write(payload[:size]); err != nil {
+			return err
+		}
+		payload = payload[size:]
+
+		if len(payload) == 0 {
+			break
+		}
+
+		// continuation chunk (type 3)
+		if err := cw.w.WriteByte(0xC0 | byte(csid&0x3F)); err != nil {
+			return err
+		}
+	}
+
+	return cw.w.Flush()
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v >> 16)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v)
+}
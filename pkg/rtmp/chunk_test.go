@@ -0,0 +1,222 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func newTestReader(data []byte) *chunkReader {
+	return newChunkReader(bufio.NewReader(bytes.NewReader(data)))
+}
+
+// type 0 chunk header
+func header0(csid byte, timestamp, length uint32, typeID uint8, streamID uint32) []byte {
+	h := []byte{csid}
+	h = append(h, byte(timestamp>>16), byte(timestamp>>8), byte(timestamp))
+	h = append(h, byte(length>>16), byte(length>>8), byte(length))
+	h = append(h, typeID)
+	return binary.LittleEndian.AppendUint32(h, streamID)
+}
+
+func TestChunkRoundTrip(t *testing.T) {
+	payload := make([]byte, 1000)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	msgs := []*message{
+		{typeID: msgVideo, streamID: 1, timestamp: 40, payload: payload},
+		{typeID: msgAudio, streamID: 1, timestamp: 63, payload: payload[:128]},
+		{typeID: msgDataAMF0, streamID: 1, timestamp: 80, payload: payload[:1]},
+	}
+
+	var buf bytes.Buffer
+	cw := &chunkWriter{w: bufio.NewWriter(&buf), chunkSize: defaultChunkSize}
+	for _, msg := range msgs {
+		if err := cw.writeMessage(6, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cr := newTestReader(buf.Bytes())
+	for i, want := range msgs {
+		got, err := cr.readMessage()
+		if err != nil {
+			t.Fatalf("message %v: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("message %v: got %+v, want %+v", i, got, want)
+		}
+	}
+
+	if _, err := cr.readMessage(); !errors.Is(err, io.EOF) {
+		t.Errorf("got %v after the last message, want EOF", err)
+	}
+
+	if cr.read != uint32(buf.Len()) {
+		t.Errorf("read %v bytes, want %v", cr.read, buf.Len())
+	}
+}
+
+func TestChunkHeaderTypes(t *testing.T) {
+	var data []byte
+	// 100: full header
+	data = append(data, header0(4, 100, 2, msgVideo, 1)...)
+	data = append(data, 'a', 'b')
+	// 140: delta, length and type
+	data = append(data, 0x40|4, 0, 0, 40, 0, 0, 1, msgAudio)
+	data = append(data, 'c')
+	// 170: delta only
+	data = append(data, 0x80|4, 0, 0, 30)
+	data = append(data, 'd')
+	// 200: previous delta
+	data = append(data, 0xC0|4)
+	data = append(data, 'e')
+
+	want := []message{
+		{typeID: msgVideo, streamID: 1, timestamp: 100, payload: []byte("ab")},
+		{typeID: msgAudio, streamID: 1, timestamp: 140, payload: []byte("c")},
+		{typeID: msgAudio, streamID: 1, timestamp: 170, payload: []byte("d")},
+		{typeID: msgAudio, streamID: 1, timestamp: 200, payload: []byte("e")},
+	}
+
+	cr := newTestReader(data)
+	for i := range want {
+		msg, err := cr.readMessage()
+		if err != nil {
+			t.Fatalf("message %v: %v", i, err)
+		}
+		if !reflect.DeepEqual(*msg, want[i]) {
+			t.Errorf("message %v: got %+v, want %+v", i, *msg, want[i])
+		}
+	}
+}
+
+func TestChunkInterleaved(t *testing.T) {
+	video := bytes.Repeat([]byte{'v'}, 200)
+	audio := bytes.Repeat([]byte{'a'}, 10)
+
+	var data []byte
+	data = append(data, header0(6, 0, 200, msgVideo, 1)...)
+	data = append(data, video[:128]...)
+	// audio message in between the chunks of the video
+	data = append(data, header0(4, 0, 10, msgAudio, 1)...)
+	data = append(data, audio...)
+	data = append(data, 0xC0|6)
+	data = append(data, video[128:]...)
+
+	cr := newTestReader(data)
+
+	msg, err := cr.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.typeID != msgAudio || !bytes.Equal(msg.payload, audio) {
+		t.Errorf("got %+v, want audio message first", msg)
+	}
+
+	msg, err = cr.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.typeID != msgVideo || !bytes.Equal(msg.payload, video) {
+		t.Errorf("got %+v, want video message", msg)
+	}
+}
+
+func TestChunkExtended(t *testing.T) {
+	payload := bytes.Repeat([]byte{'x'}, 200)
+	ts := []byte{0x01, 0x00, 0x00, 0x00}
+
+	var data []byte
+	// two byte chunk stream id: 64 + 10
+	data = append(data, 0, 10)
+	data = append(data, 0xFF, 0xFF, 0xFF, 0, 0, 200, msgVideo, 1, 0, 0, 0)
+	data = append(data, ts...)
+	data = append(data, payload[:128]...)
+	// continuation repeats the extended timestamp
+	data = append(data, 0xC0, 10)
+	data = append(data, ts...)
+	data = append(data, payload[128:]...)
+	// three byte chunk stream id: 64 + 1 + 256
+	data = append(data, 1, 1, 1)
+	data = append(data, 0, 0, 5, 0, 0, 1, msgAudio, 1, 0, 0, 0)
+	data = append(data, 'a')
+
+	cr := newTestReader(data)
+
+	msg, err := cr.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.timestamp != 0x01000000 || !bytes.Equal(msg.payload, payload) {
+		t.Errorf("got timestamp %x and %v bytes", msg.timestamp, len(msg.payload))
+	}
+
+	msg, err = cr.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.timestamp != 5 || string(msg.payload) != "a" {
+		t.Errorf("got %+v", msg)
+	}
+
+	if _, ok := cr.streams[74]; !ok {
+		t.Error("two byte chunk stream id wasn't decoded")
+	}
+	if _, ok := cr.streams[321]; !ok {
+		t.Error("three byte chunk stream id wasn't decoded")
+	}
+}
+
+func TestChunkErrors(t *testing.T) {
+	var streams []byte
+	for csid := 2; csid < 2+maxChunkStreams+1; csid++ {
+		streams = append(streams, header0(byte(csid), 0, 0, msgAudio, 1)...)
+	}
+
+	payloads := map[string]struct {
+		data []byte
+		err  error
+	}{
+		"unknown stream":  {[]byte{0x40 | 4, 0, 0, 0, 0, 0, 1, msgAudio, 'a'}, errChunkHeader},
+		"too many":        {streams, errChunkStreams},
+		"truncated":       {header0(4, 0, 10, msgVideo, 1)[:5], io.ErrUnexpectedEOF},
+		"truncated chunk": {append(header0(4, 0, 10, msgVideo, 1), 'a'), io.ErrUnexpectedEOF},
+	}
+
+	for name, tc := range payloads {
+		cr := newTestReader(tc.data)
+
+		var err error
+		for err == nil {
+			_, err = cr.readMessage()
+		}
+
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%v: got %v, want %v", name, err, tc.err)
+		}
+	}
+}
+
+// declared length of the message shouldn't be allocated up front
+func TestChunkGrowsBuffer(t *testing.T) {
+	data := header0(4, 0, 0xFFFFFF, msgVideo, 1)
+	data = append(data, bytes.Repeat([]byte{'x'}, 1000)...)
+
+	cr := newTestReader(data)
+	cr.chunkSize = maxChunkSize
+
+	if _, err := cr.readMessage(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want ErrUnexpectedEOF", err)
+	}
+
+	if size := cap(cr.streams[4].buf); size > 2*readPieceSize {
+		t.Errorf("buffer of %v bytes was allocated for 1000 bytes of data", size)
+	}
+}
@@ -0,0 +1,44 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// flv tag types, same as the rtmp message types
+const (
+	flvAudio  = msgAudio
+	flvVideo  = msgVideo
+	flvScript = msgDataAMF0
+)
+
+// remuxes rtmp media messages into an flv stream
+type flvWriter struct {
+	w io.Writer
+}
+
+func newFLVWriter(w io.Writer) (*flvWriter, error) {
+	// signature, version 1, audio + video flags, header size, first PreviousTagSize
+	header := []byte{'F', 'L', 'V', 0x01, 0x05, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &flvWriter{w: w}, nil
+}
+
+func (fw *flvWriter) writeTag(tagType uint8, timestamp uint32, data []byte) error {
+	tag := make([]byte, 11, 11+len(data)+4)
+
+	tag[0] = tagType
+	putUint24(tag[1:4], uint32(len(data)))
+	putUint24(tag[4:7], timestamp&0xFFFFFF)
+	tag[7] = byte(timestamp >> 24)
+	// stream id is always 0
+
+	tag = append(tag, data...)
+	tag = binary.BigEndian.AppendUint32(tag, uint32(11+len(data)))
+
+	_, err := fw.w.Write(tag)
+	return err
+}
@@ -0,0 +1,390 @@
+// Package rtmp implements a minimal RTMP ingest server.
+//
+// The server accepts publishing clients (OBS, ffmpeg, etc.) and remuxes the
+// published audio / video into an FLV stream, handed to the Handler.
+// Playback over RTMP is not supported.
+package rtmp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	handshakeSize = 1536
+	// acknowledgement window and peer bandwidth, announced to the clients
+	windowSize = 2500000
+
+	defaultHandshakeTimeout = 10 * time.Second
+	defaultIdleTimeout      = 30 * time.Second
+)
+
+var (
+	errVersion = errors.New("rtmp: unsupported protocol version")
+	// returned by Serve after Close
+	ErrServerClosed = errors.New("rtmp: server closed")
+)
+
+// receives published streams
+type Handler interface {
+	// called when client starts publishing a stream
+	// returned writer receives the stream in flv format and is closed when publishing ends
+	Publish(app, key string) (io.WriteCloser, error)
+}
+
+type Server struct {
+	Addr    string
+	Handler Handler
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(l)
+}
+
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.conns = make(map[net.Conn]struct{})
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+			}()
+
+			c := newConn(conn, s.Handler)
+			if err := c.serve(); err != nil && !errors.Is(err, io.EOF) {
+				log.Printf("rtmp connection %v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// stops accepting new clients and drops the connected ones
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// single client connection
+type conn struct {
+	nc      net.Conn
+	handler Handler
+
+	r *chunkReader
+	w *chunkWriter
+
+	// application name from the connect command
+	app string
+	// acknowledgement window, requested by the client
+	ackWindow uint32
+	acked     uint32
+
+	// set while the client is publishing
+	sink io.WriteCloser
+	flv  *flvWriter
+}
+
+func newConn(nc net.Conn, handler Handler) *conn {
+	return &conn{
+		nc:      nc,
+		handler: handler,
+		r:       newChunkReader(bufio.NewReader(nc)),
+		w:       &chunkWriter{w: bufio.NewWriter(nc), chunkSize: defaultChunkSize},
+	}
+}
+
+func (c *conn) serve() error {
+	defer c.nc.Close()
+	defer c.closeSink()
+
+	c.nc.SetDeadline(time.Now().Add(defaultHandshakeTimeout))
+	if err := c.handshake(); err != nil {
+		return err
+	}
+
+	for {
+		c.nc.SetDeadline(time.Now().Add(defaultIdleTimeout))
+
+		msg, err := c.r.readMessage()
+		if err != nil {
+			return err
+		}
+
+		if err := c.acknowledge(); err != nil {
+			return err
+		}
+
+		if err := c.handleMessage(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// simple (non-digest) handshake
+func (c *conn) handshake() error {
+	c0c1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(c.r.r, c0c1); err != nil {
+		return err
+	}
+
+	if c0c1[0] != 3 {
+		return errVersion
+	}
+
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	s0s1s2[0] = 3
+	// s1: time + zero + random
+	if _, err := rand.Read(s0s1s2[9 : 1+handshakeSize]); err != nil {
+		return err
+	}
+	// s2: echo of c1
+	copy(s0s1s2[1+handshakeSize:], c0c1[1:])
+
+	if _, err := c.w.w.Write(s0s1s2); err != nil {
+		return err
+	}
+	if err := c.w.w.Flush(); err != nil {
+		return err
+	}
+
+	c2 := make([]byte, handshakeSize)
+	_, err := io.ReadFull(c.r.r, c2)
+	return err
+}
+
+// sends acknowledgement, once the client's window is exhausted
+func (c *conn) acknowledge() error {
+	if c.ackWindow == 0 || c.r.read-c.acked < c.ackWindow {
+		return nil
+	}
+
+	c.acked = c.r.read
+	return c.writeControl(msgAck, be32(c.r.read))
+}
+
+func (c *conn) handleMessage(msg *message) error {
+	switch msg.typeID {
+	case msgSetChunkSize:
+		if len(msg.payload) < 4 {
+			return errChunkSize
+		}
+		size := be32value(msg.payload) & 0x7FFFFFFF
+		if size == 0 || size > maxChunkSize {
+			return errChunkSize
+		}
+		c.r.chunkSize = size
+	case msgWindowAckSize:
+		if len(msg.payload) >= 4 {
+			c.ackWindow = be32value(msg.payload)
+		}
+	case msgCommandAMF0:
+		return c.handleCommand(msg)
+	case msgDataAMF0:
+		return c.handleData(msg)
+	case msgAudio, msgVideo:
+		if c.flv == nil {
+			return nil
+		}
+		return c.writeMedia(msg.typeID, msg.timestamp, msg.payload)
+	}
+
+	return nil
+}
+
+func (c *conn) handleCommand(msg *message) error {
+	values, err := decodeAMF(msg.payload)
+	if err != nil || len(values) < 2 {
+		return err
+	}
+
+	name, _ := values[0].(string)
+	txID, _ := values[1].(float64)
+
+	switch name {
+	case "connect":
+		if len(values) > 2 {
+			if obj, ok := values[2].(map[string]any); ok {
+				c.app, _ = obj["app"].(string)
+			}
+		}
+		return c.onConnect(txID)
+	case "createStream":
+		// publishing always happens on message stream 1
+		return c.writeCommand(0, "_result", txID, nil, 1)
+	case "publish":
+		var key string
+		if len(values) > 3 {
+			key, _ = values[3].(string)
+		}
+		return c.onPublish(msg.streamID, key)
+	case "FCUnpublish", "deleteStream", "closeStream":
+		c.closeSink()
+	}
+
+	return nil
+}
+
+func (c *conn) onConnect(txID float64) error {
+	if err := c.writeControl(msgWindowAckSize, be32(windowSize)); err != nil {
+		return err
+	}
+
+	// dynamic limit type
+	if err := c.writeControl(msgSetPeerBandwidth, append(be32(windowSize), 2)); err != nil {
+		return err
+	}
+
+	if err := c.writeControl(msgSetChunkSize, be32(outChunkSize)); err != nil {
+		return err
+	}
+	c.w.chunkSize = outChunkSize
+
+	return c.writeCommand(0, "_result", txID,
+		map[string]any{
+			"fmsVer":       "FMS/3,0,1,123",
+			"capabilities": 31,
+		},
+		map[string]any{
+			"level":          "status",
+			"code":           "NetConnection.Connect.Success",
+			"description":    "Connection succeeded.",
+			"objectEncoding": 0,
+		},
+	)
+}
+
+func (c *conn) onPublish(streamID uint32, key string) error {
+	if c.sink != nil {
+		return errors.New("rtmp: client is already publishing")
+	}
+
+	sink, err := c.handler.Publish(c.app, key)
+	if err != nil {
+		c.writeCommand(streamID, "onStatus", 0, nil, map[string]any{
+			"level":       "error",
+			"code":        "NetStream.Publish.BadName",
+			"description": err.Error(),
+		})
+		return err
+	}
+
+	flv, err := newFLVWriter(sink)
+	if err != nil {
+		sink.Close()
+		return err
+	}
+
+	c.sink = sink
+	c.flv = flv
+
+	// StreamBegin user control event
+	if err := c.writeControl(msgUserControl, append([]byte{0, 0}, be32(streamID)...)); err != nil {
+		return err
+	}
+
+	return c.writeCommand(streamID, "onStatus", 0, nil, map[string]any{
+		"level":       "status",
+		"code":        "NetStream.Publish.Start",
+		"description": "Start publishing",
+	})
+}
+
+// forwards stream metadata (@setDataFrame onMetaData) into the flv
+func (c *conn) handleData(msg *message) error {
+	if c.flv == nil {
+		return nil
+	}
+
+	values, err := decodeAMF(msg.payload)
+	if err != nil || len(values) == 0 {
+		return nil
+	}
+
+	if name, _ := values[0].(string); name != "@setDataFrame" {
+		return nil
+	}
+
+	// flv script tag starts with onMetaData
+	payload := msg.payload[3+len("@setDataFrame"):]
+
+	return c.writeMedia(flvScript, msg.timestamp, payload)
+}
+
+func (c *conn) writeMedia(tagType uint8, timestamp uint32, payload []byte) error {
+	if err := c.flv.writeTag(tagType, timestamp, payload); err != nil {
+		// consumer went away, there is no point in receiving the stream
+		c.closeSink()
+		return err
+	}
+	return nil
+}
+
+func (c *conn) closeSink() {
+	if c.sink != nil {
+		c.sink.Close()
+		c.sink = nil
+		c.flv = nil
+	}
+}
+
+func (c *conn) writeControl(typeID uint8, payload []byte) error {
+	return c.w.writeMessage(2, &message{typeID: typeID, payload: payload})
+}
+
+func (c *conn) writeCommand(streamID uint32, values ...any) error {
+	return c.w.writeMessage(3, &message{typeID: msgCommandAMF0, streamID: streamID, payload: encodeAMF(values...)})
+}
+
+func be32(v uint32) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func be32value(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
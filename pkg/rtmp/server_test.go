@@ -0,0 +1,156 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// records the published streams
+type testHandler struct {
+	mu     sync.Mutex
+	app    string
+	key    string
+	sink   bytes.Buffer
+	closed chan struct{}
+}
+
+func (h *testHandler) Publish(app, key string) (io.WriteCloser, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.app, h.key = app, key
+	return h, nil
+}
+
+func (h *testHandler) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.sink.Write(p)
+}
+
+func (h *testHandler) Close() error {
+	close(h.closed)
+	return nil
+}
+
+// starts serving the server side of the pipe, returns the client side
+func serveTestConn(t *testing.T, handler Handler) (net.Conn, chan error) {
+	t.Helper()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	done := make(chan error, 1)
+	go func() {
+		done <- newConn(server, handler).serve()
+	}()
+
+	return client, done
+}
+
+func clientHandshake(t *testing.T, client net.Conn) {
+	t.Helper()
+
+	c0c1 := make([]byte, 1+handshakeSize)
+	c0c1[0] = 3
+	for i := range c0c1[1:] {
+		c0c1[1+i] = byte(i)
+	}
+	if _, err := client.Write(c0c1); err != nil {
+		t.Fatal(err)
+	}
+
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	if _, err := io.ReadFull(client, s0s1s2); err != nil {
+		t.Fatal(err)
+	}
+
+	if s0s1s2[0] != 3 {
+		t.Errorf("server version is %v, want 3", s0s1s2[0])
+	}
+	if !bytes.Equal(s0s1s2[1+handshakeSize:], c0c1[1:]) {
+		t.Error("s2 doesn't echo c1")
+	}
+
+	if _, err := client.Write(s0s1s2[1 : 1+handshakeSize]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandshakeVersion(t *testing.T) {
+	client, done := serveTestConn(t, &testHandler{})
+
+	c0c1 := make([]byte, 1+handshakeSize)
+	c0c1[0] = 6
+	if _, err := client.Write(c0c1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; !errors.Is(err, errVersion) {
+		t.Errorf("got %v, want errVersion", err)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	handler := &testHandler{closed: make(chan struct{})}
+	client, done := serveTestConn(t, handler)
+
+	clientHandshake(t, client)
+
+	// responses of the server aren't checked
+	go io.Copy(io.Discard, client)
+
+	cw := &chunkWriter{w: bufio.NewWriter(client), chunkSize: defaultChunkSize}
+	commands := [][]any{
+		{"connect", 1, map[string]any{"app": "live", "type": "nonprivate"}},
+		{"createStream", 2, nil},
+		{"publish", 3, nil, "secret", "live"},
+	}
+	for _, command := range commands {
+		streamID := uint32(0)
+		if command[0] == "publish" {
+			streamID = 1
+		}
+
+		msg := &message{typeID: msgCommandAMF0, streamID: streamID, payload: encodeAMF(command...)}
+		if err := cw.writeMessage(3, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	video := bytes.Repeat([]byte{0x17}, 300)
+	if err := cw.writeMessage(6, &message{typeID: msgVideo, streamID: 1, timestamp: 40, payload: video}); err != nil {
+		t.Fatal(err)
+	}
+
+	client.Close()
+
+	select {
+	case <-handler.closed:
+	case <-time.After(time.Second):
+		t.Fatal("sink wasn't closed along with the connection")
+	}
+
+	if err := <-done; err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("serve: %v", err)
+	}
+
+	if handler.app != "live" || handler.key != "secret" {
+		t.Errorf("published %q/%q, want live/secret", handler.app, handler.key)
+	}
+
+	var want bytes.Buffer
+	fw, _ := newFLVWriter(&want)
+	fw.writeTag(flvVideo, 40, video)
+
+	if !bytes.Equal(handler.sink.Bytes(), want.Bytes()) {
+		t.Errorf("sink received %v bytes, want %v", handler.sink.Len(), want.Len())
+	}
+}
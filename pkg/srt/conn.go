@@ -0,0 +1,479 @@
+package srt
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// full acknowledgements are sent this often
+	ackInterval = 10 * time.Millisecond
+	// least interval of the periodic loss reports
+	nakInterval       = 20 * time.Millisecond
+	keepaliveInterval = time.Second
+	// caller is dropped after this long without any packets
+	idleTimeout = 5 * time.Second
+
+	// packets, queued for the receiving goroutine
+	inboxSize = 1024
+	// largest gap in sequence numbers, treated as a loss
+	maxLossGap = 8192
+	// loss report has to fit into a single packet
+	maxNAKRanges = 128
+
+	// key material refresh, sent as user-defined control packets
+	subtypeKMREQ = 3
+	subtypeKMRSP = 4
+)
+
+// receiving statistics of the connection
+type Stats struct {
+	// smoothed round trip time and its variance
+	RTT    time.Duration
+	RTTVar time.Duration
+
+	PacketsReceived uint64
+	// packets, reported as lost (some of them may be retransmitted later)
+	PacketsLost          uint64
+	PacketsRetransmitted uint64
+	// packets, which never arrived in time and were skipped
+	PacketsDropped uint64
+	BytesReceived  uint64
+}
+
+// connected caller
+type Conn struct {
+	server   *Server
+	addr     net.Addr
+	id       uint32
+	peerID   uint32
+	streamID string
+	latency  time.Duration
+	km       *keyMaterial
+	start    time.Time
+
+	// conclusion response, repeated if the caller didn't get it
+	hsResponse []byte
+
+	inbox     chan *packet
+	w         io.WriteCloser
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// receiver state, owned by the serving goroutine
+	// next sequence number to deliver and the highest one received
+	next uint32
+	last uint32
+	// packets waiting for the missing ones
+	pending map[uint32]pendingPacket
+	loss    map[uint32]struct{}
+
+	// sent acknowledgements, awaiting ACKACK
+	ackNumber uint32
+	acks      map[uint32]time.Time
+	acked     uint32
+	lastACK   time.Time
+	// received since the last acknowledgement
+	ackPackets, ackBytes int
+
+	lastNAK  time.Time
+	lastSeen time.Time
+	lastSent time.Time
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+type pendingPacket struct {
+	payload []byte
+	arrived time.Time
+}
+
+func newConn(s *Server, addr net.Addr, id uint32, hs *handshake, streamID string, latency time.Duration, km *keyMaterial) *Conn {
+	now := time.Now()
+
+	return &Conn{
+		server:   s,
+		addr:     addr,
+		id:       id,
+		peerID:   hs.socketID,
+		streamID: streamID,
+		latency:  latency,
+		km:       km,
+		start:    now,
+
+		inbox: make(chan *packet, inboxSize),
+		done:  make(chan struct{}),
+
+		next:    hs.isn,
+		last:    seqAdd(hs.isn, -1),
+		acked:   hs.isn,
+		pending: make(map[uint32]pendingPacket),
+		loss:    make(map[uint32]struct{}),
+		acks:    make(map[uint32]time.Time),
+
+		lastACK:  now,
+		lastSeen: now,
+		lastSent: now,
+
+		stats: Stats{
+			RTT:    100 * time.Millisecond,
+			RTTVar: 50 * time.Millisecond,
+		},
+	}
+}
+
+// stream id, requested by the caller
+func (c *Conn) StreamID() string { return c.streamID }
+
+func (c *Conn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *Conn) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// disconnects the caller
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+// queues packet for the serving goroutine
+// packets are dropped if the handler falls behind, and requested again later
+func (c *Conn) receive(p *packet) {
+	select {
+	case c.inbox <- p:
+	default:
+	}
+}
+
+func (c *Conn) serve() {
+	defer c.w.Close()
+	defer c.sendControl(ctrlShutdown, 0, 0, nil)
+
+	ticker := time.NewTicker(ackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case p := <-c.inbox:
+			c.lastSeen = time.Now()
+			if err := c.handle(p); err != nil {
+				return
+			}
+		case now := <-ticker.C:
+			if now.Sub(c.lastSeen) > idleTimeout {
+				return
+			}
+			if err := c.tick(now); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Conn) handle(p *packet) error {
+	if !p.control {
+		return c.onData(p)
+	}
+
+	switch p.ctrlType {
+	case ctrlHandshake:
+		c.write(c.hsResponse)
+	case ctrlACKACK:
+		c.onACKACK(p.info)
+	case ctrlDropReq:
+		// sender gave up on the message, there is no point in waiting for it
+		if len(p.payload) >= 8 {
+			last := binary.BigEndian.Uint32(p.payload[4:])
+			if seqDiff(last, c.next) >= 0 {
+				return c.skipTo(seqAdd(last, 1))
+			}
+		}
+	case ctrlShutdown:
+		return io.EOF
+	case ctrlUser:
+		if p.subtype == subtypeKMREQ {
+			// keys are refreshed during long sessions
+			if km, err := parseKeyMaterial(p.payload, c.server.Passphrase); err == nil {
+				c.km = km
+				c.sendControl(ctrlUser, subtypeKMRSP, 0, km.raw)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Conn) onData(p *packet) error {
+	c.mu.Lock()
+	c.stats.PacketsReceived++
+	c.stats.BytesReceived += uint64(len(p.payload))
+	if p.retransmitted() {
+		c.stats.PacketsRetransmitted++
+	}
+	c.mu.Unlock()
+
+	c.ackPackets++
+	c.ackBytes += len(p.payload)
+
+	// too late, or already received
+	if seqDiff(p.seq, c.next) < 0 {
+		return nil
+	}
+	if _, ok := c.pending[p.seq]; ok {
+		return nil
+	}
+
+	gap := seqDiff(p.seq, c.last)
+	if gap > maxLossGap {
+		c.resync(p.seq)
+	} else if gap > 1 {
+		from, to := seqAdd(c.last, 1), seqAdd(p.seq, -1)
+		for seq := from; seq != p.seq; seq = seqAdd(seq, 1) {
+			c.loss[seq] = struct{}{}
+		}
+
+		c.mu.Lock()
+		c.stats.PacketsLost += uint64(gap - 1)
+		c.mu.Unlock()
+
+		// losses are reported right away, periodic reports repeat them
+		c.sendNAK([][2]uint32{{from, to}})
+	}
+
+	if seqDiff(p.seq, c.last) > 0 {
+		c.last = p.seq
+	}
+	delete(c.loss, p.seq)
+
+	if p.keyFlags() != 0 {
+		if c.km == nil || c.km.decrypt(p) != nil {
+			return nil
+		}
+	}
+
+	c.pending[p.seq] = pendingPacket{payload: p.payload, arrived: time.Now()}
+
+	return c.deliver()
+}
+
+// hands consecutive packets to the handler
+func (c *Conn) deliver() error {
+	for {
+		pp, ok := c.pending[c.next]
+		if !ok {
+			return nil
+		}
+
+		delete(c.pending, c.next)
+		c.next = seqAdd(c.next, 1)
+
+		if _, err := c.w.Write(pp.payload); err != nil {
+			return err
+		}
+	}
+}
+
+// gives up on the missing packets before the sequence number
+func (c *Conn) skipTo(seq uint32) error {
+	var dropped uint64
+	for ; seqDiff(seq, c.next) > 0; c.next = seqAdd(c.next, 1) {
+		if pp, ok := c.pending[c.next]; ok {
+			delete(c.pending, c.next)
+			if _, err := c.w.Write(pp.payload); err != nil {
+				return err
+			}
+			continue
+		}
+
+		delete(c.loss, c.next)
+		dropped++
+	}
+
+	if seqDiff(c.next, c.last) > 1 {
+		c.last = seqAdd(c.next, -1)
+	}
+
+	c.mu.Lock()
+	c.stats.PacketsDropped += dropped
+	c.mu.Unlock()
+
+	return c.deliver()
+}
+
+// sender is too far ahead, everything before the sequence number is dropped
+func (c *Conn) resync(seq uint32) {
+	c.mu.Lock()
+	c.stats.PacketsDropped += uint64(seqDiff(seq, c.next))
+	c.mu.Unlock()
+
+	c.pending = make(map[uint32]pendingPacket)
+	c.loss = make(map[uint32]struct{})
+	c.next = seq
+	c.last = seqAdd(seq, -1)
+}
+
+func (c *Conn) tick(now time.Time) error {
+	// too-late packet drop: missing packets are awaited no longer than the latency
+	if _, ok := c.pending[c.next]; !ok && len(c.pending) > 0 {
+		first, oldest := c.firstPending()
+		if now.Sub(oldest) > c.latency {
+			if err := c.skipTo(first); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.next != c.acked {
+		c.sendACK(now)
+	}
+
+	c.mu.Lock()
+	interval := max((c.stats.RTT+4*c.stats.RTTVar)/2, nakInterval)
+	c.mu.Unlock()
+
+	if len(c.loss) > 0 && now.Sub(c.lastNAK) > interval {
+		c.sendNAK(c.lossRanges())
+	}
+
+	if now.Sub(c.lastSent) > keepaliveInterval {
+		c.sendControl(ctrlKeepalive, 0, 0, nil)
+	}
+
+	return nil
+}
+
+// earliest pending packet and its arrival time
+func (c *Conn) firstPending() (uint32, time.Time) {
+	var first uint32
+	var arrived time.Time
+
+	found := false
+	for seq, pp := range c.pending {
+		if !found || seqDiff(seq, first) < 0 {
+			first, arrived, found = seq, pp.arrived, true
+		}
+	}
+
+	return first, arrived
+}
+
+func (c *Conn) sendACK(now time.Time) {
+	// acknowledgements, which were never confirmed
+	for n, sent := range c.acks {
+		if now.Sub(sent) > idleTimeout {
+			delete(c.acks, n)
+		}
+	}
+
+	c.ackNumber++
+	c.acks[c.ackNumber] = now
+	c.acked = c.next
+
+	elapsed := now.Sub(c.lastACK).Seconds()
+	pktRate := uint32(float64(c.ackPackets) / elapsed)
+	byteRate := uint32(float64(c.ackBytes) / elapsed)
+	c.lastACK, c.ackPackets, c.ackBytes = now, 0, 0
+
+	c.mu.Lock()
+	rtt := uint32(c.stats.RTT.Microseconds())
+	rttVar := uint32(c.stats.RTTVar.Microseconds())
+	c.mu.Unlock()
+
+	available := uint32(max(inboxSize-len(c.pending), 2))
+
+	c.sendControl(ctrlACK, 0, c.ackNumber, be32list(c.next, rtt, rttVar, available, pktRate, pktRate, byteRate))
+}
+
+func (c *Conn) onACKACK(number uint32) {
+	sent, ok := c.acks[number]
+	if !ok {
+		return
+	}
+
+	for n := range c.acks {
+		if n <= number {
+			delete(c.acks, n)
+		}
+	}
+
+	sample := time.Since(sent)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	diff := c.stats.RTT - sample
+	if diff < 0 {
+		diff = -diff
+	}
+
+	c.stats.RTTVar = (3*c.stats.RTTVar + diff) / 4
+	c.stats.RTT = (7*c.stats.RTT + sample) / 8
+}
+
+// lost sequence numbers, joined into ranges
+func (c *Conn) lossRanges() [][2]uint32 {
+	seqs := make([]uint32, 0, len(c.loss))
+	for seq := range c.loss {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqDiff(seqs[i], seqs[j]) < 0 })
+
+	var ranges [][2]uint32
+	for _, seq := range seqs {
+		if n := len(ranges); n > 0 && seqAdd(ranges[n-1][1], 1) == seq {
+			ranges[n-1][1] = seq
+			continue
+		}
+
+		if len(ranges) == maxNAKRanges {
+			break
+		}
+		ranges = append(ranges, [2]uint32{seq, seq})
+	}
+
+	return ranges
+}
+
+func (c *Conn) sendNAK(ranges [][2]uint32) {
+	var list []uint32
+	for _, r := range ranges {
+		if r[0] == r[1] {
+			list = append(list, r[0])
+		} else {
+			list = append(list, r[0]|0x80000000, r[1])
+		}
+	}
+
+	c.lastNAK = time.Now()
+	c.sendControl(ctrlNAK, 0, 0, be32list(list...))
+}
+
+func (c *Conn) sendControl(typ, subtype uint16, info uint32, payload []byte) {
+	p := &packet{
+		control:   true,
+		ctrlType:  typ,
+		subtype:   subtype,
+		info:      info,
+		timestamp: uint32(time.Since(c.start).Microseconds()),
+		dest:      c.peerID,
+		payload:   payload,
+	}
+
+	c.lastSent = time.Now()
+	c.write(p.marshal())
+}
+
+func (c *Conn) write(b []byte) {
+	c.server.pc.WriteTo(b, c.addr)
+}
@@ -0,0 +1,157 @@
+package srt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	kmHeaderSize = 16
+	// AES-CTR
+	kmCipherCTR = 2
+
+	pbkdf2Iterations = 2048
+	// only the last bytes of the salt are used for key derivation
+	pbkdf2SaltSize = 8
+)
+
+var (
+	errKeyMaterial = errors.New("srt: malformed key material")
+	errBadSecret   = errors.New("srt: wrong passphrase")
+
+	// initial value of the AES key wrap (RFC 3394)
+	keyWrapIV = []byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+)
+
+// stream encrypting keys, announced by the caller
+type keyMaterial struct {
+	salt []byte
+	// even and odd keys, nil if not announced
+	keys [2]cipher.Block
+
+	// original message, echoed back to the caller
+	raw []byte
+}
+
+// parses KMREQ, unwrapping the keys with the passphrase
+func parseKeyMaterial(b []byte, passphrase string) (*keyMaterial, error) {
+	if len(b) < kmHeaderSize {
+		return nil, errKeyMaterial
+	}
+
+	kk := b[3] & 0x3
+	if kk == 0 || b[8] != kmCipherCTR {
+		return nil, errKeyMaterial
+	}
+
+	saltLen := 4 * int(b[14])
+	keyLen := 4 * int(b[15])
+
+	keys := 1
+	if kk == 3 {
+		keys = 2
+	}
+
+	if saltLen < pbkdf2SaltSize || len(b) < kmHeaderSize+saltLen+8+keys*keyLen {
+		return nil, errKeyMaterial
+	}
+
+	salt := b[kmHeaderSize : kmHeaderSize+saltLen]
+	wrapped := b[kmHeaderSize+saltLen : kmHeaderSize+saltLen+8+keys*keyLen]
+
+	kek, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt[saltLen-pbkdf2SaltSize:], pbkdf2Iterations, keyLen, sha1.New))
+	if err != nil {
+		return nil, err
+	}
+
+	sek, err := unwrapKey(kek, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	km := &keyMaterial{
+		salt: append([]byte(nil), salt...),
+		raw:  append([]byte(nil), b...),
+	}
+
+	// both keys are wrapped together, even one goes first
+	for i := 0; i < 2; i++ {
+		if kk&(1<<i) == 0 {
+			continue
+		}
+
+		block, err := aes.NewCipher(sek[:keyLen])
+		if err != nil {
+			return nil, err
+		}
+
+		km.keys[i] = block
+		sek = sek[keyLen:]
+	}
+
+	return km, nil
+}
+
+// decrypts data packet payload in place
+func (km *keyMaterial) decrypt(p *packet) error {
+	kk := p.keyFlags()
+	if kk != 1 && kk != 2 {
+		return errKeyMaterial
+	}
+
+	block := km.keys[kk-1]
+	if block == nil {
+		return errKeyMaterial
+	}
+
+	// counter block: salt xor packet index, the last two bytes count the blocks
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint32(iv[10:], p.seq)
+	for i := 0; i < 14 && i < len(km.salt); i++ {
+		iv[i] ^= km.salt[i]
+	}
+
+	cipher.NewCTR(block, iv).XORKeyStream(p.payload, p.payload)
+	return nil
+}
+
+// AES key unwrap (RFC 3394)
+func unwrapKey(kek cipher.Block, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, errKeyMaterial
+	}
+
+	n := len(wrapped)/8 - 1
+
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+
+	r := make([]byte, 8*n)
+	copy(r, wrapped[8:])
+
+	buf := make([]byte, aes.BlockSize)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(buf, binary.BigEndian.Uint64(a)^t)
+			copy(buf[8:], r[8*(i-1):8*i])
+
+			kek.Decrypt(buf, buf)
+
+			copy(a, buf[:8])
+			copy(r[8*(i-1):8*i], buf[8:])
+		}
+	}
+
+	if !bytes.Equal(a, keyWrapIV) {
+		return nil, errBadSecret
+	}
+
+	return r, nil
+}
@@ -0,0 +1,224 @@
+package srt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// AES key wrap (RFC 3394), the way callers produce KMREQ
+func wrapKey(kek cipher.Block, key []byte) []byte {
+	n := len(key) / 8
+
+	a := append([]byte(nil), keyWrapIV...)
+	r := append([]byte(nil), key...)
+
+	buf := make([]byte, aes.BlockSize)
+	for j := 0; j <= 5; j++ {
+		for i := 1; i <= n; i++ {
+			copy(buf, a)
+			copy(buf[8:], r[8*(i-1):8*i])
+
+			kek.Encrypt(buf, buf)
+
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf)^uint64(n*j+i))
+			copy(r[8*(i-1):8*i], buf[8:])
+		}
+	}
+
+	return append(a, r...)
+}
+
+// test vectors of RFC 3394, section 4
+var keyWrapVectors = map[string]struct {
+	kek, key, wrapped string
+}{
+	"128 bit key, 128 bit kek": {
+		kek:     "000102030405060708090A0B0C0D0E0F",
+		key:     "00112233445566778899AABBCCDDEEFF",
+		wrapped: "1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5",
+	},
+	"128 bit key, 192 bit kek": {
+		kek:     "000102030405060708090A0B0C0D0E0F1011121314151617",
+		key:     "00112233445566778899AABBCCDDEEFF",
+		wrapped: "96778B25AE6CA435F92B5B97C050AED2468AB8A17AD84E5D",
+	},
+	"256 bit key, 256 bit kek": {
+		kek:     "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+		key:     "00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F",
+		wrapped: "28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21",
+	},
+}
+
+func TestUnwrapKey(t *testing.T) {
+	for name, tc := range keyWrapVectors {
+		kek, err := aes.NewCipher(unhex(t, tc.kek))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		key, err := unwrapKey(kek, unhex(t, tc.wrapped))
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(key, unhex(t, tc.key)) {
+			t.Errorf("%v: got %X, want %v", name, key, tc.key)
+		}
+
+		// the helper, test messages are built with, is checked as well
+		if wrapped := wrapKey(kek, unhex(t, tc.key)); !bytes.Equal(wrapped, unhex(t, tc.wrapped)) {
+			t.Errorf("%v: wrapped into %X, want %v", name, wrapped, tc.wrapped)
+		}
+	}
+}
+
+func TestUnwrapKeyErrors(t *testing.T) {
+	vector := keyWrapVectors["128 bit key, 128 bit kek"]
+
+	other, err := aes.NewCipher(unhex(t, "0F0E0D0C0B0A09080706050403020100"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := unwrapKey(other, unhex(t, vector.wrapped)); !errors.Is(err, errBadSecret) {
+		t.Errorf("wrong kek: got %v, want errBadSecret", err)
+	}
+
+	for _, size := range []int{0, 16, 25} {
+		if _, err := unwrapKey(other, make([]byte, size)); !errors.Is(err, errKeyMaterial) {
+			t.Errorf("%v bytes: got %v, want errKeyMaterial", size, err)
+		}
+	}
+}
+
+const testPassphrase = "passphrase1234"
+
+// builds KMREQ, announcing the keys (even first), as described by the srt rfc draft
+func testKeyMaterial(t *testing.T, salt []byte, even, odd []byte) []byte {
+	t.Helper()
+
+	var kk byte
+	var keys []byte
+	if even != nil {
+		kk |= 1
+		keys = append(keys, even...)
+	}
+	if odd != nil {
+		kk |= 2
+		keys = append(keys, odd...)
+	}
+
+	keyLen := max(len(even), len(odd))
+
+	kek, err := aes.NewCipher(pbkdf2.Key([]byte(testPassphrase), salt[len(salt)-pbkdf2SaltSize:], pbkdf2Iterations, keyLen, sha1.New))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// version 1, packet type 2 (KMmsg), signature "HAI"
+	b := []byte{0x12, 0x20, 0x29, kk, 0, 0, 0, 0, kmCipherCTR, 0, 2, 0, 0, 0, byte(len(salt) / 4), byte(keyLen / 4)}
+	b = append(b, salt...)
+	return append(b, wrapKey(kek, keys)...)
+}
+
+func TestKeyMaterial(t *testing.T) {
+	salt := unhex(t, "000102030405060708090A0B0C0D0E0F")
+	even := unhex(t, "00112233445566778899AABBCCDDEEFF")
+	odd := unhex(t, "FFEEDDCCBBAA99887766554433221100")
+
+	raw := testKeyMaterial(t, salt, even, odd)
+
+	km, err := parseKeyMaterial(raw, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(km.raw, raw) || !bytes.Equal(km.salt, salt) {
+		t.Error("key material isn't kept for the response")
+	}
+
+	// counter block of packet 0x12345678: salt with the packet index xored at bytes 10-13
+	iv := unhex(t, "00010203040506070809183F5A750000")
+	plain := []byte("transport stream packet, longer than a single aes block")
+
+	for i, key := range [][]byte{even, odd} {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encrypted := make([]byte, len(plain))
+		cipher.NewCTR(block, iv).XORKeyStream(encrypted, plain)
+
+		p := &packet{seq: 0x12345678, msg: uint32(i+1) << 27, payload: encrypted}
+		if err := km.decrypt(p); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(p.payload, plain) {
+			t.Errorf("key %v: got %q, want %q", i, p.payload, plain)
+		}
+	}
+
+	// not encrypted packet
+	if err := km.decrypt(&packet{seq: 1}); !errors.Is(err, errKeyMaterial) {
+		t.Errorf("got %v, want errKeyMaterial", err)
+	}
+}
+
+func TestKeyMaterialErrors(t *testing.T) {
+	salt := unhex(t, "000102030405060708090A0B0C0D0E0F")
+	key := unhex(t, "00112233445566778899AABBCCDDEEFF")
+
+	if _, err := parseKeyMaterial(testKeyMaterial(t, salt, key, nil), "wrong passphrase"); !errors.Is(err, errBadSecret) {
+		t.Errorf("wrong passphrase: got %v, want errBadSecret", err)
+	}
+
+	raw := testKeyMaterial(t, salt, key, nil)
+
+	noKeys := append([]byte(nil), raw...)
+	noKeys[3] = 0
+
+	otherCipher := append([]byte(nil), raw...)
+	otherCipher[8] = 1
+
+	payloads := map[string][]byte{
+		"short header": raw[:kmHeaderSize-1],
+		"truncated":    raw[:len(raw)-1],
+		"no keys":      noKeys,
+		"not ctr":      otherCipher,
+	}
+
+	for name, b := range payloads {
+		if _, err := parseKeyMaterial(b, testPassphrase); !errors.Is(err, errKeyMaterial) {
+			t.Errorf("%v: got %v, want errKeyMaterial", name, err)
+		}
+	}
+
+	// only the odd key is announced
+	km, err := parseKeyMaterial(testKeyMaterial(t, salt, nil, key), testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := km.decrypt(&packet{msg: 1 << 27}); !errors.Is(err, errKeyMaterial) {
+		t.Errorf("even key: got %v, want errKeyMaterial", err)
+	}
+}
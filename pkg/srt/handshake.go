@@ -0,0 +1,155 @@
+package srt
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	hsSize = 48
+	// extension field of the listener's induction response
+	hsMagic = 0x4A17
+
+	hsInduction  uint32 = 0x00000001
+	hsConclusion uint32 = 0xFFFFFFFF
+
+	// handshake extension flags
+	hsFlagHSREQ  = 0x1
+	hsFlagKMREQ  = 0x2
+	hsFlagConfig = 0x4
+
+	// handshake extension types
+	extHSREQ = 1
+	extHSRSP = 2
+	extKMREQ = 3
+	extKMRSP = 4
+	extSID   = 5
+
+	// srt flags of HSREQ / HSRSP
+	flagTSBPDSND    = 0x01
+	flagTSBPDRCV    = 0x02
+	flagCrypt       = 0x04
+	flagTLPktDrop   = 0x08
+	flagPeriodicNAK = 0x10
+	flagRexmit      = 0x20
+
+	// announced srt version (1.5.0)
+	srtVersion = 0x00010500
+)
+
+// rejection reasons, sent back instead of the handshake type
+const (
+	rejectBase = 1000
+
+	rejectRogue     = rejectBase + 4
+	rejectVersion   = rejectBase + 8
+	rejectBadSecret = rejectBase + 10
+	rejectUnsecure  = rejectBase + 11
+	// access control: forbidden
+	rejectForbidden = rejectBase + 1403
+)
+
+var errHandshake = errors.New("srt: malformed handshake")
+
+type handshake struct {
+	version    uint32
+	encryption uint16
+	extension  uint16
+	isn        uint32
+	mtu        uint32
+	flowWindow uint32
+	reqType    uint32
+	socketID   uint32
+	cookie     uint32
+	peerIP     [16]byte
+
+	exts []hsExtension
+}
+
+type hsExtension struct {
+	typ  uint16
+	data []byte
+}
+
+func parseHandshake(b []byte) (*handshake, error) {
+	if len(b) < hsSize {
+		return nil, errHandshake
+	}
+
+	hs := &handshake{
+		version:    binary.BigEndian.Uint32(b[0:]),
+		encryption: binary.BigEndian.Uint16(b[4:]),
+		extension:  binary.BigEndian.Uint16(b[6:]),
+		isn:        binary.BigEndian.Uint32(b[8:]),
+		mtu:        binary.BigEndian.Uint32(b[12:]),
+		flowWindow: binary.BigEndian.Uint32(b[16:]),
+		reqType:    binary.BigEndian.Uint32(b[20:]),
+		socketID:   binary.BigEndian.Uint32(b[24:]),
+		cookie:     binary.BigEndian.Uint32(b[28:]),
+	}
+	copy(hs.peerIP[:], b[32:48])
+
+	// extension length is given in 4 byte words
+	rest := b[hsSize:]
+	for len(rest) >= 4 {
+		typ := binary.BigEndian.Uint16(rest)
+		size := 4 * int(binary.BigEndian.Uint16(rest[2:]))
+		if len(rest) < 4+size {
+			return nil, errHandshake
+		}
+
+		hs.exts = append(hs.exts, hsExtension{typ: typ, data: rest[4 : 4+size]})
+		rest = rest[4+size:]
+	}
+
+	return hs, nil
+}
+
+func (hs *handshake) marshal() []byte {
+	b := make([]byte, hsSize)
+
+	binary.BigEndian.PutUint32(b[0:], hs.version)
+	binary.BigEndian.PutUint16(b[4:], hs.encryption)
+	binary.BigEndian.PutUint16(b[6:], hs.extension)
+	binary.BigEndian.PutUint32(b[8:], hs.isn)
+	binary.BigEndian.PutUint32(b[12:], hs.mtu)
+	binary.BigEndian.PutUint32(b[16:], hs.flowWindow)
+	binary.BigEndian.PutUint32(b[20:], hs.reqType)
+	binary.BigEndian.PutUint32(b[24:], hs.socketID)
+	binary.BigEndian.PutUint32(b[28:], hs.cookie)
+	copy(b[32:48], hs.peerIP[:])
+
+	for _, ext := range hs.exts {
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint16(header, ext.typ)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(ext.data)/4))
+		b = append(b, header...)
+		b = append(b, ext.data...)
+	}
+
+	return b
+}
+
+func (hs *handshake) ext(typ uint16) ([]byte, bool) {
+	for _, ext := range hs.exts {
+		if ext.typ == typ {
+			return ext.data, true
+		}
+	}
+	return nil, false
+}
+
+// stream id is sent in 4 byte words with reversed byte order
+func decodeStreamID(b []byte) string {
+	id := make([]byte, 0, len(b))
+	for i := 0; i+4 <= len(b); i += 4 {
+		id = append(id, b[i+3], b[i+2], b[i+1], b[i])
+	}
+
+	// zero padded
+	for len(id) > 0 && id[len(id)-1] == 0 {
+		id = id[:len(id)-1]
+	}
+
+	return string(id)
+}
@@ -0,0 +1,80 @@
+package srt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHandshakeRoundTrip(t *testing.T) {
+	want := &handshake{
+		version:    5,
+		encryption: 2,
+		extension:  hsFlagHSREQ | hsFlagKMREQ | hsFlagConfig,
+		isn:        0x1234567,
+		mtu:        1500,
+		flowWindow: 8192,
+		reqType:    hsConclusion,
+		socketID:   0xABCDEF,
+		cookie:     0x5555,
+		peerIP:     [16]byte{127, 0, 0, 1},
+		exts: []hsExtension{
+			{typ: extHSREQ, data: be32list(srtVersion, flagTSBPDSND|flagCrypt, 120<<16|120)},
+			{typ: extSID, data: []byte("evil")},
+		},
+	}
+
+	got, err := parseHandshake(want.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if data, ok := got.ext(extSID); !ok || string(data) != "evil" {
+		t.Errorf("got stream id extension %q", data)
+	}
+	if _, ok := got.ext(extKMREQ); ok {
+		t.Error("missing extension was found")
+	}
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	hs := &handshake{exts: []hsExtension{{typ: extSID, data: []byte("live")}}}
+	b := hs.marshal()
+
+	payloads := map[string][]byte{
+		"short":               b[:hsSize-1],
+		"truncated extension": b[:len(b)-1],
+	}
+
+	for name, payload := range payloads {
+		if _, err := parseHandshake(payload); !errors.Is(err, errHandshake) {
+			t.Errorf("%v: got %v, want errHandshake", name, err)
+		}
+	}
+
+	// trailing bytes, shorter than an extension header, are ignored
+	if _, err := parseHandshake(append(b, 0, 0)); err != nil {
+		t.Errorf("trailing bytes: %v", err)
+	}
+}
+
+func TestDecodeStreamID(t *testing.T) {
+	ids := map[string]struct {
+		data []byte
+		want string
+	}{
+		"whole words": {[]byte("evillive"), "liveevil"},
+		"padded":      {[]byte{'e', 'v', 'i', 'l', 0, 'e', 'v', 'i'}, "liveive"},
+		"empty":       {nil, ""},
+	}
+
+	for name, tc := range ids {
+		if got := decodeStreamID(tc.data); got != tc.want {
+			t.Errorf("%v: got %q, want %q", name, got, tc.want)
+		}
+	}
+}
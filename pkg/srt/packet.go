@@ -0,0 +1,111 @@
+package srt
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	headerSize = 16
+	// largest udp payload, the server expects
+	maxPacketSize = 1500
+
+	// sequence numbers are 31 bit long
+	seqMask = 0x7FFFFFFF
+)
+
+// control packet types
+const (
+	ctrlHandshake uint16 = 0x0
+	ctrlKeepalive uint16 = 0x1
+	ctrlACK       uint16 = 0x2
+	ctrlNAK       uint16 = 0x3
+	ctrlShutdown  uint16 = 0x5
+	ctrlACKACK    uint16 = 0x6
+	ctrlDropReq   uint16 = 0x7
+	// subtypes carry srt extensions (e.g. key material refresh)
+	ctrlUser uint16 = 0x7FFF
+)
+
+var errShortPacket = errors.New("srt: packet is too short")
+
+type packet struct {
+	control bool
+
+	// data packets
+	seq uint32
+	// packet position, order, encryption key, retransmission and message number
+	msg uint32
+
+	// control packets
+	ctrlType uint16
+	subtype  uint16
+	// type-specific information
+	info uint32
+
+	timestamp uint32
+	dest      uint32
+	payload   []byte
+}
+
+func parsePacket(b []byte) (*packet, error) {
+	if len(b) < headerSize {
+		return nil, errShortPacket
+	}
+
+	p := &packet{
+		timestamp: binary.BigEndian.Uint32(b[8:]),
+		dest:      binary.BigEndian.Uint32(b[12:]),
+		payload:   b[headerSize:],
+	}
+
+	word := binary.BigEndian.Uint32(b)
+	if word&0x80000000 != 0 {
+		p.control = true
+		p.ctrlType = uint16(word>>16) & 0x7FFF
+		p.subtype = uint16(word)
+		p.info = binary.BigEndian.Uint32(b[4:])
+	} else {
+		p.seq = word
+		p.msg = binary.BigEndian.Uint32(b[4:])
+	}
+
+	return p, nil
+}
+
+func (p *packet) marshal() []byte {
+	b := make([]byte, headerSize+len(p.payload))
+
+	if p.control {
+		binary.BigEndian.PutUint32(b, 0x80000000|uint32(p.ctrlType)<<16|uint32(p.subtype))
+		binary.BigEndian.PutUint32(b[4:], p.info)
+	} else {
+		binary.BigEndian.PutUint32(b, p.seq&seqMask)
+		binary.BigEndian.PutUint32(b[4:], p.msg)
+	}
+
+	binary.BigEndian.PutUint32(b[8:], p.timestamp)
+	binary.BigEndian.PutUint32(b[12:], p.dest)
+	copy(b[headerSize:], p.payload)
+
+	return b
+}
+
+// encryption key of the data packet: 0 - none, 1 - even, 2 - odd
+func (p *packet) keyFlags() uint32 { return (p.msg >> 27) & 0x3 }
+
+// set on retransmitted data packets
+func (p *packet) retransmitted() bool { return p.msg&(1<<26) != 0 }
+
+func seqAdd(seq uint32, n int) uint32 { return uint32(int64(seq)+int64(n)) & seqMask }
+
+// circular difference a - b
+func seqDiff(a, b uint32) int32 { return int32((a-b)<<1) >> 1 }
+
+func be32list(values ...uint32) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
@@ -0,0 +1,88 @@
+package srt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSeqDiff(t *testing.T) {
+	diffs := map[string]struct {
+		a, b uint32
+		want int32
+	}{
+		"equal":             {5, 5, 0},
+		"ahead":             {10, 5, 5},
+		"behind":            {5, 10, -5},
+		"ahead over wrap":   {2, seqMask - 1, 4},
+		"behind over wrap":  {seqMask - 1, 2, -4},
+		"last and first":    {0, seqMask, 1},
+		"half of the space": {1 << 29, 0, 1 << 29},
+	}
+
+	for name, tc := range diffs {
+		if got := seqDiff(tc.a, tc.b); got != tc.want {
+			t.Errorf("%v: seqDiff(%v, %v) = %v, want %v", name, tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestSeqAdd(t *testing.T) {
+	sums := map[string]struct {
+		seq  uint32
+		n    int
+		want uint32
+	}{
+		"forward":       {5, 3, 8},
+		"backward":      {5, -3, 2},
+		"over wrap":     {seqMask, 1, 0},
+		"back the wrap": {1, -2, seqMask},
+	}
+
+	for name, tc := range sums {
+		if got := seqAdd(tc.seq, tc.n); got != tc.want {
+			t.Errorf("%v: seqAdd(%v, %v) = %v, want %v", name, tc.seq, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	packets := map[string]*packet{
+		"data": {
+			seq:       seqMask,
+			msg:       0xC0000000 | 2<<27 | 1<<26 | 42,
+			timestamp: 1000,
+			dest:      7,
+			payload:   []byte("payload"),
+		},
+		"control": {
+			control:   true,
+			ctrlType:  ctrlUser,
+			subtype:   extKMREQ,
+			info:      3,
+			timestamp: 2000,
+			dest:      7,
+			payload:   []byte{1, 2, 3, 4},
+		},
+	}
+
+	for name, want := range packets {
+		got, err := parsePacket(want.marshal())
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %+v, want %+v", name, got, want)
+		}
+	}
+
+	p := packets["data"]
+	if p.keyFlags() != 2 || !p.retransmitted() {
+		t.Errorf("got key flags %v and retransmission %v", p.keyFlags(), p.retransmitted())
+	}
+
+	if _, err := parsePacket(make([]byte, headerSize-1)); !errors.Is(err, errShortPacket) {
+		t.Errorf("got %v, want errShortPacket", err)
+	}
+}
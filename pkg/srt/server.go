@@ -0,0 +1,327 @@
+// Package srt implements a minimal SRT listener.
+//
+// Callers (ffmpeg, OBS, hardware encoders) connect in live mode and push the
+// stream, which is handed to the Handler as is (usually mpeg-ts). The listener
+// supports HSv5 handshake, stream ids, AES-CTR encryption, retransmission
+// requests and too-late packet drop. Sending streams to the callers is not supported.
+package srt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLatency = 120 * time.Millisecond
+	// cookies are bound to the peer address and the current minute
+	cookieLifetime = time.Minute
+)
+
+// returned by Serve after Close
+var ErrServerClosed = errors.New("srt: server closed")
+
+// receives published streams
+type Handler interface {
+	// called when caller connects, returning an error rejects the caller
+	// returned writer receives the stream and is closed, once the caller leaves
+	Publish(conn *Conn) (io.WriteCloser, error)
+}
+
+type Server struct {
+	Addr string
+	// if set, callers must encrypt the stream with it (10 to 79 characters)
+	Passphrase string
+	// how long lost packets are awaited, before they are dropped
+	Latency time.Duration
+	Handler Handler
+
+	mu sync.Mutex
+	pc net.PacketConn
+	// connected callers by their socket id on this side
+	conns map[uint32]*Conn
+	// connected callers by their address and socket id
+	callers map[string]*Conn
+	secret  []byte
+	start   time.Time
+	closed  bool
+}
+
+func (s *Server) ListenAndServe() error {
+	pc, err := net.ListenPacket("udp", s.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(pc)
+}
+
+func (s *Server) Serve(pc net.PacketConn) error {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.pc = pc
+	s.conns = make(map[uint32]*Conn)
+	s.callers = make(map[string]*Conn)
+	s.secret = secret
+	s.start = time.Now()
+	s.mu.Unlock()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		p, err := parsePacket(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+
+		// connection requests aren't addressed to any socket yet
+		if p.control && p.ctrlType == ctrlHandshake && p.dest == 0 {
+			s.handshake(p, addr)
+			continue
+		}
+
+		s.mu.Lock()
+		c := s.conns[p.dest]
+		s.mu.Unlock()
+
+		if c != nil {
+			c.receive(p)
+		}
+	}
+}
+
+// stops accepting new callers and drops the connected ones
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for _, c := range s.conns {
+		c.Close()
+	}
+
+	if s.pc == nil {
+		return nil
+	}
+	return s.pc.Close()
+}
+
+func (s *Server) handshake(p *packet, addr net.Addr) {
+	hs, err := parseHandshake(p.payload)
+	if err != nil {
+		return
+	}
+
+	switch hs.reqType {
+	case hsInduction:
+		s.send(addr, hs.socketID, &handshake{
+			version:    5,
+			extension:  hsMagic,
+			isn:        hs.isn,
+			mtu:        hs.mtu,
+			flowWindow: hs.flowWindow,
+			reqType:    hsInduction,
+			cookie:     s.cookie(addr, time.Now()),
+		})
+	case hsConclusion:
+		s.conclude(hs, addr)
+	}
+}
+
+func (s *Server) conclude(hs *handshake, addr net.Addr) {
+	key := fmt.Sprintf("%v/%d", addr, hs.socketID)
+
+	// response to the previous conclusion was lost
+	s.mu.Lock()
+	c := s.callers[key]
+	s.mu.Unlock()
+
+	if c != nil {
+		c.write(c.hsResponse)
+		return
+	}
+
+	now := time.Now()
+	if hs.cookie != s.cookie(addr, now) && hs.cookie != s.cookie(addr, now.Add(-cookieLifetime)) {
+		return
+	}
+
+	if hs.version != 5 {
+		s.reject(addr, hs, rejectVersion)
+		return
+	}
+
+	c, reason := s.accept(hs, addr)
+	if c == nil {
+		s.reject(addr, hs, reason)
+		return
+	}
+
+	s.mu.Lock()
+	s.conns[c.id] = c
+	s.callers[key] = c
+	s.mu.Unlock()
+
+	go func() {
+		c.serve()
+
+		s.mu.Lock()
+		delete(s.conns, c.id)
+		delete(s.callers, key)
+		s.mu.Unlock()
+	}()
+
+	c.write(c.hsResponse)
+}
+
+// negotiates connection parameters and hands the connection to the handler
+// returns rejection reason, if the caller isn't accepted
+func (s *Server) accept(hs *handshake, addr net.Addr) (*Conn, uint32) {
+	hsreq, ok := hs.ext(extHSREQ)
+	if !ok || len(hsreq) < 12 {
+		return nil, rejectRogue
+	}
+
+	// receiver latency is the largest of the two sides
+	latency := s.Latency
+	if latency == 0 {
+		latency = defaultLatency
+	}
+	if delay := time.Duration(binary.BigEndian.Uint16(hsreq[10:])) * time.Millisecond; delay > latency {
+		latency = delay
+	}
+
+	kmreq, encrypted := hs.ext(extKMREQ)
+	if encrypted != (s.Passphrase != "") {
+		return nil, rejectUnsecure
+	}
+
+	var km *keyMaterial
+	if encrypted {
+		var err error
+		if km, err = parseKeyMaterial(kmreq, s.Passphrase); err != nil {
+			return nil, rejectBadSecret
+		}
+	}
+
+	var streamID string
+	if sid, ok := hs.ext(extSID); ok {
+		streamID = decodeStreamID(sid)
+	}
+
+	id, err := socketID()
+	if err != nil {
+		return nil, rejectRogue
+	}
+
+	c := newConn(s, addr, id, hs, streamID, latency, km)
+
+	w, err := s.Handler.Publish(c)
+	if err != nil {
+		log.Printf("srt caller %v (%v): %v", addr, streamID, err)
+		return nil, rejectForbidden
+	}
+	c.w = w
+
+	flags := uint32(flagTSBPDSND | flagTSBPDRCV | flagTLPktDrop | flagPeriodicNAK | flagRexmit)
+	extension := uint16(hsFlagHSREQ)
+	if encrypted {
+		flags |= flagCrypt
+		extension |= hsFlagKMREQ
+	}
+
+	ms := uint32(latency / time.Millisecond)
+	res := &handshake{
+		version:    5,
+		encryption: hs.encryption,
+		extension:  extension,
+		isn:        hs.isn,
+		mtu:        min(hs.mtu, maxPacketSize),
+		flowWindow: hs.flowWindow,
+		reqType:    hsConclusion,
+		socketID:   c.id,
+		cookie:     hs.cookie,
+		exts: []hsExtension{
+			{typ: extHSRSP, data: be32list(srtVersion, flags, ms<<16|ms)},
+		},
+	}
+
+	if encrypted {
+		res.exts = append(res.exts, hsExtension{typ: extKMRSP, data: km.raw})
+	}
+
+	c.hsResponse = (&packet{
+		control:   true,
+		ctrlType:  ctrlHandshake,
+		timestamp: s.timestamp(),
+		dest:      hs.socketID,
+		payload:   res.marshal(),
+	}).marshal()
+
+	return c, 0
+}
+
+func (s *Server) reject(addr net.Addr, hs *handshake, reason uint32) {
+	res := *hs
+	res.reqType = reason
+	res.exts = nil
+
+	s.send(addr, hs.socketID, &res)
+}
+
+func (s *Server) send(addr net.Addr, dest uint32, hs *handshake) {
+	p := &packet{
+		control:   true,
+		ctrlType:  ctrlHandshake,
+		timestamp: s.timestamp(),
+		dest:      dest,
+		payload:   hs.marshal(),
+	}
+
+	s.pc.WriteTo(p.marshal(), addr)
+}
+
+// proves that the caller owns its address, without keeping any state
+func (s *Server) cookie(addr net.Addr, at time.Time) uint32 {
+	h := sha256.New()
+	h.Write(s.secret)
+	fmt.Fprintf(h, "%v/%d", addr, at.Unix()/int64(cookieLifetime/time.Second))
+
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+func (s *Server) timestamp() uint32 {
+	return uint32(time.Since(s.start).Microseconds())
+}
+
+func socketID() (uint32, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return 0, err
+	}
+
+	// zero is reserved for connection requests
+	return binary.BigEndian.Uint32(b)&0x3FFFFFFF | 1, nil
+}
@@ -0,0 +1,14 @@
+#!/bin/bash
+
+# path to the chunk file (chunk file template)
+CHUNKPATH=$1
+# path to the segment list (csv), appended as segments are finished
+LISTPATH=$2
+# segmentation interval length
+SEGTIME=$3
+# container of the incoming stream (flv, mpegts)
+FORMAT=$4
+
+# stream is read from stdin
+exec ffmpeg -loglevel error -nostats -f $FORMAT -i pipe:0 -codec copy -f segment -segment_time $SEGTIME -segment_format mpegts \
+    -segment_list $LISTPATH -segment_list_type csv -segment_list_flags +live "$CHUNKPATH"
@@ -5,5 +5,5 @@ DIR=$1
 if [ -d $DIR ]; then 
     exit 0
 else 
-    mkdir $DIR
+    mkdir -p $DIR
 fi
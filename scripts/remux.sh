@@ -0,0 +1,8 @@
+#!/bin/bash
+
+# path to the concat list of the segments
+LISTPATH=$1
+# path to the resulting video file
+VIDPATH=$2
+
+ffmpeg -y -f concat -safe 0 -i $LISTPATH -codec copy -bsf:a aac_adtstoasc -movflags +faststart $VIDPATH
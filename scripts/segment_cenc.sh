@@ -0,0 +1,28 @@
+#!/bin/bash
+
+# path to the video file
+VIDPATH=$1
+# path to the segment list file (manifest path)
+MANPATH=$2
+# path to the chunk file (chunk file template)
+CHUNKPATH=$3
+# name of the fmp4 initialization segment
+INITNAME=$4
+# 16-byte content key (hex)
+KEY=$5
+# 16-byte key id (hex)
+KID=$6
+# segmentation interval length
+SEGTIME=${SEGMENT_TIME:=2}
+
+ffmpeg -i $VIDPATH -codec copy -f hls -hls_time $SEGTIME -hls_playlist_type vod \
+    -hls_segment_type fmp4 -hls_fmp4_init_filename $INITNAME -hls_segment_filename "$CHUNKPATH" \
+    -hls_segment_options "encryption_scheme=cenc-aes-ctr:encryption_key=$KEY:encryption_kid=$KID" \
+    $MANPATH
+
+# the init segment is written next to the playlist, but is served along with the chunks
+MANDIR=$(dirname $MANPATH)
+CHUNKDIR=$(dirname "$CHUNKPATH")
+if [ -f $MANDIR/$INITNAME ] && [ "$MANDIR" != "$CHUNKDIR" ]; then
+    mv $MANDIR/$INITNAME $CHUNKDIR/$INITNAME
+fi
@@ -0,0 +1,8 @@
+#!/bin/bash
+
+# path to the video file
+VIDPATH=$1
+# path to the resulting jpeg
+THUMBPATH=$2
+
+ffmpeg -y -i $VIDPATH -vf "thumbnail,scale=640:-2" -frames:v 1 $THUMBPATH